@@ -0,0 +1,172 @@
+package main
+
+//// Small CLI tool used to fill in the netlog visits host, registered domain and canonical url columns,
+//// for the visits stored before the columns were added, or after the url canonicalization changes.
+//// The visits already up to date are skipped, so it's safe to run it again, e.g. after being stopped.
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/2beens/serjtubincom/internal/db"
+	"github.com/2beens/serjtubincom/internal/netlog"
+)
+
+func init() {
+	log.SetOutput(os.Stdout)
+}
+
+type backfillParams struct {
+	host      string
+	port      string
+	dbName    string
+	batchSize int
+	dryRun    bool
+	verbose   bool
+}
+
+type summary struct {
+	checked int
+	updated int
+}
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	params, err := parseAndValidateInput()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	log.Printf("PostgreSQL Host: %s\n", params.host)
+	log.Printf("PostgreSQL Port: %s\n", params.port)
+	log.Printf("PostgreSQL DB Name: %s\n", params.dbName)
+	if params.dryRun {
+		log.Println("Dry run, nothing will be changed")
+	}
+
+	repo, err := getRepo(ctx, params.port, params.host, params.dbName)
+	if err != nil {
+		log.Fatalf("Failed to get repo: %v\n", err)
+	}
+
+	report, err := backfillVisits(ctx, repo, params)
+	printSummary(params, report)
+	if err != nil {
+		log.Fatalf("Backfill failed: %v\n", err)
+	}
+}
+
+func backfillVisits(ctx context.Context, repo *netlog.Repo, params backfillParams) (summary, error) {
+	var report summary
+	afterID := 0
+	for {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+
+		visits, err := repo.GetVisitsAfterID(ctx, afterID, params.batchSize)
+		if err != nil {
+			return report, fmt.Errorf("get visits after [%d]: %w", afterID, err)
+		}
+		if len(visits) == 0 {
+			return report, nil
+		}
+		afterID = visits[len(visits)-1].Id
+		report.checked += len(visits)
+
+		var toUpdate []*netlog.Visit
+		for _, v := range visits {
+			stored := *v
+			v.DeriveURLFields()
+			if v.Host == stored.Host && v.RegisteredDomain == stored.RegisteredDomain && v.CanonicalURL == stored.CanonicalURL {
+				continue
+			}
+			toUpdate = append(toUpdate, v)
+			if params.verbose {
+				log.Printf("*** [%d] %s -> %s [%s]\n", v.Id, v.URL, v.CanonicalURL, v.RegisteredDomain)
+			}
+		}
+
+		if !params.dryRun {
+			if err := repo.UpdateVisitsURL(ctx, toUpdate); err != nil {
+				return report, fmt.Errorf("update visits: %w", err)
+			}
+		}
+		report.updated += len(toUpdate)
+
+		log.Printf("Checked visits up to [%d], %d to update so far\n", afterID, report.updated)
+	}
+}
+
+func printSummary(params backfillParams, report summary) {
+	updatedLabel := "Updated"
+	if params.dryRun {
+		updatedLabel = "Would update"
+	}
+
+	log.Println("----------------------------------------------------")
+	log.Printf("Checked visits:               %d\n", report.checked)
+	log.Printf("%-30s%d\n", updatedLabel+":", report.updated)
+	log.Println("----------------------------------------------------")
+}
+
+func getRepo(ctx context.Context, port string, host string, dbName string) (*netlog.Repo, error) {
+	dbPool, err := db.NewDBPool(ctx, db.NewDBPoolParams{
+		DBHost:         host,
+		DBPort:         port,
+		DBName:         dbName,
+		TracingEnabled: false,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("new db pool: %w", err)
+	}
+
+	if err := dbPool.Ping(ctx); err != nil {
+		return nil, fmt.Errorf("ping db: %w", err)
+	}
+
+	return netlog.NewRepo(dbPool), nil
+}
+
+func parseAndValidateInput() (backfillParams, error) {
+	host := flag.String("host", "", "PostgreSQL host (e.g., localhost or IP address)")
+	port := flag.String("port", "", "PostgreSQL port (e.g., 5432)")
+	dbName := flag.String("dbname", "", "PostgreSQL database name")
+	batchSize := flag.Int("batch", 1000, "Number of visits checked and updated at once")
+	dryRun := flag.Bool("dry-run", false, "Only report how many visits would be updated")
+	verbose := flag.Bool("verbose", false, "Verbose output")
+
+	flag.Parse()
+
+	if *host == "" {
+		return backfillParams{}, errors.New("PostgreSQL host is required (use -host)")
+	}
+	if *port == "" {
+		return backfillParams{}, errors.New("PostgreSQL port is required (use -port)")
+	}
+	if *dbName == "" {
+		return backfillParams{}, errors.New("PostgreSQL database name is required (use -dbname)")
+	}
+	if *batchSize < 1 {
+		return backfillParams{}, errors.New("batch size has to be positive (use -batch)")
+	}
+
+	return backfillParams{
+		host:      *host,
+		port:      *port,
+		dbName:    *dbName,
+		batchSize: *batchSize,
+		dryRun:    *dryRun,
+		verbose:   *verbose,
+	}, nil
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
@@ -17,7 +18,7 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-// netlog google drive backup cmd
+// netlog backup cmd, backs up to google drive (default), local dir or s3 compatible storage
 
 func main() {
 	credentialsFile := flag.String(
@@ -33,15 +34,28 @@ func main() {
 	logToStdout := flag.Bool("o", true, "additionally, write logs to stdout")
 	logsPath := flag.String("logs-path", "/var/log/serj-tubin-backend/netlog-backup.log", "server logs file path (empty for stdout)")
 	reinit := flag.Bool("reinit", false, "reinitialize all again")
-	destroy := flag.Bool("destroy", false, "destroy all files (warning!!) (try running more times, if more than 100 files are present)")
+	destroy := flag.Bool("destroy", false, "destroy all files (warning!!)")
 	env := flag.String("env", "development", "environment [prod | production | dev | development | ddev | dockerdev]")
 	configPath := flag.String("config", "./config.toml", "path for the TOML config file")
+	target := flag.String("target", "", "backup target [gdrive | local | s3] (overrides the config)")
+	localDir := flag.String("local-dir", "", "backups dir for the local target (overrides the config)")
+	compression := flag.String("compression", "", "backup chunks compression [gzip | zstd] (overrides the config)")
+	workers := flag.Int("workers", 0, "number of backup chunks uploaded in parallel (overrides the config)")
+	keyFile := flag.String("key-file", "", "AES-256 key file to encrypt and decrypt the backup chunks with (overrides the config)")
+	restore := flag.Bool("restore", false, "restore the visits from the backup, after validating it against the manifest")
+	prunePreview := flag.Bool("prune-preview", false, "show what the retention policy would prune, without deleting anything")
+	verify := flag.Bool("verify", false, "compare the backup with the visits in the database, without changing anything")
+	schema := flag.String("schema", netlog.DefaultVisitsSchema, "postgres schema of the visit table to restore into or verify against")
+	dbName := flag.String("dbname", "", "postgres database name (overrides the config), e.g. an empty database to restore into")
 	flag.Parse()
 
 	cfg, err := config.Load(*env, *configPath)
 	if err != nil {
 		panic(err)
 	}
+	if *dbName != "" {
+		cfg.PostgresDBName = *dbName
+	}
 
 	sentryDSN := os.Getenv("SENTRY_DSN")
 	logging.Setup(logging.LoggerSetupParams{
@@ -55,22 +69,44 @@ func main() {
 		SentryServerName: "netlog-gd-backup",
 	})
 
-	log.Println("staring netlog backup ...")
-
-	if *credentialsFile == "" {
-		log.Fatalln("google drive credentials json not specified")
+	if *target != "" {
+		cfg.NetlogBackupTarget = *target
 	}
-	if *tokenFile == "" {
-		log.Fatalln("google drive token file json not specified")
+	if cfg.NetlogBackupTarget == "" {
+		cfg.NetlogBackupTarget = netlog.BackupTargetGoogleDrive
 	}
-	if *reinit {
-		log.Println("!! attention: will reinitialize all again...")
+	if *localDir != "" {
+		cfg.NetlogBackupLocalDir = *localDir
+	}
+	if *compression != "" {
+		cfg.NetlogBackupCompression = *compression
+	}
+	if *keyFile != "" {
+		cfg.NetlogBackupKeyFile = *keyFile
+	}
+	if *workers > 0 {
+		cfg.NetlogBackupUploadWorkers = *workers
 	}
 
-	// lazar.dusan.veliki@gmail.com // stara sifra
-	credentialsFileBytes, err := os.ReadFile(*credentialsFile)
-	if err != nil {
-		log.Fatalf("unable to read client secret file: %v", err)
+	log.Printf("staring netlog backup to %s ...", cfg.NetlogBackupTarget)
+
+	var credentialsFileBytes []byte
+	if cfg.NetlogBackupTarget == netlog.BackupTargetGoogleDrive {
+		if *credentialsFile == "" {
+			log.Fatalln("google drive credentials json not specified")
+		}
+		if *tokenFile == "" {
+			log.Fatalln("google drive token file json not specified")
+		}
+
+		// lazar.dusan.veliki@gmail.com // stara sifra
+		credentialsFileBytes, err = os.ReadFile(*credentialsFile)
+		if err != nil {
+			log.Fatalf("unable to read client secret file: %v", err)
+		}
+	}
+	if *reinit {
+		log.Println("!! attention: will reinitialize all again...")
 	}
 
 	chOsInterrupt := make(chan os.Signal, 1)
@@ -83,7 +119,7 @@ func main() {
 		cancel()
 	}()
 
-	if *destroy {
+	if *destroy && cfg.NetlogBackupTarget == netlog.BackupTargetGoogleDrive {
 		if err := netlog.DestroyAllFiles(ctx, credentialsFileBytes); err != nil {
 			log.Fatalf("destroy failed: %s", err)
 		}
@@ -91,6 +127,32 @@ func main() {
 		return
 	}
 
+	backupTarget, err := newBackupTarget(ctx, cfg, credentialsFileBytes)
+	if err != nil {
+		log.Fatalf("failed to create backup target: %s", err)
+	}
+
+	var backupKey []byte
+	if cfg.NetlogBackupKeyFile != "" {
+		backupKey, err = netlog.LoadBackupKey(cfg.NetlogBackupKeyFile)
+		if err != nil {
+			log.Fatalf("failed to load backup key: %s", err)
+		}
+	}
+	backupCodec, err := netlog.NewBackupCodec(cfg.NetlogBackupCompression, backupKey)
+	if err != nil {
+		log.Fatalf("failed to create backup codec: %s", err)
+	}
+	log.Printf("backup chunks format: %+v", backupCodec.Format())
+
+	if *destroy {
+		if err := netlog.DeleteAllBackupFiles(ctx, backupTarget); err != nil {
+			log.Fatalf("destroy failed: %s", err)
+		}
+		log.Println("destroy done!")
+		return
+	}
+
 	// TODO: enable tracing here
 
 	honeycombEnabled := os.Getenv("HONEYCOMB_ENABLED") == "true"
@@ -114,15 +176,51 @@ func main() {
 	}
 	defer dbPool.Close()
 
-	s, err := netlog.NewGoogleDriveBackupService(
-		ctx,
-		credentialsFileBytes,
-		dbPool,
-		cfg.NetlogUnixSocketAddrDir,
-		cfg.NetlogUnixSocketFileName,
-	)
-	if err != nil {
-		log.Fatalf("failed to create google drive backup service: %s", err)
+	s := netlog.NewBackupService(netlog.BackupServiceParams{
+		Repo:          netlog.NewRepo(dbPool),
+		Target:        backupTarget,
+		Codec:         backupCodec,
+		UploadWorkers: cfg.NetlogBackupUploadWorkers,
+		Retention: netlog.BackupRetentionPolicy{
+			KeepLast:    cfg.NetlogBackupKeepLast,
+			KeepDaily:   cfg.NetlogBackupKeepDaily,
+			KeepWeekly:  cfg.NetlogBackupKeepWeekly,
+			KeepMonthly: cfg.NetlogBackupKeepMonthly,
+			FullEvery:   time.Duration(cfg.NetlogBackupFullEveryDays) * 24 * time.Hour,
+		},
+		NetlogUnixSocketAddrDir:  cfg.NetlogUnixSocketAddrDir,
+		NetlogUnixSocketFileName: cfg.NetlogUnixSocketFileName,
+	})
+
+	if *prunePreview {
+		report, err := s.Prune(ctx, true)
+		if err != nil {
+			log.Fatalf("prune preview failed: %s", err)
+		}
+		logPruneReport(report)
+		return
+	}
+
+	if *restore {
+		result, err := s.Restore(ctx, *schema)
+		if err != nil {
+			log.Fatalf("restore failed: %s", err)
+		}
+		log.Printf("restore done, inserted: %d, updated: %d", result.Inserted, result.Updated)
+		return
+	}
+
+	if *verify {
+		report, err := s.Verify(ctx, *schema)
+		if err != nil {
+			log.Fatalf("verify failed: %s", err)
+		}
+		logVerifyReport(report)
+		if !report.OK() {
+			log.Fatalln("verify failed, the backup and the database differ")
+		}
+		log.Println("verify done, the backup matches the database")
+		return
 	}
 
 	baseTime := time.Now()
@@ -139,3 +237,53 @@ func main() {
 		log.Fatalf("%+v", err)
 	}
 }
+
+func newBackupTarget(ctx context.Context, cfg *config.Config, gdCredentialsJson []byte) (netlog.BackupTarget, error) {
+	switch cfg.NetlogBackupTarget {
+	case netlog.BackupTargetGoogleDrive:
+		return netlog.NewGoogleDriveBackupTarget(ctx, netlog.GoogleDriveBackupTargetParams{
+			CredentialsJson: gdCredentialsJson,
+			FolderName:      cfg.NetlogBackupGDFolder,
+			ShareWithEmail:  cfg.NetlogBackupGDShareWith,
+		})
+	case netlog.BackupTargetLocal:
+		return netlog.NewLocalBackupTarget(cfg.NetlogBackupLocalDir)
+	case netlog.BackupTargetS3:
+		return netlog.NewS3BackupTarget(ctx, netlog.S3BackupTargetParams{
+			Endpoint:  cfg.NetlogBackupS3Endpoint,
+			Bucket:    cfg.NetlogBackupS3Bucket,
+			Prefix:    cfg.NetlogBackupS3Prefix,
+			AccessKey: cfg.NetlogBackupS3AccessKey,
+			SecretKey: cfg.NetlogBackupS3SecretKey,
+			UseSSL:    cfg.NetlogBackupS3UseSSL,
+		})
+	default:
+		return nil, fmt.Errorf("unknown backup target: %s", cfg.NetlogBackupTarget)
+	}
+}
+
+func logVerifyReport(report *netlog.BackupVerifyReport) {
+	log.Println("----------------------------------------------------")
+	log.Printf("visits in the backup:           %d", report.BackupVisits)
+	log.Printf("visits in the database:         %d", report.TableVisits)
+	log.Printf("missing in the database:        %d %v", len(report.MissingInTable), report.MissingInTable)
+	log.Printf("different in the database:      %d %v", len(report.Different), report.Different)
+	log.Printf("not in the backup:              %d %v", len(report.NotInBackup), report.NotInBackup)
+	log.Printf("added after the last backup:    %d", report.NewerThanBackup)
+	log.Println("----------------------------------------------------")
+}
+
+func logPruneReport(report *netlog.BackupPruneReport) {
+	log.Println("----------------------------------------------------")
+	log.Printf("runs kept:        %d", len(report.KeptRuns))
+	for _, run := range report.KeptRuns {
+		log.Printf("  + %s full: %t, chunks: %d", run.StartedAt.Format(time.RFC3339), run.Full, len(run.Chunks))
+	}
+	log.Printf("runs pruned:      %d", len(report.PrunedRuns))
+	for _, run := range report.PrunedRuns {
+		log.Printf("  - %s full: %t, chunks: %d", run.StartedAt.Format(time.RFC3339), run.Full, len(run.Chunks))
+	}
+	log.Printf("chunks pruned:    %d %v", len(report.PrunedChunks), report.PrunedChunks)
+	log.Printf("orphan files:     %d %v", len(report.OrphanFiles), report.OrphanFiles)
+	log.Println("----------------------------------------------------")
+}
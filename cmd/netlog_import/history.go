@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const (
+	formatFirefox = "firefox"
+	formatChrome  = "chrome"
+	formatTakeout = "takeout"
+)
+
+// chromeEpoch is the start of the Chrome (WebKit) timestamps, which are microseconds since 1601-01-01 UTC
+var chromeEpoch = time.Date(1601, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// historyEntry is a single visit read from a browser history file
+type historyEntry struct {
+	URL       string
+	Title     string
+	Timestamp time.Time
+}
+
+// detectFormat guesses the history file format from its name, as browsers always use the same ones
+func detectFormat(path string) string {
+	name := strings.ToLower(filepath.Base(path))
+	switch {
+	case strings.HasPrefix(name, "places") && strings.HasSuffix(name, ".sqlite"):
+		return formatFirefox
+	case strings.HasPrefix(name, "history"):
+		return formatChrome
+	case strings.HasSuffix(name, ".json"):
+		return formatTakeout
+	}
+	return ""
+}
+
+func readHistory(ctx context.Context, format, path string) ([]historyEntry, error) {
+	switch format {
+	case formatFirefox:
+		// visit_date is in microseconds since the unix epoch
+		return readSQLiteHistory(ctx, path, `
+			SELECT p.url, COALESCE(p.title, ''), v.visit_date
+			FROM moz_historyvisits v
+			JOIN moz_places p ON p.id = v.place_id
+			ORDER BY v.visit_date;
+		`, time.UnixMicro)
+	case formatChrome:
+		return readSQLiteHistory(ctx, path, `
+			SELECT u.url, COALESCE(u.title, ''), v.visit_time
+			FROM visits v
+			JOIN urls u ON u.id = v.url
+			ORDER BY v.visit_time;
+		`, chromeTime)
+	case formatTakeout:
+		return readTakeoutHistory(path)
+	}
+	return nil, fmt.Errorf("unknown history format: %q", format)
+}
+
+func chromeTime(micros int64) time.Time {
+	return chromeEpoch.Add(time.Duration(micros) * time.Microsecond)
+}
+
+// readSQLiteHistory reads the history file in read-only mode. Browsers keep the file locked while running,
+// so it's best to import from a copy of it.
+func readSQLiteHistory(ctx context.Context, path, query string, toTime func(int64) time.Time) ([]historyEntry, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	sqliteDB, err := sql.Open("sqlite", "file:"+absPath+"?mode=ro&immutable=1")
+	if err != nil {
+		return nil, fmt.Errorf("open history db: %w", err)
+	}
+	defer sqliteDB.Close()
+
+	rows, err := sqliteDB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("query history db: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []historyEntry
+	for rows.Next() {
+		var entry historyEntry
+		var timestamp int64
+		if err := rows.Scan(&entry.URL, &entry.Title, &timestamp); err != nil {
+			return nil, fmt.Errorf("scan history row: %w", err)
+		}
+		entry.Timestamp = toTime(timestamp)
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// takeoutHistory is the Google Takeout Chrome BrowserHistory.json file
+type takeoutHistory struct {
+	BrowserHistory []struct {
+		Title    string `json:"title"`
+		URL      string `json:"url"`
+		TimeUsec int64  `json:"time_usec"`
+	} `json:"Browser History"`
+}
+
+func readTakeoutHistory(path string) ([]historyEntry, error) {
+	jsonData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+
+	var history takeoutHistory
+	if err := json.Unmarshal(jsonData, &history); err != nil {
+		return nil, fmt.Errorf("parse json: %w", err)
+	}
+
+	entries := make([]historyEntry, 0, len(history.BrowserHistory))
+	for _, item := range history.BrowserHistory {
+		entries = append(entries, historyEntry{
+			URL:       item.URL,
+			Title:     item.Title,
+			Timestamp: time.UnixMicro(item.TimeUsec),
+		})
+	}
+
+	return entries, nil
+}
+
+// isImportableURL filters out the browser internal pages, e.g.: chrome://settings, about:blank, place:...
+func isImportableURL(rawURL string) bool {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return (parsedURL.Scheme == "http" || parsedURL.Scheme == "https") && parsedURL.Host != ""
+}
@@ -0,0 +1,401 @@
+package main
+
+//// Small CLI tool used to import the browser history from before the netlog browser extension existed.
+//// Supports Firefox places.sqlite, Chrome History and Google Takeout BrowserHistory.json files.
+//// The netlog redaction rules from the config are applied to the visits before they are imported.
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/2beens/serjtubincom/internal/config"
+	"github.com/2beens/serjtubincom/internal/db"
+	"github.com/2beens/serjtubincom/internal/netlog"
+)
+
+// duplicateTolerance is the max time difference for a visit of the same url to count as the same visit.
+// The visits sent by the extension have the timestamps truncated to seconds.
+const duplicateTolerance = 2 * time.Second
+
+func init() {
+	log.SetOutput(os.Stdout)
+}
+
+type importParams struct {
+	host       string
+	port       string
+	dbName     string
+	path       string
+	format     string
+	source     string
+	device     string
+	env        string
+	configPath string
+	from       time.Time
+	to         time.Time
+	batchSize  int
+	dryRun     bool
+	verbose    bool
+}
+
+type summary struct {
+	read           int
+	outsideRange   int
+	unsupportedURL int
+	redacted       int
+	dropped        int
+	alreadyInDB    int
+	alreadyAdded   int
+	added          int
+}
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	params, err := parseAndValidateInput()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	cfg, err := config.Load(params.env, params.configPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v\n", err)
+	}
+
+	redactor := netlog.NewRedactor()
+	if err := redactor.Update(netlog.RedactionRules{
+		DropHosts:         cfg.NetlogRedactDropHosts,
+		StripQueryParams:  cfg.NetlogRedactStripQueryParams,
+		HashPathHosts:     cfg.NetlogRedactHashPathHosts,
+		TruncatePathHosts: cfg.NetlogRedactTruncatePathHosts,
+	}); err != nil {
+		log.Fatalf("Invalid redaction rules: %v\n", err)
+	}
+
+	log.Printf("PostgreSQL Host: %s\n", params.host)
+	log.Printf("PostgreSQL Port: %s\n", params.port)
+	log.Printf("PostgreSQL DB Name: %s\n", params.dbName)
+	log.Printf("History file: %s [%s]\n", params.path, params.format)
+	log.Printf("Source: %s, Device: %s\n", params.source, params.device)
+	log.Printf("Redaction rules from: %s [%s]\n", params.configPath, params.env)
+	if params.dryRun {
+		log.Println("Dry run, nothing will be added")
+	}
+
+	repo, err := getRepo(ctx, params.port, params.host, params.dbName)
+	if err != nil {
+		log.Fatalf("Failed to get repo: %v\n", err)
+	}
+
+	entries, err := readHistory(ctx, params.format, params.path)
+	if err != nil {
+		log.Fatalf("Failed to read history: %v\n", err)
+	}
+	log.Printf("Read %d history entries\n", len(entries))
+
+	report, err := importHistory(ctx, repo, redactor, params, entries)
+	printSummary(params, report)
+	if err != nil {
+		log.Fatalf("Import failed: %v\n", err)
+	}
+}
+
+func importHistory(
+	ctx context.Context,
+	repo *netlog.Repo,
+	redactor *netlog.Redactor,
+	params importParams,
+	entries []historyEntry,
+) (summary, error) {
+	report := summary{read: len(entries)}
+
+	var toImport []netlog.BatchVisit
+	minTime, maxTime := time.Time{}, time.Time{}
+	for _, entry := range entries {
+		if (!params.from.IsZero() && entry.Timestamp.Before(params.from)) ||
+			(!params.to.IsZero() && !entry.Timestamp.Before(params.to)) {
+			report.outsideRange++
+			continue
+		}
+		if !isImportableURL(entry.URL) {
+			report.unsupportedURL++
+			continue
+		}
+
+		visit := &netlog.Visit{
+			Title:     entry.Title,
+			Source:    params.source,
+			Device:    params.device,
+			URL:       entry.URL,
+			Timestamp: entry.Timestamp,
+		}
+		if redactor.Redact(visit) {
+			report.dropped++
+			if params.verbose {
+				log.Printf("--- Dropping, redaction rules [%s] %s\n", entry.Timestamp, entry.URL)
+			}
+			continue
+		}
+		if visit.URL != entry.URL || visit.Title != entry.Title {
+			report.redacted++
+		}
+
+		if minTime.IsZero() || entry.Timestamp.Before(minTime) {
+			minTime = entry.Timestamp
+		}
+		if entry.Timestamp.After(maxTime) {
+			maxTime = entry.Timestamp
+		}
+		// the client id is of the history entry as it is, so it's the same when the redaction rules change
+		toImport = append(toImport, netlog.BatchVisit{
+			ClientID: importClientID(params.source, entry),
+			Visit:    visit,
+		})
+	}
+
+	if len(toImport) == 0 {
+		return report, nil
+	}
+
+	// the visits already in netlog, e.g. added by the extension, in the same time range
+	existingVisits, err := repo.GetVisitsInRange(ctx, netlog.StatsRange{
+		From: minTime.Add(-duplicateTolerance),
+		To:   maxTime.Add(duplicateTolerance + time.Microsecond),
+	})
+	if err != nil {
+		return report, fmt.Errorf("get existing visits: %w", err)
+	}
+	// compared by the canonical urls, e.g. the extension and the history file can differ in the tracking params
+	existing := map[string][]time.Time{}
+	for _, v := range existingVisits {
+		canonicalURL := netlog.CanonicalizeURL(v.URL)
+		existing[canonicalURL] = append(existing[canonicalURL], v.Timestamp)
+	}
+
+	var batch []netlog.BatchVisit
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		defer func() {
+			batch = batch[:0]
+		}()
+
+		if params.dryRun {
+			report.added += len(batch)
+			return nil
+		}
+
+		added, err := repo.AddVisitsBatch(ctx, batch)
+		if err != nil {
+			return err
+		}
+		for i, isAdded := range added {
+			if isAdded {
+				report.added++
+				if params.verbose {
+					log.Printf("+++ Added visit [%s] %s\n", batch[i].Visit.Timestamp, batch[i].Visit.URL)
+				}
+			} else {
+				report.alreadyAdded++
+			}
+		}
+		return nil
+	}
+
+	for _, batchVisit := range toImport {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+
+		// the visits in netlog are already redacted, as the imported ones are now
+		visit := batchVisit.Visit
+		if isDuplicate(existing[netlog.CanonicalizeURL(visit.URL)], visit.Timestamp) {
+			report.alreadyInDB++
+			if params.verbose {
+				log.Printf("--- Skipping, already in netlog [%s] %s\n", visit.Timestamp, visit.URL)
+			}
+			continue
+		}
+
+		batch = append(batch, batchVisit)
+		if len(batch) >= params.batchSize {
+			if err := flush(); err != nil {
+				return report, fmt.Errorf("add visits batch: %w", err)
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return report, fmt.Errorf("add visits batch: %w", err)
+	}
+
+	return report, nil
+}
+
+func isDuplicate(existingTimestamps []time.Time, timestamp time.Time) bool {
+	for _, existing := range existingTimestamps {
+		diff := existing.Sub(timestamp)
+		if diff >= -duplicateTolerance && diff <= duplicateTolerance {
+			return true
+		}
+	}
+	return false
+}
+
+// importClientID is a deterministic visit ID, so importing the same file again skips the visits
+// added by the previous import
+func importClientID(source string, entry historyEntry) string {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%d", source, entry.URL, entry.Timestamp.UnixMicro())))
+	return "import:" + hex.EncodeToString(hash[:16])
+}
+
+func printSummary(params importParams, report summary) {
+	addedLabel := "Added"
+	if params.dryRun {
+		addedLabel = "Would add"
+	}
+
+	log.Println("----------------------------------------------------")
+	log.Printf("Read from the history file:   %d\n", report.read)
+	log.Printf("Outside the time range:       %d\n", report.outsideRange)
+	log.Printf("Unsupported urls:             %d\n", report.unsupportedURL)
+	log.Printf("Dropped by the redaction:     %d\n", report.dropped)
+	log.Printf("Redacted:                     %d\n", report.redacted)
+	log.Printf("Already in netlog:            %d\n", report.alreadyInDB)
+	log.Printf("Already imported before:      %d\n", report.alreadyAdded)
+	log.Printf("%-30s%d\n", addedLabel+":", report.added)
+	log.Println("----------------------------------------------------")
+}
+
+func getRepo(ctx context.Context, port string, host string, dbName string) (*netlog.Repo, error) {
+	dbPool, err := db.NewDBPool(ctx, db.NewDBPoolParams{
+		DBHost:         host,
+		DBPort:         port,
+		DBName:         dbName,
+		TracingEnabled: false,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("new db pool: %w", err)
+	}
+
+	if err := dbPool.Ping(ctx); err != nil {
+		return nil, fmt.Errorf("ping db: %w", err)
+	}
+
+	return netlog.NewRepo(dbPool), nil
+}
+
+func parseTimeFlag(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid -%s time, use YYYY-MM-DD or RFC3339", name)
+	}
+	return t, nil
+}
+
+func parseAndValidateInput() (importParams, error) {
+	host := flag.String("host", "", "PostgreSQL host (e.g., localhost or IP address)")
+	port := flag.String("port", "", "PostgreSQL port (e.g., 5432)")
+	dbName := flag.String("dbname", "", "PostgreSQL database name")
+	path := flag.String("file", "", "Path to the history file: Firefox places.sqlite, Chrome History or Takeout BrowserHistory.json")
+	format := flag.String("format", "", "History file format: firefox, chrome or takeout (detected from the file name if not set)")
+	source := flag.String("source", "", "Visits source (defaults to the browser, i.e. firefox or chrome)")
+	device := flag.String("device", "", "Visits device, e.g. mb-serj")
+	env := flag.String("env", "production", "Config environment to take the redaction rules from")
+	configPath := flag.String("config", "./config.toml", "Path for the TOML config file")
+	from := flag.String("from", "", "Import only the visits from this time on (YYYY-MM-DD or RFC3339)")
+	to := flag.String("to", "", "Import only the visits before this time (YYYY-MM-DD or RFC3339)")
+	batchSize := flag.Int("batch", 500, "Number of visits added in a single transaction")
+	dryRun := flag.Bool("dry-run", false, "Only report what would be imported")
+	verbose := flag.Bool("verbose", false, "Verbose output")
+
+	flag.Parse()
+
+	if *host == "" {
+		return importParams{}, errors.New("PostgreSQL host is required (use -host)")
+	}
+	if *port == "" {
+		return importParams{}, errors.New("PostgreSQL port is required (use -port)")
+	}
+	if *dbName == "" {
+		return importParams{}, errors.New("PostgreSQL database name is required (use -dbname)")
+	}
+	if *path == "" {
+		return importParams{}, errors.New("path to the history file is required (use -file)")
+	}
+	if _, err := os.Stat(*path); os.IsNotExist(err) {
+		return importParams{}, fmt.Errorf("history file does not exist at path: %s", *path)
+	}
+	if *device == "" {
+		return importParams{}, errors.New("device is required, history files don't have it (use -device)")
+	}
+	if _, err := os.Stat(*configPath); os.IsNotExist(err) {
+		return importParams{}, fmt.Errorf("config file does not exist at path: %s", *configPath)
+	}
+	if *batchSize < 1 {
+		return importParams{}, errors.New("batch size has to be positive (use -batch)")
+	}
+
+	params := importParams{
+		host:       *host,
+		port:       *port,
+		dbName:     *dbName,
+		path:       *path,
+		format:     *format,
+		source:     *source,
+		device:     *device,
+		env:        *env,
+		configPath: *configPath,
+		batchSize:  *batchSize,
+		dryRun:     *dryRun,
+		verbose:    *verbose,
+	}
+
+	if params.format == "" {
+		params.format = detectFormat(params.path)
+	}
+	switch params.format {
+	case formatFirefox:
+		if params.source == "" {
+			params.source = "firefox"
+		}
+	case formatChrome, formatTakeout:
+		if params.source == "" {
+			params.source = "chrome"
+		}
+	default:
+		return importParams{}, errors.New("unknown history file format (use -format firefox|chrome|takeout)")
+	}
+
+	var err error
+	if params.from, err = parseTimeFlag("from", *from); err != nil {
+		return importParams{}, err
+	}
+	if params.to, err = parseTimeFlag("to", *to); err != nil {
+		return importParams{}, err
+	}
+	if !params.from.IsZero() && !params.to.IsZero() && !params.from.Before(params.to) {
+		return importParams{}, errors.New("-from has to be before -to")
+	}
+
+	return params, nil
+}
@@ -0,0 +1,215 @@
+package main
+
+//// Small CLI tool used to maintain the netlog visit monthly partitions: it creates the partitions ahead
+//// (as the service does), archives the partitions past the retention from the config into compressed
+//// files in the archive dir, e.g. from a monthly cron job, and restores an archived month on demand.
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/2beens/serjtubincom/internal/config"
+	"github.com/2beens/serjtubincom/internal/db"
+	"github.com/2beens/serjtubincom/internal/netlog"
+)
+
+func init() {
+	log.SetOutput(os.Stdout)
+}
+
+type partitionsParams struct {
+	host       string
+	port       string
+	dbName     string
+	env        string
+	configPath string
+	archive    bool
+	restore    time.Time
+	list       bool
+	dryRun     bool
+}
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	params, err := parseAndValidateInput()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	cfg, err := config.Load(params.env, params.configPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v\n", err)
+	}
+
+	log.Printf("PostgreSQL Host: %s\n", params.host)
+	log.Printf("PostgreSQL Port: %s\n", params.port)
+	log.Printf("PostgreSQL DB Name: %s\n", params.dbName)
+	log.Printf("Archive dir: %s\n", cfg.NetlogArchiveDir)
+	if params.dryRun {
+		log.Println("Dry run, nothing will be archived")
+	}
+
+	repo, err := getRepo(ctx, params.port, params.host, params.dbName)
+	if err != nil {
+		log.Fatalf("Failed to get repo: %v\n", err)
+	}
+
+	archiver, err := netlog.NewVisitsArchiver(repo, cfg.NetlogArchiveDir)
+	if err != nil {
+		log.Fatalf("Failed to create visits archiver: %v\n", err)
+	}
+
+	if !params.dryRun && cfg.NetlogPartitionsAheadMonths > 0 {
+		created, err := netlog.EnsureVisitPartitions(ctx, repo, time.Now(), cfg.NetlogPartitionsAheadMonths)
+		for _, month := range created {
+			log.Printf("+++ Created partition: %s\n", month.Format("2006-01"))
+		}
+		if err != nil {
+			log.Fatalf("Failed to create partitions: %v\n", err)
+		}
+	}
+
+	if params.archive {
+		if err := archivePartitions(ctx, archiver, cfg.NetlogArchiveAfterMonths, params.dryRun); err != nil {
+			log.Fatalf("Archive failed: %v\n", err)
+		}
+	}
+
+	if !params.restore.IsZero() {
+		result, err := archiver.Restore(ctx, params.restore)
+		if err != nil {
+			log.Fatalf("Restore failed: %v\n", err)
+		}
+		log.Printf("Restored %s, inserted visits: %d, updated visits: %d\n", params.restore.Format("2006-01"), result.Inserted, result.Updated)
+	}
+
+	if params.list {
+		if err := listPartitions(ctx, repo, archiver); err != nil {
+			log.Fatalf("List failed: %v\n", err)
+		}
+	}
+}
+
+func archivePartitions(ctx context.Context, archiver *netlog.VisitsArchiver, afterMonths int, dryRun bool) error {
+	if afterMonths <= 0 {
+		log.Println("Archiving disabled in the config (netlog_archive_after_months), nothing to archive")
+		return nil
+	}
+
+	archived, err := archiver.ArchiveOlderThan(ctx, time.Now(), afterMonths, dryRun)
+	for _, month := range archived {
+		if dryRun {
+			log.Printf("--- Would archive %s to %s\n", month.Month.Format("2006-01"), month.File)
+			continue
+		}
+		log.Printf("--- Archived %s to %s, visits: %d\n", month.Month.Format("2006-01"), month.File, month.Visits)
+	}
+	archivedLabel := "Archived partitions:"
+	if dryRun {
+		archivedLabel = "Would archive partitions:"
+	}
+	log.Printf("%s %d\n", archivedLabel, len(archived))
+	return err
+}
+
+func listPartitions(ctx context.Context, repo *netlog.Repo, archiver *netlog.VisitsArchiver) error {
+	partitions, err := repo.GetVisitPartitions(ctx)
+	if err != nil {
+		return err
+	}
+	archives, err := archiver.Archives()
+	if err != nil {
+		return err
+	}
+
+	log.Println("----------------------------------------------------")
+	log.Println("Partitions (estimated visits):")
+	for _, p := range partitions {
+		log.Printf("  %s  %d\n", p.Month.Format("2006-01"), p.Rows)
+	}
+	log.Println("Archives:")
+	for _, month := range archives {
+		log.Printf("  %s\n", month.Format("2006-01"))
+	}
+	log.Println("----------------------------------------------------")
+	return nil
+}
+
+func getRepo(ctx context.Context, port string, host string, dbName string) (*netlog.Repo, error) {
+	dbPool, err := db.NewDBPool(ctx, db.NewDBPoolParams{
+		DBHost:         host,
+		DBPort:         port,
+		DBName:         dbName,
+		TracingEnabled: false,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("new db pool: %w", err)
+	}
+
+	if err := dbPool.Ping(ctx); err != nil {
+		return nil, fmt.Errorf("ping db: %w", err)
+	}
+
+	return netlog.NewRepo(dbPool), nil
+}
+
+func parseAndValidateInput() (partitionsParams, error) {
+	host := flag.String("host", "", "PostgreSQL host (e.g., localhost or IP address)")
+	port := flag.String("port", "", "PostgreSQL port (e.g., 5432)")
+	dbName := flag.String("dbname", "", "PostgreSQL database name")
+	env := flag.String("env", "production", "Config environment to take the partitions and archive settings from")
+	configPath := flag.String("config", "./config.toml", "Path for the TOML config file")
+	archive := flag.Bool("archive", false, "Archive the partitions past the retention from the config")
+	restore := flag.String("restore", "", "Month to restore from its archive (e.g., 2023-04)")
+	list := flag.Bool("list", false, "List the partitions and the archived months")
+	dryRun := flag.Bool("dry-run", false, "Only report what would be archived")
+
+	flag.Parse()
+
+	if *host == "" {
+		return partitionsParams{}, errors.New("PostgreSQL host is required (use -host)")
+	}
+	if *port == "" {
+		return partitionsParams{}, errors.New("PostgreSQL port is required (use -port)")
+	}
+	if *dbName == "" {
+		return partitionsParams{}, errors.New("PostgreSQL database name is required (use -dbname)")
+	}
+	if _, err := os.Stat(*configPath); os.IsNotExist(err) {
+		return partitionsParams{}, fmt.Errorf("config file does not exist at path: %s", *configPath)
+	}
+
+	var restoreMonth time.Time
+	if *restore != "" {
+		var err error
+		if restoreMonth, err = time.Parse("2006-01", *restore); err != nil {
+			return partitionsParams{}, fmt.Errorf("invalid month to restore, expected YYYY-MM: %s", *restore)
+		}
+	}
+	if *archive && !restoreMonth.IsZero() {
+		return partitionsParams{}, errors.New("archive and restore can't be done at once")
+	}
+
+	return partitionsParams{
+		host:       *host,
+		port:       *port,
+		dbName:     *dbName,
+		env:        *env,
+		configPath: *configPath,
+		archive:    *archive,
+		restore:    restoreMonth,
+		list:       *list,
+		dryRun:     *dryRun,
+	}, nil
+}
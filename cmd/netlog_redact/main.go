@@ -0,0 +1,214 @@
+package main
+
+//// Small CLI tool used to apply the netlog redaction rules from the config to the already stored visits,
+//// e.g. after a new rule is added. The visits in the existing backups are not changed.
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/2beens/serjtubincom/internal/config"
+	"github.com/2beens/serjtubincom/internal/db"
+	"github.com/2beens/serjtubincom/internal/netlog"
+)
+
+func init() {
+	log.SetOutput(os.Stdout)
+}
+
+type redactParams struct {
+	host       string
+	port       string
+	dbName     string
+	env        string
+	configPath string
+	batchSize  int
+	dryRun     bool
+	verbose    bool
+}
+
+type summary struct {
+	checked  int
+	redacted int
+	dropped  int
+}
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	params, err := parseAndValidateInput()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	cfg, err := config.Load(params.env, params.configPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v\n", err)
+	}
+
+	redactor := netlog.NewRedactor()
+	if err := redactor.Update(netlog.RedactionRules{
+		DropHosts:         cfg.NetlogRedactDropHosts,
+		StripQueryParams:  cfg.NetlogRedactStripQueryParams,
+		HashPathHosts:     cfg.NetlogRedactHashPathHosts,
+		TruncatePathHosts: cfg.NetlogRedactTruncatePathHosts,
+	}); err != nil {
+		log.Fatalf("Invalid redaction rules: %v\n", err)
+	}
+
+	log.Printf("PostgreSQL Host: %s\n", params.host)
+	log.Printf("PostgreSQL Port: %s\n", params.port)
+	log.Printf("PostgreSQL DB Name: %s\n", params.dbName)
+	log.Printf("Redaction rules from: %s [%s]\n", params.configPath, params.env)
+	if params.dryRun {
+		log.Println("Dry run, nothing will be changed")
+	}
+
+	repo, err := getRepo(ctx, params.port, params.host, params.dbName)
+	if err != nil {
+		log.Fatalf("Failed to get repo: %v\n", err)
+	}
+
+	report, err := redactVisits(ctx, repo, redactor, params)
+	printSummary(params, report)
+	if err != nil {
+		log.Fatalf("Redaction failed: %v\n", err)
+	}
+}
+
+// redactVisits goes through all the visits by their IDs, so the changed ones don't have to be skipped
+func redactVisits(ctx context.Context, repo *netlog.Repo, redactor *netlog.Redactor, params redactParams) (summary, error) {
+	var report summary
+	afterID := 0
+	for {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+
+		visits, err := repo.GetVisitsAfterID(ctx, afterID, params.batchSize)
+		if err != nil {
+			return report, fmt.Errorf("get visits after [%d]: %w", afterID, err)
+		}
+		if len(visits) == 0 {
+			return report, nil
+		}
+		afterID = visits[len(visits)-1].Id
+		report.checked += len(visits)
+
+		var toUpdate []*netlog.Visit
+		var toDelete []int
+		for _, v := range visits {
+			original := *v
+			if redactor.Redact(v) {
+				toDelete = append(toDelete, v.Id)
+				if params.verbose {
+					log.Printf("--- Dropping [%d] %s\n", v.Id, original.URL)
+				}
+				continue
+			}
+			if v.URL != original.URL || v.Title != original.Title {
+				toUpdate = append(toUpdate, v)
+				if params.verbose {
+					log.Printf("*** Redacting [%d] %s -> %s\n", v.Id, original.URL, v.URL)
+				}
+			}
+		}
+
+		if params.dryRun {
+			report.dropped += len(toDelete)
+			report.redacted += len(toUpdate)
+			continue
+		}
+
+		deleted, err := repo.DeleteVisits(ctx, toDelete)
+		if err != nil {
+			return report, fmt.Errorf("delete visits: %w", err)
+		}
+		report.dropped += deleted
+
+		if err := repo.UpdateVisitsURL(ctx, toUpdate); err != nil {
+			return report, fmt.Errorf("update visits: %w", err)
+		}
+		report.redacted += len(toUpdate)
+	}
+}
+
+func printSummary(params redactParams, report summary) {
+	redactedLabel, droppedLabel := "Redacted", "Dropped"
+	if params.dryRun {
+		redactedLabel, droppedLabel = "Would redact", "Would drop"
+	}
+
+	log.Println("----------------------------------------------------")
+	log.Printf("Checked visits:               %d\n", report.checked)
+	log.Printf("%-30s%d\n", redactedLabel+":", report.redacted)
+	log.Printf("%-30s%d\n", droppedLabel+":", report.dropped)
+	log.Println("----------------------------------------------------")
+}
+
+func getRepo(ctx context.Context, port string, host string, dbName string) (*netlog.Repo, error) {
+	dbPool, err := db.NewDBPool(ctx, db.NewDBPoolParams{
+		DBHost:         host,
+		DBPort:         port,
+		DBName:         dbName,
+		TracingEnabled: false,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("new db pool: %w", err)
+	}
+
+	if err := dbPool.Ping(ctx); err != nil {
+		return nil, fmt.Errorf("ping db: %w", err)
+	}
+
+	return netlog.NewRepo(dbPool), nil
+}
+
+func parseAndValidateInput() (redactParams, error) {
+	host := flag.String("host", "", "PostgreSQL host (e.g., localhost or IP address)")
+	port := flag.String("port", "", "PostgreSQL port (e.g., 5432)")
+	dbName := flag.String("dbname", "", "PostgreSQL database name")
+	env := flag.String("env", "production", "Config environment to take the redaction rules from")
+	configPath := flag.String("config", "./config.toml", "Path for the TOML config file")
+	batchSize := flag.Int("batch", 1000, "Number of visits checked and changed at once")
+	dryRun := flag.Bool("dry-run", false, "Only report what would be changed")
+	verbose := flag.Bool("verbose", false, "Verbose output, the original urls included")
+
+	flag.Parse()
+
+	if *host == "" {
+		return redactParams{}, errors.New("PostgreSQL host is required (use -host)")
+	}
+	if *port == "" {
+		return redactParams{}, errors.New("PostgreSQL port is required (use -port)")
+	}
+	if *dbName == "" {
+		return redactParams{}, errors.New("PostgreSQL database name is required (use -dbname)")
+	}
+	if _, err := os.Stat(*configPath); os.IsNotExist(err) {
+		return redactParams{}, fmt.Errorf("config file does not exist at path: %s", *configPath)
+	}
+	if *batchSize < 1 {
+		return redactParams{}, errors.New("batch size has to be positive (use -batch)")
+	}
+
+	return redactParams{
+		host:       *host,
+		port:       *port,
+		dbName:     *dbName,
+		env:        *env,
+		configPath: *configPath,
+		batchSize:  *batchSize,
+		dryRun:     *dryRun,
+		verbose:    *verbose,
+	}, nil
+}
@@ -156,6 +156,27 @@ func main() {
 
 	server.Serve(ctx, cfg.Host, cfg.Port)
 
+	// SIGHUP reloads the config, but only the netlog redaction rules are applied without a restart
+	chSighup := make(chan os.Signal, 1)
+	signal.Notify(chSighup, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-chSighup:
+				newCfg, err := config.Load(*env, *configPath)
+				if err != nil {
+					log.Errorf("reload config: %s", err)
+					continue
+				}
+				if err := server.ReloadNetlogRedaction(newCfg); err != nil {
+					log.Errorf("reload netlog redaction rules: %s", err)
+				}
+			}
+		}
+	}()
+
 	receivedSig := <-chOsInterrupt
 	log.Warnf("signal [%s] received, killing everything ...", receivedSig)
 	cancel()
@@ -0,0 +1,341 @@
+package blog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// feedSize is the number of the latest published posts in the feeds
+	feedSize          = 20
+	feedSummaryLength = 300
+	feedTitle         = "Serj Tubin - Blog"
+	feedAuthor        = "Serj Tubin"
+)
+
+// FeedFormat is the blog syndication feed format, its value is the feed file extension
+type FeedFormat string
+
+const (
+	FeedRSS  FeedFormat = "rss"
+	FeedAtom FeedFormat = "atom"
+	// FeedJSON is JSON Feed 1.1, https://www.jsonfeed.org/version/1.1/
+	FeedJSON FeedFormat = "json"
+)
+
+func (f FeedFormat) ContentType() string {
+	switch f {
+	case FeedRSS:
+		return "application/rss+xml; charset=utf-8"
+	case FeedAtom:
+		return "application/atom+xml; charset=utf-8"
+	default:
+		return "application/feed+json; charset=utf-8"
+	}
+}
+
+// FeedLinks are the base urls of the links in the feeds
+type FeedLinks struct {
+	// SiteURL is the website, the blog posts are at SiteURL/blog/{id}
+	SiteURL string
+	// FeedsURL is where this service is reached from outside, for the feeds links to themselves
+	FeedsURL string
+}
+
+func (l FeedLinks) postURL(id int) string {
+	return fmt.Sprintf("%s/blog/%d", l.SiteURL, id)
+}
+
+// feed is the format independent blog feed, encoded to one of the FeedFormat
+type feed struct {
+	Title   string
+	SiteURL string
+	FeedURL string
+	Updated time.Time
+	Items   []feedItem
+}
+
+type feedItem struct {
+	URL       string
+	Title     string
+	Published time.Time
+	Summary   string
+	// ContentHTML is empty in the summary only feeds
+	ContentHTML string
+	Tags        []string
+}
+
+// newFeed makes the feed of the posts, the newest first, with their full rendered content or only
+// with their summaries
+func newFeed(posts []*Blog, title, feedURL string, links FeedLinks, summaryOnly bool, renderer *Renderer) *feed {
+	f := &feed{
+		Title:   title,
+		SiteURL: links.SiteURL,
+		FeedURL: feedURL,
+		Items:   make([]feedItem, 0, len(posts)),
+	}
+
+	for _, post := range posts {
+		item := feedItem{
+			URL:       links.postURL(post.ID),
+			Title:     post.Title,
+			Published: publishedAt(post),
+			Summary:   renderer.Summary(post.Content, feedSummaryLength),
+			Tags:      post.Tags,
+		}
+		if !summaryOnly {
+			item.ContentHTML = post.ContentHTML
+		}
+		if item.Published.After(f.Updated) {
+			f.Updated = item.Published
+		}
+		f.Items = append(f.Items, item)
+	}
+
+	slices.SortStableFunc(f.Items, func(a, b feedItem) int {
+		return b.Published.Compare(a.Published)
+	})
+	return f
+}
+
+// feedETag identifies the feed content by everything it's made of, so it's known before the feed is made
+func feedETag(format FeedFormat, feedURL string, summaryOnly bool, posts []*Blog) string {
+	hash := sha256.New()
+	_, _ = fmt.Fprintf(hash, "%s\n%s\n%t\n%d\n", format, feedURL, summaryOnly, RenderVersion)
+	for _, post := range posts {
+		_, _ = fmt.Fprintf(
+			hash, "%d %q %q %d %q\n",
+			post.ID, post.Title, post.Content, publishedAt(post).UnixNano(), post.Tags,
+		)
+	}
+	return `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+}
+
+// etagMatches reports whether the If-None-Match header has the etag, or any with "*"
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// publishedAt is when the post was published, the scheduled ones are published later than created
+func publishedAt(post *Blog) time.Time {
+	if post.PublishAt != nil && post.PublishAt.After(post.CreatedAt) {
+		return *post.PublishAt
+	}
+	return post.CreatedAt
+}
+
+func (f *feed) Encode(format FeedFormat) ([]byte, error) {
+	switch format {
+	case FeedRSS:
+		return f.rss()
+	case FeedAtom:
+		return f.atom()
+	case FeedJSON:
+		return f.json()
+	default:
+		return nil, fmt.Errorf("unknown feed format: %s", format)
+	}
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Self          atomLink  `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        string   `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Description string   `xml:"description"`
+	Categories  []string `xml:"category"`
+}
+
+func (f *feed) rss() ([]byte, error) {
+	channel := rssChannel{
+		Title:       f.Title,
+		Link:        f.SiteURL,
+		Description: f.Title,
+		Self:        atomLink{Href: f.FeedURL, Rel: "self", Type: "application/rss+xml"},
+	}
+	if !f.Updated.IsZero() {
+		channel.LastBuildDate = f.Updated.UTC().Format(time.RFC1123Z)
+	}
+	for _, item := range f.Items {
+		description := item.ContentHTML
+		if description == "" {
+			description = item.Summary
+		}
+		channel.Items = append(channel.Items, rssItem{
+			Title:       item.Title,
+			Link:        item.URL,
+			GUID:        item.URL,
+			PubDate:     item.Published.UTC().Format(time.RFC1123Z),
+			Description: description,
+			Categories:  item.Tags,
+		})
+	}
+
+	return marshalXML(rssFeed{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		Channel: channel,
+	})
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Link       atomLink       `xml:"link"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Summary    atomText       `xml:"summary"`
+	Content    *atomText      `xml:"content,omitempty"`
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+func (f *feed) atom() ([]byte, error) {
+	atom := atomFeed{
+		Title:   f.Title,
+		ID:      f.FeedURL,
+		Updated: f.Updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: f.FeedURL, Rel: "self", Type: "application/atom+xml"},
+			{Href: f.SiteURL, Rel: "alternate", Type: "text/html"},
+		},
+		Author: atomAuthor{Name: feedAuthor},
+	}
+	for _, item := range f.Items {
+		published := item.Published.UTC().Format(time.RFC3339)
+		entry := atomEntry{
+			Title:     item.Title,
+			ID:        item.URL,
+			Link:      atomLink{Href: item.URL, Rel: "alternate", Type: "text/html"},
+			Published: published,
+			Updated:   published,
+			Summary:   atomText{Type: "text", Body: item.Summary},
+		}
+		if item.ContentHTML != "" {
+			entry.Content = &atomText{Type: "html", Body: item.ContentHTML}
+		}
+		for _, tag := range item.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+		atom.Entries = append(atom.Entries, entry)
+	}
+
+	return marshalXML(atom)
+}
+
+func marshalXML(v any) ([]byte, error) {
+	body, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url"`
+	FeedURL     string           `json:"feed_url"`
+	Authors     []jsonFeedAuthor `json:"authors"`
+	Items       []jsonFeedItem   `json:"items"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedItem struct {
+	ID            string   `json:"id"`
+	URL           string   `json:"url"`
+	Title         string   `json:"title"`
+	ContentHTML   string   `json:"content_html,omitempty"`
+	ContentText   string   `json:"content_text,omitempty"`
+	Summary       string   `json:"summary"`
+	DatePublished string   `json:"date_published"`
+	Tags          []string `json:"tags,omitempty"`
+}
+
+func (f *feed) json() ([]byte, error) {
+	jf := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       f.Title,
+		HomePageURL: f.SiteURL,
+		FeedURL:     f.FeedURL,
+		Authors:     []jsonFeedAuthor{{Name: feedAuthor}},
+		Items:       make([]jsonFeedItem, 0, len(f.Items)),
+	}
+	for _, item := range f.Items {
+		jsonItem := jsonFeedItem{
+			ID:            item.URL,
+			URL:           item.URL,
+			Title:         item.Title,
+			ContentHTML:   item.ContentHTML,
+			Summary:       item.Summary,
+			DatePublished: item.Published.UTC().Format(time.RFC3339),
+			Tags:          item.Tags,
+		}
+		// an item has either the html or the text content
+		if jsonItem.ContentHTML == "" {
+			jsonItem.ContentText = item.Summary
+		}
+		jf.Items = append(jf.Items, jsonItem)
+	}
+
+	return json.MarshalIndent(jf, "", "  ")
+}
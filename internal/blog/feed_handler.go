@@ -0,0 +1,70 @@
+package blog
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/2beens/serjtubincom/pkg"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// handleFeed returns the feed of the latest published blog posts in the format, optionally only
+// the posts with ?tag=, and only their summaries with ?content=summary.
+// The feeds support the conditional GET by their ETag only, there is no Last-Modified, since the
+// posts edits, unpublishing and deleting change the feed too, and no post time tells about them all.
+func (handler *Handler) handleFeed(format FeedFormat) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tag := strings.ToLower(r.URL.Query().Get("tag"))
+		summaryOnly := false
+		switch content := r.URL.Query().Get("content"); content {
+		case "", "full":
+		case "summary":
+			summaryOnly = true
+		default:
+			http.Error(w, "invalid content, full or summary expected", http.StatusBadRequest)
+			return
+		}
+
+		posts, err := handler.repo.GetFeedBlogs(r.Context(), feedSize, tag)
+		if err != nil {
+			log.Errorf("get blog %s feed posts: %s", format, err)
+			http.Error(w, "failed to get blog feed", http.StatusInternalServerError)
+			return
+		}
+
+		title := feedTitle
+		query := url.Values{}
+		if tag != "" {
+			title = fmt.Sprintf("%s: %s", feedTitle, tag)
+			query.Set("tag", tag)
+		}
+		if summaryOnly {
+			query.Set("content", "summary")
+		}
+		feedURL := fmt.Sprintf("%s/blog/feed.%s", handler.feedLinks.FeedsURL, format)
+		if len(query) > 0 {
+			feedURL += "?" + query.Encode()
+		}
+
+		// the feed is made only if the client doesn't have it already
+		etag := feedETag(format, feedURL, summaryOnly, posts)
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		body, err := newFeed(posts, title, feedURL, handler.feedLinks, summaryOnly, handler.renderer).Encode(format)
+		if err != nil {
+			log.Errorf("encode blog %s feed: %s", format, err)
+			http.Error(w, "failed to get blog feed", http.StatusInternalServerError)
+			return
+		}
+
+		pkg.WriteResponseBytesOK(w, format.ContentType(), body)
+	}
+}
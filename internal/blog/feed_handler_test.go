@@ -0,0 +1,100 @@
+package blog
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-redis/redismock/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlogHandler_feeds(t *testing.T) {
+	redisClient, _ := redismock.NewClientMock()
+	repoMock, loginChecker := getRepoMockAndLoginChecker(t, redisClient)
+	r := setupBlogRouterForTests(t, repoMock, loginChecker)
+
+	repoMock.Posts[2].Status = StatusDraft
+	repoMock.Posts[3].Tags = []string{"go"}
+
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", path, nil)
+		require.NoError(t, err)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("/blog/feed.json", nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, "application/feed+json; charset=utf-8", rr.Header().Get("Content-Type"))
+	var jf jsonFeed
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &jf))
+	assert.Equal(t, "https://h.serj-tubin.com/api/blog/feed.json", jf.FeedURL)
+	// the draft is not there, the newest first
+	require.Len(t, jf.Items, 4)
+	assert.Equal(t, "https://www.serj-tubin.com/blog/4", jf.Items[0].URL)
+	assert.Equal(t, "<p>blog 4 content</p>\n", jf.Items[0].ContentHTML)
+	assert.Equal(t, "https://www.serj-tubin.com/blog/0", jf.Items[3].URL)
+
+	etag := rr.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	assert.Empty(t, rr.Header().Get("Last-Modified"))
+
+	rr = get("/blog/feed.json", http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+	assert.Empty(t, rr.Body.String())
+	assert.Equal(t, etag, rr.Header().Get("ETag"))
+	rr = get("/blog/feed.json", http.Header{"If-None-Match": {`"stale"`}})
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// an edited post changes the feed
+	require.NoError(t, repoMock.UpdateBlog(context.Background(), 4, "blog4title", "blog 4 content, edited", "", ""))
+	rr = get("/blog/feed.json", http.Header{"If-None-Match": {etag}})
+	require.Equal(t, http.StatusOK, rr.Code)
+	etag = rr.Header().Get("ETag")
+	jf = jsonFeed{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &jf))
+	assert.Equal(t, "<p>blog 4 content, edited</p>\n", jf.Items[0].ContentHTML)
+
+	// and so does an unpublished one
+	require.NoError(t, repoMock.SetBlogStatus(context.Background(), 1, StatusDraft, nil))
+	rr = get("/blog/feed.json", http.Header{"If-None-Match": {etag}})
+	require.Equal(t, http.StatusOK, rr.Code)
+	jf = jsonFeed{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &jf))
+	assert.Len(t, jf.Items, 3)
+
+	rr = get("/blog/feed.rss?tag=Go&content=summary", nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, "application/rss+xml; charset=utf-8", rr.Header().Get("Content-Type"))
+	var rss rssFeed
+	require.NoError(t, xml.Unmarshal(rr.Body.Bytes(), &rss))
+	assert.Equal(t, "Serj Tubin - Blog: go", rss.Channel.Title)
+	assert.Contains(t, rr.Body.String(), `<atom:link href="https://h.serj-tubin.com/api/blog/feed.rss?content=summary&amp;tag=go" rel="self"`)
+	require.Len(t, rss.Channel.Items, 1)
+	assert.Equal(t, "blog3title", rss.Channel.Items[0].Title)
+	assert.Equal(t, "blog 3 content", rss.Channel.Items[0].Description)
+
+	rr = get("/blog/feed.atom", nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, "application/atom+xml; charset=utf-8", rr.Header().Get("Content-Type"))
+	var atom atomFeed
+	require.NoError(t, xml.Unmarshal(rr.Body.Bytes(), &atom))
+	assert.Len(t, atom.Entries, 3)
+
+	rr = get("/blog/feed.atom?tag=nope", nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	atom = atomFeed{}
+	require.NoError(t, xml.Unmarshal(rr.Body.Bytes(), &atom))
+	assert.Empty(t, atom.Entries)
+
+	assert.Equal(t, http.StatusBadRequest, get("/blog/feed.rss?content=some", nil).Code)
+}
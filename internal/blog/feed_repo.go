@@ -0,0 +1,75 @@
+package blog
+
+import (
+	"context"
+
+	"github.com/2beens/serjtubincom/internal/telemetry/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// GetFeedBlogs returns the latest published blogs, only the ones with the tag if it's not empty,
+// the latest published first, with their content rendered to html
+func (r *Repo) GetFeedBlogs(ctx context.Context, size int, tag string) (_ []*Blog, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "blogApi.GetFeedBlogs")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+	span.SetAttributes(attribute.Int("size", size))
+	span.SetAttributes(attribute.String("tag", tag))
+
+	rows, err := r.db.Query(
+		ctx,
+		`
+			SELECT `+blogListColumns+`, blog.content_html, blog.render_version
+			FROM `+blogListFrom+`
+			WHERE `+blogListWhere+`
+			ORDER BY GREATEST(blog.created_at, blog.publish_at) DESC, blog.id DESC
+			LIMIT $4;
+		`,
+		true, tag, "", size,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blogs []*Blog
+	var stale []*Blog
+	for rows.Next() {
+		blog := &Blog{}
+		var status string
+		var seriesSlug, seriesTitle *string
+		var seriesPart *int
+		var contentHTML *string
+		var renderVersion int
+		if err := rows.Scan(
+			&blog.ID, &blog.Title, &blog.CreatedAt, &blog.Content, &blog.Claps, &blog.ReadingTime, &status,
+			&blog.PublishAt, &blog.Tags, &seriesSlug, &seriesTitle, &seriesPart, &contentHTML, &renderVersion,
+		); err != nil {
+			return nil, err
+		}
+		blog.Status = Status(status)
+		blog.Series = postSeries(seriesSlug, seriesTitle, seriesPart)
+
+		if contentHTML == nil || renderVersion < RenderVersion {
+			stale = append(stale, blog)
+		} else {
+			blog.ContentHTML = *contentHTML
+		}
+		blogs = append(blogs, blog)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// posts added before the rendering, or rendered by an older version, are rendered now
+	for _, blog := range stale {
+		if err := r.renderAndCache(ctx, blog); err != nil {
+			return nil, err
+		}
+	}
+
+	return blogs, nil
+}
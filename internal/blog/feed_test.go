@@ -0,0 +1,128 @@
+package blog
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFeed(t *testing.T) {
+	created := time.Date(2026, 3, 9, 10, 0, 0, 0, time.UTC)
+	publishAt := created.Add(48 * time.Hour)
+	posts := []*Blog{
+		{ID: 1, Title: "older", CreatedAt: created, Content: "The **older** post.", ContentHTML: "<p>The <strong>older</strong> post.</p>\n"},
+		// scheduled, published after the newer one was created
+		{ID: 2, Title: "scheduled", CreatedAt: created.Add(-time.Hour), PublishAt: &publishAt, Content: "Scheduled post.", Tags: []string{"go"}},
+		{ID: 3, Title: "newer", CreatedAt: created.Add(24 * time.Hour), Content: "The newer post."},
+	}
+	links := FeedLinks{SiteURL: "https://example.com", FeedsURL: "https://api.example.com"}
+
+	f := newFeed(posts, feedTitle, "https://api.example.com/blog/feed.json", links, false, NewRenderer())
+	assert.Equal(t, publishAt, f.Updated)
+	require.Len(t, f.Items, 3)
+	assert.Equal(t, "https://example.com/blog/2", f.Items[0].URL)
+	assert.Equal(t, "https://example.com/blog/3", f.Items[1].URL)
+	assert.Equal(t, "<p>The <strong>older</strong> post.</p>\n", f.Items[2].ContentHTML)
+	assert.Equal(t, "The older post.", f.Items[2].Summary)
+
+	summaryOnly := newFeed(posts, feedTitle, "", links, true, NewRenderer())
+	assert.Empty(t, summaryOnly.Items[2].ContentHTML)
+	assert.Equal(t, "Scheduled post.", summaryOnly.Items[0].Summary)
+}
+
+func TestFeedETag(t *testing.T) {
+	posts := []*Blog{
+		{ID: 1, Title: "first", CreatedAt: time.Now(), Content: "content"},
+		{ID: 2, Title: "second", CreatedAt: time.Now(), Content: "content", Tags: []string{"go"}},
+	}
+
+	etag := feedETag(FeedRSS, "https://api.example.com/blog/feed.rss", false, posts)
+	assert.Equal(t, etag, feedETag(FeedRSS, "https://api.example.com/blog/feed.rss", false, posts))
+	assert.NotEqual(t, etag, feedETag(FeedAtom, "https://api.example.com/blog/feed.rss", false, posts))
+	assert.NotEqual(t, etag, feedETag(FeedRSS, "https://api.example.com/blog/feed.rss", true, posts))
+	// a post removed from the feed
+	assert.NotEqual(t, etag, feedETag(FeedRSS, "https://api.example.com/blog/feed.rss", false, posts[:1]))
+
+	posts[1].Tags = nil
+	assert.NotEqual(t, etag, feedETag(FeedRSS, "https://api.example.com/blog/feed.rss", false, posts))
+
+	assert.True(t, etagMatches(etag, etag))
+	assert.True(t, etagMatches(`"other", W/`+etag, etag))
+	assert.True(t, etagMatches("*", etag))
+	assert.False(t, etagMatches(`"other"`, etag))
+	assert.False(t, etagMatches("", etag))
+}
+
+func TestFeed_Encode(t *testing.T) {
+	published := time.Date(2026, 3, 9, 10, 0, 0, 0, time.UTC)
+	f := &feed{
+		Title:   feedTitle,
+		SiteURL: "https://example.com",
+		FeedURL: "https://api.example.com/blog/feed",
+		Updated: published,
+		Items: []feedItem{
+			{
+				URL:         "https://example.com/blog/1",
+				Title:       "first & last",
+				Published:   published,
+				Summary:     "Summary.",
+				ContentHTML: "<p>Content.</p>",
+				Tags:        []string{"go", "home-lab"},
+			},
+			{
+				URL:       "https://example.com/blog/0",
+				Title:     "summary only",
+				Published: published.Add(-time.Hour),
+				Summary:   "Only summary.",
+			},
+		},
+	}
+
+	rssBody, err := f.Encode(FeedRSS)
+	require.NoError(t, err)
+	var rss rssFeed
+	require.NoError(t, xml.Unmarshal(rssBody, &rss))
+	assert.Equal(t, "2.0", rss.Version)
+	assert.Equal(t, "Mon, 09 Mar 2026 10:00:00 +0000", rss.Channel.LastBuildDate)
+	require.Len(t, rss.Channel.Items, 2)
+	assert.Equal(t, "first & last", rss.Channel.Items[0].Title)
+	assert.Equal(t, "<p>Content.</p>", rss.Channel.Items[0].Description)
+	assert.Equal(t, []string{"go", "home-lab"}, rss.Channel.Items[0].Categories)
+	assert.Equal(t, "Only summary.", rss.Channel.Items[1].Description)
+
+	atomBody, err := f.Encode(FeedAtom)
+	require.NoError(t, err)
+	var atom atomFeed
+	require.NoError(t, xml.Unmarshal(atomBody, &atom))
+	assert.Equal(t, "https://api.example.com/blog/feed", atom.ID)
+	assert.Equal(t, "2026-03-09T10:00:00Z", atom.Updated)
+	assert.Equal(t, feedAuthor, atom.Author.Name)
+	require.Len(t, atom.Entries, 2)
+	require.NotNil(t, atom.Entries[0].Content)
+	assert.Equal(t, "html", atom.Entries[0].Content.Type)
+	assert.Equal(t, "<p>Content.</p>", atom.Entries[0].Content.Body)
+	assert.Len(t, atom.Entries[0].Categories, 2)
+	assert.Nil(t, atom.Entries[1].Content)
+	assert.Equal(t, "Only summary.", atom.Entries[1].Summary.Body)
+
+	jsonBody, err := f.Encode(FeedJSON)
+	require.NoError(t, err)
+	var jf jsonFeed
+	require.NoError(t, json.Unmarshal(jsonBody, &jf))
+	assert.Equal(t, "https://jsonfeed.org/version/1.1", jf.Version)
+	assert.Equal(t, "https://example.com", jf.HomePageURL)
+	require.Len(t, jf.Items, 2)
+	assert.Equal(t, "https://example.com/blog/1", jf.Items[0].ID)
+	assert.Equal(t, "<p>Content.</p>", jf.Items[0].ContentHTML)
+	assert.Empty(t, jf.Items[0].ContentText)
+	assert.Equal(t, "2026-03-09T10:00:00Z", jf.Items[0].DatePublished)
+	assert.Empty(t, jf.Items[1].ContentHTML)
+	assert.Equal(t, "Only summary.", jf.Items[1].ContentText)
+
+	_, err = f.Encode("csv")
+	assert.Error(t, err)
+}
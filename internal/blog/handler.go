@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/2beens/serjtubincom/internal/auth"
@@ -28,37 +29,69 @@ type clapBlogRequest struct {
 type newBlogRequest struct {
 	Title   string `json:"title"`
 	Content string `json:"content"`
+	// Status is published if empty, PublishAt is needed for the scheduled one
+	Status    string     `json:"status"`
+	PublishAt *time.Time `json:"publish_at"`
+}
+
+type blogStatusRequest struct {
+	ID        int        `json:"id"`
+	Status    string     `json:"status"`
+	PublishAt *time.Time `json:"publish_at"`
 }
 
 type updateBlogRequest struct {
 	ID      int    `json:"id"`
 	Title   string `json:"title"`
 	Content string `json:"content"`
+	// the author and the summary of the new revision, both optional
+	Author  string `json:"author"`
+	Summary string `json:"summary"`
+}
+
+type RevisionsResponse struct {
+	Revisions []*Revision `json:"revisions"`
 }
 
 type blogRepo interface {
 	GetBlog(ctx context.Context, id int) (*Blog, error)
 	AddBlog(ctx context.Context, blog *Blog) error
-	UpdateBlog(ctx context.Context, id int, title, content string) error
+	UpdateBlog(ctx context.Context, id int, title, content, author, summary string) error
+	GetRevisions(ctx context.Context, blogID int) ([]*Revision, error)
+	GetRevision(ctx context.Context, blogID, number int) (*Revision, error)
+	RestoreRevision(ctx context.Context, blogID, number int, author string) error
+	SetBlogStatus(ctx context.Context, id int, status Status, publishAt *time.Time) error
+	PublishScheduled(ctx context.Context, now time.Time) ([]int, error)
 	BlogClapped(ctx context.Context, id int) error
 	DeleteBlog(ctx context.Context, id int) error
-	All(ctx context.Context) ([]*Blog, error)
-	BlogsCount(ctx context.Context) (int, error)
-	GetBlogsPage(ctx context.Context, page, size int) ([]*Blog, error)
+	All(ctx context.Context, publishedOnly bool) ([]*Blog, error)
+	BlogsCount(ctx context.Context, filter ListFilter) (int, error)
+	GetBlogsPage(ctx context.Context, page, size int, filter ListFilter) ([]*Blog, error)
+	GetFeedBlogs(ctx context.Context, size int, tag string) ([]*Blog, error)
+	SetBlogTags(ctx context.Context, id int, tags []string) ([]string, error)
+	TagCloud(ctx context.Context, publishedOnly bool) ([]TagCount, error)
+	SaveSeries(ctx context.Context, series *Series) (*Series, error)
+	GetSeries(ctx context.Context, publishedOnly bool) ([]Series, error)
+	SetBlogSeries(ctx context.Context, id int, slug string, part int) error
 }
 
 type Handler struct {
 	repo         blogRepo
 	loginChecker auth.Checker
+	feedLinks    FeedLinks
+	renderer     *Renderer
 }
 
 func NewBlogHandler(
 	repo blogRepo,
 	loginChecker auth.Checker,
+	feedLinks FeedLinks,
 ) *Handler {
 	return &Handler{
 		repo:         repo,
 		loginChecker: loginChecker,
+		feedLinks:    feedLinks,
+		renderer:     NewRenderer(),
 	}
 }
 
@@ -66,10 +99,25 @@ func (handler *Handler) SetupRoutes(router *mux.Router) {
 	router.HandleFunc("/blog/post/{id}", handler.handleGetBlog).Methods("GET").Name("get-blog")
 	router.HandleFunc("/blog/new", handler.handleNewBlog).Methods("POST", "OPTIONS").Name("new-blog")
 	router.HandleFunc("/blog/update", handler.handleUpdateBlog).Methods("POST", "OPTIONS").Name("update-blog")
+	router.HandleFunc("/blog/status", handler.handleSetBlogStatus).Methods("POST", "OPTIONS").Name("blog-status")
+	// revisions, not under /blog/post/{id} which is public
+	router.HandleFunc("/blog/revisions/{id}", handler.handleRevisions).Methods("GET").Name("blog-revisions")
+	router.HandleFunc("/blog/revisions/{id}/diff", handler.handleRevisionsDiff).Methods("GET").Name("blog-revisions-diff")
+	router.HandleFunc("/blog/revisions/{id}/{revision:[0-9]+}", handler.handleRevision).Methods("GET").Name("blog-revision")
+	router.HandleFunc("/blog/revisions/{id}/{revision:[0-9]+}/restore", handler.handleRestoreRevision).
+		Methods("POST", "OPTIONS").Name("blog-revision-restore")
 	router.HandleFunc("/blog/clap", handler.handleBlogClapped).Methods("PATCH", "OPTIONS").Name("blog-clapped")
 	router.HandleFunc("/blog/delete/{id}", handler.handleDeleteBlog).Methods("DELETE", "OPTIONS").Name("delete-blog")
 	router.HandleFunc("/blog/all", handler.handleAll).Methods("GET").Name("all-blogs")
 	router.HandleFunc("/blog/page/{page}/size/{size}", handler.handleGetPage).Methods("GET").Name("blogs-page")
+	router.HandleFunc("/blog/tags", handler.handleTagCloud).Methods("GET").Name("blog-tags")
+	router.HandleFunc("/blog/update/tags", handler.handleSetBlogTags).Methods("POST", "OPTIONS").Name("update-blog-tags")
+	router.HandleFunc("/blog/series", handler.handleSeries).Methods("GET").Name("blog-series")
+	router.HandleFunc("/blog/series/new", handler.handleSaveSeries).Methods("POST", "OPTIONS").Name("new-blog-series")
+	router.HandleFunc("/blog/update/series", handler.handleSetBlogSeries).Methods("POST", "OPTIONS").Name("update-blog-series")
+	router.HandleFunc("/blog/feed.rss", handler.handleFeed(FeedRSS)).Methods("GET").Name("blog-feed-rss")
+	router.HandleFunc("/blog/feed.atom", handler.handleFeed(FeedAtom)).Methods("GET").Name("blog-feed-atom")
+	router.HandleFunc("/blog/feed.json", handler.handleFeed(FeedJSON)).Methods("GET").Name("blog-feed-json")
 }
 
 func (handler *Handler) handleGetBlog(w http.ResponseWriter, r *http.Request) {
@@ -96,6 +144,12 @@ func (handler *Handler) handleGetBlog(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// drafts and the not yet published posts are not there for the public
+	if !blog.Status.Visible() && !handler.isAdmin(r) {
+		http.Error(w, "blog not found", http.StatusNotFound)
+		return
+	}
+
 	blogJson, err := json.Marshal(blog)
 	if err != nil {
 		log.Errorf("marshal blog %d error: %s", id, err)
@@ -123,6 +177,15 @@ func (handler *Handler) handleNewBlog(w http.ResponseWriter, r *http.Request) {
 		newBlogReq = newBlogRequest{
 			Title:   r.Form.Get("title"),
 			Content: r.Form.Get("content"),
+			Status:  r.Form.Get("status"),
+		}
+		if publishAtStr := r.Form.Get("publish_at"); publishAtStr != "" {
+			publishAt, err := time.Parse(time.RFC3339, publishAtStr)
+			if err != nil {
+				http.Error(w, "error, invalid publish_at", http.StatusBadRequest)
+				return
+			}
+			newBlogReq.PublishAt = &publishAt
 		}
 	}
 
@@ -135,10 +198,22 @@ func (handler *Handler) handleNewBlog(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	status, err := ParseStatus(newBlogReq.Status)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateStatus(status, newBlogReq.PublishAt); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	newBlog := &Blog{
 		Title:     newBlogReq.Title,
 		Content:   newBlogReq.Content,
 		CreatedAt: time.Now(),
+		Status:    status,
+		PublishAt: newBlogReq.PublishAt,
 	}
 
 	if err := handler.repo.AddBlog(r.Context(), newBlog); err != nil {
@@ -185,6 +260,8 @@ func (handler *Handler) handleUpdateBlog(w http.ResponseWriter, r *http.Request)
 			ID:      id,
 			Title:   r.Form.Get("title"),
 			Content: r.Form.Get("content"),
+			Author:  r.Form.Get("author"),
+			Summary: r.Form.Get("summary"),
 		}
 	}
 
@@ -197,7 +274,19 @@ func (handler *Handler) handleUpdateBlog(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := handler.repo.UpdateBlog(r.Context(), updateBlogReq.ID, updateBlogReq.Title, updateBlogReq.Content); err != nil {
+	err := handler.repo.UpdateBlog(
+		r.Context(),
+		updateBlogReq.ID,
+		updateBlogReq.Title,
+		updateBlogReq.Content,
+		updateBlogReq.Author,
+		updateBlogReq.Summary,
+	)
+	switch {
+	case errors.Is(err, ErrBlogNotFound):
+		http.Error(w, "blog not found", http.StatusNotFound)
+		return
+	case err != nil:
 		log.Errorf("update blog failed: %s", err)
 		http.Error(w, "update blog failed", http.StatusInternalServerError)
 		return
@@ -206,6 +295,37 @@ func (handler *Handler) handleUpdateBlog(w http.ResponseWriter, r *http.Request)
 	pkg.WriteTextResponseOK(w, fmt.Sprintf("updated:%d", updateBlogReq.ID))
 }
 
+// handleSetBlogStatus moves the blog to another lifecycle state, e.g. a draft to the scheduled one
+func (handler *Handler) handleSetBlogStatus(w http.ResponseWriter, r *http.Request) {
+	var statusReq blogStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&statusReq); err != nil {
+		http.Error(w, "invalid blog status json", http.StatusBadRequest)
+		return
+	}
+
+	status, err := ParseStatus(statusReq.Status)
+	if err != nil || statusReq.Status == "" {
+		http.Error(w, "error, invalid status", http.StatusBadRequest)
+		return
+	}
+
+	err = handler.repo.SetBlogStatus(r.Context(), statusReq.ID, status, statusReq.PublishAt)
+	switch {
+	case errors.Is(err, ErrPublishAtMissing):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, ErrBlogNotFound):
+		http.Error(w, "blog not found", http.StatusNotFound)
+		return
+	case err != nil:
+		log.Errorf("set blog %d status %s: %s", statusReq.ID, status, err)
+		http.Error(w, "set blog status failed", http.StatusInternalServerError)
+		return
+	}
+
+	pkg.WriteTextResponseOK(w, fmt.Sprintf("%s:%d", status, statusReq.ID))
+}
+
 func (handler *Handler) handleBlogClapped(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseForm(); err != nil {
 		log.Errorf("update blog failed, parse form error: %s", err)
@@ -269,7 +389,7 @@ func (handler *Handler) handleDeleteBlog(w http.ResponseWriter, r *http.Request)
 }
 
 func (handler *Handler) handleAll(w http.ResponseWriter, r *http.Request) {
-	allBlogs, err := handler.repo.All(r.Context())
+	allBlogs, err := handler.repo.All(r.Context(), !handler.isAdmin(r))
 
 	if err != nil {
 		log.Errorf("get all blogs error: %s", err)
@@ -315,7 +435,13 @@ func (handler *Handler) handleGetPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	blogPosts, err := handler.repo.GetBlogsPage(r.Context(), page, size)
+	// optionally filtered by ?tag= or ?series= (slug)
+	filter := ListFilter{
+		PublishedOnly: !handler.isAdmin(r),
+		Tag:           strings.ToLower(r.URL.Query().Get("tag")),
+		Series:        strings.ToLower(r.URL.Query().Get("series")),
+	}
+	blogPosts, err := handler.repo.GetBlogsPage(r.Context(), page, size, filter)
 	if err != nil {
 		log.Errorf("get blogs error: %s", err)
 		http.Error(w, "failed to get blog posts", http.StatusInternalServerError)
@@ -324,7 +450,7 @@ func (handler *Handler) handleGetPage(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Add("Content-Type", "application/json")
 
-	totalBlogsCount, err := handler.repo.BlogsCount(r.Context())
+	totalBlogsCount, err := handler.repo.BlogsCount(r.Context(), filter)
 	if err != nil {
 		log.Errorf("get blogs error: %s", err)
 		http.Error(w, "failed to get blog posts", http.StatusInternalServerError)
@@ -345,3 +471,19 @@ func (handler *Handler) handleGetPage(w http.ResponseWriter, r *http.Request) {
 
 	pkg.WriteResponseBytes(w, pkg.ContentType.JSON, blogPostsRespJson, http.StatusOK)
 }
+
+// isAdmin reports whether the request comes from the logged in admin, who sees the blogs in all the states,
+// the public blog routes are not behind the auth middleware, so it is checked here
+func (handler *Handler) isAdmin(r *http.Request) bool {
+	authToken := r.Header.Get("X-SERJ-TOKEN")
+	if authToken == "" || handler.loginChecker == nil {
+		return false
+	}
+
+	isLogged, err := handler.loginChecker.IsLogged(r.Context(), authToken)
+	if err != nil {
+		log.Tracef("blog, check login: %s", err)
+		return false
+	}
+	return isLogged
+}
@@ -31,9 +31,16 @@ func TestMain(m *testing.M) {
 		goleak.IgnoreTopFunction(
 			"github.com/go-redis/redis/v8/internal/pool.(*ConnPool).reaper",
 		),
+		// the regexp2 clock, used by the code blocks highlighting, stops only after a while
+		goleak.IgnoreAnyFunction("github.com/dlclark/regexp2.runClock"),
 	)
 }
 
+var testFeedLinks = FeedLinks{
+	SiteURL:  "https://www.serj-tubin.com",
+	FeedsURL: "https://h.serj-tubin.com/api",
+}
+
 func setupBlogRouterForTests(t *testing.T, repo *repoMock, loginChecker *auth.LoginChecker) *mux.Router {
 	t.Helper()
 
@@ -46,7 +53,7 @@ func setupBlogRouterForTests(t *testing.T, repo *repoMock, loginChecker *auth.Lo
 	)
 	r.Use(authMiddleware.AuthCheck())
 
-	NewBlogHandler(repo, loginChecker).SetupRoutes(r)
+	NewBlogHandler(repo, loginChecker, testFeedLinks).SetupRoutes(r)
 
 	return r
 }
@@ -73,7 +80,7 @@ func getRepoMockAndLoginChecker(t *testing.T, redisClient *redis.Client) (*repoM
 func TestNewBlogHandler(t *testing.T) {
 	r := mux.NewRouter()
 
-	handler := NewBlogHandler(nil, nil)
+	handler := NewBlogHandler(nil, nil, FeedLinks{})
 	handler.SetupRoutes(r)
 
 	for caseName, route := range map[string]struct {
@@ -111,6 +118,11 @@ func TestNewBlogHandler(t *testing.T) {
 			path:   "/blog/delete/1",
 			method: "OPTIONS",
 		},
+		"blog-status-post": {
+			name:   "blog-status",
+			path:   "/blog/status",
+			method: "POST",
+		},
 		"all-blog-post": {
 			name:   "all-blogs",
 			path:   "/blog/all",
@@ -121,6 +133,16 @@ func TestNewBlogHandler(t *testing.T) {
 			path:   "/blog/page/1/size/2",
 			method: "GET",
 		},
+		"blog-feed-rss": {
+			name:   "blog-feed-rss",
+			path:   "/blog/feed.rss",
+			method: "GET",
+		},
+		"blog-feed-json": {
+			name:   "blog-feed-json",
+			path:   "/blog/feed.json",
+			method: "GET",
+		},
 	} {
 		nextRoute := route
 		cn := caseName
@@ -166,6 +188,115 @@ func TestBlogHandler_handleAll(t *testing.T) {
 	}
 }
 
+func TestBlogHandler_handleGetBlog(t *testing.T) {
+	redisClient, _ := redismock.NewClientMock()
+	repoMock, loginChecker := getRepoMockAndLoginChecker(t, redisClient)
+	r := setupBlogRouterForTests(t, repoMock, loginChecker)
+
+	require.NoError(t, repoMock.AddBlog(context.Background(), &Blog{
+		ID:        10,
+		Title:     "markdown",
+		CreatedAt: time.Now(),
+		Content:   "# Intro\n\nSome **bold** text.\n\n## Details\n\n<script>alert(1)</script>",
+	}))
+
+	req, err := http.NewRequest("GET", "/blog/post/10", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+
+	r.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var blogPost Blog
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &blogPost))
+	assert.Equal(t, 10, blogPost.ID)
+	assert.Contains(t, blogPost.ContentHTML, `<h1 id="intro">`)
+	assert.Contains(t, blogPost.ContentHTML, "<strong>bold</strong>")
+	assert.NotContains(t, blogPost.ContentHTML, "<script>")
+	assert.Equal(t, []TOCEntry{
+		{Level: 1, ID: "intro", Title: "Intro"},
+		{Level: 2, ID: "details", Title: "Details"},
+	}, blogPost.TOC)
+	assert.Equal(t, 1, blogPost.ReadingTime)
+
+	req, err = http.NewRequest("GET", "/blog/post/100", nil)
+	require.NoError(t, err)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestBlogHandler_statuses(t *testing.T) {
+	redisClient, redisMock := redismock.NewClientMock()
+	repoMock, loginChecker := getRepoMockAndLoginChecker(t, redisClient)
+	r := setupBlogRouterForTests(t, repoMock, loginChecker)
+
+	require.NoError(t, repoMock.AddBlog(context.Background(), &Blog{
+		ID: 10, Title: "draft", Content: "draft", CreatedAt: time.Now(), Status: StatusDraft,
+	}))
+	require.NoError(t, repoMock.AddBlog(context.Background(), &Blog{
+		ID: 11, Title: "unlisted", Content: "unlisted", CreatedAt: time.Now(), Status: StatusUnlisted,
+	}))
+
+	send := func(method, path, body string, admin bool) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		require.NoError(t, err)
+		if admin {
+			req.Header.Set("X-SERJ-TOKEN", "mylittlesecret")
+			redisMock.ExpectGet("serj-service-session||mylittlesecret").SetVal(fmt.Sprintf("%d", time.Now().Unix()))
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	getPosts := func(admin bool) PostsResponse {
+		rr := send("GET", "/blog/page/1/size/100", "", admin)
+		require.Equal(t, http.StatusOK, rr.Code)
+		var postsResp PostsResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &postsResp))
+		return postsResp
+	}
+
+	// the public sees only the published posts listed
+	postsResp := getPosts(false)
+	assert.Len(t, postsResp.Posts, 5)
+	assert.Equal(t, 5, postsResp.Total)
+	rr := send("GET", "/blog/all", "", false)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "draft")
+
+	postsResp = getPosts(true)
+	assert.Len(t, postsResp.Posts, 7)
+	assert.Equal(t, 7, postsResp.Total)
+
+	// the unlisted post is there with the link to it
+	assert.Equal(t, http.StatusNotFound, send("GET", "/blog/post/10", "", false).Code)
+	assert.Equal(t, http.StatusOK, send("GET", "/blog/post/10", "", true).Code)
+	assert.Equal(t, http.StatusOK, send("GET", "/blog/post/11", "", false).Code)
+
+	rr = send("POST", "/blog/status", `{"id":10,"status":"scheduled"}`, true)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	rr = send("POST", "/blog/status", `{"id":10,"status":"archived"}`, true)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	rr = send("POST", "/blog/status", `{"id":100,"status":"draft"}`, true)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	rr = send("POST", "/blog/status", `{"id":10,"status":"scheduled","publish_at":"2026-03-10T09:00:00Z"}`, true)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "scheduled:10", rr.Body.String())
+	assert.Equal(t, StatusScheduled, repoMock.Posts[10].Status)
+	assert.Equal(t, time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC), repoMock.Posts[10].PublishAt.UTC())
+
+	// not logged in
+	rr = send("POST", "/blog/status", `{"id":10,"status":"published"}`, false)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	published, err := repoMock.PublishScheduled(context.Background(), time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, []int{10}, published)
+	assert.Equal(t, http.StatusOK, send("GET", "/blog/post/10", "", false).Code)
+	assert.Len(t, getPosts(false).Posts, 6)
+}
+
 func TestBlogHandler_handleGetPage(t *testing.T) {
 	redisClient, _ := redismock.NewClientMock()
 	repoMock, loginChecker := getRepoMockAndLoginChecker(t, redisClient)
@@ -189,7 +320,7 @@ func TestBlogHandler_handleDelete(t *testing.T) {
 	repoMock, loginChecker := getRepoMockAndLoginChecker(t, redisClient)
 	r := setupBlogRouterForTests(t, repoMock, loginChecker)
 
-	handler := NewBlogHandler(repoMock, loginChecker)
+	handler := NewBlogHandler(repoMock, loginChecker, FeedLinks{})
 	handler.SetupRoutes(r.PathPrefix("/blog").Subrouter())
 
 	req, err := http.NewRequest("DELETE", "/blog/delete/3", nil)
@@ -226,7 +357,7 @@ func TestBlogHandler_handleNewBlog_notLoggedIn(t *testing.T) {
 	repoMock, loginChecker := getRepoMockAndLoginChecker(t, redisClient)
 	r := setupBlogRouterForTests(t, repoMock, loginChecker)
 
-	handler := NewBlogHandler(repoMock, loginChecker)
+	handler := NewBlogHandler(repoMock, loginChecker, FeedLinks{})
 	handler.SetupRoutes(r.PathPrefix("/blog").Subrouter())
 
 	req, err := http.NewRequest("POST", "/blog/new", nil)
@@ -351,6 +482,7 @@ func TestBlogHandler_handleNewBlog_correctToken(t *testing.T) {
 	require.NotNil(t, addedPost)
 	assert.Equal(t, "Nonsense", addedPost.Title)
 	assert.Equal(t, "This content makes no sense", addedPost.Content)
+	assert.Equal(t, "<p>This content makes no sense</p>\n", addedPost.ContentHTML)
 	assert.False(t, addedPost.CreatedAt.IsZero())
 }
 
@@ -359,7 +491,7 @@ func TestBlogHandler_handleNewBlog_jsonPayload_correctToken(t *testing.T) {
 	repoMock, loginChecker := getRepoMockAndLoginChecker(t, redisClient)
 	r := setupBlogRouterForTests(t, repoMock, loginChecker)
 
-	handler := NewBlogHandler(repoMock, loginChecker)
+	handler := NewBlogHandler(repoMock, loginChecker, FeedLinks{})
 	handler.SetupRoutes(r.PathPrefix("/blog").Subrouter())
 
 	newBlogParams := newBlogRequest{
@@ -390,6 +522,8 @@ func TestBlogHandler_handleNewBlog_jsonPayload_correctToken(t *testing.T) {
 	assert.Equal(t, newBlogParams.Title, addedPost.Title)
 	assert.Equal(t, newBlogParams.Content, addedPost.Content)
 	assert.False(t, addedPost.CreatedAt.IsZero())
+	// published right away, with no status given
+	assert.Equal(t, StatusPublished, addedPost.Status)
 }
 
 func TestBlogHandler_handleUpdateBlog_correctToken(t *testing.T) {
@@ -422,6 +556,7 @@ func TestBlogHandler_handleUpdateBlog_correctToken(t *testing.T) {
 	require.NotNil(t, addedPost)
 	assert.Equal(t, "Nonsense", addedPost.Title)
 	assert.Equal(t, "This content makes no sense", addedPost.Content)
+	assert.Equal(t, "<p>This content makes no sense</p>\n", addedPost.ContentHTML)
 	assert.False(t, addedPost.CreatedAt.IsZero())
 }
 
@@ -0,0 +1,190 @@
+package blog
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+)
+
+// RenderVersion is stored with the rendered content of a blog post, bump it when the rendering changes
+// so the posts rendered before are rendered again when read
+const RenderVersion = 1
+
+// readingWordsPerMinute is the average reading speed used for the blog post reading time
+const readingWordsPerMinute = 200
+
+// TOCEntry is a heading of the blog post in the table of contents, ID is the heading anchor
+type TOCEntry struct {
+	Level int    `json:"level"`
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// Rendered is the blog post markdown content rendered to html
+type Rendered struct {
+	HTML        string
+	TOC         []TOCEntry
+	ReadingTime int // minutes
+}
+
+// Renderer renders the blog posts markdown (CommonMark with the GitHub flavoured tables, strikethrough,
+// task lists and autolinks) to sanitized html, with syntax highlighted code blocks and a self link
+// anchor next to each heading
+type Renderer struct {
+	markdown  goldmark.Markdown
+	sanitizer *bluemonday.Policy
+}
+
+func NewRenderer() *Renderer {
+	markdown := goldmark.New(
+		goldmark.WithExtensions(
+			extension.GFM,
+			highlighting.NewHighlighting(
+				highlighting.WithStyle("github"),
+				highlighting.WithFormatOptions(chromahtml.WithClasses(false)),
+			),
+		),
+		goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+		// raw html in the content is allowed here, and sanitized after
+		goldmark.WithRendererOptions(html.WithUnsafe()),
+	)
+
+	sanitizer := bluemonday.UGCPolicy()
+	sanitizer.AllowAttrs("class").Matching(regexp.MustCompile(`^heading-anchor$`)).OnElements("a")
+	// the highlighted code blocks are styled inline
+	sanitizer.AllowStyles("color", "background-color", "font-weight", "font-style", "text-decoration").
+		OnElements("pre", "span")
+	sanitizer.AllowAttrs("tabindex").Matching(regexp.MustCompile(`^0$`)).OnElements("pre")
+	// tables columns alignment
+	sanitizer.AllowStyles("text-align").MatchingEnum("left", "center", "right").OnElements("th", "td")
+	// task lists
+	sanitizer.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	sanitizer.AllowAttrs("checked", "disabled").OnElements("input")
+
+	return &Renderer{
+		markdown:  markdown,
+		sanitizer: sanitizer,
+	}
+}
+
+func (r *Renderer) Render(content string) (*Rendered, error) {
+	source := []byte(content)
+	doc := r.markdown.Parser().Parse(text.NewReader(source))
+	toc := addHeadingAnchors(doc, source)
+
+	var buf bytes.Buffer
+	if err := r.markdown.Renderer().Render(&buf, source, doc); err != nil {
+		return nil, fmt.Errorf("render markdown: %w", err)
+	}
+
+	return &Rendered{
+		HTML:        r.sanitizer.Sanitize(buf.String()),
+		TOC:         toc,
+		ReadingTime: ReadingTime(content),
+	}, nil
+}
+
+// ReadingTime returns the estimated minutes needed to read the content, at least one
+func ReadingTime(content string) int {
+	words := len(strings.Fields(content))
+	return max(1, int(math.Ceil(float64(words)/readingWordsPerMinute)))
+}
+
+// Summary returns the plain text of the content paragraphs, without the headings and the code blocks,
+// cut to at most maxLength characters on a word boundary
+func (r *Renderer) Summary(content string, maxLength int) string {
+	source := []byte(content)
+	doc := r.markdown.Parser().Parse(text.NewReader(source))
+
+	var sb strings.Builder
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if sb.Len() > maxLength*utf8.UTFMax {
+			return ast.WalkStop, nil
+		}
+		if paragraph, ok := n.(*ast.Paragraph); ok && entering {
+			sb.WriteString(nodeText(paragraph, source))
+			sb.WriteByte(' ')
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+
+	summary := []rune(strings.Join(strings.Fields(sb.String()), " "))
+	if len(summary) <= maxLength {
+		return string(summary)
+	}
+	cut := string(summary[:maxLength])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + "…"
+}
+
+// addHeadingAnchors appends a "#" link to itself to each heading, and returns the headings
+// as the table of contents
+func addHeadingAnchors(doc ast.Node, source []byte) []TOCEntry {
+	var headings []*ast.Heading
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if heading, ok := n.(*ast.Heading); ok && entering {
+			headings = append(headings, heading)
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+
+	toc := make([]TOCEntry, 0, len(headings))
+	for _, heading := range headings {
+		id, _ := heading.AttributeString("id")
+		idBytes, ok := id.([]byte)
+		if !ok {
+			continue
+		}
+		idStr := string(idBytes)
+
+		toc = append(toc, TOCEntry{
+			Level: heading.Level,
+			ID:    idStr,
+			Title: strings.TrimSpace(nodeText(heading, source)),
+		})
+
+		anchor := ast.NewLink()
+		anchor.Destination = []byte("#" + idStr)
+		anchor.SetAttributeString("class", []byte("heading-anchor"))
+		anchor.AppendChild(anchor, ast.NewString([]byte("#")))
+		heading.AppendChild(heading, ast.NewString([]byte(" ")))
+		heading.AppendChild(heading, anchor)
+	}
+
+	return toc
+}
+
+func nodeText(n ast.Node, source []byte) string {
+	var sb strings.Builder
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		switch t := c.(type) {
+		case *ast.Text:
+			sb.Write(t.Segment.Value(source))
+			if t.SoftLineBreak() || t.HardLineBreak() {
+				sb.WriteByte(' ')
+			}
+		case *ast.String:
+			sb.Write(t.Value)
+		default:
+			sb.WriteString(nodeText(c, source))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,76 @@
+package blog
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderer_Render(t *testing.T) {
+	content := strings.Join([]string{
+		"# Hello `World`",
+		"",
+		"Some <b onclick=\"steal()\">bold</b> text<script>alert(1)</script>, [a link](javascript:alert(1)) and ~~strike~~.",
+		"",
+		"## Hello `World`",
+		"",
+		"| name | count |",
+		"|:-----|------:|",
+		"| beer | 2     |",
+		"",
+		"- [x] done",
+		"- [ ] todo",
+		"",
+		"```go",
+		"func main() {}",
+		"```",
+	}, "\n")
+
+	rendered, err := NewRenderer().Render(content)
+	require.NoError(t, err)
+
+	// heading anchors, the duplicated heading gets a unique one
+	assert.Contains(t, rendered.HTML, `<h1 id="hello-world">Hello <code>World</code> <a href="#hello-world" class="heading-anchor"`)
+	assert.Contains(t, rendered.HTML, `<h2 id="hello-world-1">`)
+	assert.Equal(t, []TOCEntry{
+		{Level: 1, ID: "hello-world", Title: "Hello World"},
+		{Level: 2, ID: "hello-world-1", Title: "Hello World"},
+	}, rendered.TOC)
+
+	// sanitized
+	assert.Contains(t, rendered.HTML, "<b>bold</b>")
+	assert.NotContains(t, rendered.HTML, "onclick")
+	assert.NotContains(t, rendered.HTML, "<script>")
+	assert.NotContains(t, rendered.HTML, "javascript:")
+
+	// GFM
+	assert.Contains(t, rendered.HTML, "<del>strike</del>")
+	assert.Contains(t, rendered.HTML, `<th style="text-align: left">name</th>`)
+	assert.Contains(t, rendered.HTML, `<td style="text-align: right">2</td>`)
+	assert.Contains(t, rendered.HTML, `<input checked="" disabled="" type="checkbox"> done`)
+
+	// highlighted code, styled inline
+	assert.Contains(t, rendered.HTML, `<pre style="background-color: #f7f7f7"><code>`)
+	assert.Contains(t, rendered.HTML, `<span style="color: #cf222e">func</span>`)
+
+	assert.Equal(t, 1, rendered.ReadingTime)
+}
+
+func TestReadingTime(t *testing.T) {
+	assert.Equal(t, 1, ReadingTime(""))
+	assert.Equal(t, 1, ReadingTime("just a few words"))
+	assert.Equal(t, 1, ReadingTime(strings.Repeat("word ", 200)))
+	assert.Equal(t, 2, ReadingTime(strings.Repeat("word ", 201)))
+	assert.Equal(t, 5, ReadingTime(strings.Repeat("word\n", 1000)))
+}
+
+func TestRenderer_Summary(t *testing.T) {
+	renderer := NewRenderer()
+
+	content := "# Intro\n\nSome *emphasized* text with [a link](https://example.com).\n\n```go\nfmt.Println(\"skipped\")\n```\n\nThe second paragraph."
+	assert.Equal(t, "Some emphasized text with a link. The second paragraph.", renderer.Summary(content, 100))
+	assert.Equal(t, "Some emphasized text…", renderer.Summary(content, 24))
+	assert.Empty(t, renderer.Summary("# Only a heading", 100))
+}
@@ -3,6 +3,7 @@ package blog
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
@@ -29,17 +30,43 @@ type Blog struct {
 	CreatedAt time.Time `json:"created_at"`
 	Content   string    `json:"content"`
 	Claps     int       `json:"claps"` // basically blog likes
+	// ContentHTML and TOC are the content rendered to html and its headings, they are returned
+	// only with the single blog post, not with the lists of them
+	ContentHTML string     `json:"content_html,omitempty"`
+	TOC         []TOCEntry `json:"toc,omitempty"`
+	ReadingTime int        `json:"reading_time"` // minutes
+	Status      Status     `json:"status"`
+	// PublishAt is when the scheduled post is published
+	PublishAt *time.Time  `json:"publish_at,omitempty"`
+	Tags      []string    `json:"tags"`
+	Series    *PostSeries `json:"series,omitempty"`
 }
 
+// blogListColumns are the columns of the blog posts lists, without the rendered content, from blogListFrom
+const blogListColumns = `
+	blog.id, blog.title, blog.created_at, blog.content, blog.claps, blog.reading_time, blog.status, blog.publish_at,
+	ARRAY(SELECT tag FROM blog_tag WHERE blog_tag.blog_id = blog.id ORDER BY tag),
+	blog_series.slug, blog_series.title, blog.series_part`
+
+const blogListFrom = `blog LEFT JOIN blog_series ON blog_series.id = blog.series_id`
+
+// blogListWhere filters the blogs by the ListFilter, the arguments are $1 published only, $2 tag and $3 series slug
+const blogListWhere = `
+	(NOT $1 OR blog.status = 'published')
+	AND ($2 = '' OR EXISTS (SELECT 1 FROM blog_tag WHERE blog_tag.blog_id = blog.id AND blog_tag.tag = $2))
+	AND ($3 = '' OR blog_series.slug = $3)`
+
 var _ blogRepo = (*Repo)(nil)
 
 type Repo struct {
-	db *pgxpool.Pool
+	db       *pgxpool.Pool
+	renderer *Renderer
 }
 
 func NewRepo(db *pgxpool.Pool) *Repo {
 	return &Repo{
-		db: db,
+		db:       db,
+		renderer: NewRenderer(),
 	}
 }
 
@@ -56,49 +83,105 @@ func (r *Repo) AddBlog(ctx context.Context, blog *Blog) (err error) {
 	if blog.CreatedAt.IsZero() {
 		blog.CreatedAt = time.Now()
 	}
+	if blog.Status == "" {
+		blog.Status = StatusPublished
+	}
+	if err := validateStatus(blog.Status, blog.PublishAt); err != nil {
+		return err
+	}
 
-	rows, err := r.db.Query(
-		ctx,
-		`INSERT INTO blog (title, created_at, content, claps) VALUES ($1, $2, $3, $4) RETURNING id;`,
-		blog.Title, blog.CreatedAt, blog.Content, blog.Claps,
-	)
+	rendered, err := r.renderer.Render(blog.Content)
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
-
-	if err := rows.Err(); err != nil {
+	toc, err := json.Marshal(rendered.TOC)
+	if err != nil {
 		return err
 	}
+	blog.ContentHTML = rendered.HTML
+	blog.TOC = rendered.TOC
+	blog.ReadingTime = rendered.ReadingTime
 
-	if rows.Next() {
-		var id int
-		if err := rows.Scan(&id); err == nil {
-			blog.ID = id
-			return nil
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			log.Errorf("add blog, rollback: %s", err)
 		}
+	}()
+
+	var id int
+	if err := tx.QueryRow(
+		ctx,
+		`
+			INSERT INTO blog (
+				title, created_at, content, claps, content_html, toc, reading_time, render_version, status, publish_at
+			)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id;
+		`,
+		blog.Title, blog.CreatedAt, blog.Content, blog.Claps,
+		rendered.HTML, toc, rendered.ReadingTime, RenderVersion, string(blog.Status), blog.PublishAt,
+	).Scan(&id); err != nil {
+		return fmt.Errorf("insert blog: %w", err)
 	}
 
-	return errors.New("unexpected error, failed to insert blog")
+	if _, err := insertRevision(ctx, tx, &Revision{
+		BlogID:  id,
+		Title:   blog.Title,
+		Content: blog.Content,
+		Author:  DefaultRevisionAuthor,
+		Summary: "initial revision",
+	}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	blog.ID = id
+	return nil
 }
 
-// UpdateBlog will update the content and title of the blog
+// UpdateBlog will update the content and title of the blog, and render the content again
 // createdAt and claps are not updated
-func (r *Repo) UpdateBlog(ctx context.Context, id int, title, content string) (err error) {
+// a new revision is stored when the title or the content is changed, by the author (the default one if empty)
+// and with the summary of the change (made from the change itself if empty)
+func (r *Repo) UpdateBlog(ctx context.Context, id int, title, content, author, summary string) (err error) {
 	ctx, span := tracing.GlobalTracer.Start(ctx, "blogApi.UpdateBlog")
 	defer func() {
 		tracing.EndSpanWithErrCheck(span, err)
 	}()
+	span.SetAttributes(attribute.Int("id", id))
 
 	if content == "" || title == "" {
 		return ErrBlogTitleOrContentEmpty
 	}
 
-	tag, err := r.db.Exec(
-		ctx,
-		`UPDATE blog SET title = $1, content = $2 WHERE id = $3`,
-		title, content, id,
-	)
+	rendered, err := r.renderer.Render(content)
+	if err != nil {
+		return err
+	}
+	toc, err := json.Marshal(rendered.TOC)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			log.Errorf("update blog %d, rollback: %s", id, err)
+		}
+	}()
+
+	// locked, so the concurrent updates of the blog get the subsequent revision numbers
+	var oldTitle, oldContent string
+	err = tx.QueryRow(ctx, `SELECT title, content FROM blog WHERE id = $1 FOR UPDATE`, id).Scan(&oldTitle, &oldContent)
 	switch {
 	case errors.Is(err, pgx.ErrNoRows), errors.Is(err, sql.ErrNoRows):
 		return ErrBlogNotFound
@@ -106,13 +189,100 @@ func (r *Repo) UpdateBlog(ctx context.Context, id int, title, content string) (e
 		return fmt.Errorf("query: %w", err)
 	}
 
-	if tag.RowsAffected() == 0 {
-		log.Tracef("blog %d not updated", id)
+	if _, err := tx.Exec(
+		ctx,
+		`
+			UPDATE blog
+			SET title = $1, content = $2, content_html = $3, toc = $4, reading_time = $5, render_version = $6
+			WHERE id = $7
+		`,
+		title, content, rendered.HTML, toc, rendered.ReadingTime, RenderVersion, id,
+	); err != nil {
+		return fmt.Errorf("query: %w", err)
+	}
+
+	if oldTitle == title && oldContent == content {
+		log.Tracef("blog %d not changed, no new revision", id)
+		return tx.Commit(ctx)
+	}
+
+	if author == "" {
+		author = DefaultRevisionAuthor
+	}
+	if summary == "" {
+		summary = revisionSummary(oldTitle, oldContent, title, content)
+	}
+	revision, err := insertRevision(ctx, tx, &Revision{
+		BlogID:  id,
+		Title:   title,
+		Content: content,
+		Author:  author,
+		Summary: summary,
+	})
+	if err != nil {
+		return err
+	}
+	span.SetAttributes(attribute.Int("revision", revision))
+
+	return tx.Commit(ctx)
+}
+
+// SetBlogStatus moves the blog to the status, publishAt is needed only for the scheduled one
+func (r *Repo) SetBlogStatus(ctx context.Context, id int, status Status, publishAt *time.Time) (err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "blogApi.SetBlogStatus")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+	span.SetAttributes(attribute.Int("id", id))
+	span.SetAttributes(attribute.String("status", string(status)))
+
+	if err := validateStatus(status, publishAt); err != nil {
+		return err
 	}
 
+	tag, err := r.db.Exec(
+		ctx,
+		`UPDATE blog SET status = $1, publish_at = $2 WHERE id = $3`,
+		string(status), publishAt, id,
+	)
+	if err != nil {
+		return fmt.Errorf("query: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrBlogNotFound
+	}
 	return nil
 }
 
+// PublishScheduled publishes the scheduled blogs with the publish_at time before now, and returns their ids
+func (r *Repo) PublishScheduled(ctx context.Context, now time.Time) (_ []int, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "blogApi.PublishScheduled")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	rows, err := r.db.Query(
+		ctx,
+		`
+			UPDATE blog SET status = $1
+			WHERE status = $2 AND publish_at <= $3
+			RETURNING id;
+		`,
+		string(StatusPublished), string(StatusScheduled), now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+
+	published, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("published", len(published)))
+	return published, nil
+}
+
 func (r *Repo) BlogClapped(ctx context.Context, id int) (err error) {
 	ctx, span := tracing.GlobalTracer.Start(ctx, "blogApi.BlogClapped")
 	defer func() {
@@ -152,7 +322,8 @@ func (r *Repo) DeleteBlog(ctx context.Context, id int) (err error) {
 	return nil
 }
 
-func (r *Repo) All(ctx context.Context) (_ []*Blog, err error) {
+// All returns all the blogs, or only the published ones with publishedOnly, the newest first
+func (r *Repo) All(ctx context.Context, publishedOnly bool) (_ []*Blog, err error) {
 	ctx, span := tracing.GlobalTracer.Start(ctx, "blogApi.All")
 	defer func() {
 		tracing.EndSpanWithErrCheck(span, err)
@@ -160,7 +331,8 @@ func (r *Repo) All(ctx context.Context) (_ []*Blog, err error) {
 
 	rows, err := r.db.Query(
 		ctx,
-		`SELECT * FROM blog ORDER BY id DESC;`,
+		`SELECT `+blogListColumns+` FROM `+blogListFrom+` WHERE `+blogListWhere+` ORDER BY blog.id DESC;`,
+		publishedOnly, "", "",
 	)
 	if err != nil {
 		return nil, fmt.Errorf("query: %w", err)
@@ -174,13 +346,17 @@ func (r *Repo) All(ctx context.Context) (_ []*Blog, err error) {
 	return r.rows2blogs(rows)
 }
 
-func (r *Repo) BlogsCount(ctx context.Context) (_ int, err error) {
+func (r *Repo) BlogsCount(ctx context.Context, filter ListFilter) (_ int, err error) {
 	ctx, span := tracing.GlobalTracer.Start(ctx, "blogApi.BlogsCount")
 	defer func() {
 		tracing.EndSpanWithErrCheck(span, err)
 	}()
 
-	rows, err := r.db.Query(ctx, `SELECT COUNT(*) FROM blog`)
+	rows, err := r.db.Query(
+		ctx,
+		`SELECT COUNT(*) FROM `+blogListFrom+` WHERE `+blogListWhere,
+		filter.PublishedOnly, filter.Tag, filter.Series,
+	)
 	if err != nil {
 		return -1, err
 	}
@@ -200,7 +376,9 @@ func (r *Repo) BlogsCount(ctx context.Context) (_ int, err error) {
 	return -1, errors.New("unexpected error, failed to get blogs count")
 }
 
-func (r *Repo) GetBlogsPage(ctx context.Context, page, size int) (_ []*Blog, err error) {
+// GetBlogsPage returns the page of the blogs matching the filter, the newest first,
+// or by their part if filtered by the series
+func (r *Repo) GetBlogsPage(ctx context.Context, page, size int, filter ListFilter) (_ []*Blog, err error) {
 	ctx, span := tracing.GlobalTracer.Start(ctx, "blogApi.GetBlogsPage")
 	defer func() {
 		tracing.EndSpanWithErrCheck(span, err)
@@ -208,19 +386,19 @@ func (r *Repo) GetBlogsPage(ctx context.Context, page, size int) (_ []*Blog, err
 
 	span.SetAttributes(attribute.Int("page", page))
 	span.SetAttributes(attribute.Int("size", size))
+	span.SetAttributes(attribute.String("tag", filter.Tag))
+	span.SetAttributes(attribute.String("series", filter.Series))
 
 	limit := size
 	offset := (page - 1) * size
-	blogsCount, err := r.BlogsCount(ctx)
+	blogsCount, err := r.BlogsCount(ctx, filter)
 	if err != nil {
 		return nil, err
 	}
 
 	if blogsCount <= limit {
-		return r.All(ctx)
-	}
-
-	if blogsCount-offset < limit {
+		offset = 0
+	} else if blogsCount-offset < limit {
 		offset = blogsCount - limit
 	}
 
@@ -229,11 +407,15 @@ func (r *Repo) GetBlogsPage(ctx context.Context, page, size int) (_ []*Blog, err
 	rows, err := r.db.Query(
 		ctx,
 		`
-			SELECT * FROM blog
-			ORDER BY id DESC
-			LIMIT $1
-			OFFSET $2;
+			SELECT `+blogListColumns+` FROM `+blogListFrom+`
+			WHERE `+blogListWhere+`
+			ORDER BY CASE WHEN $3 <> '' THEN blog.series_part END, blog.id DESC
+			LIMIT $4
+			OFFSET $5;
 		`,
+		filter.PublishedOnly,
+		filter.Tag,
+		filter.Series,
 		limit,
 		offset,
 	)
@@ -261,8 +443,13 @@ func (r *Repo) GetBlog(ctx context.Context, id int) (_ *Blog, err error) {
 	rows, err := r.db.Query(
 		ctx,
 		`
-			SELECT * FROM blog
-			WHERE id = $1;
+			SELECT
+				blog.id, blog.title, blog.created_at, blog.content, blog.claps, blog.content_html, blog.toc,
+				blog.reading_time, blog.render_version, blog.status, blog.publish_at,
+				ARRAY(SELECT tag FROM blog_tag WHERE blog_tag.blog_id = blog.id ORDER BY tag),
+				blog_series.slug, blog_series.title, blog.series_part
+			FROM `+blogListFrom+`
+			WHERE blog.id = $1;
 		`,
 		id,
 	)
@@ -287,16 +474,89 @@ func (r *Repo) GetBlog(ctx context.Context, id int) (_ *Blog, err error) {
 	var createdAt time.Time
 	var content string
 	var claps int
-	if err := rows.Scan(&blogId, &title, &createdAt, &content, &claps); err != nil {
+	var contentHTML *string
+	var toc []byte
+	var readingTime int
+	var renderVersion int
+	var status string
+	var publishAt *time.Time
+	var tags []string
+	var seriesSlug, seriesTitle *string
+	var seriesPart *int
+	if err := rows.Scan(
+		&blogId, &title, &createdAt, &content, &claps, &contentHTML, &toc, &readingTime, &renderVersion,
+		&status, &publishAt, &tags, &seriesSlug, &seriesTitle, &seriesPart,
+	); err != nil {
 		return nil, err
 	}
-	return &Blog{
-		ID:        blogId,
-		Title:     title,
-		CreatedAt: createdAt,
-		Content:   content,
-		Claps:     claps,
-	}, nil
+	rows.Close()
+
+	blog := &Blog{
+		ID:          blogId,
+		Title:       title,
+		CreatedAt:   createdAt,
+		Content:     content,
+		Claps:       claps,
+		ReadingTime: readingTime,
+		Status:      Status(status),
+		PublishAt:   publishAt,
+		Tags:        tags,
+		Series:      postSeries(seriesSlug, seriesTitle, seriesPart),
+	}
+
+	// posts added before the rendering, or rendered by an older version, are rendered now
+	if contentHTML == nil || renderVersion < RenderVersion {
+		if err := r.renderAndCache(ctx, blog); err != nil {
+			return nil, err
+		}
+	} else {
+		blog.ContentHTML = *contentHTML
+		if len(toc) > 0 {
+			if err := json.Unmarshal(toc, &blog.TOC); err != nil {
+				return nil, fmt.Errorf("invalid blog toc: %w", err)
+			}
+		}
+	}
+
+	if blog.Series != nil {
+		if err := r.setSeriesNeighbours(ctx, blog); err != nil {
+			return nil, err
+		}
+	}
+
+	return blog, nil
+}
+
+// renderAndCache renders the blog content and stores the result with it, failing to store it
+// is only logged, the post is rendered again the next time it is read
+func (r *Repo) renderAndCache(ctx context.Context, blog *Blog) (err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "blogApi.renderAndCache")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+	span.SetAttributes(attribute.Int("id", blog.ID))
+
+	rendered, err := r.renderer.Render(blog.Content)
+	if err != nil {
+		return err
+	}
+	blog.ContentHTML = rendered.HTML
+	blog.TOC = rendered.TOC
+	blog.ReadingTime = rendered.ReadingTime
+
+	toc, err := json.Marshal(rendered.TOC)
+	if err != nil {
+		return err
+	}
+	if _, err := r.db.Exec(
+		ctx,
+		`UPDATE blog SET content_html = $1, toc = $2, reading_time = $3, render_version = $4 WHERE id = $5`,
+		rendered.HTML, toc, rendered.ReadingTime, RenderVersion, blog.ID,
+	); err != nil {
+		log.Warnf("cache rendered blog %d: %s", blog.ID, err)
+	}
+
+	return nil
 }
 
 func (r *Repo) rows2blogs(rows pgx.Rows) ([]*Blog, error) {
@@ -307,16 +567,37 @@ func (r *Repo) rows2blogs(rows pgx.Rows) ([]*Blog, error) {
 		var createdAt time.Time
 		var content string
 		var claps int
-		if err := rows.Scan(&id, &title, &createdAt, &content, &claps); err != nil {
+		var readingTime int
+		var status string
+		var publishAt *time.Time
+		var tags []string
+		var seriesSlug, seriesTitle *string
+		var seriesPart *int
+		if err := rows.Scan(
+			&id, &title, &createdAt, &content, &claps, &readingTime, &status, &publishAt,
+			&tags, &seriesSlug, &seriesTitle, &seriesPart,
+		); err != nil {
 			return nil, err
 		}
 		blogs = append(blogs, &Blog{
-			ID:        id,
-			Title:     title,
-			CreatedAt: createdAt,
-			Content:   content,
-			Claps:     claps,
+			ID:          id,
+			Title:       title,
+			CreatedAt:   createdAt,
+			Content:     content,
+			Claps:       claps,
+			ReadingTime: readingTime,
+			Status:      Status(status),
+			PublishAt:   publishAt,
+			Tags:        tags,
+			Series:      postSeries(seriesSlug, seriesTitle, seriesPart),
 		})
 	}
 	return blogs, nil
 }
+
+func postSeries(slug, title *string, part *int) *PostSeries {
+	if slug == nil || title == nil || part == nil {
+		return nil
+	}
+	return &PostSeries{Slug: *slug, Title: *title, Part: *part}
+}
@@ -3,20 +3,31 @@ package blog
 import (
 	"context"
 	"errors"
+	"fmt"
+	"slices"
 	"sort"
 	"sync"
+	"time"
 )
 
 var _ blogRepo = (*repoMock)(nil)
 
 type repoMock struct {
 	Posts map[int]*Blog
-	mutex sync.Mutex
+	// blog revisions, the oldest first
+	Revisions map[int][]*Revision
+	// by slug
+	Series   map[string]*Series
+	mutex    sync.Mutex
+	renderer *Renderer
 }
 
 func newRepoMock() *repoMock {
 	return &repoMock{
-		Posts: make(map[int]*Blog),
+		Posts:     make(map[int]*Blog),
+		Revisions: make(map[int][]*Revision),
+		Series:    make(map[string]*Series),
+		renderer:  NewRenderer(),
 	}
 }
 
@@ -32,8 +43,21 @@ func (r *repoMock) GetBlog(_ context.Context, id int) (*Blog, error) {
 	if !found {
 		return nil, ErrBlogNotFound
 	}
+	if b.Series == nil {
+		return b, nil
+	}
 
-	return b, nil
+	var parts []SeriesLink
+	for _, part := range r.posts(ListFilter{PublishedOnly: true, Series: b.Series.Slug}) {
+		if part.ID != id {
+			parts = append(parts, SeriesLink{ID: part.ID, Title: part.Title, Part: part.Series.Part})
+		}
+	}
+	withSeries := *b
+	series := *b.Series
+	series.Previous, series.Next = seriesNeighbours(series.Part, parts)
+	withSeries.Series = &series
+	return &withSeries, nil
 }
 
 func (r *repoMock) AddBlog(_ context.Context, blog *Blog) error {
@@ -47,16 +71,58 @@ func (r *repoMock) AddBlog(_ context.Context, blog *Blog) error {
 	if _, ok := r.Posts[blog.ID]; ok {
 		return errors.New("blog exists already")
 	}
+	if blog.Status == "" {
+		blog.Status = StatusPublished
+	}
+	if err := validateStatus(blog.Status, blog.PublishAt); err != nil {
+		return err
+	}
+
+	rendered, err := r.renderer.Render(blog.Content)
+	if err != nil {
+		return err
+	}
+	blog.ContentHTML = rendered.HTML
+	blog.TOC = rendered.TOC
+	blog.ReadingTime = rendered.ReadingTime
 
 	r.Posts[blog.ID] = blog
+	r.addRevision(blog.ID, blog.Title, blog.Content, DefaultRevisionAuthor, "initial revision")
 	return nil
 }
 
-func (r *repoMock) UpdateBlog(_ context.Context, id int, title, content string) error {
+func (r *repoMock) UpdateBlog(_ context.Context, id int, title, content, author, summary string) error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
+	return r.updateBlog(id, title, content, author, summary)
+}
+
+func (r *repoMock) updateBlog(id int, title, content, author, summary string) error {
+	b, found := r.Posts[id]
+	if !found {
+		return ErrBlogNotFound
+	}
+
+	rendered, err := r.renderer.Render(content)
+	if err != nil {
+		return err
+	}
+
+	if b.Title != title || b.Content != content {
+		if author == "" {
+			author = DefaultRevisionAuthor
+		}
+		if summary == "" {
+			summary = revisionSummary(b.Title, b.Content, title, content)
+		}
+		r.addRevision(id, title, content, author, summary)
+	}
+
 	r.Posts[id].Title = title
 	r.Posts[id].Content = content
+	r.Posts[id].ContentHTML = rendered.HTML
+	r.Posts[id].TOC = rendered.TOC
+	r.Posts[id].ReadingTime = rendered.ReadingTime
 	return nil
 }
 
@@ -83,45 +149,126 @@ func (r *repoMock) DeleteBlog(_ context.Context, id int) error {
 	}
 
 	delete(r.Posts, id)
+	delete(r.Revisions, id)
 
 	return nil
 }
 
-func (r *repoMock) All(_ context.Context) ([]*Blog, error) {
+func (r *repoMock) GetRevisions(_ context.Context, blogID int) ([]*Revision, error) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
-	var blogs []*Blog
-	for id := range r.Posts {
-		blogs = append(blogs, r.Posts[id])
+
+	revisions := r.Revisions[blogID]
+	if len(revisions) == 0 {
+		return nil, ErrBlogNotFound
+	}
+
+	newestFirst := make([]*Revision, 0, len(revisions))
+	for i := len(revisions) - 1; i >= 0; i-- {
+		rev := *revisions[i]
+		rev.Content = ""
+		newestFirst = append(newestFirst, &rev)
 	}
-	return blogs, nil
+	return newestFirst, nil
 }
 
-func (r *repoMock) BlogsCount(_ context.Context) (int, error) {
+func (r *repoMock) GetRevision(_ context.Context, blogID, number int) (*Revision, error) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
-	return len(r.Posts), nil
+	return r.getRevision(blogID, number)
 }
 
-func (r *repoMock) GetBlogsPage(ctx context.Context, page, size int) ([]*Blog, error) {
+func (r *repoMock) getRevision(blogID, number int) (*Revision, error) {
+	revisions := r.Revisions[blogID]
+	if number < 1 || number > len(revisions) {
+		return nil, ErrRevisionNotFound
+	}
+	return revisions[number-1], nil
+}
+
+func (r *repoMock) RestoreRevision(_ context.Context, blogID, number int, author string) error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	if len(r.Posts) <= size {
-		return r.All(ctx)
+	rev, err := r.getRevision(blogID, number)
+	if err != nil {
+		return err
 	}
+	return r.updateBlog(blogID, rev.Title, rev.Content, author, fmt.Sprintf("restored revision %d", number))
+}
 
-	var allPosts []*Blog
-	for id := range r.Posts {
-		allPosts = append(allPosts, r.Posts[id])
+func (r *repoMock) addRevision(blogID int, title, content, author, summary string) {
+	r.Revisions[blogID] = append(r.Revisions[blogID], &Revision{
+		BlogID:    blogID,
+		Number:    len(r.Revisions[blogID]) + 1,
+		Title:     title,
+		Content:   content,
+		Author:    author,
+		Summary:   summary,
+		CreatedAt: time.Now(),
+	})
+}
+
+func (r *repoMock) SetBlogStatus(_ context.Context, id int, status Status, publishAt *time.Time) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := validateStatus(status, publishAt); err != nil {
+		return err
+	}
+	b, found := r.Posts[id]
+	if !found {
+		return ErrBlogNotFound
 	}
+	b.Status = status
+	b.PublishAt = publishAt
+	return nil
+}
+
+func (r *repoMock) PublishScheduled(_ context.Context, now time.Time) ([]int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var published []int
+	for id, b := range r.Posts {
+		if b.Status == StatusScheduled && !b.PublishAt.After(now) {
+			b.Status = StatusPublished
+			published = append(published, id)
+		}
+	}
+	sort.Ints(published)
+	return published, nil
+}
 
+func (r *repoMock) All(_ context.Context, publishedOnly bool) ([]*Blog, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.posts(ListFilter{PublishedOnly: publishedOnly}), nil
+}
+
+func (r *repoMock) BlogsCount(_ context.Context, filter ListFilter) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.posts(filter)), nil
+}
+
+func (r *repoMock) GetBlogsPage(_ context.Context, page, size int, filter ListFilter) ([]*Blog, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	allPosts := r.posts(filter)
 	sort.Slice(allPosts, func(i, j int) bool {
+		if filter.Series != "" {
+			return allPosts[i].Series.Part < allPosts[j].Series.Part
+		}
 		return allPosts[i].CreatedAt.Before(allPosts[j].CreatedAt)
 	})
+	if len(allPosts) <= size {
+		return allPosts, nil
+	}
 
 	startIndex := (page - 1) * size
-	endIndex := startIndex + size
+	endIndex := min(startIndex+size, len(allPosts))
 
 	// overflow
 	if startIndex >= len(allPosts) {
@@ -130,3 +277,142 @@ func (r *repoMock) GetBlogsPage(ctx context.Context, page, size int) ([]*Blog, e
 
 	return allPosts[startIndex:endIndex], nil
 }
+
+func (r *repoMock) GetFeedBlogs(_ context.Context, size int, tag string) ([]*Blog, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	posts := r.posts(ListFilter{PublishedOnly: true, Tag: tag})
+	sort.Slice(posts, func(i, j int) bool {
+		return publishedAt(posts[i]).After(publishedAt(posts[j]))
+	})
+	return posts[:min(size, len(posts))], nil
+}
+
+func (r *repoMock) SetBlogTags(_ context.Context, id int, tags []string) ([]string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	tags, err := normalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	b, found := r.Posts[id]
+	if !found {
+		return nil, ErrBlogNotFound
+	}
+	b.Tags = tags
+	return tags, nil
+}
+
+func (r *repoMock) TagCloud(_ context.Context, publishedOnly bool) ([]TagCount, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	counts := make(map[string]int)
+	for _, b := range r.posts(ListFilter{PublishedOnly: publishedOnly}) {
+		for _, tag := range b.Tags {
+			counts[tag]++
+		}
+	}
+
+	var tags []TagCount
+	for tag, count := range counts {
+		tags = append(tags, TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+	return tags, nil
+}
+
+func (r *repoMock) SaveSeries(_ context.Context, series *Series) (*Series, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := normalizeSeries(series); err != nil {
+		return nil, err
+	}
+	if existing, ok := r.Series[series.Slug]; ok {
+		existing.Title = series.Title
+	} else {
+		r.Series[series.Slug] = &Series{ID: len(r.Series) + 1, Slug: series.Slug, Title: series.Title}
+	}
+
+	saved := *r.Series[series.Slug]
+	saved.Parts = r.seriesParts(saved.Slug, false)
+	return &saved, nil
+}
+
+func (r *repoMock) GetSeries(_ context.Context, publishedOnly bool) ([]Series, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var allSeries []Series
+	for _, series := range r.Series {
+		s := *series
+		s.Parts = r.seriesParts(s.Slug, publishedOnly)
+		if publishedOnly && s.Parts == 0 {
+			continue
+		}
+		allSeries = append(allSeries, s)
+	}
+	sort.Slice(allSeries, func(i, j int) bool {
+		return allSeries[i].ID < allSeries[j].ID
+	})
+	return allSeries, nil
+}
+
+func (r *repoMock) SetBlogSeries(_ context.Context, id int, slug string, part int) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	b, found := r.Posts[id]
+	if !found {
+		return ErrBlogNotFound
+	}
+	if slug == "" {
+		b.Series = nil
+		return nil
+	}
+	if part < 1 {
+		return ErrInvalidSeriesPart
+	}
+	series, found := r.Series[slug]
+	if !found {
+		return ErrSeriesNotFound
+	}
+	for _, other := range r.posts(ListFilter{Series: slug}) {
+		if other.ID != id && other.Series.Part == part {
+			return ErrSeriesPartTaken
+		}
+	}
+
+	b.Series = &PostSeries{Slug: series.Slug, Title: series.Title, Part: part}
+	return nil
+}
+
+func (r *repoMock) seriesParts(slug string, publishedOnly bool) int {
+	return len(r.posts(ListFilter{PublishedOnly: publishedOnly, Series: slug}))
+}
+
+func (r *repoMock) posts(filter ListFilter) []*Blog {
+	var blogs []*Blog
+	for id := range r.Posts {
+		b := r.Posts[id]
+		if filter.PublishedOnly && !b.Status.Listed() {
+			continue
+		}
+		if filter.Tag != "" && !slices.Contains(b.Tags, filter.Tag) {
+			continue
+		}
+		if filter.Series != "" && (b.Series == nil || b.Series.Slug != filter.Series) {
+			continue
+		}
+		blogs = append(blogs, b)
+	}
+	return blogs
+}
@@ -48,7 +48,7 @@ func TestRepo_AddBlog_DeleteBlog(t *testing.T) {
 	repo, shutdown := testRepoSetup(t)
 	defer shutdown()
 
-	blogsCount, err := repo.BlogsCount(ctx)
+	blogsCount, err := repo.BlogsCount(ctx, ListFilter{})
 	require.NoError(t, err)
 
 	now := time.Now().Add(-time.Minute)
@@ -79,7 +79,7 @@ func TestRepo_AddBlog_DeleteBlog(t *testing.T) {
 	assert.True(t, now.Before(b2.CreatedAt), "%v should be before %v", now, b2.CreatedAt)
 	assert.True(t, now.Before(b2.CreatedAt), "%v should be before %v", now, b3.CreatedAt)
 
-	blogsCountAfter, err := repo.BlogsCount(ctx)
+	blogsCountAfter, err := repo.BlogsCount(ctx, ListFilter{})
 	require.NoError(t, err)
 	assert.Equal(t, 3+blogsCount, blogsCountAfter)
 
@@ -104,7 +104,7 @@ func TestRepo_UpdateBlog_BlogClapped(t *testing.T) {
 	err := repo.AddBlog(ctx, blog)
 	require.NoError(t, err)
 
-	require.NoError(t, repo.UpdateBlog(ctx, blog.ID, "newtitle", "newcontent"))
+	require.NoError(t, repo.UpdateBlog(ctx, blog.ID, "newtitle", "newcontent", "", ""))
 
 	updatedBlog, err := repo.GetBlog(ctx, blog.ID)
 	require.NoError(t, err)
@@ -132,7 +132,7 @@ func TestRepo_All(t *testing.T) {
 	repo, shutdown := testRepoSetup(t)
 	defer shutdown()
 
-	blogsCount, err := repo.BlogsCount(ctx)
+	blogsCount, err := repo.BlogsCount(ctx, ListFilter{})
 	require.NoError(t, err)
 
 	addedCount := 5
@@ -145,11 +145,11 @@ func TestRepo_All(t *testing.T) {
 		require.NoError(t, err)
 	}
 
-	blogsCountAfter, err := repo.BlogsCount(ctx)
+	blogsCountAfter, err := repo.BlogsCount(ctx, ListFilter{})
 	require.NoError(t, err)
 	assert.Equal(t, addedCount+blogsCount, blogsCountAfter)
 
-	allBlogs, err := repo.All(ctx)
+	allBlogs, err := repo.All(ctx, false)
 	require.NoError(t, err)
 	assert.True(t, len(allBlogs) >= addedCount)
 }
@@ -168,15 +168,266 @@ func TestRepo_GetBlogsPage(t *testing.T) {
 		require.NoError(t, repo.AddBlog(ctx, b))
 	}
 
-	blogs, err := repo.GetBlogsPage(ctx, 2, 2)
+	blogs, err := repo.GetBlogsPage(ctx, 2, 2, ListFilter{})
 	require.NoError(t, err)
 	assert.Len(t, blogs, 2)
 
-	blogs, err = repo.GetBlogsPage(ctx, 1, 1)
+	blogs, err = repo.GetBlogsPage(ctx, 1, 1, ListFilter{})
 	require.NoError(t, err)
 	assert.Len(t, blogs, 1)
 
-	blogs, err = repo.GetBlogsPage(ctx, 1, addedCount)
+	blogs, err = repo.GetBlogsPage(ctx, 1, addedCount, ListFilter{})
 	require.NoError(t, err)
 	assert.Len(t, blogs, addedCount)
 }
+
+func TestRepo_GetBlog_rendered(t *testing.T) {
+	ctx := context.Background()
+	repo, shutdown := testRepoSetup(t)
+	defer shutdown()
+
+	blog := &Blog{
+		Title:   "rendered",
+		Content: "# Title\n\nsome *text*",
+	}
+	require.NoError(t, repo.AddBlog(ctx, blog))
+
+	stored, err := repo.GetBlog(ctx, blog.ID)
+	require.NoError(t, err)
+	assert.Contains(t, stored.ContentHTML, "<em>text</em>")
+	assert.Equal(t, []TOCEntry{{Level: 1, ID: "title", Title: "Title"}}, stored.TOC)
+	assert.Equal(t, 1, stored.ReadingTime)
+
+	// rendered by an older version, rendered again when read
+	_, err = repo.db.Exec(ctx, `UPDATE blog SET content_html = 'stale', render_version = 0 WHERE id = $1`, blog.ID)
+	require.NoError(t, err)
+	stored, err = repo.GetBlog(ctx, blog.ID)
+	require.NoError(t, err)
+	assert.Contains(t, stored.ContentHTML, "<em>text</em>")
+
+	var renderVersion int
+	require.NoError(t, repo.db.QueryRow(ctx, `SELECT render_version FROM blog WHERE id = $1`, blog.ID).Scan(&renderVersion))
+	assert.Equal(t, RenderVersion, renderVersion)
+
+	require.NoError(t, repo.UpdateBlog(ctx, blog.ID, "rendered", "## Other", "", ""))
+	stored, err = repo.GetBlog(ctx, blog.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []TOCEntry{{Level: 2, ID: "other", Title: "Other"}}, stored.TOC)
+
+	require.NoError(t, repo.DeleteBlog(ctx, blog.ID))
+}
+
+func TestRepo_BlogStatus(t *testing.T) {
+	ctx := context.Background()
+	repo, shutdown := testRepoSetup(t)
+	defer shutdown()
+
+	publishedCount, err := repo.BlogsCount(ctx, ListFilter{PublishedOnly: true})
+	require.NoError(t, err)
+	allCount, err := repo.BlogsCount(ctx, ListFilter{})
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, repo.AddBlog(ctx, &Blog{Title: "s", Content: "s", Status: StatusScheduled}), ErrPublishAtMissing)
+
+	draft := &Blog{Title: "draft", Content: "draft", Status: StatusDraft}
+	require.NoError(t, repo.AddBlog(ctx, draft))
+	publishAt := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+	scheduled := &Blog{Title: "scheduled", Content: "scheduled", Status: StatusScheduled, PublishAt: &publishAt}
+	require.NoError(t, repo.AddBlog(ctx, scheduled))
+
+	count, err := repo.BlogsCount(ctx, ListFilter{PublishedOnly: true})
+	require.NoError(t, err)
+	assert.Equal(t, publishedCount, count)
+	count, err = repo.BlogsCount(ctx, ListFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, allCount+2, count)
+
+	stored, err := repo.GetBlog(ctx, scheduled.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusScheduled, stored.Status)
+	require.NotNil(t, stored.PublishAt)
+	assert.True(t, publishAt.Equal(*stored.PublishAt))
+
+	// not yet
+	published, err := repo.PublishScheduled(ctx, time.Now())
+	require.NoError(t, err)
+	assert.NotContains(t, published, scheduled.ID)
+
+	published, err = repo.PublishScheduled(ctx, publishAt)
+	require.NoError(t, err)
+	assert.Contains(t, published, scheduled.ID)
+	stored, err = repo.GetBlog(ctx, scheduled.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusPublished, stored.Status)
+
+	require.NoError(t, repo.SetBlogStatus(ctx, draft.ID, StatusUnlisted, nil))
+	assert.ErrorIs(t, repo.SetBlogStatus(ctx, draft.ID, StatusScheduled, nil), ErrPublishAtMissing)
+	assert.ErrorIs(t, repo.SetBlogStatus(ctx, 25342523, StatusDraft, nil), ErrBlogNotFound)
+
+	count, err = repo.BlogsCount(ctx, ListFilter{PublishedOnly: true})
+	require.NoError(t, err)
+	assert.Equal(t, publishedCount+1, count)
+
+	require.NoError(t, repo.DeleteBlog(ctx, draft.ID))
+	require.NoError(t, repo.DeleteBlog(ctx, scheduled.ID))
+}
+
+func TestRepo_Revisions(t *testing.T) {
+	ctx := context.Background()
+	repo, shutdown := testRepoSetup(t)
+	defer shutdown()
+
+	blog := &Blog{Title: "revised", Content: "first\nsecond"}
+	require.NoError(t, repo.AddBlog(ctx, blog))
+	defer func() {
+		require.NoError(t, repo.DeleteBlog(ctx, blog.ID))
+	}()
+
+	require.NoError(t, repo.UpdateBlog(ctx, blog.ID, "revised", "first\nsecond\nthird", "serj", "third line"))
+	// nothing changed, no new revision
+	require.NoError(t, repo.UpdateBlog(ctx, blog.ID, "revised", "first\nsecond\nthird", "serj", ""))
+	require.NoError(t, repo.UpdateBlog(ctx, blog.ID, "revised again", "first", "", ""))
+	assert.ErrorIs(t, repo.UpdateBlog(ctx, 25342523, "t", "c", "", ""), ErrBlogNotFound)
+
+	revisions, err := repo.GetRevisions(ctx, blog.ID)
+	require.NoError(t, err)
+	require.Len(t, revisions, 3)
+	assert.Equal(t, 3, revisions[0].Number)
+	assert.Equal(t, DefaultRevisionAuthor, revisions[0].Author)
+	assert.Equal(t, "title changed, content +0 -2 lines", revisions[0].Summary)
+	assert.Empty(t, revisions[0].Content)
+	assert.Equal(t, "serj", revisions[1].Author)
+	assert.Equal(t, "third line", revisions[1].Summary)
+	assert.Equal(t, 1, revisions[2].Number)
+
+	second, err := repo.GetRevision(ctx, blog.ID, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "first\nsecond\nthird", second.Content)
+	_, err = repo.GetRevision(ctx, blog.ID, 4)
+	assert.ErrorIs(t, err, ErrRevisionNotFound)
+
+	require.NoError(t, repo.RestoreRevision(ctx, blog.ID, 2, "serj"))
+	restored, err := repo.GetBlog(ctx, blog.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "revised", restored.Title)
+	assert.Equal(t, "first\nsecond\nthird", restored.Content)
+
+	latest, err := repo.GetRevision(ctx, blog.ID, 4)
+	require.NoError(t, err)
+	assert.Equal(t, "restored revision 2", latest.Summary)
+	assert.ErrorIs(t, repo.RestoreRevision(ctx, blog.ID, 10, ""), ErrRevisionNotFound)
+}
+
+func TestRepo_TagsAndSeries(t *testing.T) {
+	ctx := context.Background()
+	repo, shutdown := testRepoSetup(t)
+	defer shutdown()
+
+	tag := fmt.Sprintf("tag-%d", time.Now().UnixNano())
+	slug := fmt.Sprintf("series-%d", time.Now().UnixNano())
+
+	var blogs []*Blog
+	for i := 0; i < 3; i++ {
+		blog := &Blog{Title: fmt.Sprintf("part %d", i), Content: "content"}
+		require.NoError(t, repo.AddBlog(ctx, blog))
+		blogs = append(blogs, blog)
+	}
+	defer func() {
+		for _, blog := range blogs {
+			require.NoError(t, repo.DeleteBlog(ctx, blog.ID))
+		}
+		_, err := repo.db.Exec(ctx, `DELETE FROM blog_series WHERE slug = $1`, slug)
+		require.NoError(t, err)
+	}()
+
+	tags, err := repo.SetBlogTags(ctx, blogs[0].ID, []string{tag, "Go", "go"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go", tag}, tags)
+	_, err = repo.SetBlogTags(ctx, blogs[1].ID, []string{tag})
+	require.NoError(t, err)
+	_, err = repo.SetBlogTags(ctx, 25342523, []string{tag})
+	assert.ErrorIs(t, err, ErrBlogNotFound)
+
+	cloud, err := repo.TagCloud(ctx, true)
+	require.NoError(t, err)
+	assert.Contains(t, cloud, TagCount{Tag: tag, Count: 2})
+
+	count, err := repo.BlogsCount(ctx, ListFilter{PublishedOnly: true, Tag: tag})
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	series, err := repo.SaveSeries(ctx, &Series{Slug: slug, Title: "Series"})
+	require.NoError(t, err)
+	assert.Zero(t, series.Parts)
+
+	// added in the reverse order, listed by the parts
+	for i, blog := range blogs {
+		require.NoError(t, repo.SetBlogSeries(ctx, blog.ID, slug, len(blogs)-i))
+	}
+	assert.ErrorIs(t, repo.SetBlogSeries(ctx, blogs[0].ID, slug, 1), ErrSeriesPartTaken)
+	assert.ErrorIs(t, repo.SetBlogSeries(ctx, blogs[0].ID, "no-such-series", 1), ErrSeriesNotFound)
+
+	page, err := repo.GetBlogsPage(ctx, 1, 10, ListFilter{PublishedOnly: true, Series: slug})
+	require.NoError(t, err)
+	require.Len(t, page, 3)
+	assert.Equal(t, blogs[2].ID, page[0].ID)
+	assert.Equal(t, blogs[0].ID, page[2].ID)
+	assert.Equal(t, 1, page[0].Series.Part)
+
+	middle, err := repo.GetBlog(ctx, blogs[1].ID)
+	require.NoError(t, err)
+	require.NotNil(t, middle.Series)
+	assert.Equal(t, slug, middle.Series.Slug)
+	assert.Equal(t, 2, middle.Series.Part)
+	assert.Equal(t, &SeriesLink{ID: blogs[2].ID, Title: blogs[2].Title, Part: 1}, middle.Series.Previous)
+	assert.Equal(t, &SeriesLink{ID: blogs[0].ID, Title: blogs[0].Title, Part: 3}, middle.Series.Next)
+	assert.Equal(t, []string{tag}, middle.Tags)
+
+	require.NoError(t, repo.SetBlogSeries(ctx, blogs[0].ID, "", 0))
+	allSeries, err := repo.GetSeries(ctx, true)
+	require.NoError(t, err)
+	for _, s := range allSeries {
+		if s.Slug == slug {
+			assert.Equal(t, 2, s.Parts)
+		}
+	}
+}
+
+func TestRepo_GetFeedBlogs(t *testing.T) {
+	ctx := context.Background()
+	repo, shutdown := testRepoSetup(t)
+	defer shutdown()
+
+	tag := fmt.Sprintf("feed-%d", time.Now().UnixNano())
+	var blogs []*Blog
+	for i := 0; i < 3; i++ {
+		blog := &Blog{Title: fmt.Sprintf("feed %d", i), Content: fmt.Sprintf("feed **%d**", i)}
+		require.NoError(t, repo.AddBlog(ctx, blog))
+		_, err := repo.SetBlogTags(ctx, blog.ID, []string{tag})
+		require.NoError(t, err)
+		blogs = append(blogs, blog)
+	}
+	defer func() {
+		for _, blog := range blogs {
+			require.NoError(t, repo.DeleteBlog(ctx, blog.ID))
+		}
+	}()
+	require.NoError(t, repo.SetBlogStatus(ctx, blogs[2].ID, StatusDraft, nil))
+
+	// rendered before the cache existed
+	_, err := repo.db.Exec(ctx, `UPDATE blog SET content_html = NULL, render_version = 0 WHERE id = $1`, blogs[0].ID)
+	require.NoError(t, err)
+
+	feedBlogs, err := repo.GetFeedBlogs(ctx, 10, tag)
+	require.NoError(t, err)
+	require.Len(t, feedBlogs, 2)
+	assert.Equal(t, blogs[1].ID, feedBlogs[0].ID)
+	assert.Equal(t, "<p>feed <strong>1</strong></p>\n", feedBlogs[0].ContentHTML)
+	assert.Equal(t, blogs[0].ID, feedBlogs[1].ID)
+	assert.Equal(t, "<p>feed <strong>0</strong></p>\n", feedBlogs[1].ContentHTML)
+	assert.Equal(t, []string{tag}, feedBlogs[1].Tags)
+
+	var renderVersion int
+	require.NoError(t, repo.db.QueryRow(ctx, `SELECT render_version FROM blog WHERE id = $1`, blogs[0].ID).Scan(&renderVersion))
+	assert.Equal(t, RenderVersion, renderVersion)
+}
@@ -0,0 +1,112 @@
+package blog
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// DefaultRevisionAuthor is the author of the revisions made without one given, the only one
+// who can edit the blog
+const DefaultRevisionAuthor = "admin"
+
+var ErrRevisionNotFound = errors.New("blog revision not found")
+
+// Revision is an immutable version of a blog title and content, a new one is stored when the blog is
+// added and with each update that changes it. Number is the revision number within the blog, from 1
+type Revision struct {
+	BlogID    int       `json:"blog_id"`
+	Number    int       `json:"revision"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content,omitempty"` // not in the revisions list
+	Author    string    `json:"author"`
+	Summary   string    `json:"summary"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RevisionsDiff is the unified diff between two blog revisions, the title is compared as the first line
+type RevisionsDiff struct {
+	BlogID  int    `json:"blog_id"`
+	From    int    `json:"from"`
+	To      int    `json:"to"`
+	Added   int    `json:"added"`   // lines
+	Removed int    `json:"removed"` // lines
+	Diff    string `json:"diff"`
+}
+
+func DiffRevisions(from, to *Revision) (*RevisionsDiff, error) {
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(revisionText(from.Title, from.Content)),
+		B:        splitLines(revisionText(to.Title, to.Content)),
+		FromFile: fmt.Sprintf("revision %d", from.Number),
+		ToFile:   fmt.Sprintf("revision %d", to.Number),
+		Context:  3,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("diff revisions: %w", err)
+	}
+
+	added, removed := diffStats(diff)
+	return &RevisionsDiff{
+		BlogID:  to.BlogID,
+		From:    from.Number,
+		To:      to.Number,
+		Added:   added,
+		Removed: removed,
+		Diff:    diff,
+	}, nil
+}
+
+// revisionSummary describes the change from the old title and content to the new ones,
+// for the revisions stored without a summary given
+func revisionSummary(oldTitle, oldContent, newTitle, newContent string) string {
+	var changes []string
+	if oldTitle != newTitle {
+		changes = append(changes, "title changed")
+	}
+	if oldContent != newContent {
+		diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A: splitLines(oldContent),
+			B: splitLines(newContent),
+		})
+		added, removed := diffStats(diff)
+		changes = append(changes, fmt.Sprintf("content +%d -%d lines", added, removed))
+	}
+	return strings.Join(changes, ", ")
+}
+
+// splitLines splits the text into the lines for the diff, each ending with a newline
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return strings.SplitAfter(text, "\n")[:strings.Count(text, "\n")]
+}
+
+func revisionText(title, content string) string {
+	return "# " + title + "\n\n" + content
+}
+
+// diffStats counts the added and removed lines in the unified diff
+func diffStats(diff string) (added, removed int) {
+	// the ---/+++ header lines are before the first hunk
+	inHunk := false
+	for _, line := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			inHunk = true
+		case !inHunk:
+		case strings.HasPrefix(line, "+"):
+			added++
+		case strings.HasPrefix(line, "-"):
+			removed++
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,136 @@
+package blog
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/2beens/serjtubincom/pkg"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+func (handler *Handler) handleRevisions(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "error, id NaN", http.StatusBadRequest)
+		return
+	}
+
+	revisions, err := handler.repo.GetRevisions(r.Context(), id)
+	switch {
+	case errors.Is(err, ErrBlogNotFound):
+		http.Error(w, "blog not found", http.StatusNotFound)
+		return
+	case err != nil:
+		log.Errorf("get blog %d revisions: %s", id, err)
+		http.Error(w, "failed to get blog revisions", http.StatusInternalServerError)
+		return
+	}
+
+	pkg.SendJsonResponse(w, http.StatusOK, RevisionsResponse{Revisions: revisions})
+}
+
+func (handler *Handler) handleRevision(w http.ResponseWriter, r *http.Request) {
+	id, number, err := revisionFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	revision, err := handler.getRevision(w, r, id, number)
+	if err != nil {
+		return
+	}
+
+	pkg.SendJsonResponse(w, http.StatusOK, revision)
+}
+
+// handleRevisionsDiff returns the unified diff between the revisions ?from= and ?to= of the blog
+func (handler *Handler) handleRevisionsDiff(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "error, id NaN", http.StatusBadRequest)
+		return
+	}
+	from, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil {
+		http.Error(w, "error, invalid from revision", http.StatusBadRequest)
+		return
+	}
+	to, err := strconv.Atoi(r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, "error, invalid to revision", http.StatusBadRequest)
+		return
+	}
+
+	fromRevision, err := handler.getRevision(w, r, id, from)
+	if err != nil {
+		return
+	}
+	toRevision, err := handler.getRevision(w, r, id, to)
+	if err != nil {
+		return
+	}
+
+	diff, err := DiffRevisions(fromRevision, toRevision)
+	if err != nil {
+		log.Errorf("diff blog %d revisions %d and %d: %s", id, from, to, err)
+		http.Error(w, "failed to diff blog revisions", http.StatusInternalServerError)
+		return
+	}
+
+	pkg.SendJsonResponse(w, http.StatusOK, diff)
+}
+
+// handleRestoreRevision makes the old revision the current blog title and content, as a new revision
+// by the ?author= (optional)
+func (handler *Handler) handleRestoreRevision(w http.ResponseWriter, r *http.Request) {
+	id, number, err := revisionFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = handler.repo.RestoreRevision(r.Context(), id, number, r.URL.Query().Get("author"))
+	switch {
+	case errors.Is(err, ErrBlogNotFound), errors.Is(err, ErrRevisionNotFound):
+		http.Error(w, "blog revision not found", http.StatusNotFound)
+		return
+	case err != nil:
+		log.Errorf("restore blog %d revision %d: %s", id, number, err)
+		http.Error(w, "failed to restore blog revision", http.StatusInternalServerError)
+		return
+	}
+
+	pkg.WriteTextResponseOK(w, "restored:"+strconv.Itoa(number))
+}
+
+// getRevision gets the blog revision, or writes the error response
+func (handler *Handler) getRevision(w http.ResponseWriter, r *http.Request, id, number int) (*Revision, error) {
+	revision, err := handler.repo.GetRevision(r.Context(), id, number)
+	switch {
+	case errors.Is(err, ErrRevisionNotFound):
+		http.Error(w, "blog revision not found", http.StatusNotFound)
+		return nil, err
+	case err != nil:
+		log.Errorf("get blog %d revision %d: %s", id, number, err)
+		http.Error(w, "failed to get blog revision", http.StatusInternalServerError)
+		return nil, err
+	}
+	return revision, nil
+}
+
+func revisionFromRequest(r *http.Request) (id, number int, err error) {
+	vars := mux.Vars(r)
+	id, err = strconv.Atoi(vars["id"])
+	if err != nil {
+		return 0, 0, errors.New("error, id NaN")
+	}
+	number, err = strconv.Atoi(vars["revision"])
+	if err != nil {
+		return 0, 0, errors.New("error, revision NaN")
+	}
+	return id, number, nil
+}
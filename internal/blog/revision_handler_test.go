@@ -0,0 +1,94 @@
+package blog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redismock/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlogHandler_revisions(t *testing.T) {
+	redisClient, redisMock := redismock.NewClientMock()
+	repoMock, loginChecker := getRepoMockAndLoginChecker(t, redisClient)
+	r := setupBlogRouterForTests(t, repoMock, loginChecker)
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-SERJ-TOKEN", "mylittlesecret")
+		redisMock.ExpectGet("serj-service-session||mylittlesecret").SetVal(fmt.Sprintf("%d", time.Now().Unix()))
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := send("POST", "/blog/update", `{"id":2,"title":"blog2title","content":"blog 2 content\nmore","author":"serj","summary":"more"}`)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	rr = send("POST", "/blog/update", `{"id":2,"title":"oops","content":"gone"}`)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	rr = send("POST", "/blog/update", `{"id":200,"title":"t","content":"c"}`)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = send("GET", "/blog/revisions/2", "")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var revisionsResp RevisionsResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &revisionsResp))
+	require.Len(t, revisionsResp.Revisions, 3)
+	assert.Equal(t, 3, revisionsResp.Revisions[0].Number)
+	assert.Equal(t, "oops", revisionsResp.Revisions[0].Title)
+	assert.Equal(t, DefaultRevisionAuthor, revisionsResp.Revisions[0].Author)
+	assert.Equal(t, "title changed, content +1 -2 lines", revisionsResp.Revisions[0].Summary)
+	assert.Equal(t, "serj", revisionsResp.Revisions[1].Author)
+	assert.Equal(t, "more", revisionsResp.Revisions[1].Summary)
+	assert.Equal(t, http.StatusNotFound, send("GET", "/blog/revisions/200", "").Code)
+
+	rr = send("GET", "/blog/revisions/2/2", "")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var revision Revision
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &revision))
+	assert.Equal(t, "blog 2 content\nmore", revision.Content)
+	assert.Equal(t, http.StatusNotFound, send("GET", "/blog/revisions/2/7", "").Code)
+
+	rr = send("GET", "/blog/revisions/2/diff?from=2&to=3", "")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var diff RevisionsDiff
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &diff))
+	assert.Equal(t, 2, diff.Added)
+	assert.Equal(t, 3, diff.Removed)
+	assert.Contains(t, diff.Diff, "-more\n")
+	assert.Equal(t, http.StatusBadRequest, send("GET", "/blog/revisions/2/diff?from=2", "").Code)
+	assert.Equal(t, http.StatusNotFound, send("GET", "/blog/revisions/2/diff?from=2&to=9", "").Code)
+
+	// the lost paragraph is back, as a new revision
+	rr = send("POST", "/blog/revisions/2/2/restore?author=serj", "")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, "restored:2", rr.Body.String())
+	assert.Equal(t, "blog2title", repoMock.Posts[2].Title)
+	assert.Equal(t, "blog 2 content\nmore", repoMock.Posts[2].Content)
+	require.Len(t, repoMock.Revisions[2], 4)
+	assert.Equal(t, "restored revision 2", repoMock.Revisions[2][3].Summary)
+	assert.Equal(t, "serj", repoMock.Revisions[2][3].Author)
+	assert.Equal(t, http.StatusNotFound, send("POST", "/blog/revisions/2/9/restore", "").Code)
+}
+
+func TestBlogHandler_revisions_notLoggedIn(t *testing.T) {
+	redisClient, _ := redismock.NewClientMock()
+	repoMock, loginChecker := getRepoMockAndLoginChecker(t, redisClient)
+	r := setupBlogRouterForTests(t, repoMock, loginChecker)
+
+	for _, path := range []string{"/blog/revisions/2", "/blog/revisions/2/1", "/blog/revisions/2/diff?from=1&to=1"} {
+		req, err := http.NewRequest("GET", path, nil)
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code, path)
+	}
+}
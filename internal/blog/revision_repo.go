@@ -0,0 +1,115 @@
+package blog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/2beens/serjtubincom/internal/telemetry/tracing"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// GetRevisions returns the revisions of the blog without their content, the newest first
+func (r *Repo) GetRevisions(ctx context.Context, blogID int) (_ []*Revision, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "blogApi.GetRevisions")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+	span.SetAttributes(attribute.Int("id", blogID))
+
+	rows, err := r.db.Query(
+		ctx,
+		`
+			SELECT blog_id, revision, title, author, summary, created_at
+			FROM blog_revision
+			WHERE blog_id = $1
+			ORDER BY revision DESC;
+		`,
+		blogID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+
+	revisions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*Revision, error) {
+		var rev Revision
+		err := row.Scan(&rev.BlogID, &rev.Number, &rev.Title, &rev.Author, &rev.Summary, &rev.CreatedAt)
+		return &rev, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(revisions) == 0 {
+		return nil, ErrBlogNotFound
+	}
+
+	return revisions, nil
+}
+
+func (r *Repo) GetRevision(ctx context.Context, blogID, number int) (_ *Revision, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "blogApi.GetRevision")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+	span.SetAttributes(attribute.Int("id", blogID))
+	span.SetAttributes(attribute.Int("revision", number))
+
+	var rev Revision
+	err = r.db.QueryRow(
+		ctx,
+		`
+			SELECT blog_id, revision, title, content, author, summary, created_at
+			FROM blog_revision
+			WHERE blog_id = $1 AND revision = $2;
+		`,
+		blogID, number,
+	).Scan(&rev.BlogID, &rev.Number, &rev.Title, &rev.Content, &rev.Author, &rev.Summary, &rev.CreatedAt)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return nil, ErrRevisionNotFound
+	case err != nil:
+		return nil, fmt.Errorf("query: %w", err)
+	}
+
+	return &rev, nil
+}
+
+// RestoreRevision updates the blog to the title and the content of its old revision, which is stored
+// as the new revision, the revisions after the old one are kept
+func (r *Repo) RestoreRevision(ctx context.Context, blogID, number int, author string) (err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "blogApi.RestoreRevision")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+	span.SetAttributes(attribute.Int("id", blogID))
+	span.SetAttributes(attribute.Int("revision", number))
+
+	rev, err := r.GetRevision(ctx, blogID, number)
+	if err != nil {
+		return err
+	}
+
+	return r.UpdateBlog(ctx, blogID, rev.Title, rev.Content, author, fmt.Sprintf("restored revision %d", number))
+}
+
+// insertRevision stores the next revision of the blog, the blog row has to be locked by the transaction
+// (or be a new one), and returns its number
+func insertRevision(ctx context.Context, tx pgx.Tx, rev *Revision) (int, error) {
+	var number int
+	if err := tx.QueryRow(
+		ctx,
+		`
+			INSERT INTO blog_revision (blog_id, revision, title, content, author, summary)
+			SELECT $1, COALESCE(MAX(revision), 0) + 1, $2, $3, $4, $5
+			FROM blog_revision
+			WHERE blog_id = $1
+			RETURNING revision;
+		`,
+		rev.BlogID, rev.Title, rev.Content, rev.Author, rev.Summary,
+	).Scan(&number); err != nil {
+		return 0, fmt.Errorf("insert revision: %w", err)
+	}
+	return number, nil
+}
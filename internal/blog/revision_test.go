@@ -0,0 +1,45 @@
+package blog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffRevisions(t *testing.T) {
+	from := &Revision{BlogID: 3, Number: 1, Title: "Title", Content: "one\ntwo\nthree\n"}
+	to := &Revision{BlogID: 3, Number: 4, Title: "New title", Content: "one\n--- two\nthree\nfour\n"}
+
+	diff, err := DiffRevisions(from, to)
+	require.NoError(t, err)
+	assert.Equal(t, 3, diff.BlogID)
+	assert.Equal(t, 1, diff.From)
+	assert.Equal(t, 4, diff.To)
+	assert.Equal(t, 3, diff.Added)
+	assert.Equal(t, 2, diff.Removed)
+	assert.Equal(t, `--- revision 1
++++ revision 4
+@@ -1,5 +1,6 @@
+-# Title
++# New title
+ 
+ one
+-two
++--- two
+ three
++four
+`, diff.Diff)
+
+	same, err := DiffRevisions(from, from)
+	require.NoError(t, err)
+	assert.Empty(t, same.Diff)
+	assert.Zero(t, same.Added)
+	assert.Zero(t, same.Removed)
+}
+
+func TestRevisionSummary(t *testing.T) {
+	assert.Equal(t, "title changed", revisionSummary("a", "content", "b", "content"))
+	assert.Equal(t, "content +2 -1 lines", revisionSummary("a", "one\ntwo", "a", "one\n2\n3"))
+	assert.Equal(t, "title changed, content +1 -0 lines", revisionSummary("a", "one", "b", "one\ntwo"))
+}
@@ -0,0 +1,93 @@
+package blog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrInvalidStatus    = errors.New("invalid blog status")
+	ErrPublishAtMissing = errors.New("scheduled blog post needs publish_at")
+)
+
+// Status is the blog post lifecycle state
+type Status string
+
+const (
+	// StatusDraft posts are seen only by the admin
+	StatusDraft Status = "draft"
+	// StatusScheduled posts are published by RunScheduledPublisher once their publish_at time comes
+	StatusScheduled Status = "scheduled"
+	// StatusPublished posts are listed and seen by everyone
+	StatusPublished Status = "published"
+	// StatusUnlisted posts are seen by everyone with the link to them, but are not listed
+	StatusUnlisted Status = "unlisted"
+)
+
+// ParseStatus returns the status from its name, an empty one is published, as the posts
+// were before they had the status
+func ParseStatus(s string) (Status, error) {
+	switch status := Status(s); status {
+	case "":
+		return StatusPublished, nil
+	case StatusDraft, StatusScheduled, StatusPublished, StatusUnlisted:
+		return status, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrInvalidStatus, s)
+	}
+}
+
+// Listed reports whether the posts with the status are in the public posts lists
+func (s Status) Listed() bool {
+	return s == StatusPublished
+}
+
+// Visible reports whether the posts with the status are seen by the public, by their id
+func (s Status) Visible() bool {
+	return s == StatusPublished || s == StatusUnlisted
+}
+
+func validateStatus(status Status, publishAt *time.Time) error {
+	if _, err := ParseStatus(string(status)); err != nil {
+		return err
+	}
+	if status == StatusScheduled && publishAt == nil {
+		return ErrPublishAtMissing
+	}
+	return nil
+}
+
+type scheduledPublisher interface {
+	PublishScheduled(ctx context.Context, now time.Time) ([]int, error)
+}
+
+// RunScheduledPublisher publishes the scheduled blog posts with the publish_at time passed, every interval,
+// until the context is done
+func RunScheduledPublisher(ctx context.Context, publisher scheduledPublisher, interval time.Duration) {
+	if interval <= 0 {
+		log.Debugln("blog scheduled publisher disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		published, err := publisher.PublishScheduled(ctx, time.Now())
+		if err != nil {
+			log.Errorf("publish scheduled blog posts: %s", err)
+		} else if len(published) > 0 {
+			log.Infof("scheduled blog posts published: %v", published)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package blog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStatus(t *testing.T) {
+	status, err := ParseStatus("")
+	require.NoError(t, err)
+	assert.Equal(t, StatusPublished, status)
+
+	status, err = ParseStatus("unlisted")
+	require.NoError(t, err)
+	assert.Equal(t, StatusUnlisted, status)
+	assert.True(t, status.Visible())
+	assert.False(t, status.Listed())
+
+	_, err = ParseStatus("archived")
+	assert.ErrorIs(t, err, ErrInvalidStatus)
+}
+
+func TestRunScheduledPublisher(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	repo := newRepoMock()
+
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	require.NoError(t, repo.AddBlog(ctx, &Blog{ID: 1, Title: "a", Content: "a", Status: StatusScheduled, PublishAt: &past}))
+	require.NoError(t, repo.AddBlog(ctx, &Blog{ID: 2, Title: "b", Content: "b", Status: StatusScheduled, PublishAt: &future}))
+	require.NoError(t, repo.AddBlog(ctx, &Blog{ID: 3, Title: "c", Content: "c", Status: StatusDraft}))
+
+	done := make(chan struct{})
+	go func() {
+		RunScheduledPublisher(ctx, repo, time.Millisecond)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		count, _ := repo.BlogsCount(ctx, ListFilter{PublishedOnly: true})
+		return count == 1
+	}, time.Second, 5*time.Millisecond)
+	cancel()
+	<-done
+
+	assert.Equal(t, StatusPublished, repo.Posts[1].Status)
+	assert.Equal(t, StatusScheduled, repo.Posts[2].Status)
+	assert.Equal(t, StatusDraft, repo.Posts[3].Status)
+}
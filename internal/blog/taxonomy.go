@@ -0,0 +1,107 @@
+package blog
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const maxTagsPerBlog = 10
+
+var (
+	ErrInvalidTag        = errors.New("invalid blog tag")
+	ErrInvalidSeries     = errors.New("invalid blog series")
+	ErrSeriesNotFound    = errors.New("blog series not found")
+	ErrSeriesPartTaken   = errors.New("blog series part taken")
+	ErrInvalidSeriesPart = errors.New("invalid blog series part")
+)
+
+// tags and series slugs are lowercase words joined with dashes, e.g. "go", "home-lab"
+var slugRegex = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// ListFilter filters the blog posts lists, the empty Tag and Series match all the posts
+type ListFilter struct {
+	PublishedOnly bool
+	Tag           string
+	Series        string // series slug, the posts are ordered by their part then
+}
+
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// Series is an ordered multi-part group of blog posts, Parts is the number of the posts in it
+type Series struct {
+	ID    int    `json:"id"`
+	Slug  string `json:"slug"`
+	Title string `json:"title"`
+	Parts int    `json:"parts"`
+}
+
+// PostSeries is the series of a blog post, with the links to the previous and the next published
+// parts in the single post response
+type PostSeries struct {
+	Slug     string      `json:"slug"`
+	Title    string      `json:"title"`
+	Part     int         `json:"part"`
+	Previous *SeriesLink `json:"previous,omitempty"`
+	Next     *SeriesLink `json:"next,omitempty"`
+}
+
+type SeriesLink struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+	Part  int    `json:"part"`
+}
+
+// normalizeTags lowercases the tags, joins the words with dashes and removes the duplicates,
+// and returns them sorted
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.Join(strings.Fields(strings.ToLower(tag)), "-")
+		if len(tag) > 32 || !slugRegex.MatchString(tag) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidTag, tag)
+		}
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxTagsPerBlog {
+		return nil, fmt.Errorf("%w: more than %d tags", ErrInvalidTag, maxTagsPerBlog)
+	}
+
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+func normalizeSeries(series *Series) error {
+	series.Slug = strings.ToLower(strings.TrimSpace(series.Slug))
+	series.Title = strings.TrimSpace(series.Title)
+	if len(series.Slug) > 64 || !slugRegex.MatchString(series.Slug) {
+		return fmt.Errorf("%w: invalid slug %q", ErrInvalidSeries, series.Slug)
+	}
+	if series.Title == "" {
+		return fmt.Errorf("%w: title empty", ErrInvalidSeries)
+	}
+	return nil
+}
+
+// seriesNeighbours returns the parts just before and after the part, from the series parts
+func seriesNeighbours(part int, parts []SeriesLink) (previous, next *SeriesLink) {
+	for i := range parts {
+		switch {
+		case parts[i].Part < part && (previous == nil || parts[i].Part > previous.Part):
+			previous = &parts[i]
+		case parts[i].Part > part && (next == nil || parts[i].Part < next.Part):
+			next = &parts[i]
+		}
+	}
+	return previous, next
+}
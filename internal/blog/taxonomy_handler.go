@@ -0,0 +1,141 @@
+package blog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/2beens/serjtubincom/pkg"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type TagCloudResponse struct {
+	Tags []TagCount `json:"tags"`
+}
+
+type SeriesResponse struct {
+	Series []Series `json:"series"`
+}
+
+type blogTagsRequest struct {
+	ID   int      `json:"id"`
+	Tags []string `json:"tags"`
+}
+
+type newSeriesRequest struct {
+	Slug  string `json:"slug"`
+	Title string `json:"title"`
+}
+
+type blogSeriesRequest struct {
+	ID int `json:"id"`
+	// series slug, empty to take the blog out of its series
+	Series string `json:"series"`
+	Part   int    `json:"part"`
+}
+
+// handleTagCloud returns the tags with their blogs count, the most used first
+func (handler *Handler) handleTagCloud(w http.ResponseWriter, r *http.Request) {
+	tags, err := handler.repo.TagCloud(r.Context(), !handler.isAdmin(r))
+	if err != nil {
+		log.Errorf("get blog tag cloud: %s", err)
+		http.Error(w, "failed to get blog tags", http.StatusInternalServerError)
+		return
+	}
+
+	if tags == nil {
+		tags = []TagCount{}
+	}
+	pkg.SendJsonResponse(w, http.StatusOK, TagCloudResponse{Tags: tags})
+}
+
+// handleSetBlogTags replaces the blog tags, and returns them normalized
+func (handler *Handler) handleSetBlogTags(w http.ResponseWriter, r *http.Request) {
+	var tagsReq blogTagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&tagsReq); err != nil {
+		http.Error(w, "invalid blog tags json", http.StatusBadRequest)
+		return
+	}
+
+	tags, err := handler.repo.SetBlogTags(r.Context(), tagsReq.ID, tagsReq.Tags)
+	switch {
+	case errors.Is(err, ErrInvalidTag):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, ErrBlogNotFound):
+		http.Error(w, "blog not found", http.StatusNotFound)
+		return
+	case err != nil:
+		log.Errorf("set blog %d tags: %s", tagsReq.ID, err)
+		http.Error(w, "set blog tags failed", http.StatusInternalServerError)
+		return
+	}
+
+	pkg.SendJsonResponse(w, http.StatusOK, blogTagsRequest{ID: tagsReq.ID, Tags: tags})
+}
+
+func (handler *Handler) handleSeries(w http.ResponseWriter, r *http.Request) {
+	series, err := handler.repo.GetSeries(r.Context(), !handler.isAdmin(r))
+	if err != nil {
+		log.Errorf("get blog series: %s", err)
+		http.Error(w, "failed to get blog series", http.StatusInternalServerError)
+		return
+	}
+
+	if series == nil {
+		series = []Series{}
+	}
+	pkg.SendJsonResponse(w, http.StatusOK, SeriesResponse{Series: series})
+}
+
+// handleSaveSeries adds a series, or changes the title of the one with the same slug
+func (handler *Handler) handleSaveSeries(w http.ResponseWriter, r *http.Request) {
+	var seriesReq newSeriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&seriesReq); err != nil {
+		http.Error(w, "invalid blog series json", http.StatusBadRequest)
+		return
+	}
+
+	series, err := handler.repo.SaveSeries(r.Context(), &Series{Slug: seriesReq.Slug, Title: seriesReq.Title})
+	switch {
+	case errors.Is(err, ErrInvalidSeries):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Errorf("save blog series [%s]: %s", seriesReq.Slug, err)
+		http.Error(w, "save blog series failed", http.StatusInternalServerError)
+		return
+	}
+
+	pkg.SendJsonResponse(w, http.StatusOK, series)
+}
+
+// handleSetBlogSeries makes the blog the part of the series, or takes it out of its series
+func (handler *Handler) handleSetBlogSeries(w http.ResponseWriter, r *http.Request) {
+	var seriesReq blogSeriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&seriesReq); err != nil {
+		http.Error(w, "invalid blog series json", http.StatusBadRequest)
+		return
+	}
+
+	err := handler.repo.SetBlogSeries(r.Context(), seriesReq.ID, seriesReq.Series, seriesReq.Part)
+	switch {
+	case errors.Is(err, ErrInvalidSeriesPart):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, ErrSeriesPartTaken):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, ErrBlogNotFound), errors.Is(err, ErrSeriesNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		log.Errorf("set blog %d series [%s]: %s", seriesReq.ID, seriesReq.Series, err)
+		http.Error(w, "set blog series failed", http.StatusInternalServerError)
+		return
+	}
+
+	pkg.WriteTextResponseOK(w, fmt.Sprintf("updated:%d", seriesReq.ID))
+}
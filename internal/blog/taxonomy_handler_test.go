@@ -0,0 +1,119 @@
+package blog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redismock/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlogHandler_tagsAndSeries(t *testing.T) {
+	redisClient, redisMock := redismock.NewClientMock()
+	repoMock, loginChecker := getRepoMockAndLoginChecker(t, redisClient)
+	r := setupBlogRouterForTests(t, repoMock, loginChecker)
+
+	send := func(method, path, body string, admin bool) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		if admin {
+			req.Header.Set("X-SERJ-TOKEN", "mylittlesecret")
+			redisMock.ExpectGet("serj-service-session||mylittlesecret").SetVal(fmt.Sprintf("%d", time.Now().Unix()))
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := send("POST", "/blog/update/tags", `{"id":1,"tags":["Go","home lab"]}`, true)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.JSONEq(t, `{"id":1,"tags":["go","home-lab"]}`, rr.Body.String())
+	rr = send("POST", "/blog/update/tags", `{"id":2,"tags":["go"]}`, true)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Equal(t, http.StatusBadRequest, send("POST", "/blog/update/tags", `{"id":3,"tags":["c++"]}`, true).Code)
+	assert.Equal(t, http.StatusNotFound, send("POST", "/blog/update/tags", `{"id":300,"tags":["go"]}`, true).Code)
+
+	rr = send("GET", "/blog/tags", "", false)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var tagsResp TagCloudResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &tagsResp))
+	assert.Equal(t, []TagCount{{Tag: "go", Count: 2}, {Tag: "home-lab", Count: 1}}, tagsResp.Tags)
+
+	rr = send("GET", "/blog/page/1/size/10?tag=Go", "", false)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var postsResp PostsResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &postsResp))
+	assert.Equal(t, 2, postsResp.Total)
+	require.Len(t, postsResp.Posts, 2)
+
+	rr = send("POST", "/blog/series/new", `{"slug":"home-lab","title":"Home lab"}`, true)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var series Series
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &series))
+	assert.Equal(t, "home-lab", series.Slug)
+	assert.Zero(t, series.Parts)
+	assert.Equal(t, http.StatusBadRequest, send("POST", "/blog/series/new", `{"slug":"home lab","title":"x"}`, true).Code)
+
+	// the empty series are not there for the public
+	rr = send("GET", "/blog/series", "", false)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.JSONEq(t, `{"series":[]}`, rr.Body.String())
+
+	for id, part := range map[int]int{4: 1, 1: 2, 3: 3} {
+		rr = send("POST", "/blog/update/series", fmt.Sprintf(`{"id":%d,"series":"home-lab","part":%d}`, id, part), true)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	}
+	assert.Equal(t, http.StatusConflict, send("POST", "/blog/update/series", `{"id":2,"series":"home-lab","part":3}`, true).Code)
+	assert.Equal(t, http.StatusBadRequest, send("POST", "/blog/update/series", `{"id":2,"series":"home-lab","part":0}`, true).Code)
+	assert.Equal(t, http.StatusNotFound, send("POST", "/blog/update/series", `{"id":2,"series":"nope","part":4}`, true).Code)
+
+	rr = send("GET", "/blog/series", "", false)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var seriesResp SeriesResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &seriesResp))
+	require.Len(t, seriesResp.Series, 1)
+	assert.Equal(t, 3, seriesResp.Series[0].Parts)
+
+	// the series posts are listed by their part
+	rr = send("GET", "/blog/page/1/size/10?series=home-lab", "", false)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	postsResp = PostsResponse{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &postsResp))
+	assert.Equal(t, 3, postsResp.Total)
+	require.Len(t, postsResp.Posts, 3)
+	assert.Equal(t, 4, postsResp.Posts[0].ID)
+	assert.Equal(t, 1, postsResp.Posts[1].ID)
+	assert.Equal(t, 3, postsResp.Posts[2].ID)
+
+	rr = send("GET", "/blog/post/1", "", false)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var blog Blog
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &blog))
+	require.NotNil(t, blog.Series)
+	assert.Equal(t, 2, blog.Series.Part)
+	assert.Equal(t, &SeriesLink{ID: 4, Title: "blog4title", Part: 1}, blog.Series.Previous)
+	assert.Equal(t, &SeriesLink{ID: 3, Title: "blog3title", Part: 3}, blog.Series.Next)
+
+	// the drafts are skipped in the series links
+	rr = send("POST", "/blog/status", `{"id":3,"status":"draft"}`, true)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	blog = Blog{}
+	rr = send("GET", "/blog/post/1", "", false)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &blog))
+	assert.Nil(t, blog.Series.Next)
+
+	rr = send("POST", "/blog/update/series", `{"id":1,"series":""}`, true)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.Nil(t, repoMock.Posts[1].Series)
+
+	assert.Equal(t, http.StatusUnauthorized, send("POST", "/blog/update/tags", `{"id":1,"tags":["go"]}`, false).Code)
+	assert.Equal(t, http.StatusUnauthorized, send("POST", "/blog/series/new", `{"slug":"x","title":"x"}`, false).Code)
+	assert.Equal(t, http.StatusUnauthorized, send("POST", "/blog/update/series", `{"id":1,"series":""}`, false).Code)
+}
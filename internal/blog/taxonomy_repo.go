@@ -0,0 +1,221 @@
+package blog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/2beens/serjtubincom/internal/telemetry/tracing"
+	"github.com/2beens/serjtubincom/pkg"
+
+	"github.com/jackc/pgx/v5"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// SetBlogTags replaces the tags of the blog, and returns them normalized
+func (r *Repo) SetBlogTags(ctx context.Context, id int, tags []string) (_ []string, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "blogApi.SetBlogTags")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+	span.SetAttributes(attribute.Int("id", id))
+
+	tags, err = normalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			log.Errorf("set blog %d tags, rollback: %s", id, err)
+		}
+	}()
+
+	// locked, so the concurrent changes of the blog tags don't mix
+	err = tx.QueryRow(ctx, `SELECT id FROM blog WHERE id = $1 FOR UPDATE`, id).Scan(&id)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return nil, ErrBlogNotFound
+	case err != nil:
+		return nil, fmt.Errorf("query: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM blog_tag WHERE blog_id = $1`, id); err != nil {
+		return nil, fmt.Errorf("delete tags: %w", err)
+	}
+	if _, err := tx.Exec(
+		ctx,
+		`INSERT INTO blog_tag (blog_id, tag) SELECT $1, unnest($2::text[])`,
+		id, tags,
+	); err != nil {
+		return nil, fmt.Errorf("insert tags: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// TagCloud returns the tags with the number of the blogs with them, the most used first
+func (r *Repo) TagCloud(ctx context.Context, publishedOnly bool) (_ []TagCount, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "blogApi.TagCloud")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	rows, err := r.db.Query(
+		ctx,
+		`
+			SELECT blog_tag.tag, COUNT(*)
+			FROM blog_tag JOIN blog ON blog.id = blog_tag.blog_id
+			WHERE (NOT $1 OR blog.status = 'published')
+			GROUP BY blog_tag.tag
+			ORDER BY COUNT(*) DESC, blog_tag.tag;
+		`,
+		publishedOnly,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (TagCount, error) {
+		var tc TagCount
+		err := row.Scan(&tc.Tag, &tc.Count)
+		return tc, err
+	})
+}
+
+// SaveSeries adds the series, or changes the title of the existing one with the same slug
+func (r *Repo) SaveSeries(ctx context.Context, series *Series) (_ *Series, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "blogApi.SaveSeries")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	if err := normalizeSeries(series); err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.String("series", series.Slug))
+
+	saved := *series
+	if err := r.db.QueryRow(
+		ctx,
+		`
+			INSERT INTO blog_series (slug, title)
+			VALUES ($1, $2)
+			ON CONFLICT (slug) DO UPDATE SET title = EXCLUDED.title
+			RETURNING id, (SELECT COUNT(*) FROM blog WHERE blog.series_id = blog_series.id);
+		`,
+		series.Slug, series.Title,
+	).Scan(&saved.ID, &saved.Parts); err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+
+	return &saved, nil
+}
+
+// GetSeries returns all the series with their number of parts, the ones without any
+// (published, with publishedOnly) are left out then
+func (r *Repo) GetSeries(ctx context.Context, publishedOnly bool) (_ []Series, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "blogApi.GetSeries")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	rows, err := r.db.Query(
+		ctx,
+		`
+			SELECT blog_series.id, blog_series.slug, blog_series.title, COUNT(blog.id)
+			FROM blog_series
+			LEFT JOIN blog ON blog.series_id = blog_series.id AND (NOT $1 OR blog.status = 'published')
+			GROUP BY blog_series.id
+			HAVING NOT $1 OR COUNT(blog.id) > 0
+			ORDER BY blog_series.id;
+		`,
+		publishedOnly,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Series, error) {
+		var series Series
+		err := row.Scan(&series.ID, &series.Slug, &series.Title, &series.Parts)
+		return series, err
+	})
+}
+
+// SetBlogSeries makes the blog the part of the series, or takes it out of its series with the empty slug
+func (r *Repo) SetBlogSeries(ctx context.Context, id int, slug string, part int) (err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "blogApi.SetBlogSeries")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+	span.SetAttributes(attribute.Int("id", id))
+	span.SetAttributes(attribute.String("series", slug))
+	span.SetAttributes(attribute.Int("part", part))
+
+	var seriesID *int
+	var seriesPart *int
+	if slug != "" {
+		if part < 1 {
+			return ErrInvalidSeriesPart
+		}
+		var sid int
+		err := r.db.QueryRow(ctx, `SELECT id FROM blog_series WHERE slug = $1`, slug).Scan(&sid)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return ErrSeriesNotFound
+		case err != nil:
+			return fmt.Errorf("query: %w", err)
+		}
+		seriesID, seriesPart = &sid, &part
+	}
+
+	tag, err := r.db.Exec(ctx, `UPDATE blog SET series_id = $1, series_part = $2 WHERE id = $3`, seriesID, seriesPart, id)
+	switch {
+	case pkg.IsUniqueViolationError(err):
+		return ErrSeriesPartTaken
+	case err != nil:
+		return fmt.Errorf("query: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrBlogNotFound
+	}
+	return nil
+}
+
+// setSeriesNeighbours sets the previous and the next published parts of the blog series
+func (r *Repo) setSeriesNeighbours(ctx context.Context, blog *Blog) error {
+	rows, err := r.db.Query(
+		ctx,
+		`
+			SELECT part.id, part.title, part.series_part
+			FROM blog JOIN blog part ON part.series_id = blog.series_id
+			WHERE blog.id = $1 AND part.id <> blog.id AND part.status = 'published'
+			ORDER BY part.series_part;
+		`,
+		blog.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("query series parts: %w", err)
+	}
+
+	parts, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (SeriesLink, error) {
+		var link SeriesLink
+		err := row.Scan(&link.ID, &link.Title, &link.Part)
+		return link, err
+	})
+	if err != nil {
+		return err
+	}
+
+	blog.Series.Previous, blog.Series.Next = seriesNeighbours(blog.Series.Part, parts)
+	return nil
+}
@@ -0,0 +1,63 @@
+package blog
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tags, err := normalizeTags([]string{"Go", " home lab ", "go", "postgres"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go", "home-lab", "postgres"}, tags)
+
+	tags, err = normalizeTags(nil)
+	require.NoError(t, err)
+	assert.Empty(t, tags)
+
+	for _, invalid := range []string{"", "c++", "-go", "a-very-long-tag-name-with-many-words"} {
+		_, err = normalizeTags([]string{invalid})
+		assert.ErrorIs(t, err, ErrInvalidTag, invalid)
+	}
+
+	tooMany := make([]string, maxTagsPerBlog+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("tag%d", i)
+	}
+	_, err = normalizeTags(tooMany)
+	assert.ErrorIs(t, err, ErrInvalidTag)
+}
+
+func TestNormalizeSeries(t *testing.T) {
+	series := &Series{Slug: " Home-Lab ", Title: " Building a home lab "}
+	require.NoError(t, normalizeSeries(series))
+	assert.Equal(t, "home-lab", series.Slug)
+	assert.Equal(t, "Building a home lab", series.Title)
+
+	assert.ErrorIs(t, normalizeSeries(&Series{Slug: "home lab", Title: "title"}), ErrInvalidSeries)
+	assert.ErrorIs(t, normalizeSeries(&Series{Slug: "home-lab", Title: " "}), ErrInvalidSeries)
+}
+
+func TestSeriesNeighbours(t *testing.T) {
+	parts := []SeriesLink{
+		{ID: 7, Part: 4},
+		{ID: 3, Part: 1},
+		{ID: 5, Part: 2},
+	}
+
+	previous, next := seriesNeighbours(3, parts)
+	require.NotNil(t, previous)
+	require.NotNil(t, next)
+	assert.Equal(t, 5, previous.ID)
+	assert.Equal(t, 7, next.ID)
+
+	previous, next = seriesNeighbours(1, parts[:1])
+	assert.Nil(t, previous)
+	assert.Equal(t, 7, next.ID)
+
+	previous, next = seriesNeighbours(5, parts)
+	assert.Equal(t, 7, previous.ID)
+	assert.Nil(t, next)
+}
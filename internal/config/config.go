@@ -19,6 +19,51 @@ type Config struct {
 	// netlog backup
 	NetlogUnixSocketAddrDir  string `toml:"netlog_unix_socket_addr_dir"`
 	NetlogUnixSocketFileName string `toml:"netlog_unix_socket_file_name"`
+	// netlog backup target: gdrive (default), local or s3
+	NetlogBackupTarget      string `toml:"netlog_backup_target"`
+	NetlogBackupLocalDir    string `toml:"netlog_backup_local_dir"`
+	NetlogBackupGDFolder    string `toml:"netlog_backup_gd_folder"`
+	NetlogBackupGDShareWith string `toml:"netlog_backup_gd_share_with"`
+	NetlogBackupS3Endpoint  string `toml:"netlog_backup_s3_endpoint"`
+	NetlogBackupS3Bucket    string `toml:"netlog_backup_s3_bucket"`
+	NetlogBackupS3Prefix    string `toml:"netlog_backup_s3_prefix"`
+	NetlogBackupS3UseSSL    bool   `toml:"netlog_backup_s3_use_ssl"`
+	NetlogBackupS3AccessKey string // loaded from env. var.
+	NetlogBackupS3SecretKey string // loaded from env. var.
+	// netlog backup chunks compression: none (empty), gzip or zstd, and the AES-256 key file for the encryption
+	NetlogBackupCompression string `toml:"netlog_backup_compression"`
+	NetlogBackupKeyFile     string `toml:"netlog_backup_key_file"`
+	// number of backup chunks uploaded in parallel, 0 for the default
+	NetlogBackupUploadWorkers int `toml:"netlog_backup_upload_workers"`
+	// backup retention, nothing is pruned if all keep_* are 0, see netlog.BackupRetentionPolicy
+	NetlogBackupKeepLast      int `toml:"netlog_backup_keep_last"`
+	NetlogBackupKeepDaily     int `toml:"netlog_backup_keep_daily"`
+	NetlogBackupKeepWeekly    int `toml:"netlog_backup_keep_weekly"`
+	NetlogBackupKeepMonthly   int `toml:"netlog_backup_keep_monthly"`
+	NetlogBackupFullEveryDays int `toml:"netlog_backup_full_every_days"`
+	// errors are logged (and sent to sentry) when there is no successful backup in that many days, 0 disables it
+	NetlogBackupAlertAfterDays int `toml:"netlog_backup_alert_after_days"`
+	// netlog sessions: a pause between two visits longer than this starts a new session
+	NetlogSessionIdleGapMinutes int `toml:"netlog_session_idle_gap_minutes"`
+	// netlog privacy rules applied to the new visits, see netlog.RedactionRules, reloaded on SIGHUP
+	NetlogRedactDropHosts         []string `toml:"netlog_redact_drop_hosts"`
+	NetlogRedactStripQueryParams  []string `toml:"netlog_redact_strip_query_params"`
+	NetlogRedactHashPathHosts     []string `toml:"netlog_redact_hash_path_hosts"`
+	NetlogRedactTruncatePathHosts []string `toml:"netlog_redact_truncate_path_hosts"`
+	// netlog live stream fan-out over redis pub/sub, so the stream works with more than one service instance
+	NetlogStreamOverRedis bool `toml:"netlog_stream_over_redis"`
+	// netlog visit monthly partitions, created that many months ahead by the service, 0 disables it
+	NetlogPartitionsAheadMonths int `toml:"netlog_partitions_ahead_months"`
+	// the partitions older than that many months are archived by cmd/netlog_partitions, 0 keeps them all
+	NetlogArchiveAfterMonths int    `toml:"netlog_archive_after_months"`
+	NetlogArchiveDir         string `toml:"netlog_archive_dir"`
+	// netlog focus reports of the current and the previous day and week are rebuilt that often, 0 disables it
+	NetlogFocusReportsIntervalMinutes int `toml:"netlog_focus_reports_interval_minutes"`
+	// blog scheduled posts are checked and published that often, 0 disables it
+	BlogPublisherIntervalSeconds int `toml:"blog_publisher_interval_seconds"`
+	// blog feeds links: the website with the blog posts, and this service as reached from outside
+	BlogSiteURL  string `toml:"blog_site_url"`
+	BlogFeedsURL string `toml:"blog_feeds_url"`
 	// prometheus metrics
 	PrometheusMetricsPort string `toml:"prometheus_metrics_port"`
 	PrometheusMetricsHost string `toml:"prometheus_metrics_host"`
@@ -94,5 +139,8 @@ func Load(env, path string) (*Config, error) {
 		cfg.MCPSecret = v
 	}
 
+	cfg.NetlogBackupS3AccessKey = os.Getenv("NETLOG_BACKUP_S3_ACCESS_KEY")
+	cfg.NetlogBackupS3SecretKey = os.Getenv("NETLOG_BACKUP_S3_SECRET_KEY")
+
 	return cfg, nil
 }
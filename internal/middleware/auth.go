@@ -42,8 +42,14 @@ func NewAuthMiddlewareHandler(
 		loginChecker:          loginChecker,
 		allowedPaths: map[string]bool{
 			// blog handler:
-			"/blog/all":  true,
-			"/blog/clap": true,
+			"/blog/all":    true,
+			"/blog/clap":   true,
+			"/blog/tags":   true,
+			"/blog/series": true,
+			// blog feeds, for the feed readers
+			"/blog/feed.rss":  true,
+			"/blog/feed.atom": true,
+			"/blog/feed.json": true,
 
 			// misc handler:
 			"/":             true,
@@ -143,10 +149,10 @@ func (h *AuthMiddlewareHandler) AuthCheck() func(next http.Handler) http.Handler
 			}
 
 			// requests coming from browser extension
-			if strings.HasPrefix(r.URL.Path, "/netlog/new") {
+			if strings.HasPrefix(r.URL.Path, "/netlog/new") || strings.HasPrefix(r.URL.Path, "/netlog/batch") {
 				if h.browserRequestsSecret != authToken {
 					reqIp, _ := pkg.ReadUserIP(r)
-					log.Errorf("unauthorized /netlog/new request detected from %s, authToken: %s", reqIp, authToken)
+					log.Errorf("unauthorized %s request detected from %s, authToken: %s", r.URL.Path, reqIp, authToken)
 					// fool the "attacker" by a fake positive response
 					pkg.WriteTextResponseOK(w, "added")
 					span.SetStatus(codes.Error, "decoy-sent")
@@ -38,6 +38,12 @@ func TestAuthMiddlewareHandler_AuthCheck(t *testing.T) {
 			method:             "GET",
 			expectedStatusCode: http.StatusOK,
 		},
+		{
+			name:               "BlogFeedWithoutToken",
+			path:               "/blog/feed.atom",
+			method:             "GET",
+			expectedStatusCode: http.StatusOK,
+		},
 		{
 			name:               "NotAllowedPathWithoutToken",
 			path:               "/admin/panel",
@@ -74,6 +80,20 @@ func TestAuthMiddlewareHandler_AuthCheck(t *testing.T) {
 			token:              "invalid-token",
 			expectedStatusCode: http.StatusOK, // Response is OK, but it's a decoy.
 		},
+		{
+			name:               "BrowserExtensionBatchRequestValidToken",
+			path:               "/netlog/batch",
+			method:             "POST",
+			token:              "browserRequestsSecret",
+			expectedStatusCode: http.StatusOK,
+		},
+		{
+			name:               "BrowserExtensionBatchRequestInvalidToken",
+			path:               "/netlog/batch",
+			method:             "POST",
+			token:              "invalid-token",
+			expectedStatusCode: http.StatusOK, // Response is OK, but it's a decoy.
+		},
 		{
 			name:               "GymStatsAgentValidToken",
 			path:               "/gymstats/some-resource",
@@ -47,3 +47,8 @@ func (r *responseWriter) WriteHeader(statusCode int) {
 	r.ResponseWriter.WriteHeader(statusCode)
 	r.statusCode = statusCode
 }
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush the streamed responses
+func (r *responseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
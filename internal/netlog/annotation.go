@@ -0,0 +1,108 @@
+package netlog
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	maxAnnotationTags      = 20
+	maxAnnotationTagLength = 50
+	maxAnnotationNoteLen   = 10000
+)
+
+var (
+	ErrVisitNotFound           = errors.New("visit not found")
+	ErrVisitAnnotationNotFound = errors.New("visit annotation not found")
+	ErrInvalidVisitAnnotation  = errors.New("invalid visit annotation")
+)
+
+// VisitAnnotation makes a bookmark out of a visit: it can be starred, tagged, noted, and put in the
+// read later queue, which it leaves once the same (canonical) url is visited again
+type VisitAnnotation struct {
+	Starred bool     `json:"starred"`
+	Tags    []string `json:"tags"`
+	Note    string   `json:"note"`
+	// ReadLater is true while the visit is in the read later queue
+	ReadLater bool `json:"read_later"`
+	// ReadLaterAt is when the visit was put in the read later queue, kept after it leaves the queue
+	ReadLaterAt *time.Time `json:"read_later_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+type TagCount struct {
+	Tag    string `json:"tag"`
+	Visits int    `json:"visits"`
+}
+
+// AnnotatedVisitsList is one of the lists of the annotated visits
+type AnnotatedVisitsList string
+
+const (
+	// AnnotatedListAll lists all the annotated visits, the last changed first
+	AnnotatedListAll AnnotatedVisitsList = "all"
+	// AnnotatedListReadLater lists the visits in the read later queue, the first added first
+	AnnotatedListReadLater AnnotatedVisitsList = "read-later"
+)
+
+// readLaterPendingSQL is the SQL condition telling if the annotation (with the given table alias) is still
+// in the read later queue, i.e. its url was not visited again since it was put in the queue
+func readLaterPendingSQL(alias string) string {
+	return fmt.Sprintf(
+		`(%[1]s.read_later_at IS NOT NULL AND NOT EXISTS (
+			SELECT 1 FROM netlog.visit lv
+			WHERE lv.canonical_url = %[1]s.read_later_url AND lv.timestamp > %[1]s.read_later_at
+		))`,
+		alias,
+	)
+}
+
+// normalizeAnnotation trims the note, and lowercases, dedupes and sorts the tags, so the same tag
+// is always stored the same way
+func normalizeAnnotation(annotation *VisitAnnotation) error {
+	annotation.Note = strings.TrimSpace(annotation.Note)
+	if utf8.RuneCountInString(annotation.Note) > maxAnnotationNoteLen {
+		return fmt.Errorf("%w: note longer than %d characters", ErrInvalidVisitAnnotation, maxAnnotationNoteLen)
+	}
+
+	tags := make([]string, 0, len(annotation.Tags))
+	for _, tag := range annotation.Tags {
+		tag, err := normalizeTag(tag)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidVisitAnnotation, err)
+		}
+		tags = append(tags, tag)
+	}
+	slices.Sort(tags)
+	tags = slices.Compact(tags)
+
+	if len(tags) > maxAnnotationTags {
+		return fmt.Errorf("%w: more than %d tags", ErrInvalidVisitAnnotation, maxAnnotationTags)
+	}
+	annotation.Tags = tags
+
+	return nil
+}
+
+// normalizeTag lowercases the tag, and checks it's made of letters, digits, '-', '_' and '.' only
+func normalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" {
+		return "", errors.New("empty tag")
+	}
+	if utf8.RuneCountInString(tag) > maxAnnotationTagLength {
+		return "", fmt.Errorf("tag %q longer than %d characters", tag, maxAnnotationTagLength)
+	}
+	for _, c := range tag {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '-' && c != '_' && c != '.' {
+			return "", fmt.Errorf("tag %q can only have letters, digits, '-', '_' and '.'", tag)
+		}
+	}
+	return tag, nil
+}
@@ -0,0 +1,167 @@
+package netlog
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/2beens/serjtubincom/internal/telemetry/tracing"
+	"github.com/2beens/serjtubincom/pkg"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type TagCountsResponse struct {
+	Tags []TagCount `json:"tags"`
+}
+
+type visitAnnotationRequest struct {
+	Starred   bool     `json:"starred"`
+	Tags      []string `json:"tags"`
+	Note      string   `json:"note"`
+	ReadLater bool     `json:"read_later"`
+}
+
+// handleSaveAnnotation sets (replaces) the annotation of the visit
+func (handler *Handler) handleSaveAnnotation(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.GlobalTracer.Start(r.Context(), "netlogHandler.saveAnnotation")
+	defer span.End()
+
+	visitID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid visit id", http.StatusBadRequest)
+		return
+	}
+	span.SetAttributes(attribute.Int("visit.id", visitID))
+
+	var req visitAnnotationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid annotation json", http.StatusBadRequest)
+		return
+	}
+
+	annotation, err := handler.repo.SaveVisitAnnotation(ctx, visitID, &VisitAnnotation{
+		Starred:   req.Starred,
+		Tags:      req.Tags,
+		Note:      req.Note,
+		ReadLater: req.ReadLater,
+	})
+	switch {
+	case errors.Is(err, ErrInvalidVisitAnnotation):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, ErrVisitNotFound):
+		http.Error(w, "visit not found", http.StatusNotFound)
+		return
+	case err != nil:
+		log.Errorf("save netlog visit [%d] annotation: %s", visitID, err)
+		http.Error(w, "failed to save visit annotation", http.StatusInternalServerError)
+		return
+	}
+
+	pkg.SendJsonResponse(w, http.StatusOK, annotation)
+}
+
+func (handler *Handler) handleDeleteAnnotation(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.GlobalTracer.Start(r.Context(), "netlogHandler.deleteAnnotation")
+	defer span.End()
+
+	visitID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid visit id", http.StatusBadRequest)
+		return
+	}
+	span.SetAttributes(attribute.Int("visit.id", visitID))
+
+	err = handler.repo.DeleteVisitAnnotation(ctx, visitID)
+	switch {
+	case errors.Is(err, ErrVisitAnnotationNotFound):
+		http.Error(w, "visit annotation not found", http.StatusNotFound)
+		return
+	case err != nil:
+		log.Errorf("delete netlog visit [%d] annotation: %s", visitID, err)
+		http.Error(w, "failed to delete visit annotation", http.StatusInternalServerError)
+		return
+	}
+
+	pkg.WriteTextResponseOK(w, "deleted:"+strconv.Itoa(visitID))
+}
+
+// handleAnnotatedPage returns a page of the annotated visits, with the optional <q> URL query param
+// with the search query (see query.go), e.g. q=tag:golang is:starred
+func (handler *Handler) handleAnnotatedPage(w http.ResponseWriter, r *http.Request) {
+	handler.annotatedPage(w, r, AnnotatedListAll)
+}
+
+// handleReadLaterPage returns a page of the read later queue, with the optional <q> URL query param
+func (handler *Handler) handleReadLaterPage(w http.ResponseWriter, r *http.Request) {
+	handler.annotatedPage(w, r, AnnotatedListReadLater)
+}
+
+func (handler *Handler) annotatedPage(w http.ResponseWriter, r *http.Request, list AnnotatedVisitsList) {
+	ctx, span := tracing.GlobalTracer.Start(r.Context(), "netlogHandler.annotatedPage")
+	defer span.End()
+
+	vars := mux.Vars(r)
+	page, err := strconv.Atoi(vars["page"])
+	if err != nil || page < 1 {
+		http.Error(w, "invalid <page>, has to be a positive number", http.StatusBadRequest)
+		return
+	}
+	size, err := strconv.Atoi(vars["size"])
+	if err != nil || size < 1 {
+		http.Error(w, "invalid <size>, has to be a positive number", http.StatusBadRequest)
+		return
+	}
+
+	queryRaw := r.URL.Query().Get("q")
+	span.SetAttributes(attribute.String("list", string(list)))
+	span.SetAttributes(attribute.String("query", queryRaw))
+
+	query, err := NewSearchQuery(queryRaw, queryFieldURL, "all")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	visits, err := handler.repo.GetAnnotatedVisitsPage(ctx, list, query, page, size)
+	if err != nil {
+		log.Errorf("get netlog annotated visits [%s]: %s", list, err)
+		http.Error(w, "failed to get netlog visits", http.StatusInternalServerError)
+		return
+	}
+	total, err := handler.repo.CountAnnotated(ctx, list, query)
+	if err != nil {
+		log.Errorf("count netlog annotated visits [%s]: %s", list, err)
+		http.Error(w, "failed to get netlog visits", http.StatusInternalServerError)
+		return
+	}
+
+	if visits == nil {
+		visits = []*Visit{}
+	}
+	pkg.SendJsonResponse(w, http.StatusOK, VisitsResponse{
+		Visits: visits,
+		Total:  total,
+	})
+}
+
+func (handler *Handler) handleTags(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.GlobalTracer.Start(r.Context(), "netlogHandler.tags")
+	defer span.End()
+
+	tags, err := handler.repo.TagCounts(ctx)
+	if err != nil {
+		log.Errorf("get netlog tags: %s", err)
+		http.Error(w, "failed to get netlog tags", http.StatusInternalServerError)
+		return
+	}
+
+	if tags == nil {
+		tags = []TagCount{}
+	}
+	pkg.SendJsonResponse(w, http.StatusOK, TagCountsResponse{Tags: tags})
+}
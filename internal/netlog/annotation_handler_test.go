@@ -0,0 +1,128 @@
+package netlog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/2beens/serjtubincom/internal/auth"
+	"github.com/2beens/serjtubincom/internal/telemetry/metrics"
+
+	"github.com/go-redis/redismock/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetlogHandler_annotations(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	repo := NewRepoMock()
+	m := metrics.NewTestManager()
+	loginChecker := auth.NewLoginChecker(time.Hour, db)
+	r := setupNetlogRouterForTests(t, repo, m, loginChecker, "beer")
+
+	send := func(method, path string, body io.Reader) *httptest.ResponseRecorder {
+		mock.ExpectGet("serj-service-session||tokenAbc123").SetVal(fmt.Sprintf("%d", time.Now().Unix()))
+
+		req, err := http.NewRequest(method, path, body)
+		require.NoError(t, err)
+		req.Header.Set("Origin", "test")
+		req.Header.Set("X-SERJ-TOKEN", "tokenAbc123")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	getPage := func(path string) VisitsResponse {
+		rr := send("GET", path, nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var resp VisitsResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		return resp
+	}
+
+	rr := send("PUT", "/netlog/visits/1/annotation", strings.NewReader(
+		`{"starred":true,"tags":["Go"," reading","go"],"note":" later ","read_later":true}`,
+	))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var annotation VisitAnnotation
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &annotation))
+	assert.True(t, annotation.Starred)
+	assert.Equal(t, []string{"go", "reading"}, annotation.Tags)
+	assert.Equal(t, "later", annotation.Note)
+	assert.True(t, annotation.ReadLater)
+	require.NotNil(t, annotation.ReadLaterAt)
+
+	rr = send("PUT", "/netlog/visits/0/annotation", strings.NewReader(`{"tags":["go"]}`))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	rr = send("PUT", "/netlog/visits/100/annotation", strings.NewReader(`{"starred":true}`))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	rr = send("PUT", "/netlog/visits/1/annotation", strings.NewReader(`{"tags":["two words"]}`))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	rr = send("PUT", "/netlog/visits/1/annotation", strings.NewReader(`{"tags":`))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	resp := getPage("/netlog/annotated/page/1/size/10?q=tag:go")
+	assert.Equal(t, 2, resp.Total)
+	require.Len(t, resp.Visits, 2)
+	// the last changed first
+	assert.Equal(t, 0, resp.Visits[0].Id)
+	assert.Equal(t, 1, resp.Visits[1].Id)
+	require.NotNil(t, resp.Visits[1].Annotation)
+	assert.Equal(t, "later", resp.Visits[1].Annotation.Note)
+
+	resp = getPage("/netlog/annotated/page/1/size/10?q=is:starred")
+	require.Len(t, resp.Visits, 1)
+	assert.Equal(t, 1, resp.Visits[0].Id)
+
+	// the annotation terms work in the regular search too
+	resp = getPage("/netlog/s/all/f/url/search/is:starred/page/1/size/10")
+	assert.Equal(t, 1, resp.Total)
+
+	rr = send("GET", "/netlog/annotated/page/1/size/10?q=is:unknown", nil)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	resp = getPage("/netlog/read-later/page/1/size/10")
+	require.Len(t, resp.Visits, 1)
+	assert.Equal(t, 1, resp.Visits[0].Id)
+
+	// saving the annotation again keeps the visit in the queue
+	rr = send("PUT", "/netlog/visits/1/annotation", strings.NewReader(`{"starred":true,"read_later":true}`))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var resaved VisitAnnotation
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resaved))
+	assert.True(t, resaved.ReadLater)
+	assert.Equal(t, *annotation.ReadLaterAt, *resaved.ReadLaterAt)
+
+	// visiting the url again clears the read later queue entry
+	require.NoError(t, repo.AddVisit(context.Background(), &Visit{
+		URL:       "test:url:1#section",
+		Timestamp: time.Now().Add(time.Minute),
+	}))
+	resp = getPage("/netlog/read-later/page/1/size/10")
+	assert.Equal(t, 0, resp.Total)
+	assert.Empty(t, resp.Visits)
+
+	resp = getPage("/netlog/annotated/page/1/size/10?q=is:starred")
+	require.Len(t, resp.Visits, 1)
+	assert.False(t, resp.Visits[0].Annotation.ReadLater)
+
+	rr = send("GET", "/netlog/tags", nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var tagsResp TagCountsResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &tagsResp))
+	assert.Equal(t, []TagCount{{Tag: "go", Visits: 1}}, tagsResp.Tags)
+
+	rr = send("DELETE", "/netlog/visits/0/annotation", nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = send("DELETE", "/netlog/visits/0/annotation", nil)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	resp = getPage("/netlog/annotated/page/1/size/10")
+	assert.Equal(t, 1, resp.Total)
+}
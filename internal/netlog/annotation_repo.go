@@ -0,0 +1,254 @@
+package netlog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/2beens/serjtubincom/internal/telemetry/tracing"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// annotationColumnsSQL are the visit_annotation (aliased as a) columns read by scanVisitAnnotation
+var annotationColumnsSQL = `a.starred, a.tags, a.note, ` + readLaterPendingSQL("a") + `, a.read_later_at, a.created_at, a.updated_at`
+
+// SaveVisitAnnotation sets the annotation of the visit, replacing the existing one. A visit already in the
+// read later queue keeps its place in it, and a visit which left the queue is put at its end again.
+func (r *Repo) SaveVisitAnnotation(ctx context.Context, visitID int, annotation *VisitAnnotation) (_ *VisitAnnotation, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.saveVisitAnnotation")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	span.SetAttributes(attribute.Int("visit.id", visitID))
+
+	if err := normalizeAnnotation(annotation); err != nil {
+		return nil, err
+	}
+
+	// the read later url is canonicalized here, and not taken from the visit canonical_url, which is
+	// empty for the old visits until netlog_backfill_urls fills it in
+	var visitURL string
+	err = r.db.QueryRow(ctx, `SELECT url FROM netlog.visit WHERE id = $1`, visitID).Scan(&visitURL)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrVisitNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Query(
+		ctx,
+		`
+			INSERT INTO netlog.visit_annotation AS a (visit_id, starred, tags, note, read_later_at, read_later_url)
+			SELECT id, $2, $3, $4, CASE WHEN $5::boolean THEN now() END, $6
+			FROM netlog.visit
+			WHERE id = $1
+			ON CONFLICT (visit_id) DO UPDATE SET
+				starred = EXCLUDED.starred,
+				tags = EXCLUDED.tags,
+				note = EXCLUDED.note,
+				read_later_at = CASE
+					WHEN NOT $5::boolean THEN NULL
+					WHEN `+readLaterPendingSQL("a")+` THEN a.read_later_at
+					ELSE now()
+				END,
+				read_later_url = EXCLUDED.read_later_url,
+				updated_at = now()
+			RETURNING `+annotationColumnsSQL+`;
+		`,
+		visitID, annotation.Starred, annotation.Tags, annotation.Note, annotation.ReadLater, CanonicalizeURL(visitURL),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	saved, err := pgx.CollectExactlyOneRow(rows, scanVisitAnnotation)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrVisitNotFound
+	}
+	return saved, err
+}
+
+func (r *Repo) GetVisitAnnotation(ctx context.Context, visitID int) (_ *VisitAnnotation, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.getVisitAnnotation")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	span.SetAttributes(attribute.Int("visit.id", visitID))
+
+	rows, err := r.db.Query(
+		ctx,
+		`SELECT `+annotationColumnsSQL+` FROM netlog.visit_annotation a WHERE a.visit_id = $1;`,
+		visitID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	annotation, err := pgx.CollectExactlyOneRow(rows, scanVisitAnnotation)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrVisitAnnotationNotFound
+	}
+	return annotation, err
+}
+
+func (r *Repo) DeleteVisitAnnotation(ctx context.Context, visitID int) (err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.deleteVisitAnnotation")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	span.SetAttributes(attribute.Int("visit.id", visitID))
+
+	tag, err := r.db.Exec(ctx, `DELETE FROM netlog.visit_annotation WHERE visit_id = $1;`, visitID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrVisitAnnotationNotFound
+	}
+
+	return nil
+}
+
+// GetAnnotatedVisitsPage returns an offset based page of the annotated visits matching the query,
+// with their annotations set
+func (r *Repo) GetAnnotatedVisitsPage(
+	ctx context.Context,
+	list AnnotatedVisitsList,
+	query *SearchQuery,
+	page, size int,
+) (_ []*Visit, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.getAnnotatedVisitsPage")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	span.SetAttributes(attribute.String("list", string(list)))
+	span.SetAttributes(attribute.String("visit.query", query.String()))
+	span.SetAttributes(attribute.Int("page", page))
+	span.SetAttributes(attribute.Int("size", size))
+
+	if page < 1 || size < 1 {
+		return []*Visit{}, nil
+	}
+
+	where, args := annotatedWhereClause(list, query)
+	orderBy := "a.updated_at DESC, id DESC"
+	if list == AnnotatedListReadLater {
+		orderBy = "a.read_later_at, id"
+	}
+
+	sqlQuery := fmt.Sprintf(`
+		SELECT `+visitColumnsSQL+`, `+annotationColumnsSQL+`
+		FROM netlog.visit
+		JOIN netlog.visit_annotation a ON a.visit_id = id
+		%s
+		ORDER BY %s
+		LIMIT $%d
+		OFFSET $%d;
+	`, where, orderBy, len(args)+1, len(args)+2)
+
+	rows, err := r.db.Query(ctx, sqlQuery, append(args, size, (page-1)*size)...)
+	if err != nil {
+		return nil, err
+	}
+
+	visits, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*Visit, error) {
+		v := &Visit{Annotation: &VisitAnnotation{}}
+		err := row.Scan(
+			&v.Id, &v.Title, &v.Source, &v.Device, &v.URL, &v.Timestamp,
+			&v.Host, &v.RegisteredDomain, &v.CanonicalURL,
+			&v.Annotation.Starred, &v.Annotation.Tags, &v.Annotation.Note, &v.Annotation.ReadLater,
+			&v.Annotation.ReadLaterAt, &v.Annotation.CreatedAt, &v.Annotation.UpdatedAt,
+		)
+		return v, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("found-visits", len(visits)))
+	return visits, nil
+}
+
+func (r *Repo) CountAnnotated(ctx context.Context, list AnnotatedVisitsList, query *SearchQuery) (_ int, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.countAnnotated")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	span.SetAttributes(attribute.String("list", string(list)))
+	span.SetAttributes(attribute.String("visit.query", query.String()))
+
+	where, args := annotatedWhereClause(list, query)
+	sqlQuery := fmt.Sprintf(`
+		SELECT COUNT(*)
+		FROM netlog.visit
+		JOIN netlog.visit_annotation a ON a.visit_id = id
+		%s;
+	`, where)
+
+	var count int
+	if err := r.db.QueryRow(ctx, sqlQuery, args...).Scan(&count); err != nil {
+		return -1, err
+	}
+	return count, nil
+}
+
+// TagCounts returns all the tags used, with the number of visits tagged, the most used first.
+// The archived visits are not counted.
+func (r *Repo) TagCounts(ctx context.Context) (_ []TagCount, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.tagCounts")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	rows, err := r.db.Query(
+		ctx,
+		`
+			SELECT tag, COUNT(*)
+			FROM netlog.visit_annotation a, unnest(a.tags) AS tag
+			WHERE EXISTS (SELECT 1 FROM netlog.visit v WHERE v.id = a.visit_id)
+			GROUP BY tag
+			ORDER BY COUNT(*) DESC, tag;
+		`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (TagCount, error) {
+		var tc TagCount
+		err := row.Scan(&tc.Tag, &tc.Visits)
+		return tc, err
+	})
+}
+
+func annotatedWhereClause(list AnnotatedVisitsList, query *SearchQuery) (string, []any) {
+	cond, args := query.whereCondition(0)
+	if list == AnnotatedListReadLater {
+		if cond == "" {
+			cond = readLaterPendingSQL("a")
+		} else {
+			cond = readLaterPendingSQL("a") + " AND " + cond
+		}
+	}
+	if cond == "" {
+		return "", nil
+	}
+	return "WHERE " + cond, args
+}
+
+func scanVisitAnnotation(row pgx.CollectableRow) (*VisitAnnotation, error) {
+	var annotation VisitAnnotation
+	err := row.Scan(
+		&annotation.Starred, &annotation.Tags, &annotation.Note, &annotation.ReadLater,
+		&annotation.ReadLaterAt, &annotation.CreatedAt, &annotation.UpdatedAt,
+	)
+	return &annotation, err
+}
@@ -0,0 +1,113 @@
+//go:build all_tests
+
+package netlog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepo_VisitAnnotations(t *testing.T) {
+	ctx := context.Background()
+	repo, shutdown := testRepoSetup(t)
+	defer shutdown()
+
+	addedVisits := cleanupAndAddTestVisits(ctx, t, repo)
+	require.Len(t, addedVisits, 5)
+	first, second := addedVisits[0], addedVisits[1]
+
+	_, err := repo.SaveVisitAnnotation(ctx, -1, &VisitAnnotation{Starred: true})
+	assert.ErrorIs(t, err, ErrVisitNotFound)
+	_, err = repo.SaveVisitAnnotation(ctx, first.Id, &VisitAnnotation{Tags: []string{"a/b"}})
+	assert.ErrorIs(t, err, ErrInvalidVisitAnnotation)
+
+	saved, err := repo.SaveVisitAnnotation(ctx, first.Id, &VisitAnnotation{
+		Starred:   true,
+		Tags:      []string{"Go", "reading", "go"},
+		Note:      "read it",
+		ReadLater: true,
+	})
+	require.NoError(t, err)
+	assert.True(t, saved.Starred)
+	assert.Equal(t, []string{"go", "reading"}, saved.Tags)
+	assert.True(t, saved.ReadLater)
+	require.NotNil(t, saved.ReadLaterAt)
+
+	_, err = repo.SaveVisitAnnotation(ctx, second.Id, &VisitAnnotation{Tags: []string{"go"}})
+	require.NoError(t, err)
+
+	// saved again, the visit keeps its place in the read later queue
+	resaved, err := repo.SaveVisitAnnotation(ctx, first.Id, &VisitAnnotation{Starred: true, Tags: []string{"go", "reading"}, ReadLater: true})
+	require.NoError(t, err)
+	assert.True(t, resaved.ReadLater)
+	assert.True(t, saved.ReadLaterAt.Equal(*resaved.ReadLaterAt))
+	assert.Empty(t, resaved.Note)
+
+	visits, err := repo.GetAnnotatedVisitsPage(ctx, AnnotatedListAll, MustNewSearchQuery("tag:go", "url", "all"), 1, 10)
+	require.NoError(t, err)
+	require.Len(t, visits, 2)
+	assert.Equal(t, first.Id, visits[0].Id)
+	assert.Equal(t, []string{"go", "reading"}, visits[0].Annotation.Tags)
+	assert.Equal(t, second.Id, visits[1].Id)
+
+	count, err := repo.Count(ctx, MustNewSearchQuery("is:starred", "url", "all"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	count, err = repo.CountAnnotated(ctx, AnnotatedListReadLater, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	tags, err := repo.TagCounts(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []TagCount{{Tag: "go", Visits: 2}, {Tag: "reading", Visits: 1}}, tags)
+
+	// visiting the page again takes it out of the read later queue
+	require.NoError(t, repo.AddVisit(ctx, &Visit{URL: first.URL + "#again", Timestamp: time.Now().Add(time.Minute)}))
+	visits, err = repo.GetAnnotatedVisitsPage(ctx, AnnotatedListReadLater, nil, 1, 10)
+	require.NoError(t, err)
+	assert.Empty(t, visits)
+	annotation, err := repo.GetVisitAnnotation(ctx, first.Id)
+	require.NoError(t, err)
+	assert.False(t, annotation.ReadLater)
+	assert.NotNil(t, annotation.ReadLaterAt)
+
+	require.NoError(t, repo.DeleteVisitAnnotation(ctx, second.Id))
+	assert.ErrorIs(t, repo.DeleteVisitAnnotation(ctx, second.Id), ErrVisitAnnotationNotFound)
+
+	// the annotations are deleted with their visits
+	_, err = repo.DeleteVisits(ctx, []int{first.Id})
+	require.NoError(t, err)
+	_, err = repo.GetVisitAnnotation(ctx, first.Id)
+	assert.ErrorIs(t, err, ErrVisitAnnotationNotFound)
+}
+
+func TestRepo_VisitAnnotations_ReadLaterNotBackfilled(t *testing.T) {
+	ctx := context.Background()
+	repo, shutdown := testRepoSetup(t)
+	defer shutdown()
+
+	addedVisits := cleanupAndAddTestVisits(ctx, t, repo)
+	visit := addedVisits[0]
+
+	// an old visit, without the url fields until netlog_backfill_urls runs
+	_, err := repo.db.Exec(
+		ctx,
+		`UPDATE netlog.visit SET url = $1, canonical_url = NULL, host = NULL, registered_domain = NULL WHERE id = $2`,
+		"HTTPS://Example.com/article?utm_source=feed#top", visit.Id,
+	)
+	require.NoError(t, err)
+
+	_, err = repo.SaveVisitAnnotation(ctx, visit.Id, &VisitAnnotation{ReadLater: true})
+	require.NoError(t, err)
+
+	// visiting the page again takes it out of the read later queue
+	require.NoError(t, repo.AddVisit(ctx, &Visit{URL: "https://example.com/article", Timestamp: time.Now().Add(time.Minute)}))
+	annotation, err := repo.GetVisitAnnotation(ctx, visit.Id)
+	require.NoError(t, err)
+	assert.False(t, annotation.ReadLater)
+}
@@ -0,0 +1,251 @@
+package netlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	BackupCompressionNone = ""
+	BackupCompressionGzip = "gzip"
+	BackupCompressionZstd = "zstd"
+
+	BackupEncryptionNone   = ""
+	BackupEncryptionAESGCM = "aes-256-gcm"
+
+	backupKeySize = 32
+)
+
+var (
+	ErrBackupKeyMissing  = errors.New("backup chunk is encrypted, but the encryption key is not set")
+	ErrBackupKeyMismatch = errors.New("backup chunk is encrypted with a different key")
+)
+
+// BackupFormat is how a backup chunk is encoded, the zero value is plain json
+type BackupFormat struct {
+	Compression string `json:"compression,omitempty"`
+	Encryption  string `json:"encryption,omitempty"`
+	// KeyId identifies the encryption key, so a wrong key is reported as such, and not as a corrupted chunk
+	KeyId string `json:"key_id,omitempty"`
+}
+
+// fileSuffix is appended to the chunk file name, after the .json extension
+func (f BackupFormat) fileSuffix() string {
+	suffix := ""
+	switch f.Compression {
+	case BackupCompressionGzip:
+		suffix += ".gz"
+	case BackupCompressionZstd:
+		suffix += ".zst"
+	}
+	if f.Encryption != BackupEncryptionNone {
+		suffix += ".enc"
+	}
+	return suffix
+}
+
+func (f BackupFormat) isPlain() bool {
+	return f.Compression == BackupCompressionNone && f.Encryption == BackupEncryptionNone
+}
+
+// BackupCodec compresses and encrypts the backup chunks before they are uploaded, and reverses it
+// when they are downloaded. Chunks are compressed first, as the encrypted data doesn't compress.
+type BackupCodec struct {
+	compression string
+	key         []byte
+	keyId       string
+}
+
+// NewBackupCodec creates the codec, with no encryption if the key is nil. A nil codec is valid, and
+// keeps the chunks as plain json.
+func NewBackupCodec(compression string, key []byte) (*BackupCodec, error) {
+	switch compression {
+	case BackupCompressionNone, BackupCompressionGzip, BackupCompressionZstd:
+	default:
+		return nil, fmt.Errorf("unknown backup compression: %s", compression)
+	}
+
+	c := &BackupCodec{compression: compression}
+	if key != nil {
+		if len(key) != backupKeySize {
+			return nil, fmt.Errorf("backup encryption key has to be %d bytes, got %d", backupKeySize, len(key))
+		}
+		keyHash := sha256.Sum256(key)
+		c.key = key
+		c.keyId = hex.EncodeToString(keyHash[:8])
+	}
+
+	return c, nil
+}
+
+// LoadBackupKey reads the encryption key file, containing 32 raw bytes or 64 hex characters,
+// e.g. created with: openssl rand -hex 32 > netlog-backup.key
+func LoadBackupKey(path string) ([]byte, error) {
+	keyData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read backup key file: %w", err)
+	}
+	if len(keyData) == backupKeySize {
+		return keyData, nil
+	}
+
+	key, err := hex.DecodeString(string(bytes.TrimSpace(keyData)))
+	if err != nil {
+		return nil, fmt.Errorf("backup key file has to contain %d raw bytes or %d hex characters", backupKeySize, 2*backupKeySize)
+	}
+	return key, nil
+}
+
+func (c *BackupCodec) Format() BackupFormat {
+	if c == nil {
+		return BackupFormat{}
+	}
+
+	format := BackupFormat{Compression: c.compression}
+	if c.key != nil {
+		format.Encryption = BackupEncryptionAESGCM
+		format.KeyId = c.keyId
+	}
+	return format
+}
+
+// Encode compresses and encrypts the chunk data. The chunk name is authenticated along with the data,
+// so an encrypted chunk can't be passed off as another one.
+func (c *BackupCodec) Encode(name string, data []byte) ([]byte, error) {
+	format := c.Format()
+
+	var err error
+	switch format.Compression {
+	case BackupCompressionGzip:
+		var buf bytes.Buffer
+		gzipWriter := gzip.NewWriter(&buf)
+		if _, err := gzipWriter.Write(data); err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		if err := gzipWriter.Close(); err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		data = buf.Bytes()
+	case BackupCompressionZstd:
+		encoder, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, fmt.Errorf("zstd: %w", err)
+		}
+		data = encoder.EncodeAll(data, nil)
+		if err := encoder.Close(); err != nil {
+			return nil, fmt.Errorf("zstd: %w", err)
+		}
+	}
+
+	if format.Encryption == BackupEncryptionAESGCM {
+		data, err = c.encrypt(name, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+// Decode reverses Encode for the chunk stored in the given format, which does not have to match the codec
+// format, as older chunks stay in the format they were backed up in
+func (c *BackupCodec) Decode(name string, format BackupFormat, data []byte) ([]byte, error) {
+	var err error
+	switch format.Encryption {
+	case BackupEncryptionNone:
+	case BackupEncryptionAESGCM:
+		if c == nil || c.key == nil {
+			return nil, ErrBackupKeyMissing
+		}
+		if format.KeyId != c.keyId {
+			return nil, fmt.Errorf("%w: %s", ErrBackupKeyMismatch, format.KeyId)
+		}
+		data, err = c.decrypt(name, data)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown backup encryption: %s", format.Encryption)
+	}
+
+	switch format.Compression {
+	case BackupCompressionNone:
+	case BackupCompressionGzip:
+		gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("gunzip: %w", err)
+		}
+		defer gzipReader.Close()
+		data, err = io.ReadAll(gzipReader)
+		if err != nil {
+			return nil, fmt.Errorf("gunzip: %w", err)
+		}
+	case BackupCompressionZstd:
+		decoder, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, fmt.Errorf("zstd: %w", err)
+		}
+		defer decoder.Close()
+		data, err = decoder.DecodeAll(data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("zstd: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown backup compression: %s", format.Compression)
+	}
+
+	return data, nil
+}
+
+// encrypt returns the random nonce followed by the sealed data
+func (c *BackupCodec) encrypt(name string, data []byte) ([]byte, error) {
+	gcm, err := c.gcm()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+
+	return gcm.Seal(nonce, nonce, data, []byte(name)), nil
+}
+
+func (c *BackupCodec) decrypt(name string, data []byte) ([]byte, error) {
+	gcm, err := c.gcm()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("decrypt: encrypted data too short")
+	}
+
+	nonce, sealed := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, sealed, []byte(name))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt: %w", err)
+	}
+
+	return plain, nil
+}
+
+func (c *BackupCodec) gcm() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(c.key)
+	if err != nil {
+		return nil, fmt.Errorf("new cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
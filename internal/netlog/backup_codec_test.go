@@ -0,0 +1,163 @@
+package netlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testBackupKey(fill byte) []byte {
+	return bytes.Repeat([]byte{fill}, backupKeySize)
+}
+
+func TestBackupCodec_EncodeDecode(t *testing.T) {
+	chunkJson := []byte(strings.Repeat(`{"id":1,"url":"https://serj-tubin.com"},`, 100))
+
+	for _, compression := range []string{BackupCompressionNone, BackupCompressionGzip, BackupCompressionZstd} {
+		for _, key := range [][]byte{nil, testBackupKey(1)} {
+			codec, err := NewBackupCodec(compression, key)
+			require.NoError(t, err)
+
+			format := codec.Format()
+			assert.Equal(t, compression, format.Compression)
+			if key == nil {
+				assert.Empty(t, format.Encryption)
+			} else {
+				assert.Equal(t, BackupEncryptionAESGCM, format.Encryption)
+				assert.NotEmpty(t, format.KeyId)
+			}
+
+			encoded, err := codec.Encode("chunk_1.json", chunkJson)
+			require.NoError(t, err)
+			if !format.isPlain() {
+				assert.NotEqual(t, chunkJson, encoded)
+			}
+			if compression != BackupCompressionNone {
+				assert.Less(t, len(encoded), len(chunkJson))
+			}
+
+			decoded, err := codec.Decode("chunk_1.json", format, encoded)
+			require.NoError(t, err)
+			assert.Equal(t, chunkJson, decoded)
+		}
+	}
+}
+
+func TestBackupCodec_DecodeEncrypted(t *testing.T) {
+	codec, err := NewBackupCodec(BackupCompressionGzip, testBackupKey(1))
+	require.NoError(t, err)
+	format := codec.Format()
+
+	encoded, err := codec.Encode("chunk_1.json", []byte(`[]`))
+	require.NoError(t, err)
+
+	// no key
+	var noCodec *BackupCodec
+	_, err = noCodec.Decode("chunk_1.json", format, encoded)
+	assert.ErrorIs(t, err, ErrBackupKeyMissing)
+
+	// a different key
+	otherCodec, err := NewBackupCodec(BackupCompressionGzip, testBackupKey(2))
+	require.NoError(t, err)
+	_, err = otherCodec.Decode("chunk_1.json", format, encoded)
+	assert.ErrorIs(t, err, ErrBackupKeyMismatch)
+
+	// a chunk passed off as another one
+	_, err = codec.Decode("chunk_2.json", format, encoded)
+	assert.ErrorContains(t, err, "decrypt")
+
+	// tampered chunk
+	encoded[len(encoded)-1] ^= 0xff
+	_, err = codec.Decode("chunk_1.json", format, encoded)
+	assert.ErrorContains(t, err, "decrypt")
+
+	// plain chunks are decoded without the key, as the older backups stay in the format they were made in
+	decoded, err := codec.Decode("old.json", BackupFormat{}, []byte(`[]`))
+	require.NoError(t, err)
+	assert.Equal(t, `[]`, string(decoded))
+}
+
+func TestNewBackupCodec_Invalid(t *testing.T) {
+	_, err := NewBackupCodec("lz4", nil)
+	assert.Error(t, err)
+	_, err = NewBackupCodec(BackupCompressionNone, []byte("short key"))
+	assert.Error(t, err)
+}
+
+func TestLoadBackupKey(t *testing.T) {
+	dir := t.TempDir()
+
+	rawKeyPath := filepath.Join(dir, "raw.key")
+	require.NoError(t, os.WriteFile(rawKeyPath, testBackupKey(7), 0o600))
+	key, err := LoadBackupKey(rawKeyPath)
+	require.NoError(t, err)
+	assert.Equal(t, testBackupKey(7), key)
+
+	hexKeyPath := filepath.Join(dir, "hex.key")
+	require.NoError(t, os.WriteFile(hexKeyPath, []byte(hex.EncodeToString(testBackupKey(8))+"\n"), 0o600))
+	key, err = LoadBackupKey(hexKeyPath)
+	require.NoError(t, err)
+	assert.Equal(t, testBackupKey(8), key)
+
+	invalidKeyPath := filepath.Join(dir, "invalid.key")
+	require.NoError(t, os.WriteFile(invalidKeyPath, []byte("not a key"), 0o600))
+	_, err = LoadBackupKey(invalidKeyPath)
+	assert.Error(t, err)
+}
+
+func TestBackupService_EncryptedBackupRestore(t *testing.T) {
+	ctx := context.Background()
+	target, err := NewLocalBackupTarget(t.TempDir())
+	require.NoError(t, err)
+
+	codec, err := NewBackupCodec(BackupCompressionZstd, testBackupKey(1))
+	require.NoError(t, err)
+
+	repo := &backupRepoMock{
+		visits: testVisits(1, 5, time.Now()),
+	}
+	s := NewBackupService(BackupServiceParams{
+		Repo:                     repo,
+		Target:                   target,
+		Codec:                    codec,
+		NetlogUnixSocketAddrDir:  t.TempDir(),
+		NetlogUnixSocketFileName: "none.sock",
+	})
+	require.NoError(t, s.DoBackup(ctx, time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)))
+
+	files, err := target.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "initial-10-5-2024_1.json.zst.enc", files[0].Name)
+
+	content, err := target.Download(ctx, files[0])
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "serj-tubin.com")
+
+	manifest, err := target.GetManifest(ctx)
+	require.NoError(t, err)
+	require.Len(t, manifest.Chunks, 1)
+	assert.Equal(t, codec.Format(), manifest.Chunks[0].Format)
+
+	result, err := s.Restore(ctx, "netlog_restored")
+	require.NoError(t, err)
+	assert.Equal(t, 5, result.Inserted)
+
+	// without the key, the backup can't be restored
+	noKeyService := NewBackupService(BackupServiceParams{
+		Repo:                     repo,
+		Target:                   target,
+		NetlogUnixSocketAddrDir:  t.TempDir(),
+		NetlogUnixSocketFileName: "none.sock",
+	})
+	_, err = noKeyService.Restore(ctx, "netlog_restored")
+	assert.ErrorIs(t, err, ErrBackupKeyMissing)
+}
@@ -0,0 +1,213 @@
+package netlog
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// The netlog backup reports its runs to the main service over the unix socket. Each message is a
+// 4 bytes big endian length, followed by that many bytes of json. Every message is acknowledged with
+// an ack message, carrying the error if the message was rejected.
+
+const (
+	BackupIPCProtocolVersion = 1
+
+	BackupIPCRunStarted  = "run_started"
+	BackupIPCProgress    = "progress"
+	BackupIPCRunFinished = "run_finished"
+	BackupIPCRunFailed   = "run_failed"
+	BackupIPCAck         = "ack"
+
+	backupIPCMaxMessageSize = 64 * 1024
+)
+
+var (
+	ErrBackupIPCMessageTooLarge = errors.New("backup ipc message too large")
+)
+
+type BackupIPCMessage struct {
+	Version   int       `json:"version"`
+	Type      string    `json:"type"`
+	RunId     string    `json:"run_id,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	// Target is set in the run started message
+	Target string `json:"target,omitempty"`
+	// VisitsCount is the number of visits backed up so far, or in total when the run is finished
+	VisitsCount int `json:"visits_count,omitempty"`
+	ChunksDone  int `json:"chunks_done,omitempty"`
+	ChunksTotal int `json:"chunks_total,omitempty"`
+	// DurationSeconds is set when the run is finished or failed
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+	// Error is set when the run failed, or in the ack when the message was rejected
+	Error string `json:"error,omitempty"`
+}
+
+func (m *BackupIPCMessage) validate() error {
+	if m.Version != BackupIPCProtocolVersion {
+		return fmt.Errorf("unsupported protocol version: %d", m.Version)
+	}
+	switch m.Type {
+	case BackupIPCRunStarted, BackupIPCProgress, BackupIPCRunFinished, BackupIPCRunFailed:
+	default:
+		return fmt.Errorf("unknown message type: %s", m.Type)
+	}
+	if m.RunId == "" {
+		return errors.New("run id missing")
+	}
+	return nil
+}
+
+func writeBackupIPCMessage(w io.Writer, msg *BackupIPCMessage) error {
+	msgJson, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if len(msgJson) > backupIPCMaxMessageSize {
+		return ErrBackupIPCMessageTooLarge
+	}
+
+	frame := make([]byte, 4, 4+len(msgJson))
+	binary.BigEndian.PutUint32(frame, uint32(len(msgJson)))
+	frame = append(frame, msgJson...)
+
+	_, err = w.Write(frame)
+	return err
+}
+
+// readBackupIPCMessage returns io.EOF if the connection is closed before a new message
+func readBackupIPCMessage(r io.Reader) (*BackupIPCMessage, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if size > backupIPCMaxMessageSize {
+		return nil, ErrBackupIPCMessageTooLarge
+	}
+
+	msgJson := make([]byte, size)
+	if _, err := io.ReadFull(r, msgJson); err != nil {
+		return nil, fmt.Errorf("read message: %w", err)
+	}
+
+	var msg BackupIPCMessage
+	if err := json.Unmarshal(msgJson, &msg); err != nil {
+		return nil, fmt.Errorf("unmarshal message: %w", err)
+	}
+
+	return &msg, nil
+}
+
+// backupRunReporter sends the backup run messages to the main service. Reporting is best effort,
+// a backup never fails because the main service is not reachable.
+type backupRunReporter struct {
+	socket       string
+	runId        string
+	beginTime    time.Time
+	visitsCount  int
+	chunksDone   int
+	chunksTotal  int
+	dialTimeout  time.Duration
+	writeTimeout time.Duration
+}
+
+func newBackupRunReporter(socketAddrDir, socketFileName string) *backupRunReporter {
+	runId := make([]byte, 8)
+	_, _ = rand.Read(runId)
+
+	return &backupRunReporter{
+		socket:       filepath.Join(socketAddrDir, socketFileName),
+		runId:        hex.EncodeToString(runId),
+		beginTime:    time.Now(),
+		dialTimeout:  5 * time.Second,
+		writeTimeout: 20 * time.Second,
+	}
+}
+
+func (r *backupRunReporter) started(target string) {
+	r.send(&BackupIPCMessage{
+		Type:   BackupIPCRunStarted,
+		Target: target,
+	})
+}
+
+func (r *backupRunReporter) progress(chunkVisits, chunksTotal int) {
+	r.visitsCount += chunkVisits
+	r.chunksDone++
+	r.chunksTotal = chunksTotal
+	r.send(&BackupIPCMessage{Type: BackupIPCProgress})
+}
+
+func (r *backupRunReporter) finished() {
+	r.send(&BackupIPCMessage{
+		Type:            BackupIPCRunFinished,
+		DurationSeconds: time.Since(r.beginTime).Seconds(),
+	})
+}
+
+func (r *backupRunReporter) failed(err error) {
+	r.send(&BackupIPCMessage{
+		Type:            BackupIPCRunFailed,
+		DurationSeconds: time.Since(r.beginTime).Seconds(),
+		Error:           err.Error(),
+	})
+}
+
+func (r *backupRunReporter) send(msg *BackupIPCMessage) {
+	msg.Version = BackupIPCProtocolVersion
+	msg.RunId = r.runId
+	msg.Timestamp = time.Now()
+	msg.VisitsCount = r.visitsCount
+	msg.ChunksDone = r.chunksDone
+	msg.ChunksTotal = r.chunksTotal
+
+	if err := r.sendMessage(msg); err != nil {
+		log.Printf("backup run report [%s] not sent: %s", msg.Type, err)
+	}
+}
+
+func (r *backupRunReporter) sendMessage(msg *BackupIPCMessage) error {
+	conn, err := net.DialTimeout("unix", r.socket, r.dialTimeout)
+	if err != nil {
+		return fmt.Errorf("conn: %w", err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(r.writeTimeout)); err != nil {
+		return fmt.Errorf("set conn deadline: %w", err)
+	}
+
+	if err := writeBackupIPCMessage(conn, msg); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+
+	ack, err := readBackupIPCMessage(conn)
+	if err != nil {
+		return fmt.Errorf("read ack: %w", err)
+	}
+	if ack.Error != "" {
+		return fmt.Errorf("rejected: %s", ack.Error)
+	}
+
+	return nil
+}
+
+// done reports the run as finished, or as failed if there is an error
+func (r *backupRunReporter) done(err error) {
+	if err != nil {
+		r.failed(err)
+		return
+	}
+	r.finished()
+}
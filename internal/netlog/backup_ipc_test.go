@@ -0,0 +1,83 @@
+package netlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupIPCMessage_framing(t *testing.T) {
+	var buf bytes.Buffer
+
+	msg1 := &BackupIPCMessage{
+		Version:     BackupIPCProtocolVersion,
+		Type:        BackupIPCProgress,
+		RunId:       "abc",
+		Timestamp:   time.Date(2024, 5, 10, 10, 0, 0, 0, time.UTC),
+		VisitsCount: 350,
+		ChunksDone:  1,
+		ChunksTotal: 3,
+	}
+	msg2 := &BackupIPCMessage{
+		Version:   BackupIPCProtocolVersion,
+		Type:      BackupIPCRunFailed,
+		RunId:     "abc",
+		Timestamp: time.Date(2024, 5, 10, 10, 1, 0, 0, time.UTC),
+		Error:     "upload failed",
+	}
+	require.NoError(t, writeBackupIPCMessage(&buf, msg1))
+	require.NoError(t, writeBackupIPCMessage(&buf, msg2))
+
+	received, err := readBackupIPCMessage(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, msg1, received)
+	received, err = readBackupIPCMessage(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, msg2, received)
+
+	_, err = readBackupIPCMessage(&buf)
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestBackupIPCMessage_invalidFrames(t *testing.T) {
+	tooLarge := &BackupIPCMessage{
+		Version: BackupIPCProtocolVersion,
+		Type:    BackupIPCRunFailed,
+		Error:   string(bytes.Repeat([]byte("x"), backupIPCMaxMessageSize)),
+	}
+	assert.ErrorIs(t, writeBackupIPCMessage(io.Discard, tooLarge), ErrBackupIPCMessageTooLarge)
+
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, backupIPCMaxMessageSize+1)
+	_, err := readBackupIPCMessage(bytes.NewReader(header))
+	assert.ErrorIs(t, err, ErrBackupIPCMessageTooLarge)
+
+	// the old string protocol is not a valid frame
+	_, err = readBackupIPCMessage(bytes.NewReader([]byte("visits-count::15||duration::12.1")))
+	require.Error(t, err)
+	assert.False(t, errors.Is(err, io.EOF))
+
+	// truncated message
+	binary.BigEndian.PutUint32(header, 10)
+	_, err = readBackupIPCMessage(bytes.NewReader(append(header, []byte(`{"ver`)...)))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestBackupIPCMessage_validate(t *testing.T) {
+	valid := BackupIPCMessage{Version: BackupIPCProtocolVersion, Type: BackupIPCRunStarted, RunId: "abc"}
+	assert.NoError(t, valid.validate())
+
+	noRunId := valid
+	noRunId.RunId = ""
+	assert.EqualError(t, noRunId.validate(), "run id missing")
+
+	ack := valid
+	ack.Type = BackupIPCAck
+	assert.EqualError(t, ack.validate(), "unknown message type: ack")
+}
@@ -0,0 +1,213 @@
+package netlog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/2beens/serjtubincom/internal/telemetry/tracing"
+
+	"github.com/jackc/pgx/v5"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	DefaultVisitsSchema = "netlog"
+
+	restoreBatchSize = 1000
+)
+
+// visitTableDDL creates the visit table in the given schema, same as in sql/db_schema.sql,
+// so the backups can be restored into an empty database or a different schema. The restored visits
+// go to the default partition, and to the monthly ones once they are created, see EnsureVisitPartitions.
+// The tables restored before the partitioning have to be dropped first, as their primary key is the id only.
+const visitTableDDL = `
+	CREATE SCHEMA IF NOT EXISTS %[1]s;
+	CREATE TABLE IF NOT EXISTS %[2]s
+	(
+		id        SERIAL,
+		title     VARCHAR,
+		source    VARCHAR,
+		device    VARCHAR,
+		url       VARCHAR     NOT NULL,
+		timestamp TIMESTAMPTZ NOT NULL,
+		host              VARCHAR,
+		registered_domain VARCHAR,
+		canonical_url     VARCHAR,
+		search_vector TSVECTOR GENERATED ALWAYS AS (
+			setweight(to_tsvector('english', COALESCE(title, '')), 'A') ||
+			setweight(to_tsvector('simple', COALESCE(substring(url from '^[a-zA-Z][a-zA-Z0-9+.-]*://([^/?#:@]+)'), '')), 'B') ||
+			setweight(to_tsvector('simple', regexp_replace(url, '[^a-zA-Z0-9]+', ' ', 'g')), 'C')
+		) STORED,
+		PRIMARY KEY (id, timestamp)
+	) PARTITION BY RANGE (timestamp);
+	CREATE TABLE IF NOT EXISTS %[3]s PARTITION OF %[2]s DEFAULT;
+	CREATE INDEX IF NOT EXISTS ix_visit_created_at ON %[2]s USING btree (timestamp);
+	CREATE INDEX IF NOT EXISTS ix_visit_timestamp_id ON %[2]s USING btree (timestamp, id);
+	CREATE INDEX IF NOT EXISTS ix_visit_url ON %[2]s (url);
+	CREATE INDEX IF NOT EXISTS ix_visit_search_vector ON %[2]s USING gin (search_vector);
+	-- for the tables restored before the url derived columns were added
+	ALTER TABLE %[2]s
+		ADD COLUMN IF NOT EXISTS host              VARCHAR,
+		ADD COLUMN IF NOT EXISTS registered_domain VARCHAR,
+		ADD COLUMN IF NOT EXISTS canonical_url     VARCHAR;
+	CREATE INDEX IF NOT EXISTS ix_visit_host ON %[2]s (host);
+	CREATE INDEX IF NOT EXISTS ix_visit_registered_domain ON %[2]s (registered_domain);
+	CREATE INDEX IF NOT EXISTS ix_visit_canonical_url ON %[2]s (canonical_url);
+`
+
+// RestoreResult tells how many of the restored visits were added and how many existing ones were changed.
+// The rest were already in the table, unchanged.
+type RestoreResult struct {
+	Inserted int `json:"inserted"`
+	Updated  int `json:"updated"`
+}
+
+// RestoreVisits upserts the visits, keeping their IDs, into the visit table of the given schema, creating
+// the table first if needed. It's done in a single transaction, so a failed restore leaves no visits behind.
+func (r *Repo) RestoreVisits(ctx context.Context, schema string, visits []*Visit) (_ RestoreResult, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.restoreVisits")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	span.SetAttributes(attribute.String("schema", schema))
+	span.SetAttributes(attribute.Int("visits", len(visits)))
+
+	visitTable := pgx.Identifier{schema, "visit"}.Sanitize()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return RestoreResult{}, err
+	}
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			log.Errorf("restore visits, rollback: %s", err)
+		}
+	}()
+
+	if _, err := tx.Exec(ctx, fmt.Sprintf(
+		visitTableDDL,
+		pgx.Identifier{schema}.Sanitize(), visitTable, pgx.Identifier{schema, visitDefaultPartition}.Sanitize(),
+	)); err != nil {
+		return RestoreResult{}, fmt.Errorf("create visit table: %w", err)
+	}
+
+	// existing rows are only updated if they differ from the backup, xmax is 0 only for the inserted rows
+	upsertSQL := fmt.Sprintf(`
+		INSERT INTO %s AS v (id, title, source, device, url, timestamp, host, registered_domain, canonical_url)
+		SELECT * FROM unnest(
+			$1::int[], $2::varchar[], $3::varchar[], $4::varchar[], $5::varchar[], $6::timestamptz[],
+			$7::varchar[], $8::varchar[], $9::varchar[]
+		)
+		ON CONFLICT (id, timestamp) DO UPDATE SET
+			title = EXCLUDED.title,
+			source = EXCLUDED.source,
+			device = EXCLUDED.device,
+			url = EXCLUDED.url,
+			host = EXCLUDED.host,
+			registered_domain = EXCLUDED.registered_domain,
+			canonical_url = EXCLUDED.canonical_url
+		WHERE (COALESCE(v.title, ''), COALESCE(v.source, ''), COALESCE(v.device, ''), v.url)
+			IS DISTINCT FROM (EXCLUDED.title, EXCLUDED.source, EXCLUDED.device, EXCLUDED.url)
+		RETURNING (xmax = 0) AS inserted;
+	`, visitTable)
+
+	var result RestoreResult
+	for from := 0; from < len(visits); from += restoreBatchSize {
+		to := min(from+restoreBatchSize, len(visits))
+
+		batchSize := to - from
+		ids := make([]int, 0, batchSize)
+		titles := make([]string, 0, batchSize)
+		sources := make([]string, 0, batchSize)
+		devices := make([]string, 0, batchSize)
+		urls := make([]string, 0, batchSize)
+		timestamps := make([]time.Time, 0, batchSize)
+		hosts := make([]string, 0, batchSize)
+		registeredDomains := make([]string, 0, batchSize)
+		canonicalURLs := make([]string, 0, batchSize)
+		for _, v := range visits[from:to] {
+			// the derived fields are not in the older backups
+			v.DeriveURLFields()
+			ids = append(ids, v.Id)
+			titles = append(titles, v.Title)
+			sources = append(sources, v.Source)
+			devices = append(devices, v.Device)
+			urls = append(urls, v.URL)
+			timestamps = append(timestamps, v.Timestamp)
+			hosts = append(hosts, v.Host)
+			registeredDomains = append(registeredDomains, v.RegisteredDomain)
+			canonicalURLs = append(canonicalURLs, v.CanonicalURL)
+		}
+
+		rows, err := tx.Query(
+			ctx, upsertSQL,
+			ids, titles, sources, devices, urls, timestamps, hosts, registeredDomains, canonicalURLs,
+		)
+		if err != nil {
+			return RestoreResult{}, fmt.Errorf("upsert visits: %w", err)
+		}
+		inserted, err := pgx.CollectRows(rows, pgx.RowTo[bool])
+		if err != nil {
+			return RestoreResult{}, fmt.Errorf("upsert visits: %w", err)
+		}
+		for _, isInserted := range inserted {
+			if isInserted {
+				result.Inserted++
+			} else {
+				result.Updated++
+			}
+		}
+	}
+
+	// the IDs were set explicitly, so the sequence has to be moved past them for the new visits
+	if _, err := tx.Exec(
+		ctx,
+		fmt.Sprintf(`SELECT setval(pg_get_serial_sequence($1, 'id'), GREATEST((SELECT MAX(id) FROM %s), 1));`, visitTable),
+		visitTable,
+	); err != nil {
+		return RestoreResult{}, fmt.Errorf("update visit id sequence: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return RestoreResult{}, err
+	}
+
+	span.SetAttributes(attribute.Int("inserted", result.Inserted))
+	span.SetAttributes(attribute.Int("updated", result.Updated))
+	return result, nil
+}
+
+// GetAllSchemaVisits returns all visits from the visit table of the given schema, ordered by ID
+func (r *Repo) GetAllSchemaVisits(ctx context.Context, schema string) (_ []*Visit, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.getAllSchemaVisits")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	span.SetAttributes(attribute.String("schema", schema))
+
+	rows, err := r.db.Query(
+		ctx,
+		fmt.Sprintf(`
+			SELECT `+visitColumnsSQL+`
+			FROM %s
+			ORDER BY id;
+		`, pgx.Identifier{schema, "visit"}.Sanitize()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	visits, err := visitsFromRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("found-visits", len(visits)))
+	return visits, nil
+}
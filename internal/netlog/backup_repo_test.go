@@ -0,0 +1,58 @@
+//go:build all_tests
+
+package netlog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepo_RestoreVisits(t *testing.T) {
+	ctx := context.Background()
+	repo, shutdown := testRepoSetup(t)
+	defer shutdown()
+
+	const schema = "netlog_restore_test"
+	_, err := repo.db.Exec(ctx, `DROP SCHEMA IF EXISTS netlog_restore_test CASCADE`)
+	require.NoError(t, err)
+	defer func() {
+		_, err := repo.db.Exec(ctx, `DROP SCHEMA IF EXISTS netlog_restore_test CASCADE`)
+		assert.NoError(t, err)
+	}()
+
+	now := time.Now().Truncate(time.Microsecond)
+	visits := []*Visit{
+		{Id: 3, Title: "three", Source: "chrome", Device: "mb-serj", URL: "https://serj-tubin.com/3", Timestamp: now},
+		{Id: 7, Title: "seven", Source: "safari", Device: "iphone", URL: "https://serj-tubin.com/7", Timestamp: now.Add(time.Minute)},
+	}
+
+	// restoring into an empty schema creates the visit table
+	result, err := repo.RestoreVisits(ctx, schema, visits)
+	require.NoError(t, err)
+	assert.Equal(t, RestoreResult{Inserted: 2}, result)
+
+	// restoring again doesn't duplicate the visits, and only the changed ones are updated
+	changedVisit := *visits[1]
+	changedVisit.Title = "seven changed"
+	result, err = repo.RestoreVisits(ctx, schema, []*Visit{visits[0], &changedVisit})
+	require.NoError(t, err)
+	assert.Equal(t, RestoreResult{Updated: 1}, result)
+
+	restored, err := repo.GetAllSchemaVisits(ctx, schema)
+	require.NoError(t, err)
+	require.Len(t, restored, 2)
+	assert.True(t, sameVisit(visits[0], restored[0]))
+	assert.True(t, sameVisit(&changedVisit, restored[1]))
+
+	// new visits continue after the restored IDs
+	var nextId int
+	require.NoError(t, repo.db.QueryRow(
+		ctx,
+		`INSERT INTO netlog_restore_test.visit (url, timestamp) VALUES ('https://serj-tubin.com/new', now()) RETURNING id`,
+	).Scan(&nextId))
+	assert.Equal(t, 8, nextId)
+}
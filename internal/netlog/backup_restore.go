@@ -0,0 +1,257 @@
+package netlog
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/2beens/serjtubincom/internal/telemetry/tracing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrBackupChunkInvalid = errors.New("backup chunk invalid")
+)
+
+// BackupVerifyReport is the difference between the backup and the live visit table
+type BackupVerifyReport struct {
+	BackupVisits int
+	TableVisits  int
+	// MissingInTable are the IDs of the backed up visits not found in the table
+	MissingInTable []int
+	// Different are the IDs of the visits that differ between the backup and the table
+	Different []int
+	// NotInBackup are the IDs of the visits in the table that should have been backed up, but are not
+	NotInBackup []int
+	// NewerThanBackup is the number of visits added to the table after the last backup
+	NewerThanBackup int
+}
+
+func (r *BackupVerifyReport) OK() bool {
+	return len(r.MissingInTable) == 0 && len(r.Different) == 0 && len(r.NotInBackup) == 0
+}
+
+// LoadBackup downloads all the chunks listed in the backup manifest and validates them against it.
+// Returned visits are ordered by ID, and the visits found in more than one chunk are returned once.
+func (s *BackupService) LoadBackup(ctx context.Context) ([]*Visit, error) {
+	ctx, span := tracing.GlobalNetlogBackupTracer.Start(ctx, "netlogService.loadBackup")
+	defer span.End()
+
+	manifest, err := s.target.GetManifest(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get backup manifest: %w", err)
+	}
+
+	files, err := s.target.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list backup files: %w", err)
+	}
+	filesByName := make(map[string]BackupFile, len(files))
+	for _, f := range files {
+		filesByName[f.Name] = f
+	}
+
+	// only the latest chain is loaded, the older ones are kept by the retention policy
+	chunks := manifest.lastChainChunks()
+	visitsById := map[int]*Visit{}
+	for i, chunk := range chunks {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		file, ok := filesByName[chunk.Name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s: file not found on %s", ErrBackupChunkInvalid, chunk.Name, s.target.Name())
+		}
+
+		log.Printf("%s: loading backup chunk [%d / %d] ...", chunk.Name, i+1, len(chunks))
+		chunkJson, err := s.target.Download(ctx, file)
+		if err != nil {
+			return nil, fmt.Errorf("download %s: %w", chunk.Name, err)
+		}
+
+		chunkJson, err = s.codec.Decode(chunk.Name, chunk.Format, chunkJson)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: decode: %w", ErrBackupChunkInvalid, chunk.Name, err)
+		}
+
+		visits, err := validateBackupChunk(chunk, chunkJson)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, v := range visits {
+			visitsById[v.Id] = v
+		}
+	}
+
+	for _, chunk := range manifest.Chunks {
+		delete(filesByName, chunk.Name)
+	}
+	for name := range filesByName {
+		log.Printf("!! warning, backup file [%s] not in the manifest, skipping it", name)
+	}
+
+	visits := make([]*Visit, 0, len(visitsById))
+	for _, v := range visitsById {
+		visits = append(visits, v)
+	}
+	sort.Slice(visits, func(i, j int) bool {
+		return visits[i].Id < visits[j].Id
+	})
+
+	return visits, nil
+}
+
+// Restore upserts all the backed up visits into the visit table of the given schema. Nothing is
+// restored if any of the backup chunks is invalid.
+func (s *BackupService) Restore(ctx context.Context, schema string) (RestoreResult, error) {
+	ctx, span := tracing.GlobalNetlogBackupTracer.Start(ctx, "netlogService.restore")
+	defer span.End()
+
+	visits, err := s.LoadBackup(ctx)
+	if err != nil {
+		return RestoreResult{}, err
+	}
+
+	log.Printf("restoring %d visits into %s.visit ...", len(visits), schema)
+
+	return s.repo.RestoreVisits(ctx, schema, visits)
+}
+
+// Verify compares the backed up visits with the ones in the visit table of the given schema
+func (s *BackupService) Verify(ctx context.Context, schema string) (*BackupVerifyReport, error) {
+	ctx, span := tracing.GlobalNetlogBackupTracer.Start(ctx, "netlogService.verify")
+	defer span.End()
+
+	backupVisits, err := s.LoadBackup(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tableVisits, err := s.repo.GetAllSchemaVisits(ctx, schema)
+	if err != nil {
+		return nil, fmt.Errorf("get table visits: %w", err)
+	}
+
+	return diffBackupVisits(backupVisits, tableVisits), nil
+}
+
+// diffBackupVisits expects the backup visits to be ordered by ID
+func diffBackupVisits(backupVisits, tableVisits []*Visit) *BackupVerifyReport {
+	report := &BackupVerifyReport{
+		BackupVisits: len(backupVisits),
+		TableVisits:  len(tableVisits),
+	}
+
+	lastBackedUpId := 0
+	if len(backupVisits) > 0 {
+		lastBackedUpId = backupVisits[len(backupVisits)-1].Id
+	}
+
+	tableVisitsById := make(map[int]*Visit, len(tableVisits))
+	for _, v := range tableVisits {
+		tableVisitsById[v.Id] = v
+	}
+
+	backupIds := make(map[int]bool, len(backupVisits))
+	for _, bv := range backupVisits {
+		backupIds[bv.Id] = true
+		tv, ok := tableVisitsById[bv.Id]
+		if !ok {
+			report.MissingInTable = append(report.MissingInTable, bv.Id)
+			continue
+		}
+		if !sameVisit(bv, tv) {
+			report.Different = append(report.Different, bv.Id)
+		}
+	}
+
+	for _, tv := range tableVisits {
+		if backupIds[tv.Id] {
+			continue
+		}
+		if tv.Id > lastBackedUpId {
+			report.NewerThanBackup++
+		} else {
+			report.NotInBackup = append(report.NotInBackup, tv.Id)
+		}
+	}
+	sort.Ints(report.NotInBackup)
+
+	return report
+}
+
+func sameVisit(a, b *Visit) bool {
+	return a.Id == b.Id &&
+		a.Title == b.Title &&
+		a.Source == b.Source &&
+		a.Device == b.Device &&
+		a.URL == b.URL &&
+		a.Timestamp.Equal(b.Timestamp)
+}
+
+// validateBackupChunk parses the chunk visits, and checks them against the checksum and the
+// visit IDs range from the manifest
+func validateBackupChunk(chunk BackupChunk, chunkJson []byte) ([]*Visit, error) {
+	// google drive adds the BOM to the exported files, see manifestFromLastFile
+	chunkJson = bytes.TrimPrefix(chunkJson, []byte("\xef\xbb\xbf"))
+
+	var visits []*Visit
+	if err := json.Unmarshal(chunkJson, &visits); err != nil {
+		return nil, fmt.Errorf("%w: %s: unmarshal visits: %s", ErrBackupChunkInvalid, chunk.Name, err)
+	}
+
+	if chunk.Checksum == "" {
+		log.Printf("!! warning, backup chunk [%s] has no checksum, it can't be verified", chunk.Name)
+		return visits, nil
+	}
+
+	// the checksum is calculated over the re-encoded visits, as the targets are not guaranteed
+	// to return the exact same bytes (e.g. google drive export)
+	reencodedJson, err := json.Marshal(visits)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: marshal visits: %s", ErrBackupChunkInvalid, chunk.Name, err)
+	}
+	if checksum := chunkChecksum(reencodedJson); checksum != chunk.Checksum {
+		return nil, fmt.Errorf("%w: %s: checksum mismatch, expected %s, got %s", ErrBackupChunkInvalid, chunk.Name, chunk.Checksum, checksum)
+	}
+
+	if len(visits) != chunk.VisitsCount {
+		return nil, fmt.Errorf("%w: %s: expected %d visits, got %d", ErrBackupChunkInvalid, chunk.Name, chunk.VisitsCount, len(visits))
+	}
+
+	firstVisitId, lastVisitId := visitIdsRange(visits)
+	if firstVisitId != chunk.FirstVisitId || lastVisitId != chunk.LastVisitId {
+		return nil, fmt.Errorf(
+			"%w: %s: expected visit IDs [%d, %d], got [%d, %d]",
+			ErrBackupChunkInvalid, chunk.Name, chunk.FirstVisitId, chunk.LastVisitId, firstVisitId, lastVisitId,
+		)
+	}
+
+	return visits, nil
+}
+
+func chunkChecksum(chunkJson []byte) string {
+	hash := sha256.Sum256(chunkJson)
+	return hex.EncodeToString(hash[:])
+}
+
+// visitIdsRange returns the lowest and the highest visit ID
+func visitIdsRange(visits []*Visit) (int, int) {
+	if len(visits) == 0 {
+		return 0, 0
+	}
+	first, last := visits[0].Id, visits[0].Id
+	for _, v := range visits[1:] {
+		first = min(first, v.Id)
+		last = max(last, v.Id)
+	}
+	return first, last
+}
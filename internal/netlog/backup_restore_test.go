@@ -0,0 +1,184 @@
+package netlog
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testBackupSetup(t *testing.T, visitsCount int) (*BackupService, *backupRepoMock, *LocalBackupTarget) {
+	t.Helper()
+
+	target, err := NewLocalBackupTarget(t.TempDir())
+	require.NoError(t, err)
+
+	repo := &backupRepoMock{
+		visits: testVisits(1, visitsCount, time.Now().Add(-24*time.Hour)),
+	}
+	s := NewBackupService(BackupServiceParams{
+		Repo:                     repo,
+		Target:                   target,
+		NetlogUnixSocketAddrDir:  t.TempDir(),
+		NetlogUnixSocketFileName: "none.sock",
+	})
+	require.NoError(t, s.DoBackup(context.Background(), time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)))
+
+	return s, repo, target
+}
+
+func TestBackupService_Restore(t *testing.T) {
+	ctx := context.Background()
+	s, repo, target := testBackupSetup(t, visitsFileChunkSize+10)
+
+	manifest, err := target.GetManifest(ctx)
+	require.NoError(t, err)
+	require.Len(t, manifest.Chunks, 2)
+	assert.Equal(t, 1, manifest.Chunks[0].FirstVisitId)
+	assert.Equal(t, visitsFileChunkSize, manifest.Chunks[0].LastVisitId)
+	assert.Equal(t, visitsFileChunkSize+1, manifest.Chunks[1].FirstVisitId)
+	assert.Equal(t, visitsFileChunkSize+10, manifest.Chunks[1].LastVisitId)
+	assert.NotEmpty(t, manifest.Chunks[1].Checksum)
+
+	result, err := s.Restore(ctx, "netlog_restored")
+	require.NoError(t, err)
+	assert.Equal(t, visitsFileChunkSize+10, result.Inserted)
+
+	restored := repo.restored["netlog_restored"]
+	require.Len(t, restored, len(repo.visits))
+	for i := range repo.visits {
+		assert.True(t, sameVisit(repo.visits[i], restored[i]), "visit %d", repo.visits[i].Id)
+	}
+}
+
+func TestBackupService_Restore_InvalidChunk(t *testing.T) {
+	ctx := context.Background()
+	s, repo, target := testBackupSetup(t, 5)
+
+	manifest, err := target.GetManifest(ctx)
+	require.NoError(t, err)
+	require.Len(t, manifest.Chunks, 1)
+
+	// a tampered visit in the chunk
+	visits := testVisits(1, 5, time.Now())
+	visits[2].URL = "https://tampered.com"
+	visitsJson, err := json.Marshal(visits)
+	require.NoError(t, err)
+	_, err = target.UploadChunk(ctx, manifest.Chunks[0].Name, visitsJson)
+	require.NoError(t, err)
+
+	_, err = s.Restore(ctx, DefaultVisitsSchema)
+	require.ErrorIs(t, err, ErrBackupChunkInvalid)
+	assert.ErrorContains(t, err, "checksum mismatch")
+	assert.Empty(t, repo.restored)
+
+	// a chunk file missing
+	require.NoError(t, target.Delete(ctx, BackupFile{Name: manifest.Chunks[0].Name}))
+	_, err = s.Restore(ctx, DefaultVisitsSchema)
+	require.ErrorIs(t, err, ErrBackupChunkInvalid)
+	assert.ErrorContains(t, err, "file not found")
+	assert.Empty(t, repo.restored)
+}
+
+func TestBackupService_Restore_NoManifest(t *testing.T) {
+	target, err := NewLocalBackupTarget(t.TempDir())
+	require.NoError(t, err)
+	s := NewBackupService(BackupServiceParams{
+		Repo:                     &backupRepoMock{},
+		Target:                   target,
+		NetlogUnixSocketAddrDir:  t.TempDir(),
+		NetlogUnixSocketFileName: "none.sock",
+	})
+
+	_, err = s.Restore(context.Background(), DefaultVisitsSchema)
+	assert.ErrorIs(t, err, ErrBackupManifestNotFound)
+}
+
+func TestBackupService_Verify(t *testing.T) {
+	ctx := context.Background()
+	s, repo, _ := testBackupSetup(t, 10)
+
+	report, err := s.Verify(ctx, DefaultVisitsSchema)
+	require.NoError(t, err)
+	assert.True(t, report.OK())
+	assert.Equal(t, 10, report.BackupVisits)
+	assert.Equal(t, 10, report.TableVisits)
+
+	// visit 3 deleted, visit 5 changed, visit 11 added after the backup
+	tableVisits := append([]*Visit{}, repo.visits[:2]...)
+	tableVisits = append(tableVisits, repo.visits[3:]...)
+	changedVisit := *tableVisits[3]
+	changedVisit.Title = "changed title"
+	tableVisits[3] = &changedVisit
+	tableVisits = append(tableVisits, testVisits(11, 1, time.Now())...)
+	repo.visits = tableVisits
+
+	report, err = s.Verify(ctx, DefaultVisitsSchema)
+	require.NoError(t, err)
+	assert.False(t, report.OK())
+	assert.Equal(t, []int{3}, report.MissingInTable)
+	assert.Equal(t, []int{5}, report.Different)
+	assert.Empty(t, report.NotInBackup)
+	assert.Equal(t, 1, report.NewerThanBackup)
+}
+
+func Test_diffBackupVisits(t *testing.T) {
+	now := time.Now()
+	// visit 4 never made it to the backup
+	backupVisits := testVisits(1, 5, now)
+	backupVisits = append(backupVisits[:3], backupVisits[4])
+
+	tableVisits := testVisits(1, 6, now)
+	tableVisits[0].Timestamp = tableVisits[0].Timestamp.Add(time.Second)
+
+	report := diffBackupVisits(backupVisits, tableVisits)
+	assert.False(t, report.OK())
+	assert.Empty(t, report.MissingInTable)
+	assert.Equal(t, []int{1}, report.Different)
+	assert.Equal(t, []int{4}, report.NotInBackup)
+	assert.Equal(t, 1, report.NewerThanBackup)
+}
+
+func Test_validateBackupChunk(t *testing.T) {
+	visits := testVisits(10, 3, time.Now())
+	visitsJson, err := json.Marshal(visits)
+	require.NoError(t, err)
+
+	chunk := BackupChunk{
+		Name:         "chunk_1.json",
+		VisitsCount:  3,
+		Checksum:     chunkChecksum(visitsJson),
+		FirstVisitId: 10,
+		LastVisitId:  12,
+	}
+
+	validated, err := validateBackupChunk(chunk, visitsJson)
+	require.NoError(t, err)
+	assert.Len(t, validated, 3)
+
+	// google drive export adds the BOM
+	validated, err = validateBackupChunk(chunk, append([]byte("\xef\xbb\xbf"), visitsJson...))
+	require.NoError(t, err)
+	assert.Len(t, validated, 3)
+
+	wrongRange := chunk
+	wrongRange.LastVisitId = 13
+	_, err = validateBackupChunk(wrongRange, visitsJson)
+	assert.ErrorIs(t, err, ErrBackupChunkInvalid)
+
+	wrongCount := chunk
+	wrongCount.VisitsCount = 4
+	_, err = validateBackupChunk(wrongCount, visitsJson)
+	assert.ErrorIs(t, err, ErrBackupChunkInvalid)
+
+	_, err = validateBackupChunk(chunk, []byte("[{"))
+	assert.ErrorIs(t, err, ErrBackupChunkInvalid)
+
+	// legacy chunks without the checksum are not verified
+	validated, err = validateBackupChunk(BackupChunk{Name: "legacy.json"}, visitsJson)
+	require.NoError(t, err)
+	assert.Len(t, validated, 3)
+}
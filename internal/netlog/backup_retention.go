@@ -0,0 +1,215 @@
+package netlog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/2beens/serjtubincom/internal/telemetry/tracing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// BackupRetentionPolicy selects the backup runs (restore points) to keep: the last N runs, and the last
+// run of each of the last days, weeks and months (grandfather-father-son rotation). The latest run is
+// always kept. Keeping a run keeps its whole chain, see BackupManifestRun.
+type BackupRetentionPolicy struct {
+	KeepLast    int
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+	// FullEvery is how often a full backup starts a new chain of runs. Without the full backups all
+	// the runs are in the same chain, and no run can be pruned.
+	FullEvery time.Duration
+}
+
+func (p BackupRetentionPolicy) enabled() bool {
+	return p.KeepLast > 0 || p.KeepDaily > 0 || p.KeepWeekly > 0 || p.KeepMonthly > 0
+}
+
+// BackupPruneReport is what was (or would be, in a dry run) pruned from the backup target
+type BackupPruneReport struct {
+	KeptRuns   []BackupManifestRun
+	PrunedRuns []BackupManifestRun
+	// PrunedChunks are the manifest chunks of the pruned runs
+	PrunedChunks []string
+	// OrphanFiles are the backup files not in the manifest, e.g. left from the interrupted runs
+	OrphanFiles []string
+}
+
+// Prune applies the retention policy, and deletes the backup files of the pruned runs, together with the
+// files not in the manifest. The manifest is saved before the files are deleted, so the files failed to
+// be deleted end up as orphans, and are deleted by the next prune.
+func (s *BackupService) Prune(ctx context.Context, dryRun bool) (*BackupPruneReport, error) {
+	ctx, span := tracing.GlobalNetlogBackupTracer.Start(ctx, "netlogService.prune")
+	defer span.End()
+
+	manifest, err := s.target.GetManifest(ctx)
+	if errors.Is(err, ErrBackupManifestNotFound) {
+		// without the manifest, the needed files are not known
+		log.Println("backup manifest not found, nothing to prune")
+		return &BackupPruneReport{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get backup manifest: %w", err)
+	}
+
+	files, err := s.target.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list backup files: %w", err)
+	}
+
+	report, prunedManifest := pruneManifest(manifest, s.retention)
+
+	manifestChunks := make(map[string]bool, len(manifest.Chunks))
+	for _, chunk := range manifest.Chunks {
+		manifestChunks[chunk.Name] = true
+	}
+	prunedChunks := make(map[string]bool, len(report.PrunedChunks))
+	for _, name := range report.PrunedChunks {
+		prunedChunks[name] = true
+	}
+
+	var filesToDelete []BackupFile
+	for _, f := range files {
+		if !manifestChunks[f.Name] {
+			report.OrphanFiles = append(report.OrphanFiles, f.Name)
+			filesToDelete = append(filesToDelete, f)
+		} else if prunedChunks[f.Name] {
+			filesToDelete = append(filesToDelete, f)
+		}
+	}
+
+	log.Printf(
+		"backup prune on %s: keeping %d runs, pruning %d runs (%d chunks), %d orphan files",
+		s.target.Name(), len(report.KeptRuns), len(report.PrunedRuns), len(report.PrunedChunks), len(report.OrphanFiles),
+	)
+	if dryRun || len(filesToDelete) == 0 {
+		return report, nil
+	}
+
+	if len(report.PrunedRuns) > 0 {
+		prunedManifest.UpdatedAt = time.Now()
+		if err := s.target.SaveManifest(ctx, prunedManifest); err != nil {
+			return nil, fmt.Errorf("save pruned backup manifest: %w", err)
+		}
+	}
+
+	failed := 0
+	for _, f := range filesToDelete {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.Printf("deleting backup file: %s ...", f.Name)
+		if err := s.target.Delete(ctx, f); err != nil {
+			log.Printf("failed to delete backup file %s: %s", f.Name, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return report, fmt.Errorf("failed to delete %d / %d backup files", failed, len(filesToDelete))
+	}
+
+	return report, nil
+}
+
+// pruneManifest returns the manifest without the runs not selected by the retention policy, and without
+// the chunks of those runs
+func pruneManifest(manifest *BackupManifest, policy BackupRetentionPolicy) (*BackupPruneReport, *BackupManifest) {
+	report := &BackupPruneReport{}
+	if len(manifest.Runs) == 0 {
+		return report, manifest
+	}
+
+	keep := selectRetainedRuns(manifest.Runs, policy)
+
+	// a kept run needs all the runs of its chain
+	keepLegacyChunks := false
+	for i := len(manifest.Runs) - 1; i >= 0; i-- {
+		if !keep[i] {
+			continue
+		}
+		j := i
+		for ; j > 0 && !manifest.Runs[j].Full; j-- {
+			keep[j-1] = true
+		}
+		if !manifest.Runs[j].Full {
+			keepLegacyChunks = true
+		}
+	}
+
+	runChunks := map[string]bool{}
+	keptChunks := map[string]bool{}
+	pruned := *manifest
+	pruned.Runs = nil
+	for i, run := range manifest.Runs {
+		for _, name := range run.Chunks {
+			runChunks[name] = true
+			if keep[i] {
+				keptChunks[name] = true
+			}
+		}
+		if keep[i] {
+			pruned.Runs = append(pruned.Runs, run)
+			report.KeptRuns = append(report.KeptRuns, run)
+		} else {
+			report.PrunedRuns = append(report.PrunedRuns, run)
+		}
+	}
+
+	pruned.Chunks = nil
+	for _, chunk := range manifest.Chunks {
+		// the legacy chunks are the ones from before the runs were kept track of
+		isLegacy := !runChunks[chunk.Name]
+		if keptChunks[chunk.Name] || (isLegacy && keepLegacyChunks) {
+			pruned.Chunks = append(pruned.Chunks, chunk)
+		} else {
+			report.PrunedChunks = append(report.PrunedChunks, chunk.Name)
+		}
+	}
+
+	return report, &pruned
+}
+
+// selectRetainedRuns expects the runs to be ordered by their start time, as they are in the manifest
+func selectRetainedRuns(runs []BackupManifestRun, policy BackupRetentionPolicy) []bool {
+	keep := make([]bool, len(runs))
+	if len(runs) == 0 {
+		return keep
+	}
+	if !policy.enabled() {
+		for i := range keep {
+			keep[i] = true
+		}
+		return keep
+	}
+
+	keep[len(runs)-1] = true
+	for i := max(0, len(runs)-policy.KeepLast); i < len(runs); i++ {
+		keep[i] = true
+	}
+
+	keepLastOfPeriod := func(count int, period func(t time.Time) string) {
+		seen := map[string]bool{}
+		for i := len(runs) - 1; i >= 0 && len(seen) < count; i-- {
+			p := period(runs[i].StartedAt)
+			if !seen[p] {
+				seen[p] = true
+				keep[i] = true
+			}
+		}
+	}
+	keepLastOfPeriod(policy.KeepDaily, func(t time.Time) string {
+		return t.Format(time.DateOnly)
+	})
+	keepLastOfPeriod(policy.KeepWeekly, func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-%d", year, week)
+	})
+	keepLastOfPeriod(policy.KeepMonthly, func(t time.Time) string {
+		return t.Format("2006-01")
+	})
+
+	return keep
+}
@@ -0,0 +1,174 @@
+package netlog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_selectRetainedRuns(t *testing.T) {
+	// two runs a day, from Mon 1 Jan 2024 to Wed 14 Feb 2024
+	start := time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)
+	var runs []BackupManifestRun
+	for day := 0; day < 45; day++ {
+		runs = append(runs,
+			BackupManifestRun{StartedAt: start.AddDate(0, 0, day)},
+			BackupManifestRun{StartedAt: start.AddDate(0, 0, day).Add(12 * time.Hour)},
+		)
+	}
+	last := len(runs) - 1
+
+	keptIndexes := func(policy BackupRetentionPolicy) []int {
+		var kept []int
+		for i, keep := range selectRetainedRuns(runs, policy) {
+			if keep {
+				kept = append(kept, i)
+			}
+		}
+		return kept
+	}
+
+	// no policy keeps everything
+	assert.Len(t, keptIndexes(BackupRetentionPolicy{}), len(runs))
+
+	assert.Equal(t, []int{last - 2, last - 1, last}, keptIndexes(BackupRetentionPolicy{KeepLast: 3}))
+
+	// the last run of each of the last 3 days
+	assert.Equal(t, []int{last - 4, last - 2, last}, keptIndexes(BackupRetentionPolicy{KeepDaily: 3}))
+
+	// the last run of the week of 12 Feb, 5 Feb and 29 Jan (Sunday the 4th and the 11th)
+	assert.Equal(t, []int{last - 2*10, last - 2*3, last}, keptIndexes(BackupRetentionPolicy{KeepWeekly: 3}))
+
+	// the last run of February and January
+	assert.Equal(t, []int{2*31 - 1, last}, keptIndexes(BackupRetentionPolicy{KeepMonthly: 2}))
+
+	assert.Equal(
+		t,
+		[]int{2*31 - 1, last - 2*10, last - 2*3, last - 2, last - 1, last},
+		keptIndexes(BackupRetentionPolicy{KeepLast: 2, KeepDaily: 2, KeepWeekly: 3, KeepMonthly: 2}),
+	)
+}
+
+func Test_pruneManifest(t *testing.T) {
+	start := time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)
+	manifest := &BackupManifest{
+		LastVisitId: 100,
+		Chunks: []BackupChunk{
+			{Name: "legacy_1.json"}, {Name: "a_1.json"},
+			{Name: "b_1.json"}, {Name: "b_2.json"}, {Name: "c_1.json"},
+			{Name: "d_1.json"}, {Name: "e_1.json"},
+		},
+		Runs: []BackupManifestRun{
+			// the first chain continues the legacy chunks
+			{StartedAt: start, Chunks: []string{"a_1.json"}},
+			{StartedAt: start.AddDate(0, 0, 1), Full: true, Chunks: []string{"b_1.json", "b_2.json"}},
+			{StartedAt: start.AddDate(0, 0, 2), Chunks: []string{"c_1.json"}},
+			{StartedAt: start.AddDate(0, 0, 3), Full: true, Chunks: []string{"d_1.json"}},
+			{StartedAt: start.AddDate(0, 0, 4), Chunks: []string{"e_1.json"}},
+		},
+	}
+
+	chunkNames := func(chunks []BackupChunk) []string {
+		var names []string
+		for _, c := range chunks {
+			names = append(names, c.Name)
+		}
+		return names
+	}
+
+	// the last run needs the last full run too
+	report, pruned := pruneManifest(manifest, BackupRetentionPolicy{KeepLast: 1})
+	assert.Len(t, report.KeptRuns, 2)
+	assert.Len(t, report.PrunedRuns, 3)
+	assert.Equal(t, []string{"legacy_1.json", "a_1.json", "b_1.json", "b_2.json", "c_1.json"}, report.PrunedChunks)
+	assert.Equal(t, []string{"d_1.json", "e_1.json"}, chunkNames(pruned.Chunks))
+	assert.Equal(t, manifest.Runs[3:], pruned.Runs)
+	assert.Equal(t, 100, pruned.LastVisitId)
+	assert.Equal(t, []string{"d_1.json", "e_1.json"}, chunkNames(pruned.lastChainChunks()))
+	// the original manifest is not changed
+	assert.Len(t, manifest.Runs, 5)
+
+	report, pruned = pruneManifest(manifest, BackupRetentionPolicy{KeepLast: 3})
+	assert.Len(t, report.PrunedRuns, 1)
+	assert.Equal(t, []string{"legacy_1.json", "a_1.json"}, report.PrunedChunks)
+	assert.Equal(t, manifest.Runs[1:], pruned.Runs)
+
+	// keeping the first run keeps the legacy chunks
+	report, pruned = pruneManifest(manifest, BackupRetentionPolicy{KeepLast: 1, KeepDaily: 5})
+	assert.Empty(t, report.PrunedRuns)
+	assert.Empty(t, report.PrunedChunks)
+	assert.Len(t, pruned.Chunks, 7)
+
+	// without a full run, all the runs are one chain
+	noFullManifest := &BackupManifest{
+		Chunks: []BackupChunk{{Name: "legacy_1.json"}, {Name: "a_1.json"}, {Name: "b_1.json"}},
+		Runs: []BackupManifestRun{
+			{StartedAt: start, Chunks: []string{"a_1.json"}},
+			{StartedAt: start.AddDate(0, 0, 1), Chunks: []string{"b_1.json"}},
+		},
+	}
+	report, _ = pruneManifest(noFullManifest, BackupRetentionPolicy{KeepLast: 1})
+	assert.Empty(t, report.PrunedRuns)
+	assert.Empty(t, report.PrunedChunks)
+}
+
+func TestBackupService_Prune(t *testing.T) {
+	ctx := context.Background()
+	target, err := NewLocalBackupTarget(t.TempDir())
+	require.NoError(t, err)
+
+	repo := &backupRepoMock{
+		visits: testVisits(1, 5, time.Now().Add(-time.Hour)),
+	}
+	s := NewBackupService(BackupServiceParams{
+		Repo:   repo,
+		Target: target,
+		Retention: BackupRetentionPolicy{
+			KeepLast: 1,
+			// every run is a full one
+			FullEvery: time.Nanosecond,
+		},
+		NetlogUnixSocketAddrDir:  t.TempDir(),
+		NetlogUnixSocketFileName: "none.sock",
+	})
+
+	baseTime := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, s.DoBackup(ctx, baseTime))
+
+	// e.g. left from an interrupted run
+	_, err = target.UploadChunk(ctx, "netlog-visits-9-5-2024_1.json", []byte("[]"))
+	require.NoError(t, err)
+
+	// dry run deletes nothing
+	report, err := s.Prune(ctx, true)
+	require.NoError(t, err)
+	assert.Len(t, report.KeptRuns, 1)
+	assert.Empty(t, report.PrunedRuns)
+	assert.Equal(t, []string{"netlog-visits-9-5-2024_1.json"}, report.OrphanFiles)
+	files, err := target.List(ctx)
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	// the next run is a full one, so the first one is pruned after it
+	repo.visits = append(repo.visits, testVisits(6, 3, time.Now())...)
+	require.NoError(t, s.DoBackup(ctx, baseTime.AddDate(0, 0, 1)))
+
+	files, err = target.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "full-11-5-2024_1.json", files[0].Name)
+
+	manifest, err := target.GetManifest(ctx)
+	require.NoError(t, err)
+	require.Len(t, manifest.Runs, 1)
+	assert.True(t, manifest.Runs[0].Full)
+	assert.Equal(t, []string{"full-11-5-2024_1.json"}, manifest.Runs[0].Chunks)
+
+	verifyReport, err := s.Verify(ctx, DefaultVisitsSchema)
+	require.NoError(t, err)
+	assert.True(t, verifyReport.OK())
+	assert.Equal(t, 8, verifyReport.BackupVisits)
+}
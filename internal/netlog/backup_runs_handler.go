@@ -0,0 +1,141 @@
+package netlog
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/2beens/serjtubincom/internal/telemetry/tracing"
+	"github.com/2beens/serjtubincom/pkg"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultBackupRunsLimit = 20
+	maxBackupRunsLimit     = 100
+
+	backupRunsCheckInterval = 6 * time.Hour
+)
+
+type BackupRunsResponse struct {
+	LastSuccess *BackupRun `json:"last_success"`
+	// DaysSinceLastSuccess is -1 if there was no successful backup run
+	DaysSinceLastSuccess     float64      `json:"days_since_last_success"`
+	FailuresSinceLastSuccess int          `json:"failures_since_last_success"`
+	Runs                     []*BackupRun `json:"runs"`
+}
+
+func backupRunsStatus(ctx context.Context, repo netlogRepo, limit int) (*BackupRunsResponse, error) {
+	lastSuccess, err := repo.GetLastSuccessfulBackupRun(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &BackupRunsResponse{
+		LastSuccess:          lastSuccess,
+		DaysSinceLastSuccess: -1,
+		Runs:                 []*BackupRun{},
+	}
+
+	failuresSince := time.Time{}
+	if lastSuccess != nil {
+		resp.DaysSinceLastSuccess = time.Since(lastSuccess.UpdatedAt).Hours() / 24
+		failuresSince = lastSuccess.StartedAt
+	}
+	if resp.FailuresSinceLastSuccess, err = repo.CountFailedBackupRuns(ctx, failuresSince); err != nil {
+		return nil, err
+	}
+
+	if limit > 0 {
+		runs, err := repo.GetBackupRuns(ctx, limit)
+		if err != nil {
+			return nil, err
+		}
+		if runs != nil {
+			resp.Runs = runs
+		}
+	}
+
+	return resp, nil
+}
+
+// handleBackupRuns returns the netlog backup runs status and history, with the optional <limit> URL query param
+func (handler *Handler) handleBackupRuns(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.GlobalTracer.Start(r.Context(), "netlogHandler.backupRuns")
+	defer span.End()
+
+	limit := defaultBackupRunsLimit
+	if limitRaw := r.URL.Query().Get("limit"); limitRaw != "" {
+		var err error
+		limit, err = strconv.Atoi(limitRaw)
+		if err != nil || limit < 1 || limit > maxBackupRunsLimit {
+			http.Error(w, "invalid <limit>, has to be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+	}
+
+	resp, err := backupRunsStatus(ctx, handler.repo, limit)
+	if err != nil {
+		log.Errorf("get netlog backup runs: %s", err)
+		http.Error(w, "failed to get netlog backup runs", http.StatusInternalServerError)
+		return
+	}
+
+	pkg.SendJsonResponse(w, http.StatusOK, resp)
+}
+
+// MonitorBackupRuns periodically checks when was the last successful backup, and logs an error (which
+// ends up in sentry) if it was more than maxDaysWithoutBackup days ago. It blocks until the context is done.
+func MonitorBackupRuns(ctx context.Context, repo netlogRepo, maxDaysWithoutBackup int) {
+	if maxDaysWithoutBackup <= 0 {
+		log.Debugln("netlog backup runs monitor disabled")
+		return
+	}
+
+	ticker := time.NewTicker(backupRunsCheckInterval)
+	defer ticker.Stop()
+
+	monitorStart := time.Now()
+	for {
+		if err := checkBackupRuns(ctx, repo, maxDaysWithoutBackup, monitorStart); err != nil {
+			log.Errorf("netlog backup runs monitor: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkBackupRuns returns an error if the backup is overdue. With no backup runs at all (e.g. the runs
+// history is new), the backup is overdue only if it did not happen since the monitor started.
+func checkBackupRuns(ctx context.Context, repo netlogRepo, maxDaysWithoutBackup int, monitorStart time.Time) error {
+	status, err := backupRunsStatus(ctx, repo, 0)
+	if err != nil {
+		return err
+	}
+
+	maxDuration := time.Duration(maxDaysWithoutBackup) * 24 * time.Hour
+	if status.LastSuccess == nil {
+		if time.Since(monitorStart) > maxDuration {
+			return fmt.Errorf(
+				"no successful netlog backup run found in the last %d days, failed runs: %d",
+				maxDaysWithoutBackup, status.FailuresSinceLastSuccess,
+			)
+		}
+		return nil
+	}
+	if status.DaysSinceLastSuccess > float64(maxDaysWithoutBackup) {
+		return fmt.Errorf(
+			"no successful netlog backup in the last %d days, last one at %s, failed runs since: %d",
+			maxDaysWithoutBackup, status.LastSuccess.UpdatedAt.Format(time.RFC3339), status.FailuresSinceLastSuccess,
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package netlog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/2beens/serjtubincom/internal/auth"
+	"github.com/2beens/serjtubincom/internal/telemetry/metrics"
+
+	"github.com/go-redis/redismock/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetlogHandler_backupRuns(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	repo := NewRepoMock()
+	m := metrics.NewTestManager()
+	loginChecker := auth.NewLoginChecker(time.Hour, db)
+	r := setupNetlogRouterForTests(t, repo, m, loginChecker, "beer")
+
+	get := func(path string) *httptest.ResponseRecorder {
+		mock.ExpectGet("serj-service-session||tokenAbc123").SetVal(fmt.Sprintf("%d", time.Now().Unix()))
+
+		req, err := http.NewRequest("GET", path, nil)
+		require.NoError(t, err)
+		req.Header.Set("Origin", "test")
+		req.Header.Set("X-SERJ-TOKEN", "tokenAbc123")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// no backup runs yet
+	rr := get("/netlog/backups")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var resp BackupRunsResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Nil(t, resp.LastSuccess)
+	assert.Equal(t, -1.0, resp.DaysSinceLastSuccess)
+	assert.Empty(t, resp.Runs)
+
+	now := time.Now()
+	repo.BackupRuns = map[string]*BackupRun{
+		"a": {RunId: "a", Status: BackupRunFinished, StartedAt: now.Add(-50 * time.Hour), UpdatedAt: now.Add(-48 * time.Hour), VisitsCount: 120},
+		"b": {RunId: "b", Status: BackupRunFailed, StartedAt: now.Add(-24 * time.Hour), Error: "upload failed"},
+		"c": {RunId: "c", Status: BackupRunFailed, StartedAt: now.Add(-time.Hour), Error: "upload failed"},
+		"d": {RunId: "d", Status: BackupRunFailed, StartedAt: now.Add(-100 * time.Hour)},
+	}
+
+	rr = get("/netlog/backups?limit=2")
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	resp = BackupRunsResponse{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	require.NotNil(t, resp.LastSuccess)
+	assert.Equal(t, "a", resp.LastSuccess.RunId)
+	assert.Equal(t, 120, resp.LastSuccess.VisitsCount)
+	assert.InDelta(t, 2.0, resp.DaysSinceLastSuccess, 0.01)
+	assert.Equal(t, 2, resp.FailuresSinceLastSuccess)
+	require.Len(t, resp.Runs, 2)
+	assert.Equal(t, "c", resp.Runs[0].RunId)
+	assert.Equal(t, "b", resp.Runs[1].RunId)
+
+	rr = get("/netlog/backups?limit=1000")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func Test_checkBackupRuns(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRepoMock()
+	now := time.Now()
+
+	// no backup runs, the monitor just started
+	assert.NoError(t, checkBackupRuns(ctx, repo, 2, now))
+	assert.EqualError(
+		t,
+		checkBackupRuns(ctx, repo, 2, now.Add(-72*time.Hour)),
+		"no successful netlog backup run found in the last 2 days, failed runs: 0",
+	)
+
+	repo.BackupRuns["a"] = &BackupRun{RunId: "a", Status: BackupRunFinished, StartedAt: now.Add(-25 * time.Hour), UpdatedAt: now.Add(-24 * time.Hour)}
+	assert.NoError(t, checkBackupRuns(ctx, repo, 2, now.Add(-72*time.Hour)))
+
+	repo.BackupRuns["a"].UpdatedAt = now.Add(-49 * time.Hour)
+	repo.BackupRuns["b"] = &BackupRun{RunId: "b", Status: BackupRunFailed, StartedAt: now.Add(-time.Hour)}
+	err := checkBackupRuns(ctx, repo, 2, now.Add(-72*time.Hour))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no successful netlog backup in the last 2 days")
+	assert.Contains(t, err.Error(), "failed runs since: 1")
+}
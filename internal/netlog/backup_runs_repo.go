@@ -0,0 +1,167 @@
+package netlog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/2beens/serjtubincom/internal/telemetry/tracing"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	BackupRunRunning  = "running"
+	BackupRunFinished = "finished"
+	BackupRunFailed   = "failed"
+)
+
+type backupRunsStore interface {
+	SaveBackupRunEvent(ctx context.Context, msg *BackupIPCMessage) error
+}
+
+type BackupRun struct {
+	RunId           string    `json:"run_id"`
+	Target          string    `json:"target"`
+	Status          string    `json:"status"`
+	StartedAt       time.Time `json:"started_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+	VisitsCount     int       `json:"visits_count"`
+	ChunksDone      int       `json:"chunks_done"`
+	ChunksTotal     int       `json:"chunks_total"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Error           string    `json:"error,omitempty"`
+}
+
+// SaveBackupRunEvent creates or updates the backup run from the message. The run is created by any
+// message, in case the run started message was missed (e.g. main service was restarting). Finished
+// and failed runs are final, and are not updated anymore.
+func (r *Repo) SaveBackupRunEvent(ctx context.Context, msg *BackupIPCMessage) (err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.saveBackupRunEvent")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	span.SetAttributes(attribute.String("run.id", msg.RunId))
+	span.SetAttributes(attribute.String("run.event", msg.Type))
+
+	status := BackupRunRunning
+	switch msg.Type {
+	case BackupIPCRunFinished:
+		status = BackupRunFinished
+	case BackupIPCRunFailed:
+		status = BackupRunFailed
+	}
+
+	var target, runError, duration any
+	if msg.Target != "" {
+		target = msg.Target
+	}
+	if msg.Error != "" {
+		runError = msg.Error
+	}
+	if msg.DurationSeconds > 0 {
+		duration = msg.DurationSeconds
+	}
+	startedAt := msg.Timestamp.Add(-time.Duration(msg.DurationSeconds * float64(time.Second)))
+
+	_, err = r.db.Exec(
+		ctx,
+		`
+			INSERT INTO netlog.backup_run AS r (
+				run_id, target, status, started_at, updated_at, visits_count, chunks_done, chunks_total, duration_seconds, error
+			)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			ON CONFLICT (run_id) DO UPDATE SET
+				target = COALESCE(EXCLUDED.target, r.target),
+				status = EXCLUDED.status,
+				updated_at = EXCLUDED.updated_at,
+				visits_count = EXCLUDED.visits_count,
+				chunks_done = EXCLUDED.chunks_done,
+				chunks_total = EXCLUDED.chunks_total,
+				duration_seconds = COALESCE(EXCLUDED.duration_seconds, r.duration_seconds),
+				error = COALESCE(EXCLUDED.error, r.error)
+			WHERE r.status = 'running';
+		`,
+		msg.RunId, target, status, startedAt, msg.Timestamp,
+		msg.VisitsCount, msg.ChunksDone, msg.ChunksTotal, duration, runError,
+	)
+	if err != nil {
+		return fmt.Errorf("upsert backup run: %w", err)
+	}
+
+	return nil
+}
+
+const backupRunColumns = `
+	run_id, COALESCE(target, ''), status, started_at, updated_at,
+	visits_count, chunks_done, chunks_total, COALESCE(duration_seconds, 0), COALESCE(error, '')
+`
+
+// GetBackupRuns returns the last backup runs, newest first
+func (r *Repo) GetBackupRuns(ctx context.Context, limit int) (_ []*BackupRun, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.getBackupRuns")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	rows, err := r.db.Query(
+		ctx,
+		`SELECT `+backupRunColumns+` FROM netlog.backup_run ORDER BY started_at DESC LIMIT $1;`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, scanBackupRun)
+}
+
+// GetLastSuccessfulBackupRun returns nil if there were no successful backup runs
+func (r *Repo) GetLastSuccessfulBackupRun(ctx context.Context) (_ *BackupRun, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.getLastSuccessfulBackupRun")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	rows, err := r.db.Query(
+		ctx,
+		`SELECT `+backupRunColumns+` FROM netlog.backup_run WHERE status = 'finished' ORDER BY started_at DESC LIMIT 1;`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	run, err := pgx.CollectExactlyOneRow(rows, scanBackupRun)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return run, err
+}
+
+// CountFailedBackupRuns counts the failed backup runs started after the given time
+func (r *Repo) CountFailedBackupRuns(ctx context.Context, since time.Time) (_ int, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.countFailedBackupRuns")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	var count int
+	err = r.db.QueryRow(
+		ctx,
+		`SELECT COUNT(*) FROM netlog.backup_run WHERE status = 'failed' AND started_at > $1;`,
+		since,
+	).Scan(&count)
+	return count, err
+}
+
+func scanBackupRun(row pgx.CollectableRow) (*BackupRun, error) {
+	var run BackupRun
+	err := row.Scan(
+		&run.RunId, &run.Target, &run.Status, &run.StartedAt, &run.UpdatedAt,
+		&run.VisitsCount, &run.ChunksDone, &run.ChunksTotal, &run.DurationSeconds, &run.Error,
+	)
+	return &run, err
+}
@@ -0,0 +1,72 @@
+//go:build all_tests
+
+package netlog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepo_BackupRuns(t *testing.T) {
+	ctx := context.Background()
+	repo, shutdown := testRepoSetup(t)
+	defer shutdown()
+
+	_, err := repo.db.Exec(ctx, `DELETE FROM netlog.backup_run`)
+	require.NoError(t, err)
+
+	lastSuccess, err := repo.GetLastSuccessfulBackupRun(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, lastSuccess)
+
+	now := time.Now().Truncate(time.Microsecond)
+	event := func(runId, msgType string, ts time.Time, visits int, duration float64, runErr string) {
+		t.Helper()
+		require.NoError(t, repo.SaveBackupRunEvent(ctx, &BackupIPCMessage{
+			Version:         BackupIPCProtocolVersion,
+			Type:            msgType,
+			RunId:           runId,
+			Timestamp:       ts,
+			Target:          "gdrive",
+			VisitsCount:     visits,
+			ChunksDone:      1,
+			ChunksTotal:     1,
+			DurationSeconds: duration,
+			Error:           runErr,
+		}))
+	}
+
+	event("run-1", BackupIPCRunStarted, now.Add(-2*time.Hour), 0, 0, "")
+	event("run-1", BackupIPCRunFinished, now.Add(-2*time.Hour+10*time.Second), 100, 10, "")
+	// finished runs are final
+	event("run-1", BackupIPCRunFailed, now.Add(-time.Hour), 100, 20, "late failure")
+	// the run started message can be missed
+	event("run-2", BackupIPCRunFailed, now.Add(-time.Hour), 0, 5, "upload failed")
+	event("run-3", BackupIPCRunStarted, now, 0, 0, "")
+
+	runs, err := repo.GetBackupRuns(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, runs, 3)
+	assert.Equal(t, "run-3", runs[0].RunId)
+	assert.Equal(t, BackupRunRunning, runs[0].Status)
+	assert.Equal(t, "run-2", runs[1].RunId)
+	assert.Equal(t, BackupRunFailed, runs[1].Status)
+	assert.Equal(t, "upload failed", runs[1].Error)
+	assert.True(t, now.Add(-time.Hour-5*time.Second).Equal(runs[1].StartedAt))
+
+	lastSuccess, err = repo.GetLastSuccessfulBackupRun(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, lastSuccess)
+	assert.Equal(t, "run-1", lastSuccess.RunId)
+	assert.Equal(t, 100, lastSuccess.VisitsCount)
+	assert.Equal(t, 10.0, lastSuccess.DurationSeconds)
+	assert.Empty(t, lastSuccess.Error)
+
+	failed, err := repo.CountFailedBackupRuns(ctx, lastSuccess.StartedAt)
+	require.NoError(t, err)
+	assert.Equal(t, 1, failed)
+}
@@ -0,0 +1,320 @@
+package netlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/2beens/serjtubincom/internal/telemetry/tracing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	visitsFileChunkSize = 350 // number of visits in one backup file
+)
+
+type backupVisitsRepo interface {
+	GetAllVisits(ctx context.Context, afterId int) ([]*Visit, error)
+	GetAllSchemaVisits(ctx context.Context, schema string) ([]*Visit, error)
+	RestoreVisits(ctx context.Context, schema string, visits []*Visit) (RestoreResult, error)
+}
+
+type BackupService struct {
+	repo                     backupVisitsRepo
+	target                   BackupTarget
+	codec                    *BackupCodec
+	uploadWorkers            int
+	uploadBackoff            time.Duration
+	retention                BackupRetentionPolicy
+	netlogUnixSocketAddrDir  string
+	netlogUnixSocketFileName string
+}
+
+type BackupServiceParams struct {
+	Repo   backupVisitsRepo
+	Target BackupTarget
+	// Codec is nil for the plain json chunks
+	Codec *BackupCodec
+	// UploadWorkers is the number of chunks uploaded in parallel, DefaultBackupUploadWorkers if not set
+	UploadWorkers int
+	// Retention is applied after each successful backup, nothing is pruned if not set
+	Retention                BackupRetentionPolicy
+	NetlogUnixSocketAddrDir  string
+	NetlogUnixSocketFileName string
+}
+
+func NewBackupService(params BackupServiceParams) *BackupService {
+	uploadWorkers := params.UploadWorkers
+	if uploadWorkers <= 0 {
+		uploadWorkers = DefaultBackupUploadWorkers
+	}
+
+	return &BackupService{
+		repo:                     params.Repo,
+		target:                   params.Target,
+		codec:                    params.Codec,
+		uploadWorkers:            uploadWorkers,
+		uploadBackoff:            backupUploadBaseBackoff,
+		retention:                params.Retention,
+		netlogUnixSocketAddrDir:  params.NetlogUnixSocketAddrDir,
+		netlogUnixSocketFileName: params.NetlogUnixSocketFileName,
+	}
+}
+
+func (s *BackupService) Reinit(ctx context.Context, baseTime time.Time) error {
+	ctx, span := tracing.GlobalNetlogBackupTracer.Start(ctx, "netlogService.reinit")
+	defer span.End()
+
+	log.Printf("netlog visits backup reinit on %s starting ...", s.target.Name())
+
+	// the whole reinit is reported as a single backup run
+	run := s.startRun()
+	err := DeleteAllBackupFiles(ctx, s.target)
+	if err == nil {
+		err = s.doBackup(ctx, baseTime, run)
+	}
+	run.done(err)
+
+	return err
+}
+
+func (s *BackupService) DoBackup(ctx context.Context, baseTime time.Time) error {
+	if s == nil {
+		panic("service is nil")
+	}
+
+	run := s.startRun()
+	err := s.doBackup(ctx, baseTime, run)
+	run.done(err)
+	if err != nil {
+		return err
+	}
+
+	if s.retention.enabled() {
+		// the backup itself is done, so a failed pruning is only logged, and retried with the next backup
+		if _, err := s.Prune(ctx, false); err != nil {
+			log.Errorf("netlog backup prune: %s", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *BackupService) startRun() *backupRunReporter {
+	run := newBackupRunReporter(s.netlogUnixSocketAddrDir, s.netlogUnixSocketFileName)
+	run.started(s.target.Name())
+	return run
+}
+
+func (s *BackupService) doBackup(ctx context.Context, baseTime time.Time, run *backupRunReporter) error {
+	ctx, span := tracing.GlobalNetlogBackupTracer.Start(ctx, "netlogService.doBackup")
+	defer span.End()
+
+	log.Printf("DoBackup on %s start ...", s.target.Name())
+
+	currentAllBackupFiles, err := s.target.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(currentAllBackupFiles) == 0 {
+		log.Println("backups empty, creating initial backup file ...")
+		if err := s.createInitialBackupFile(ctx, baseTime, run); err != nil {
+			return err
+		}
+		log.Println("initial backup files created!")
+		return nil
+	}
+
+	log.Println("current backup files:")
+	for _, file := range currentAllBackupFiles {
+		log.Printf(" -- [%v]: %s (%s)\n", file.CreatedAt, file.Name, file.ID)
+	}
+
+	manifest, err := s.target.GetManifest(ctx)
+	if errors.Is(err, ErrBackupManifestNotFound) {
+		log.Println("backup manifest not found, will continue from the last backup file")
+		manifest, err = s.manifestFromLastFile(ctx, currentAllBackupFiles)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get next backup visits, failed to get backup manifest: %w", err)
+	}
+
+	full := s.fullBackupDue(manifest)
+
+	var visitsToBackup []*Visit
+	nextBackupFileBaseName := fmt.Sprintf("netlog-visits-%d-%d-%d", baseTime.Day(), baseTime.Month(), baseTime.Year())
+	if full {
+		log.Printf(" > last backed up visit [%d], full backup due, starting a new chain", manifest.LastVisitId)
+		visitsToBackup, err = s.repo.GetAllVisits(ctx, 0)
+		nextBackupFileBaseName = fmt.Sprintf("full-%d-%d-%d", baseTime.Day(), baseTime.Month(), baseTime.Year())
+	} else {
+		// by the id, and not by the timestamp, so the batch, imported and offline visits with the older
+		// timestamps, added after the last backup, are not missed
+		log.Printf(" > last backed up visit [%d], will continue from it", manifest.LastVisitId)
+		visitsToBackup, err = s.repo.GetAllVisits(ctx, manifest.LastVisitId)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get next backup visits: %w", err)
+	}
+
+	if len(visitsToBackup) == 0 {
+		log.Println("no new netlog visits to backup, done")
+		return nil
+	}
+
+	log.Printf(" ---- backing up %d netlog visits after visit [%d]", len(visitsToBackup), manifest.LastVisitId)
+
+	fileCounter := 1
+	for {
+		nameExists := false
+		for _, file := range currentAllBackupFiles {
+			// the same chunk name with any format suffix is taken
+			if strings.HasPrefix(file.Name, fmt.Sprintf("%s_%d.json", nextBackupFileBaseName, fileCounter)) {
+				nameExists = true
+				break
+			}
+		}
+		if nameExists {
+			fileCounter++
+		} else {
+			break
+		}
+	}
+
+	log.Printf(" ====> next chosen name: %s_%d.json", nextBackupFileBaseName, fileCounter)
+
+	if err := s.backupVisits(ctx, manifest, full, visitsToBackup, nextBackupFileBaseName, fileCounter, run); err != nil {
+		return fmt.Errorf("failed to backup visits: %w", err)
+	}
+
+	log.Printf("next backup successfully saved: %s", nextBackupFileBaseName)
+
+	return nil
+}
+
+// manifestFromLastFile recreates the manifest from the last created backup file, for the backups
+// made before the manifest existed
+func (s *BackupService) manifestFromLastFile(ctx context.Context, files []BackupFile) (*BackupManifest, error) {
+	ctx, span := tracing.GlobalNetlogBackupTracer.Start(ctx, "netlogService.manifestFromLastFile")
+	defer span.End()
+
+	manifest := &BackupManifest{}
+	lastFile := files[0]
+	for _, file := range files {
+		manifest.Chunks = append(manifest.Chunks, BackupChunk{Name: file.Name})
+		if file.CreatedAt.After(lastFile.CreatedAt) {
+			lastFile = file
+		}
+	}
+	manifest.LastVisitTimestamp = lastFile.CreatedAt
+
+	lastFileVisitsJson, err := s.target.Download(ctx, lastFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last file content: %w", err)
+	}
+
+	if len(lastFileVisitsJson) == 0 {
+		log.Printf("!! warning, last saved file [%s] is empty", lastFile.Name)
+		return manifest, nil
+	}
+
+	// google drive returns a UTF-8 text string with a Byte Order Mark (BOM)
+	// the BOM identifies that the text is UTF-8 encoded, but it should be removed before decoding
+	// https://stackoverflow.com/questions/31398044/got-error-invalid-character-%C3%AF-looking-for-beginning-of-value-from-json-unmar
+	lastFileVisitsJson = bytes.TrimPrefix(lastFileVisitsJson, []byte("\xef\xbb\xbf"))
+
+	var lastFileVisits []Visit
+	if err := json.Unmarshal(lastFileVisitsJson, &lastFileVisits); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal last file visits: %w", err)
+	}
+
+	if len(lastFileVisits) > 0 {
+		lastVisit := lastFileVisits[len(lastFileVisits)-1]
+		manifest.LastVisitId = lastVisit.Id
+		manifest.LastVisitTimestamp = lastVisit.Timestamp
+	}
+
+	return manifest, nil
+}
+
+func (s *BackupService) createInitialBackupFile(ctx context.Context, baseTime time.Time, run *backupRunReporter) error {
+	ctx, span := tracing.GlobalNetlogBackupTracer.Start(ctx, "netlogService.createInitialBackupFile")
+	defer span.End()
+
+	visits, err := s.repo.GetAllVisits(ctx, 0)
+	if err != nil {
+		return fmt.Errorf("failed to get netlog visits from db: %w", err)
+	}
+
+	log.Printf("initial backup of %d visits starting ...", len(visits))
+
+	// the empty manifest is the checkpoint, in case the initial backup is interrupted
+	manifest := &BackupManifest{}
+	if err := s.saveCheckpoint(ctx, manifest); err != nil {
+		return fmt.Errorf("failed to save backup manifest: %w", err)
+	}
+
+	baseFileName := fmt.Sprintf("initial-%d-%d-%d", baseTime.Day(), baseTime.Month(), baseTime.Year())
+	if err := s.backupVisits(ctx, manifest, true, visits, baseFileName, 1, run); err != nil {
+		return fmt.Errorf("failed to backup visits: %w", err)
+	}
+
+	return nil
+}
+
+// backupVisits uploads the visits in chunks as a new run, see uploadChunks for how the manifest is updated
+func (s *BackupService) backupVisits(
+	ctx context.Context,
+	manifest *BackupManifest,
+	full bool,
+	visits []*Visit,
+	baseFileName string,
+	previousFileCounter int,
+	run *backupRunReporter,
+) error {
+	ctx, span := tracing.GlobalNetlogBackupTracer.Start(ctx, "netlogService.backupVisits")
+	defer span.End()
+
+	format := s.codec.Format()
+
+	var jobs []backupChunkJob
+	for fromIndex := 0; fromIndex < len(visits); fromIndex += visitsFileChunkSize {
+		toIndex := min(fromIndex+visitsFileChunkSize, len(visits))
+		jobs = append(jobs, backupChunkJob{
+			index:  len(jobs),
+			name:   fmt.Sprintf("%s_%d.json%s", baseFileName, len(jobs)+previousFileCounter, format.fileSuffix()),
+			visits: visits[fromIndex:toIndex],
+		})
+	}
+
+	log.Printf("backing up %d visits in %d chunks, with %d upload workers ...", len(visits), len(jobs), s.uploadWorkers)
+
+	// the run is saved with the first checkpoint, so the runs without any chunks are never saved
+	manifest.Runs = append(manifest.Runs, BackupManifestRun{
+		StartedAt: time.Now(),
+		Full:      full,
+	})
+
+	return s.uploadChunks(ctx, manifest, jobs, run)
+}
+
+// fullBackupDue tells if it's time to start a new chain of runs with a full backup, so the older chains
+// can be pruned by the retention policy
+func (s *BackupService) fullBackupDue(manifest *BackupManifest) bool {
+	if s.retention.FullEvery <= 0 {
+		return false
+	}
+
+	chainStart := manifest.lastChainStart()
+	if chainStart < 0 {
+		return true
+	}
+
+	return time.Since(manifest.Runs[chainStart].StartedAt) >= s.retention.FullEvery
+}
@@ -0,0 +1,254 @@
+package netlog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/2beens/serjtubincom/internal/telemetry/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupService_DoBackup_ReportsRun(t *testing.T) {
+	metrics, reg := metrics.NewTestManagerAndRegistry()
+	socketDir := t.TempDir()
+	socket := fmt.Sprintf("%d.sock", os.Getpid())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runsRepo := NewRepoMock()
+	addr, err := VisitsBackupUnixSocketListenerSetup(ctx, socketDir, socket, metrics, runsRepo)
+	require.NoError(t, err)
+	require.NotEmpty(t, addr)
+
+	target, err := NewLocalBackupTarget(t.TempDir())
+	require.NoError(t, err)
+	visitsCount := visitsFileChunkSize + 10
+	repo := &backupRepoMock{
+		visits: testVisits(1, visitsCount, time.Now().Add(-time.Hour)),
+	}
+	s := NewBackupService(BackupServiceParams{
+		Repo:                     repo,
+		Target:                   target,
+		NetlogUnixSocketAddrDir:  socketDir,
+		NetlogUnixSocketFileName: socket,
+	})
+
+	// MAIN TESTED FUNCTION
+	require.NoError(t, s.DoBackup(context.Background(), time.Now()))
+
+	require.Len(t, runsRepo.BackupRuns, 1)
+	for _, run := range runsRepo.BackupRuns {
+		assert.Equal(t, BackupRunFinished, run.Status)
+		assert.Equal(t, target.Name(), run.Target)
+		assert.Equal(t, visitsCount, run.VisitsCount)
+		assert.Equal(t, 2, run.ChunksDone)
+		assert.Equal(t, 2, run.ChunksTotal)
+		assert.Empty(t, run.Error)
+	}
+
+	counterVisitsBackups := testutil.CollectAndCount(metrics.CounterVisitsBackups, "backend_test_server_netlog_visits_backed_up")
+	histNetlogBackupDuration, err := testutil.GatherAndCount(reg, "backend_test_server_netlog_backup_duration_seconds")
+	require.NoError(t, err)
+	assert.Equal(t, 1, counterVisitsBackups)
+	assert.Equal(t, 1, histNetlogBackupDuration)
+	assert.Equal(t, float64(visitsCount), testutil.ToFloat64(metrics.CounterVisitsBackups))
+
+	// a failed backup is reported with the error
+	failingService := NewBackupService(BackupServiceParams{
+		Repo:                     repo,
+		Target:                   failingBackupTarget{target},
+		NetlogUnixSocketAddrDir:  socketDir,
+		NetlogUnixSocketFileName: socket,
+	})
+	require.Error(t, failingService.DoBackup(context.Background(), time.Now()))
+
+	require.Len(t, runsRepo.BackupRuns, 2)
+	failed, err := runsRepo.CountFailedBackupRuns(ctx, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, failed)
+	// metrics are observed only for the finished runs
+	assert.Equal(t, float64(visitsCount), testutil.ToFloat64(metrics.CounterVisitsBackups))
+}
+
+// failingBackupTarget fails to list the backup files
+type failingBackupTarget struct {
+	BackupTarget
+}
+
+func (t failingBackupTarget) List(_ context.Context) ([]BackupFile, error) {
+	return nil, errors.New("target unavailable")
+}
+
+type backupRepoMock struct {
+	visits []*Visit
+	// schema name to restored visits
+	restored map[string][]*Visit
+}
+
+func (r *backupRepoMock) GetAllSchemaVisits(_ context.Context, schema string) ([]*Visit, error) {
+	if schema == DefaultVisitsSchema {
+		return r.visits, nil
+	}
+	return r.restored[schema], nil
+}
+
+func (r *backupRepoMock) RestoreVisits(_ context.Context, schema string, visits []*Visit) (RestoreResult, error) {
+	if r.restored == nil {
+		r.restored = map[string][]*Visit{}
+	}
+	r.restored[schema] = append(r.restored[schema], visits...)
+	return RestoreResult{Inserted: len(visits)}, nil
+}
+
+func (r *backupRepoMock) GetAllVisits(_ context.Context, afterId int) ([]*Visit, error) {
+	var visits []*Visit
+	for _, v := range r.visits {
+		if v.Id > afterId {
+			visits = append(visits, v)
+		}
+	}
+	slices.SortFunc(visits, func(a, b *Visit) int {
+		return a.Id - b.Id
+	})
+	return visits, nil
+}
+
+func testVisits(fromId, count int, from time.Time) []*Visit {
+	visits := make([]*Visit, 0, count)
+	for i := 0; i < count; i++ {
+		visits = append(visits, &Visit{
+			Id:        fromId + i,
+			Title:     fmt.Sprintf("title %d", fromId+i),
+			Source:    "chrome",
+			URL:       fmt.Sprintf("https://serj-tubin.com/%d", fromId+i),
+			Timestamp: from.Add(time.Duration(i) * time.Minute).Truncate(time.Second),
+		})
+	}
+	return visits
+}
+
+func TestBackupService_DoBackup(t *testing.T) {
+	ctx := context.Background()
+	target, err := NewLocalBackupTarget(t.TempDir())
+	require.NoError(t, err)
+
+	now := time.Now()
+	repo := &backupRepoMock{
+		visits: testVisits(1, visitsFileChunkSize+10, now.Add(-24*time.Hour)),
+	}
+	s := NewBackupService(BackupServiceParams{
+		Repo:                     repo,
+		Target:                   target,
+		NetlogUnixSocketAddrDir:  t.TempDir(),
+		NetlogUnixSocketFileName: "none.sock",
+	})
+
+	// initial backup
+	baseTime := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, s.DoBackup(ctx, baseTime))
+
+	files, err := target.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	manifest, err := target.GetManifest(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, visitsFileChunkSize+10, manifest.LastVisitId)
+	require.Len(t, manifest.Chunks, 2)
+	assert.Equal(t, "initial-10-5-2024_1.json", manifest.Chunks[0].Name)
+	assert.Equal(t, visitsFileChunkSize, manifest.Chunks[0].VisitsCount)
+	assert.Equal(t, "initial-10-5-2024_2.json", manifest.Chunks[1].Name)
+	assert.Equal(t, 10, manifest.Chunks[1].VisitsCount)
+
+	// next backup continues from the last backed up visit
+	repo.visits = append(repo.visits, testVisits(visitsFileChunkSize+11, 5, now)...)
+	nextBaseTime := baseTime.Add(24 * time.Hour)
+	require.NoError(t, s.DoBackup(ctx, nextBaseTime))
+
+	files, err = target.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, files, 3)
+
+	nextFileJson, err := target.Download(ctx, BackupFile{Name: "netlog-visits-11-5-2024_1.json"})
+	require.NoError(t, err)
+	var nextFileVisits []Visit
+	require.NoError(t, json.Unmarshal(nextFileJson, &nextFileVisits))
+	require.Len(t, nextFileVisits, 5)
+	assert.Equal(t, visitsFileChunkSize+11, nextFileVisits[0].Id)
+	assert.Equal(t, visitsFileChunkSize+15, nextFileVisits[4].Id)
+
+	manifest, err = target.GetManifest(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, visitsFileChunkSize+15, manifest.LastVisitId)
+	assert.Len(t, manifest.Chunks, 3)
+}
+
+func TestBackupService_DoBackup_WithoutManifest(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	target, err := NewLocalBackupTarget(dir)
+	require.NoError(t, err)
+
+	now := time.Now()
+	backedUpVisits := testVisits(1, 3, now.Add(-time.Hour))
+	backedUpVisitsJson, err := json.Marshal(backedUpVisits)
+	require.NoError(t, err)
+	// backups made before the manifest existed, google drive adds the BOM to the exported files
+	_, err = target.UploadChunk(ctx, "initial-1-1-2024_1.json", append([]byte("\xef\xbb\xbf"), backedUpVisitsJson...))
+	require.NoError(t, err)
+
+	repo := &backupRepoMock{
+		visits: append(backedUpVisits, testVisits(4, 2, now)...),
+	}
+	s := NewBackupService(BackupServiceParams{
+		Repo:                     repo,
+		Target:                   target,
+		NetlogUnixSocketAddrDir:  t.TempDir(),
+		NetlogUnixSocketFileName: "none.sock",
+	})
+	require.NoError(t, s.DoBackup(ctx, now))
+
+	manifest, err := target.GetManifest(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 5, manifest.LastVisitId)
+	require.Len(t, manifest.Chunks, 2)
+	assert.Equal(t, "initial-1-1-2024_1.json", manifest.Chunks[0].Name)
+	// only the 2 new ones
+	assert.Equal(t, 2, manifest.Chunks[1].VisitsCount)
+}
+
+func TestBackupService_Reinit(t *testing.T) {
+	ctx := context.Background()
+	target, err := NewLocalBackupTarget(t.TempDir())
+	require.NoError(t, err)
+
+	_, err = target.UploadChunk(ctx, "old-backup_1.json", []byte("[]"))
+	require.NoError(t, err)
+
+	repo := &backupRepoMock{
+		visits: testVisits(1, 3, time.Now()),
+	}
+	s := NewBackupService(BackupServiceParams{
+		Repo:                     repo,
+		Target:                   target,
+		NetlogUnixSocketAddrDir:  t.TempDir(),
+		NetlogUnixSocketFileName: "none.sock",
+	})
+	baseTime := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, s.Reinit(ctx, baseTime))
+
+	files, err := target.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "initial-10-5-2024_1.json", files[0].Name)
+}
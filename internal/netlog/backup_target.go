@@ -0,0 +1,133 @@
+package netlog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	BackupTargetGoogleDrive = "gdrive"
+	BackupTargetLocal       = "local"
+	BackupTargetS3          = "s3"
+
+	// backupManifestFileName is stored next to the backup chunk files, and is never listed as one of them
+	backupManifestFileName = "manifest.json"
+)
+
+var (
+	ErrBackupManifestNotFound = errors.New("backup manifest not found")
+)
+
+// BackupFile is a single backup chunk file stored on a backup target
+type BackupFile struct {
+	// ID is the target specific file identifier, e.g. google drive file ID, file path or object key
+	ID        string
+	Name      string
+	CreatedAt time.Time
+}
+
+// BackupChunk describes one backup file in the manifest. The chunks from the backups made before the
+// manifest existed have no checksum and visit IDs range, and can't be verified.
+type BackupChunk struct {
+	Name        string `json:"name"`
+	VisitsCount int    `json:"visits_count"`
+	// Checksum is the hex encoded sha256 of the chunk visits json
+	Checksum     string `json:"checksum,omitempty"`
+	FirstVisitId int    `json:"first_visit_id,omitempty"`
+	LastVisitId  int    `json:"last_visit_id,omitempty"`
+	// Format the chunk is stored in, compressed and/or encrypted, the checksum is of the decoded chunk
+	Format BackupFormat `json:"format"`
+}
+
+// BackupManifestRun is one backup run, i.e. a restore point. A full run backs up all the visits, and
+// the incremental runs after it only the new ones, so a run can be restored only together with all
+// the runs since the last full one (its chain). The chunks from before the runs were kept track of
+// belong to the first chain.
+type BackupManifestRun struct {
+	StartedAt time.Time `json:"started_at"`
+	Full      bool      `json:"full,omitempty"`
+	// Chunks are the names of the chunks uploaded in the run
+	Chunks []string `json:"chunks"`
+}
+
+// BackupManifest keeps track of what is already backed up, so the next backup knows where to continue from
+// without downloading and parsing the last backup file
+type BackupManifest struct {
+	LastVisitId        int                 `json:"last_visit_id"`
+	LastVisitTimestamp time.Time           `json:"last_visit_timestamp"`
+	Chunks             []BackupChunk       `json:"chunks"`
+	Runs               []BackupManifestRun `json:"runs,omitempty"`
+	UpdatedAt          time.Time           `json:"updated_at"`
+}
+
+// lastChainStart returns the index of the last full run, or -1 if there is none
+func (m *BackupManifest) lastChainStart() int {
+	for i := len(m.Runs) - 1; i >= 0; i-- {
+		if m.Runs[i].Full {
+			return i
+		}
+	}
+	return -1
+}
+
+// lastChainChunks returns the chunks needed to restore the latest backup run
+func (m *BackupManifest) lastChainChunks() []BackupChunk {
+	chainStart := m.lastChainStart()
+	if chainStart < 0 {
+		return m.Chunks
+	}
+
+	chainChunkNames := map[string]bool{}
+	for _, run := range m.Runs[chainStart:] {
+		for _, name := range run.Chunks {
+			chainChunkNames[name] = true
+		}
+	}
+
+	var chunks []BackupChunk
+	for _, chunk := range m.Chunks {
+		if chainChunkNames[chunk.Name] {
+			chunks = append(chunks, chunk)
+		}
+	}
+	return chunks
+}
+
+// BackupTarget is the storage netlog visits backup files are kept on
+type BackupTarget interface {
+	// Name of the target, used for logging
+	Name() string
+	// List returns all backup chunk files, without the manifest
+	List(ctx context.Context) ([]BackupFile, error)
+	UploadChunk(ctx context.Context, name string, data []byte) (BackupFile, error)
+	Download(ctx context.Context, file BackupFile) ([]byte, error)
+	Delete(ctx context.Context, file BackupFile) error
+	// GetManifest returns ErrBackupManifestNotFound if the manifest is not saved yet
+	GetManifest(ctx context.Context) (*BackupManifest, error)
+	SaveManifest(ctx context.Context, manifest *BackupManifest) error
+}
+
+// DeleteAllBackupFiles deletes all backup chunk files from the target. The manifest is left as is, since
+// it is ignored when there are no backup files, and overwritten with the next initial backup.
+func DeleteAllBackupFiles(ctx context.Context, target BackupTarget) error {
+	files, err := target.List(ctx)
+	if err != nil {
+		return fmt.Errorf("list backup files: %w", err)
+	}
+
+	log.Printf("deleting %d backup files from %s ...", len(files), target.Name())
+	for _, f := range files {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := target.Delete(ctx, f); err != nil {
+			return fmt.Errorf("delete backup file %s: %w", f.Name, err)
+		}
+	}
+
+	return nil
+}
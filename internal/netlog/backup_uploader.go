@@ -0,0 +1,252 @@
+package netlog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/2beens/serjtubincom/internal/telemetry/tracing"
+	"github.com/2beens/serjtubincom/pkg"
+
+	"github.com/minio/minio-go/v7"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	DefaultBackupUploadWorkers = 4
+
+	backupUploadMaxAttempts = 5
+	backupUploadBaseBackoff = 2 * time.Second
+	backupUploadMaxBackoff  = time.Minute
+	backupCheckpointTimeout = 30 * time.Second
+)
+
+type backupChunkJob struct {
+	index  int
+	name   string
+	visits []*Visit
+}
+
+type backupChunkResult struct {
+	index int
+	chunk BackupChunk
+	file  BackupFile
+	err   error
+}
+
+// uploadChunks uploads the chunks with a pool of workers. The manifest is saved as a checkpoint every
+// time the uploaded chunks prefix grows, so an interrupted backup continues after the last chunk
+// confirmed in order, and the chunks uploaded out of order are just left out of the manifest.
+// The first failed chunk stops the whole upload.
+func (s *BackupService) uploadChunks(
+	ctx context.Context,
+	manifest *BackupManifest,
+	jobs []backupChunkJob,
+	run *backupRunReporter,
+) error {
+	ctx, span := tracing.GlobalNetlogBackupTracer.Start(ctx, "netlogService.uploadChunks")
+	defer span.End()
+
+	uploadCtx, cancelUpload := context.WithCancel(ctx)
+	defer cancelUpload()
+
+	jobsChan := make(chan backupChunkJob)
+	resultsChan := make(chan backupChunkResult)
+
+	workers := min(s.uploadWorkers, len(jobs))
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobsChan {
+				resultsChan <- s.uploadChunk(uploadCtx, job)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobsChan)
+		for _, job := range jobs {
+			select {
+			case jobsChan <- job:
+			case <-uploadCtx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(resultsChan)
+	}()
+
+	var uploadErr error
+	manifestSaved := true
+	uploaded := make(map[int]backupChunkResult, len(jobs))
+	nextIndex := 0
+	for result := range resultsChan {
+		if result.err != nil {
+			if uploadErr == nil {
+				uploadErr = result.err
+				cancelUpload()
+			}
+			continue
+		}
+
+		log.Printf("%s: backup file saved: %s", result.chunk.Name, result.file.ID)
+		uploaded[result.index] = result
+
+		// the chunks still in flight after a failure are checkpointed too, if they are next in order
+		if !manifestSaved {
+			continue
+		}
+
+		checkpoint := false
+		for ; nextIndex < len(jobs); nextIndex++ {
+			next, ok := uploaded[nextIndex]
+			if !ok {
+				break
+			}
+			delete(uploaded, nextIndex)
+
+			lastVisit := jobs[nextIndex].visits[len(jobs[nextIndex].visits)-1]
+			manifest.LastVisitId = lastVisit.Id
+			manifest.LastVisitTimestamp = lastVisit.Timestamp
+			manifest.Chunks = append(manifest.Chunks, next.chunk)
+			currentRun := &manifest.Runs[len(manifest.Runs)-1]
+			currentRun.Chunks = append(currentRun.Chunks, next.chunk.Name)
+			run.progress(next.chunk.VisitsCount, len(jobs))
+			checkpoint = true
+		}
+
+		if checkpoint {
+			if err := s.saveCheckpoint(ctx, manifest); err != nil {
+				manifestSaved = false
+				if uploadErr == nil {
+					uploadErr = fmt.Errorf("failed to save backup manifest: %w", err)
+					cancelUpload()
+				}
+			}
+		}
+	}
+
+	if uploadErr != nil {
+		if ctx.Err() != nil {
+			uploadErr = fmt.Errorf("backup interrupted: %w", ctx.Err())
+		}
+		log.Printf(
+			"backup stopped after %d / %d chunks, will continue from visit [%d] on the next run: %s",
+			nextIndex, len(jobs), manifest.LastVisitId, uploadErr,
+		)
+		return uploadErr
+	}
+
+	return nil
+}
+
+// saveCheckpoint saves the manifest even if the backup is being stopped, so the chunks uploaded
+// so far are not uploaded again on the next run
+func (s *BackupService) saveCheckpoint(ctx context.Context, manifest *BackupManifest) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), backupCheckpointTimeout)
+	defer cancel()
+
+	manifest.UpdatedAt = time.Now()
+	return s.target.SaveManifest(ctx, manifest)
+}
+
+// uploadChunk encodes and uploads the chunk, retrying with exponential backoff on transient errors
+func (s *BackupService) uploadChunk(ctx context.Context, job backupChunkJob) backupChunkResult {
+	result := backupChunkResult{index: job.index}
+
+	visitsJson, err := json.Marshal(job.visits)
+	if err != nil {
+		result.err = fmt.Errorf("%s failed to marshal netlog visits: %w", job.name, err)
+		return result
+	}
+
+	encodedChunk, err := s.codec.Encode(job.name, visitsJson)
+	if err != nil {
+		result.err = fmt.Errorf("%s failed to encode netlog visits: %w", job.name, err)
+		return result
+	}
+
+	firstVisitId, lastVisitId := visitIdsRange(job.visits)
+	result.chunk = BackupChunk{
+		Name:         job.name,
+		VisitsCount:  len(job.visits),
+		Checksum:     chunkChecksum(visitsJson),
+		FirstVisitId: firstVisitId,
+		LastVisitId:  lastVisitId,
+		Format:       s.codec.Format(),
+	}
+
+	backoff := s.uploadBackoff
+	for attempt := 1; ; attempt++ {
+		// the upload can be stopped after the job was handed out, or while waiting for the retry
+		if ctx.Err() != nil {
+			result.err = ctx.Err()
+			return result
+		}
+		log.Printf("%s: creating file with %d visits on %s [attempt %d] ...", job.name, len(job.visits), s.target.Name(), attempt)
+		result.file, err = s.target.UploadChunk(ctx, job.name, encodedChunk)
+		if err == nil {
+			return result
+		}
+		if ctx.Err() != nil {
+			result.err = ctx.Err()
+			return result
+		}
+		if !isTransientBackupError(err) || attempt >= backupUploadMaxAttempts {
+			result.err = fmt.Errorf("%s: failed to create visits backups file after %d attempts: %w", job.name, attempt, err)
+			return result
+		}
+
+		log.Printf("%s: upload failed, will try again in %s: %s", job.name, backoff, err)
+		pkg.SleepWithContext(ctx, backoff)
+		backoff = min(2*backoff, backupUploadMaxBackoff)
+	}
+}
+
+// isTransientBackupError tells if the failed upload is worth retrying, e.g. on rate limits, server
+// errors and dropped connections
+func isTransientBackupError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var gErr *googleapi.Error
+	if errors.As(err, &gErr) {
+		return isTransientStatusCode(gErr.Code)
+	}
+
+	var s3Err minio.ErrorResponse
+	if errors.As(err, &s3Err) && s3Err.StatusCode != 0 {
+		return isTransientStatusCode(s3Err.StatusCode)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		// google drive sometimes fails with an internal error not wrapped as googleapi.Error
+		strings.Contains(err.Error(), "internalError")
+}
+
+func isTransientStatusCode(code int) bool {
+	return code == http.StatusTooManyRequests || code == http.StatusRequestTimeout || code >= http.StatusInternalServerError
+}
@@ -0,0 +1,275 @@
+package netlog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+)
+
+// flakyBackupTarget fails the chunk uploads for which uploadErr returns an error
+type flakyBackupTarget struct {
+	*LocalBackupTarget
+	uploadErr func(name string, attempt int) error
+
+	mutex    sync.Mutex
+	attempts map[string]int
+}
+
+func newFlakyBackupTarget(t *testing.T, uploadErr func(name string, attempt int) error) *flakyBackupTarget {
+	t.Helper()
+	target, err := NewLocalBackupTarget(t.TempDir())
+	require.NoError(t, err)
+	return &flakyBackupTarget{
+		LocalBackupTarget: target,
+		uploadErr:         uploadErr,
+		attempts:          map[string]int{},
+	}
+}
+
+func (t *flakyBackupTarget) UploadChunk(ctx context.Context, name string, data []byte) (BackupFile, error) {
+	t.mutex.Lock()
+	t.attempts[name]++
+	attempt := t.attempts[name]
+	t.mutex.Unlock()
+
+	if t.uploadErr != nil {
+		if err := t.uploadErr(name, attempt); err != nil {
+			return BackupFile{}, err
+		}
+	}
+	return t.LocalBackupTarget.UploadChunk(ctx, name, data)
+}
+
+func testUploadService(repo backupVisitsRepo, target BackupTarget, workers int) *BackupService {
+	s := NewBackupService(BackupServiceParams{
+		Repo:                     repo,
+		Target:                   target,
+		UploadWorkers:            workers,
+		NetlogUnixSocketFileName: "none.sock",
+	})
+	s.uploadBackoff = time.Millisecond
+	return s
+}
+
+func TestBackupService_uploadChunks_Parallel(t *testing.T) {
+	ctx := context.Background()
+	target := newFlakyBackupTarget(t, func(name string, attempt int) error {
+		// the first chunks take the longest, so they are confirmed out of order
+		if name == "initial-10-5-2024_1.json" || name == "initial-10-5-2024_2.json" {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return nil
+	})
+
+	visitsCount := 9*visitsFileChunkSize + 5
+	repo := &backupRepoMock{
+		visits: testVisits(1, visitsCount, time.Now().Add(-time.Hour)),
+	}
+	s := testUploadService(repo, target, 4)
+	require.NoError(t, s.DoBackup(ctx, time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)))
+
+	manifest, err := target.GetManifest(ctx)
+	require.NoError(t, err)
+	require.Len(t, manifest.Chunks, 10)
+	for i, chunk := range manifest.Chunks {
+		assert.Equal(t, fmt.Sprintf("initial-10-5-2024_%d.json", i+1), chunk.Name)
+		assert.Equal(t, i*visitsFileChunkSize+1, chunk.FirstVisitId)
+	}
+	assert.Equal(t, visitsCount, manifest.LastVisitId)
+
+	report, err := s.Verify(ctx, DefaultVisitsSchema)
+	require.NoError(t, err)
+	assert.True(t, report.OK())
+	assert.Equal(t, visitsCount, report.BackupVisits)
+}
+
+func TestBackupService_uploadChunks_Retry(t *testing.T) {
+	ctx := context.Background()
+	target := newFlakyBackupTarget(t, func(name string, attempt int) error {
+		if name == "initial-10-5-2024_2.json" && attempt < 3 {
+			return &googleapi.Error{Code: http.StatusServiceUnavailable}
+		}
+		return nil
+	})
+
+	repo := &backupRepoMock{
+		visits: testVisits(1, 2*visitsFileChunkSize, time.Now().Add(-time.Hour)),
+	}
+	s := testUploadService(repo, target, 2)
+	require.NoError(t, s.DoBackup(ctx, time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)))
+
+	assert.Equal(t, 1, target.attempts["initial-10-5-2024_1.json"])
+	assert.Equal(t, 3, target.attempts["initial-10-5-2024_2.json"])
+
+	manifest, err := target.GetManifest(ctx)
+	require.NoError(t, err)
+	assert.Len(t, manifest.Chunks, 2)
+}
+
+func TestBackupService_uploadChunks_Resume(t *testing.T) {
+	ctx := context.Background()
+	failing := true
+	target := newFlakyBackupTarget(t, func(name string, attempt int) error {
+		if failing && name == "initial-10-5-2024_3.json" {
+			return errors.New("permission denied")
+		}
+		return nil
+	})
+
+	visitsCount := 4*visitsFileChunkSize + 5
+	repo := &backupRepoMock{
+		visits: testVisits(1, visitsCount, time.Now().Add(-time.Hour)),
+	}
+	s := testUploadService(repo, target, 1)
+	baseTime := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+
+	err := s.DoBackup(ctx, baseTime)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "permission denied")
+	// not a transient error, so not retried
+	assert.Equal(t, 1, target.attempts["initial-10-5-2024_3.json"])
+
+	// the chunks uploaded before the failed one are in the manifest
+	manifest, err := target.GetManifest(ctx)
+	require.NoError(t, err)
+	require.Len(t, manifest.Chunks, 2)
+	assert.Equal(t, 2*visitsFileChunkSize, manifest.LastVisitId)
+
+	// the next run continues after the last confirmed chunk
+	failing = false
+	require.NoError(t, s.DoBackup(ctx, baseTime))
+
+	manifest, err = target.GetManifest(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, visitsCount, manifest.LastVisitId)
+	require.Len(t, manifest.Chunks, 5)
+	assert.Equal(t, "netlog-visits-10-5-2024_1.json", manifest.Chunks[2].Name)
+	assert.Equal(t, 2*visitsFileChunkSize+1, manifest.Chunks[2].FirstVisitId)
+
+	report, err := s.Verify(ctx, DefaultVisitsSchema)
+	require.NoError(t, err)
+	assert.True(t, report.OK())
+	assert.Equal(t, visitsCount, report.BackupVisits)
+}
+
+func TestBackupService_uploadChunks_ResumeOutOfOrder(t *testing.T) {
+	ctx := context.Background()
+	failing := true
+	target := newFlakyBackupTarget(t, func(name string, attempt int) error {
+		if failing && name == "initial-10-5-2024_2.json" {
+			return errors.New("permission denied")
+		}
+		return nil
+	})
+
+	// the ids and the timestamps are not in the same order, e.g. the imported and the offline visits
+	// are added with the old timestamps, and the rows come from the db in any order
+	now := time.Now()
+	visitsCount := 3 * visitsFileChunkSize
+	visits := testVisits(1, visitsCount, now.Add(-time.Hour))
+	for i, v := range visits {
+		if i%2 == 1 {
+			v.Timestamp = now.Add(-time.Duration(visitsCount+i) * time.Hour)
+		}
+	}
+	rand.Shuffle(len(visits), func(i, j int) {
+		visits[i], visits[j] = visits[j], visits[i]
+	})
+	repo := &backupRepoMock{visits: visits}
+	s := testUploadService(repo, target, 1)
+	baseTime := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+
+	require.Error(t, s.DoBackup(ctx, baseTime))
+	manifest, err := target.GetManifest(ctx)
+	require.NoError(t, err)
+	require.Len(t, manifest.Chunks, 1)
+	assert.Equal(t, visitsFileChunkSize, manifest.LastVisitId)
+
+	// a visit with an old timestamp added while the backup was stopped
+	repo.visits = append(repo.visits, &Visit{
+		Id:        visitsCount + 1,
+		Title:     "imported",
+		Source:    "chrome",
+		URL:       "https://serj-tubin.com/imported",
+		Timestamp: now.Add(-24 * 365 * time.Hour).Truncate(time.Second),
+	})
+
+	failing = false
+	require.NoError(t, s.DoBackup(ctx, baseTime))
+
+	manifest, err = target.GetManifest(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, visitsCount+1, manifest.LastVisitId)
+	assert.Equal(t, visitsFileChunkSize+1, manifest.Chunks[1].FirstVisitId)
+
+	report, err := s.Verify(ctx, DefaultVisitsSchema)
+	require.NoError(t, err)
+	assert.True(t, report.OK(), "%+v", report)
+	assert.Equal(t, visitsCount+1, report.BackupVisits)
+}
+
+func TestBackupService_uploadChunks_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	target := newFlakyBackupTarget(t, func(name string, attempt int) error {
+		if name == "initial-10-5-2024_3.json" {
+			// e.g. SIGTERM received while uploading the chunk
+			cancel()
+			return context.Canceled
+		}
+		return nil
+	})
+
+	repo := &backupRepoMock{
+		visits: testVisits(1, 4*visitsFileChunkSize, time.Now().Add(-time.Hour)),
+	}
+	s := testUploadService(repo, target, 1)
+
+	err := s.DoBackup(ctx, time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC))
+	require.ErrorIs(t, err, context.Canceled)
+	assert.ErrorContains(t, err, "backup interrupted")
+
+	manifest, err := target.GetManifest(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, manifest.Chunks, 2)
+	// the chunk upload is not retried, and the next ones are not started
+	assert.Equal(t, 1, target.attempts["initial-10-5-2024_3.json"])
+	assert.Zero(t, target.attempts["initial-10-5-2024_4.json"])
+}
+
+func Test_isTransientBackupError(t *testing.T) {
+	testCases := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{"google rate limit", &googleapi.Error{Code: http.StatusTooManyRequests}, true},
+		{"google server error", fmt.Errorf("upload: %w", &googleapi.Error{Code: http.StatusBadGateway}), true},
+		{"google not found", &googleapi.Error{Code: http.StatusNotFound}, false},
+		{"google internal error", errors.New("googleapi: Error 500: internalError"), true},
+		{"s3 server error", minio.ErrorResponse{StatusCode: http.StatusServiceUnavailable}, true},
+		{"s3 access denied", minio.ErrorResponse{StatusCode: http.StatusForbidden, Code: "AccessDenied"}, false},
+		{"connection reset", fmt.Errorf("write: %w", syscall.ECONNRESET), true},
+		{"unexpected eof", io.ErrUnexpectedEOF, true},
+		{"canceled", context.Canceled, false},
+		{"other", errors.New("no space left on device"), false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.transient, isTransientBackupError(tc.err))
+		})
+	}
+}
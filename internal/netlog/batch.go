@@ -0,0 +1,224 @@
+package netlog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/2beens/serjtubincom/internal/telemetry/tracing"
+	"github.com/2beens/serjtubincom/pkg"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	maxBatchVisits       = 1000
+	maxBatchBodyBytes    = 8 << 20
+	maxBatchClientIDSize = 128
+)
+
+const (
+	BatchItemAdded     = "added"
+	BatchItemDuplicate = "duplicate"
+	BatchItemRejected  = "rejected"
+	// BatchItemDropped is a visit dropped by the redaction rules, see RedactionRules.DropHosts
+	BatchItemDropped = "dropped"
+)
+
+// batchVisitRequest is a single visit sent to /netlog/batch, ID is the client generated idempotency ID
+type batchVisitRequest struct {
+	ID string `json:"id"`
+	newVisitRequest
+}
+
+type BatchItemResult struct {
+	// Index is the position of the item in the request, useful for items rejected without an ID
+	Index  int    `json:"index"`
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type BatchResponse struct {
+	Added     int               `json:"added"`
+	Duplicate int               `json:"duplicate"`
+	Rejected  int               `json:"rejected"`
+	Dropped   int               `json:"dropped"`
+	Results   []BatchItemResult `json:"results"`
+}
+
+// handleNewVisitsBatch adds many visits at once, e.g. sent by the browser extension after being offline.
+// The body is either a JSON array of visits (Content-Type: application/json), or one visit per line
+// (Content-Type: application/x-ndjson). Each visit has a client generated "id", which makes retries safe:
+// a visit with an already seen ID is reported as a duplicate and not added again.
+func (handler *Handler) handleNewVisitsBatch(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.GlobalTracer.Start(r.Context(), "netlogHandler.newBatch")
+	defer span.End()
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBatchBodyBytes))
+	if err != nil {
+		log.Errorf("add netlog visits batch failed, read body: %s", err)
+		http.Error(w, "error, failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var items []json.RawMessage
+	switch mediaType {
+	case "application/json":
+		if err := json.Unmarshal(body, &items); err != nil {
+			log.Errorf("add netlog visits batch failed, decode json: %s", err)
+			http.Error(w, "decode json error", http.StatusBadRequest)
+			return
+		}
+	case "application/x-ndjson", "application/jsonl":
+		items = ndjsonItems(body)
+	default:
+		http.Error(w, "error, unsupported content type (use application/json or application/x-ndjson)", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	if len(items) == 0 {
+		http.Error(w, "error, no visits sent", http.StatusBadRequest)
+		return
+	}
+	if len(items) > maxBatchVisits {
+		http.Error(w, fmt.Sprintf("error, too many visits (max %d)", maxBatchVisits), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	span.SetAttributes(attribute.Int("batch.size", len(items)))
+
+	resp := BatchResponse{Results: make([]BatchItemResult, len(items))}
+	seenIDs := map[string]bool{}
+	var batch []BatchVisit
+	var batchIndexes []int
+	for i, item := range items {
+		result := &resp.Results[i]
+		result.Index = i
+
+		visit, clientID, err := batchVisitFromJSON(item)
+		result.ID = clientID
+		if err != nil {
+			result.Status = BatchItemRejected
+			result.Error = err.Error()
+			continue
+		}
+		if handler.redactor.Redact(visit) {
+			result.Status = BatchItemDropped
+			continue
+		}
+		if seenIDs[clientID] {
+			result.Status = BatchItemDuplicate
+			continue
+		}
+		seenIDs[clientID] = true
+
+		batch = append(batch, BatchVisit{ClientID: clientID, Visit: visit})
+		batchIndexes = append(batchIndexes, i)
+	}
+
+	if len(batch) > 0 {
+		added, err := handler.repo.AddVisitsBatch(ctx, batch)
+		if err != nil {
+			log.Errorf("add netlog visits batch of %d: %s", len(batch), err)
+			http.Error(w, "error, failed to add visits", http.StatusInternalServerError)
+			span.RecordError(err)
+			return
+		}
+		for bi, i := range batchIndexes {
+			if added[bi] {
+				resp.Results[i].Status = BatchItemAdded
+			} else {
+				resp.Results[i].Status = BatchItemDuplicate
+			}
+		}
+	}
+
+	for _, result := range resp.Results {
+		switch result.Status {
+		case BatchItemAdded:
+			resp.Added++
+		case BatchItemDuplicate:
+			resp.Duplicate++
+		case BatchItemRejected:
+			resp.Rejected++
+		case BatchItemDropped:
+			resp.Dropped++
+		}
+	}
+
+	handler.metrics.CounterNetlogVisits.Add(float64(resp.Added))
+
+	log.WithFields(log.Fields{
+		"added":     resp.Added,
+		"duplicate": resp.Duplicate,
+		"rejected":  resp.Rejected,
+		"dropped":   resp.Dropped,
+	}).Print("new visits batch processed")
+
+	pkg.SendJsonResponse(w, http.StatusOK, resp)
+}
+
+// ndjsonItems splits the body into lines, skipping the empty ones
+func ndjsonItems(body []byte) []json.RawMessage {
+	var items []json.RawMessage
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxBatchBodyBytes)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		items = append(items, json.RawMessage(bytes.Clone(line)))
+	}
+	return items
+}
+
+// batchVisitFromJSON validates a single batch item the same way /netlog/new does, and returns the visit
+// with its client ID (if it could be read at all)
+func batchVisitFromJSON(item json.RawMessage) (*Visit, string, error) {
+	var reqData batchVisitRequest
+	if err := json.Unmarshal(item, &reqData); err != nil {
+		return nil, "", errors.New("invalid json")
+	}
+
+	if reqData.ID == "" {
+		return nil, "", errors.New("id empty")
+	}
+	if len(reqData.ID) > maxBatchClientIDSize {
+		return nil, reqData.ID, fmt.Errorf("id too long (max %d)", maxBatchClientIDSize)
+	}
+
+	decodedURL, err := url.QueryUnescape(reqData.URL)
+	if err != nil {
+		return nil, reqData.ID, errors.New("invalid url encoding")
+	}
+	decodedTitle, err := url.QueryUnescape(reqData.Title)
+	if err != nil {
+		return nil, reqData.ID, errors.New("invalid title encoding")
+	}
+
+	if decodedURL == "" {
+		return nil, reqData.ID, errors.New("url empty")
+	}
+	if reqData.Timestamp <= 0 {
+		return nil, reqData.ID, errors.New("timestamp invalid")
+	}
+
+	return &Visit{
+		Title:     decodedTitle,
+		URL:       decodedURL,
+		Source:    reqData.Source,
+		Device:    reqData.Device,
+		Timestamp: time.UnixMilli(reqData.Timestamp),
+	}, reqData.ID, nil
+}
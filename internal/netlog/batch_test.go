@@ -0,0 +1,132 @@
+package netlog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/2beens/serjtubincom/internal/auth"
+	"github.com/2beens/serjtubincom/internal/telemetry/metrics"
+
+	"github.com/go-redis/redismock/v8"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sendBatch(t *testing.T, r http.Handler, token, contentType, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req, err := http.NewRequest("POST", "/netlog/batch", strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("X-SERJ-TOKEN", token)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Origin", "test")
+	rr := httptest.NewRecorder()
+
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestNetlogHandler_handleNewVisitsBatch(t *testing.T) {
+	db, _ := redismock.NewClientMock()
+	repo := NewRepoMock()
+	m := metrics.NewTestManager()
+	loginChecker := auth.NewLoginChecker(time.Hour, db)
+	r := setupNetlogRouterForTests(t, repo, m, loginChecker, "beer")
+
+	body := `[
+		{"id": "a1", "title": "One", "source": "chrome", "device": "mb-serj", "url": "https://one.com", "timestamp": 1612622746987},
+		{"id": "a2", "title": "Two", "source": "chrome", "device": "mb-serj", "url": "https://two.com", "timestamp": 1612622747987},
+		{"id": "a1", "title": "One again", "source": "chrome", "device": "mb-serj", "url": "https://one.com", "timestamp": 1612622746987},
+		{"id": "a3", "title": "No url", "source": "chrome", "device": "mb-serj", "url": "", "timestamp": 1612622746987},
+		{"title": "No id", "source": "chrome", "url": "https://x.com", "timestamp": 1612622746987}
+	]`
+	rr := sendBatch(t, r, "beer", "application/json", body)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var resp BatchResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, 2, resp.Added)
+	assert.Equal(t, 1, resp.Duplicate)
+	assert.Equal(t, 2, resp.Rejected)
+	require.Len(t, resp.Results, 5)
+	assert.Equal(t, BatchItemResult{Index: 0, ID: "a1", Status: BatchItemAdded}, resp.Results[0])
+	assert.Equal(t, BatchItemResult{Index: 1, ID: "a2", Status: BatchItemAdded}, resp.Results[1])
+	assert.Equal(t, BatchItemResult{Index: 2, ID: "a1", Status: BatchItemDuplicate}, resp.Results[2])
+	assert.Equal(t, BatchItemResult{Index: 3, ID: "a3", Status: BatchItemRejected, Error: "url empty"}, resp.Results[3])
+	assert.Equal(t, BatchItemResult{Index: 4, Status: BatchItemRejected, Error: "id empty"}, resp.Results[4])
+
+	assert.Len(t, repo.Visits, 4)
+	assert.Equal(t, "Two", repo.Visits[3].Title)
+	assert.Equal(t, time.UnixMilli(1612622747987), repo.Visits[3].Timestamp)
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.CounterNetlogVisits))
+
+	// a retry (e.g. the response got lost) adds nothing new
+	ndjson := `{"id": "a2", "title": "Two", "source": "chrome", "device": "mb-serj", "url": "https://two.com", "timestamp": 1612622747987}
+
+{"id": "a4", "title": "Four", "source": "chrome", "device": "mb-serj", "url": "https%3A%2F%2Ffour.com", "timestamp": 1612622748987}
+not json
+`
+	rr = sendBatch(t, r, "beer", "application/x-ndjson", ndjson)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	resp = BatchResponse{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, 1, resp.Added)
+	assert.Equal(t, 1, resp.Duplicate)
+	assert.Equal(t, 1, resp.Rejected)
+	assert.Equal(t, BatchItemResult{Index: 2, Status: BatchItemRejected, Error: "invalid json"}, resp.Results[2])
+
+	assert.Len(t, repo.Visits, 5)
+	assert.Equal(t, "https://four.com", repo.Visits[4].URL)
+	assert.Equal(t, float64(3), testutil.ToFloat64(m.CounterNetlogVisits))
+}
+
+func TestNetlogHandler_handleNewVisitsBatch_invalidToken(t *testing.T) {
+	db, _ := redismock.NewClientMock()
+	repo := NewRepoMock()
+	m := metrics.NewTestManager()
+	loginChecker := auth.NewLoginChecker(time.Hour, db)
+	r := setupNetlogRouterForTests(t, repo, m, loginChecker, "rakija")
+
+	body := `[{"id": "a1", "title": "One", "source": "chrome", "url": "https://one.com", "timestamp": 1612622746987}]`
+	rr := sendBatch(t, r, "beer", "application/json", body)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "added", rr.Body.String()) // this is a false positive "added"
+
+	assert.Len(t, repo.Visits, 2)
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.CounterNetlogVisits))
+}
+
+func TestNetlogHandler_handleNewVisitsBatch_badRequest(t *testing.T) {
+	db, _ := redismock.NewClientMock()
+	repo := NewRepoMock()
+	m := metrics.NewTestManager()
+	loginChecker := auth.NewLoginChecker(time.Hour, db)
+	r := setupNetlogRouterForTests(t, repo, m, loginChecker, "beer")
+
+	tooMany := "[" + strings.Repeat(`{"id": "x"},`, maxBatchVisits) + `{"id": "y"}]`
+	for name, tc := range map[string]struct {
+		contentType  string
+		body         string
+		expectedCode int
+	}{
+		"invalid json":    {contentType: "application/json", body: `[{"id": `, expectedCode: http.StatusBadRequest},
+		"not an array":    {contentType: "application/json", body: `{"id": "a"}`, expectedCode: http.StatusBadRequest},
+		"empty":           {contentType: "application/json", body: `[]`, expectedCode: http.StatusBadRequest},
+		"empty ndjson":    {contentType: "application/x-ndjson", body: "\n\n", expectedCode: http.StatusBadRequest},
+		"form":            {contentType: "application/x-www-form-urlencoded", body: "id=a", expectedCode: http.StatusUnsupportedMediaType},
+		"too many visits": {contentType: "application/json", body: tooMany, expectedCode: http.StatusRequestEntityTooLarge},
+	} {
+		t.Run(name, func(t *testing.T) {
+			rr := sendBatch(t, r, "beer", tc.contentType, tc.body)
+			assert.Equal(t, tc.expectedCode, rr.Code, rr.Body.String())
+		})
+	}
+
+	assert.Len(t, repo.Visits, 2)
+}
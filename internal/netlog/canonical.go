@@ -0,0 +1,128 @@
+package netlog
+
+import (
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// trackingQueryParams are removed from the canonical urls, a trailing * matches the name prefix
+var trackingQueryParams = []string{
+	"utm_*", "fbclid", "gclid", "dclid", "gbraid", "wbraid", "msclkid", "yclid",
+	"mc_cid", "mc_eid", "igshid", "_ga", "_gl",
+}
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// DeriveURLFields sets the visit host, registered domain and canonical url from its url. The repo does it
+// on every write, so the derived fields always match the url.
+func (v *Visit) DeriveURLFields() {
+	v.CanonicalURL, v.Host, v.RegisteredDomain = canonicalizeURL(v.URL)
+}
+
+// CanonicalizeURL returns the normalized url, used to find the visits to the same page: the scheme and
+// the host lowercased, the default port, the userinfo, the fragment and the tracking params dropped,
+// and the query params sorted by name. The urls that can't be parsed are returned as they are.
+func CanonicalizeURL(rawURL string) string {
+	canonical, _, _ := canonicalizeURL(rawURL)
+	return canonical
+}
+
+func canonicalizeURL(rawURL string) (canonical, host, registeredDomain string) {
+	parsedURL, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || parsedURL.Opaque != "" || parsedURL.Host == "" {
+		// e.g. about:blank, or a browser internal page
+		canonical, _, _ = strings.Cut(rawURL, "#")
+		return canonical, "", ""
+	}
+
+	scheme := strings.ToLower(parsedURL.Scheme)
+	host = strings.TrimSuffix(strings.ToLower(parsedURL.Hostname()), ".")
+
+	hostPort := host
+	if strings.Contains(host, ":") {
+		// IPv6
+		hostPort = "[" + host + "]"
+	}
+	if port := parsedURL.Port(); port != "" && port != defaultPorts[scheme] {
+		hostPort = net.JoinHostPort(host, port)
+	}
+
+	path := parsedURL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	canonical = scheme + "://" + hostPort + path
+	if query := canonicalQuery(parsedURL.RawQuery); query != "" {
+		canonical += "?" + query
+	}
+
+	return canonical, host, registeredDomainOf(host)
+}
+
+// canonicalQuery drops the tracking params, and sorts the rest by name, keeping the order of the values
+// of the same param, which can matter
+func canonicalQuery(rawQuery string) string {
+	type param struct {
+		name  string
+		value string
+		// hasValue tells "a=" from "a"
+		hasValue bool
+	}
+
+	var params []param
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		name, value, hasValue := strings.Cut(pair, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if unescaped, err := url.QueryUnescape(value); err == nil {
+			value = unescaped
+		}
+		if matchesAnyParam(strings.ToLower(name), trackingQueryParams) {
+			continue
+		}
+		params = append(params, param{name: name, value: value, hasValue: hasValue})
+	}
+
+	sort.SliceStable(params, func(i, j int) bool {
+		return params[i].name < params[j].name
+	})
+
+	var sb strings.Builder
+	for i, p := range params {
+		if i > 0 {
+			sb.WriteByte('&')
+		}
+		sb.WriteString(url.QueryEscape(p.name))
+		if p.hasValue {
+			sb.WriteByte('=')
+			sb.WriteString(url.QueryEscape(p.value))
+		}
+	}
+	return sb.String()
+}
+
+// registeredDomainOf returns the domain registered under a public suffix, e.g. bbc.co.uk for
+// www.bbc.co.uk, used to group the visits by site. The IP addresses, the local hosts and the public
+// suffixes themselves (e.g. github.io) are their own registered domains.
+func registeredDomainOf(host string) string {
+	if host == "" || net.ParseIP(host) != nil {
+		return host
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
@@ -0,0 +1,117 @@
+package netlog
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type cursorDirection string
+
+const (
+	// cursorNext points to older visits, i.e. the next page
+	cursorNext cursorDirection = "n"
+	// cursorPrev points to newer visits, i.e. the previous page
+	cursorPrev cursorDirection = "p"
+)
+
+// visitsCursor is a keyset pagination position over visits, ordered by (timestamp, id) descending.
+// It's handed to the clients as an opaque string, and they only send it back to get the adjacent page.
+type visitsCursor struct {
+	direction cursorDirection
+	timestamp time.Time
+	id        int
+}
+
+func newVisitsCursor(direction cursorDirection, visit *Visit) string {
+	return visitsCursor{
+		direction: direction,
+		timestamp: visit.Timestamp,
+		id:        visit.Id,
+	}.encode()
+}
+
+// encode keeps the timestamp in microseconds, the same precision as postgres timestamptz,
+// so the keyset comparison is exact
+func (c visitsCursor) encode() string {
+	raw := fmt.Sprintf("%s:%d:%d", c.direction, c.timestamp.UnixMicro(), c.id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeVisitsCursor(cursor string) (*visitsCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed", ErrInvalidCursor)
+	}
+
+	direction := cursorDirection(parts[0])
+	if direction != cursorNext && direction != cursorPrev {
+		return nil, fmt.Errorf("%w: unknown direction", ErrInvalidCursor)
+	}
+	micros, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: timestamp: %w", ErrInvalidCursor, err)
+	}
+	id, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: id: %w", ErrInvalidCursor, err)
+	}
+
+	return &visitsCursor{
+		direction: direction,
+		timestamp: time.UnixMicro(micros),
+		id:        id,
+	}, nil
+}
+
+// VisitsCursorPage is a single page of visits, with the cursors to the adjacent pages
+// (empty if there is no such page).
+type VisitsCursorPage struct {
+	Visits []*Visit
+	Next   string
+	Prev   string
+}
+
+// cursorPageFromRows builds a page from the fetched rows: size+1 rows are always requested,
+// and the extra row (if present) is only used to know whether there are more rows in the cursor direction.
+// Rows fetched with a "prev" cursor come in ascending order, and are reversed here.
+func cursorPageFromRows(visits []*Visit, cursor *visitsCursor, size int) *VisitsCursorPage {
+	hasMore := len(visits) > size
+	if hasMore {
+		visits = visits[:size]
+	}
+
+	page := &VisitsCursorPage{Visits: visits}
+	if len(visits) == 0 {
+		return page
+	}
+
+	if cursor != nil && cursor.direction == cursorPrev {
+		for i, j := 0, len(visits)-1; i < j; i, j = i+1, j-1 {
+			visits[i], visits[j] = visits[j], visits[i]
+		}
+		if hasMore {
+			page.Prev = newVisitsCursor(cursorPrev, visits[0])
+		}
+		page.Next = newVisitsCursor(cursorNext, visits[len(visits)-1])
+		return page
+	}
+
+	if hasMore {
+		page.Next = newVisitsCursor(cursorNext, visits[len(visits)-1])
+	}
+	if cursor != nil {
+		page.Prev = newVisitsCursor(cursorPrev, visits[0])
+	}
+	return page
+}
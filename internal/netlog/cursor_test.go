@@ -0,0 +1,170 @@
+package netlog
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVisitsCursor_encodeDecode(t *testing.T) {
+	visit := &Visit{
+		Id:        42,
+		Timestamp: time.Date(2025, 3, 10, 12, 0, 0, 123456789, time.UTC),
+	}
+
+	cursor, err := decodeVisitsCursor(newVisitsCursor(cursorPrev, visit))
+	require.NoError(t, err)
+	assert.Equal(t, cursorPrev, cursor.direction)
+	assert.Equal(t, 42, cursor.id)
+	// postgres keeps microseconds only
+	assert.True(t, cursor.timestamp.Equal(visit.Timestamp.Truncate(time.Microsecond)))
+
+	for _, invalid := range []string{
+		"not base64 !",
+		base64.RawURLEncoding.EncodeToString([]byte("n:123")),
+		base64.RawURLEncoding.EncodeToString([]byte("x:123:1")),
+		base64.RawURLEncoding.EncodeToString([]byte("n:abc:1")),
+		base64.RawURLEncoding.EncodeToString([]byte("n:123:abc")),
+	} {
+		_, err := decodeVisitsCursor(invalid)
+		assert.True(t, errors.Is(err, ErrInvalidCursor), invalid)
+	}
+}
+
+func TestCursorPageFromRows(t *testing.T) {
+	now := time.Now().Truncate(time.Microsecond)
+	visitsRange := func(ids ...int) []*Visit {
+		var visits []*Visit
+		for _, id := range ids {
+			visits = append(visits, &Visit{Id: id, Timestamp: now.Add(time.Duration(id) * time.Minute)})
+		}
+		return visits
+	}
+	decode := func(c string) *visitsCursor {
+		cursor, err := decodeVisitsCursor(c)
+		require.NoError(t, err)
+		return cursor
+	}
+
+	// first page, more rows
+	page := cursorPageFromRows(visitsRange(5, 4, 3), nil, 2)
+	require.Len(t, page.Visits, 2)
+	assert.Empty(t, page.Prev)
+	assert.Equal(t, 4, decode(page.Next).id)
+	assert.Equal(t, cursorNext, decode(page.Next).direction)
+
+	// next page, no more rows
+	page = cursorPageFromRows(visitsRange(2, 1), &visitsCursor{direction: cursorNext}, 2)
+	require.Len(t, page.Visits, 2)
+	assert.Empty(t, page.Next)
+	assert.Equal(t, 2, decode(page.Prev).id)
+	assert.Equal(t, cursorPrev, decode(page.Prev).direction)
+
+	// prev page, rows come in ascending order
+	page = cursorPageFromRows(visitsRange(3, 4, 5), &visitsCursor{direction: cursorPrev}, 2)
+	require.Len(t, page.Visits, 2)
+	assert.Equal(t, 4, page.Visits[0].Id)
+	assert.Equal(t, 3, page.Visits[1].Id)
+	assert.Equal(t, 4, decode(page.Prev).id)
+	assert.Equal(t, 3, decode(page.Next).id)
+
+	page = cursorPageFromRows(nil, &visitsCursor{direction: cursorNext}, 2)
+	assert.Empty(t, page.Visits)
+	assert.Empty(t, page.Next)
+	assert.Empty(t, page.Prev)
+}
+
+// visitRowsMock are visits rows that fail when read, after the first failAfter rows
+type visitRowsMock struct {
+	visits    []*Visit
+	failAfter int
+	// scanErr fails the row scan, otherwise the rows fail like with a dropped connection
+	scanErr bool
+	err     error
+	read    int
+	closed  bool
+}
+
+var _ pgx.Rows = (*visitRowsMock)(nil)
+
+func (r *visitRowsMock) Close()                                       { r.closed = true }
+func (r *visitRowsMock) Err() error                                   { return r.err }
+func (r *visitRowsMock) CommandTag() pgconn.CommandTag                { return pgconn.CommandTag{} }
+func (r *visitRowsMock) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (r *visitRowsMock) Values() ([]any, error)                       { return nil, errors.New("not implemented") }
+func (r *visitRowsMock) RawValues() [][]byte                          { return nil }
+func (r *visitRowsMock) Conn() *pgx.Conn                              { return nil }
+
+func (r *visitRowsMock) Next() bool {
+	if r.closed || r.read == len(r.visits) {
+		r.closed = true
+		return false
+	}
+	if r.read == r.failAfter && !r.scanErr {
+		r.err = errors.New("conn closed")
+		r.closed = true
+		return false
+	}
+	r.read++
+	return true
+}
+
+func (r *visitRowsMock) Scan(dest ...any) error {
+	if r.read-1 == r.failAfter {
+		r.err = errors.New("can't scan into dest[5]")
+		r.closed = true
+		return r.err
+	}
+	v := r.visits[r.read-1]
+	*dest[0].(*int) = v.Id
+	*dest[1].(*string) = v.Title
+	*dest[2].(*string) = v.Source
+	*dest[3].(*string) = v.Device
+	*dest[4].(*string) = v.URL
+	*dest[5].(*time.Time) = v.Timestamp
+	*dest[6].(*string) = v.Host
+	*dest[7].(*string) = v.RegisteredDomain
+	*dest[8].(*string) = v.CanonicalURL
+	return nil
+}
+
+func TestVisitsFromRows(t *testing.T) {
+	now := time.Now()
+	newRows := func() *visitRowsMock {
+		var visits []*Visit
+		for id := 5; id > 0; id-- {
+			visits = append(visits, &Visit{Id: id, URL: "https://serj-tubin.com", Timestamp: now.Add(time.Duration(id) * time.Minute)})
+		}
+		return &visitRowsMock{visits: visits, failAfter: -1}
+	}
+
+	rows := newRows()
+	visits, err := visitsFromRows(rows)
+	require.NoError(t, err)
+	require.Len(t, visits, 5)
+	assert.Equal(t, 5, visits[0].Id)
+	assert.True(t, visits[0].Timestamp.Equal(now.Add(5*time.Minute)))
+	assert.True(t, rows.closed)
+
+	// the rows fail partway through, e.g. a statement timeout, and no short page is made of them
+	rows = newRows()
+	rows.failAfter = 2
+	visits, err = visitsFromRows(rows)
+	require.EqualError(t, err, "conn closed")
+	assert.Nil(t, visits)
+	assert.True(t, rows.closed)
+
+	rows = newRows()
+	rows.failAfter = 3
+	rows.scanErr = true
+	visits, err = visitsFromRows(rows)
+	require.ErrorContains(t, err, "can't scan")
+	assert.Nil(t, visits)
+	assert.True(t, rows.closed)
+}
@@ -0,0 +1,312 @@
+package netlog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// FocusPeriod is the period a focus report is made for, days and weeks are in UTC, the weeks start on Monday
+type FocusPeriod string
+
+const (
+	FocusPeriodDay  FocusPeriod = "day"
+	FocusPeriodWeek FocusPeriod = "week"
+)
+
+const (
+	// UncategorizedCategory is the category of the hosts no category rule matches
+	UncategorizedCategory = "uncategorized"
+
+	maxCategoryPatternLength = 253
+	maxCategoryLength        = 50
+	// the focus reports are rebuilt from the sessions of all the visits in the range, so the range is limited
+	maxFocusRebuildRange = 92 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidCategoryRule  = errors.New("invalid category rule")
+	ErrCategoryRuleNotFound = errors.New("category rule not found")
+	ErrInvalidFocusPeriod   = errors.New("invalid focus period, use day or week")
+)
+
+func ParseFocusPeriod(raw string) (FocusPeriod, error) {
+	switch period := FocusPeriod(raw); period {
+	case FocusPeriodDay, FocusPeriodWeek:
+		return period, nil
+	default:
+		return "", ErrInvalidFocusPeriod
+	}
+}
+
+// Start returns the start of the period t is in
+func (p FocusPeriod) Start(t time.Time) time.Time {
+	day := t.UTC().Truncate(24 * time.Hour)
+	if p == FocusPeriodWeek {
+		// Monday is the first day of the week
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	}
+	return day
+}
+
+// End returns the end (exclusive) of the period starting at start
+func (p FocusPeriod) End(start time.Time) time.Time {
+	if p == FocusPeriodWeek {
+		return start.AddDate(0, 0, 7)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// CategoryRule puts the hosts matching the pattern in the category. The pattern matches the host and all
+// its subdomains (e.g. "github.com" matches "gist.github.com"), and can have the path.Match wildcards
+// (e.g. "*.slack.com" or "news.*").
+type CategoryRule struct {
+	ID        int       `json:"id"`
+	Pattern   string    `json:"pattern"`
+	Category  string    `json:"category"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// normalizeCategoryRule lowercases the pattern and the category, and checks they are valid
+func normalizeCategoryRule(rule *CategoryRule) error {
+	pattern := strings.ToLower(strings.TrimSpace(rule.Pattern))
+	if pattern == "" {
+		return fmt.Errorf("%w: empty pattern", ErrInvalidCategoryRule)
+	}
+	if len(pattern) > maxCategoryPatternLength {
+		return fmt.Errorf("%w: pattern longer than %d characters", ErrInvalidCategoryRule, maxCategoryPatternLength)
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("%w: pattern [%s]: %w", ErrInvalidCategoryRule, pattern, err)
+	}
+
+	category := strings.ToLower(strings.TrimSpace(rule.Category))
+	if category == "" {
+		return fmt.Errorf("%w: empty category", ErrInvalidCategoryRule)
+	}
+	if category == UncategorizedCategory {
+		return fmt.Errorf("%w: %s is the category of the hosts without a rule", ErrInvalidCategoryRule, UncategorizedCategory)
+	}
+	if utf8.RuneCountInString(category) > maxCategoryLength {
+		return fmt.Errorf("%w: category longer than %d characters", ErrInvalidCategoryRule, maxCategoryLength)
+	}
+	for _, c := range category {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '-' && c != '_' && c != '.' {
+			return fmt.Errorf("%w: category can only have letters, digits, '-', '_' and '.'", ErrInvalidCategoryRule)
+		}
+	}
+
+	rule.Pattern = pattern
+	rule.Category = category
+	return nil
+}
+
+// Categorizer maps the hosts to their categories by the category rules. When more rules match a host, the
+// most specific one wins: a pattern without wildcards over one with them, and then the pattern with more
+// labels (e.g. "docs.google.com" over "google.com"). Not safe for concurrent use.
+type Categorizer struct {
+	rules []CategoryRule
+	// host to its category, as the same hosts are visited over and over
+	cache map[string]string
+}
+
+func NewCategorizer(rules []CategoryRule) *Categorizer {
+	sorted := slices.Clone(rules)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return morePreciseHostPattern(sorted[i].Pattern, sorted[j].Pattern)
+	})
+	return &Categorizer{
+		rules: sorted,
+		cache: map[string]string{},
+	}
+}
+
+func morePreciseHostPattern(a, b string) bool {
+	aWildcards, bWildcards := strings.ContainsAny(a, "*?["), strings.ContainsAny(b, "*?[")
+	if aWildcards != bWildcards {
+		return !aWildcards
+	}
+	if aLabels, bLabels := strings.Count(a, "."), strings.Count(b, "."); aLabels != bLabels {
+		return aLabels > bLabels
+	}
+	return len(a) > len(b)
+}
+
+// Category returns the category of the host, UncategorizedCategory if no rule matches it
+func (c *Categorizer) Category(host string) string {
+	host = strings.ToLower(host)
+	if category, ok := c.cache[host]; ok {
+		return category
+	}
+
+	category := UncategorizedCategory
+	if host != "" {
+		for _, rule := range c.rules {
+			if matchesHost(host, rule.Pattern) {
+				category = rule.Category
+				break
+			}
+		}
+	}
+	c.cache[host] = category
+	return category
+}
+
+type CategoryTime struct {
+	Category string  `json:"category"`
+	Seconds  float64 `json:"seconds"`
+	Visits   int     `json:"visits"`
+}
+
+// FocusReport is the estimated time spent and the visits count per category, in a day or a week.
+// The time is estimated as for the sessions, see SessionAnalyzer. The reports are stored, so they can be
+// compared over time, and are not changed by the later category rules changes, until they are rebuilt.
+type FocusReport struct {
+	Period  FocusPeriod `json:"period"`
+	Start   time.Time   `json:"start"`
+	End     time.Time   `json:"end"`
+	Visits  int         `json:"visits"`
+	Seconds float64     `json:"seconds"`
+	// Categories are ordered by the time spent, descending
+	Categories []CategoryTime `json:"categories"`
+	// UpdatedAt is when the report was (re)built
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BuildFocusReport sums the time spent per category, over the session visits in the period starting at start
+func BuildFocusReport(period FocusPeriod, start time.Time, sessions []*Session, categorizer *Categorizer) *FocusReport {
+	report := &FocusReport{
+		Period: period,
+		Start:  start,
+		End:    period.End(start),
+	}
+
+	perCategory := map[string]*CategoryTime{}
+	for _, s := range sessions {
+		for _, sv := range s.Visits {
+			if sv.Timestamp.Before(report.Start) || !sv.Timestamp.Before(report.End) {
+				continue
+			}
+			category := categorizer.Category(sv.Host)
+			ct, ok := perCategory[category]
+			if !ok {
+				ct = &CategoryTime{Category: category}
+				perCategory[category] = ct
+			}
+			ct.Seconds += sv.DwellSeconds
+			ct.Visits++
+			report.Seconds += sv.DwellSeconds
+			report.Visits++
+		}
+	}
+
+	report.Categories = make([]CategoryTime, 0, len(perCategory))
+	for _, ct := range perCategory {
+		report.Categories = append(report.Categories, *ct)
+	}
+	sort.Slice(report.Categories, func(i, j int) bool {
+		if report.Categories[i].Seconds == report.Categories[j].Seconds {
+			return report.Categories[i].Category < report.Categories[j].Category
+		}
+		return report.Categories[i].Seconds > report.Categories[j].Seconds
+	})
+
+	return report
+}
+
+type focusReportsRepo interface {
+	GetCategoryRules(ctx context.Context) ([]CategoryRule, error)
+	GetVisitsInRange(ctx context.Context, statsRange StatsRange) ([]*Visit, error)
+	SaveFocusReport(ctx context.Context, report *FocusReport) error
+}
+
+// FocusReporter builds the focus reports with the current category rules, and stores them
+type FocusReporter struct {
+	repo            focusReportsRepo
+	sessionAnalyzer *SessionAnalyzer
+}
+
+func NewFocusReporter(repo focusReportsRepo, sessionIdleGap time.Duration) *FocusReporter {
+	return &FocusReporter{
+		repo:            repo,
+		sessionAnalyzer: NewSessionAnalyzer(sessionIdleGap),
+	}
+}
+
+// Rebuild builds and stores the reports of all the periods overlapping the range, and returns them
+func (fr *FocusReporter) Rebuild(ctx context.Context, period FocusPeriod, statsRange StatsRange) ([]*FocusReport, error) {
+	var starts []time.Time
+	for start := period.Start(statsRange.From); start.Before(statsRange.To); start = period.End(start) {
+		starts = append(starts, start)
+	}
+	if len(starts) == 0 {
+		return nil, nil
+	}
+
+	rules, err := fr.repo.GetCategoryRules(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get category rules: %w", err)
+	}
+	categorizer := NewCategorizer(rules)
+
+	// the visits right after the last period are included too, as the time spent on the last visits
+	// in it is measured by them
+	visits, err := fr.repo.GetVisitsInRange(ctx, StatsRange{
+		From: starts[0],
+		To:   period.End(starts[len(starts)-1]).Add(fr.sessionAnalyzer.IdleGap()),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get visits: %w", err)
+	}
+	sessions := fr.sessionAnalyzer.Sessions(visits)
+
+	now := time.Now()
+	reports := make([]*FocusReport, 0, len(starts))
+	for _, start := range starts {
+		report := BuildFocusReport(period, start, sessions, categorizer)
+		report.UpdatedAt = now
+		if err := fr.repo.SaveFocusReport(ctx, report); err != nil {
+			return reports, fmt.Errorf("save %s report %s: %w", period, start.Format(time.DateOnly), err)
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+// MaintainFocusReports rebuilds the reports of the current and the previous day and week on each interval,
+// until the context is done. The previous ones too, as the visits can arrive late, in batches.
+func MaintainFocusReports(ctx context.Context, reporter *FocusReporter, interval time.Duration) {
+	if interval <= 0 {
+		log.Debugln("netlog focus reports disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		for _, period := range []FocusPeriod{FocusPeriodDay, FocusPeriodWeek} {
+			previous := period.Start(period.Start(now).Add(-time.Nanosecond))
+			if _, err := reporter.Rebuild(ctx, period, StatsRange{From: previous, To: now}); err != nil {
+				log.Errorf("netlog %s focus reports: %s", period, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package netlog
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/2beens/serjtubincom/internal/telemetry/tracing"
+	"github.com/2beens/serjtubincom/pkg"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type CategoryRulesResponse struct {
+	Rules []CategoryRule `json:"rules"`
+}
+
+type FocusReportsResponse struct {
+	Range   StatsRange     `json:"range"`
+	Reports []*FocusReport `json:"reports"`
+}
+
+type HostCategory struct {
+	HostCount
+	Category string `json:"category"`
+}
+
+type categoryRuleRequest struct {
+	Pattern  string `json:"pattern"`
+	Category string `json:"category"`
+}
+
+func (handler *Handler) handleCategoryRules(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.GlobalTracer.Start(r.Context(), "netlogHandler.categoryRules")
+	defer span.End()
+
+	rules, err := handler.repo.GetCategoryRules(ctx)
+	if err != nil {
+		log.Errorf("get netlog category rules: %s", err)
+		http.Error(w, "failed to get netlog category rules", http.StatusInternalServerError)
+		return
+	}
+
+	if rules == nil {
+		rules = []CategoryRule{}
+	}
+	pkg.SendJsonResponse(w, http.StatusOK, CategoryRulesResponse{Rules: rules})
+}
+
+// handleSaveCategoryRule adds a category rule, or changes the category of the rule with the same pattern
+func (handler *Handler) handleSaveCategoryRule(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.GlobalTracer.Start(r.Context(), "netlogHandler.saveCategoryRule")
+	defer span.End()
+
+	var req categoryRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid category rule json", http.StatusBadRequest)
+		return
+	}
+
+	rule, err := handler.repo.SaveCategoryRule(ctx, &CategoryRule{
+		Pattern:  req.Pattern,
+		Category: req.Category,
+	})
+	switch {
+	case errors.Is(err, ErrInvalidCategoryRule):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Errorf("save netlog category rule [%s -> %s]: %s", req.Pattern, req.Category, err)
+		http.Error(w, "failed to save category rule", http.StatusInternalServerError)
+		return
+	}
+
+	pkg.SendJsonResponse(w, http.StatusOK, rule)
+}
+
+func (handler *Handler) handleDeleteCategoryRule(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.GlobalTracer.Start(r.Context(), "netlogHandler.deleteCategoryRule")
+	defer span.End()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid category rule id", http.StatusBadRequest)
+		return
+	}
+	span.SetAttributes(attribute.Int("rule.id", id))
+
+	err = handler.repo.DeleteCategoryRule(ctx, id)
+	switch {
+	case errors.Is(err, ErrCategoryRuleNotFound):
+		http.Error(w, "category rule not found", http.StatusNotFound)
+		return
+	case err != nil:
+		log.Errorf("delete netlog category rule [%d]: %s", id, err)
+		http.Error(w, "failed to delete category rule", http.StatusInternalServerError)
+		return
+	}
+
+	pkg.WriteTextResponseOK(w, "deleted:"+strconv.Itoa(id))
+}
+
+// handleHostCategories returns the top hosts in the range with their categories, to see which of the
+// often visited hosts are still uncategorized
+func (handler *Handler) handleHostCategories(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.GlobalTracer.Start(r.Context(), "netlogHandler.hostCategories")
+	defer span.End()
+
+	statsRange, err := statsRangeFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := statsLimitFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rules, err := handler.repo.GetCategoryRules(ctx)
+	if err != nil {
+		log.Errorf("get netlog category rules: %s", err)
+		http.Error(w, "failed to get netlog host categories", http.StatusInternalServerError)
+		return
+	}
+	hosts, err := handler.repo.TopHosts(ctx, statsRange, limit)
+	if err != nil {
+		log.Errorf("get netlog top hosts: %s", err)
+		http.Error(w, "failed to get netlog host categories", http.StatusInternalServerError)
+		return
+	}
+
+	categorizer := NewCategorizer(rules)
+	hostCategories := make([]HostCategory, 0, len(hosts))
+	for _, h := range hosts {
+		hostCategories = append(hostCategories, HostCategory{HostCount: h, Category: categorizer.Category(h.Host)})
+	}
+
+	pkg.SendJsonResponse(w, http.StatusOK, StatsResponse{Range: statsRange, Data: hostCategories})
+}
+
+// handleFocusReports returns the stored focus reports of the {period} (day or week) in the range,
+// the oldest first
+func (handler *Handler) handleFocusReports(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.GlobalTracer.Start(r.Context(), "netlogHandler.focusReports")
+	defer span.End()
+
+	period, err := ParseFocusPeriod(mux.Vars(r)["period"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	statsRange, err := statsRangeFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	span.SetAttributes(attribute.String("period", string(period)))
+
+	reports, err := handler.repo.GetFocusReports(ctx, period, statsRange)
+	if err != nil {
+		log.Errorf("get netlog %s focus reports: %s", period, err)
+		http.Error(w, "failed to get netlog focus reports", http.StatusInternalServerError)
+		return
+	}
+
+	if reports == nil {
+		reports = []*FocusReport{}
+	}
+	pkg.SendJsonResponse(w, http.StatusOK, FocusReportsResponse{Range: statsRange, Reports: reports})
+}
+
+// handleRebuildFocusReports rebuilds the focus reports of the {period} in the range with the current
+// category rules, e.g. after the rules are changed, and returns them
+func (handler *Handler) handleRebuildFocusReports(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.GlobalTracer.Start(r.Context(), "netlogHandler.rebuildFocusReports")
+	defer span.End()
+
+	period, err := ParseFocusPeriod(mux.Vars(r)["period"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	statsRange, err := statsRangeFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if statsRange.To.Sub(statsRange.From) > maxFocusRebuildRange {
+		http.Error(w, "invalid range, the reports rebuild is limited to 92 days", http.StatusBadRequest)
+		return
+	}
+	span.SetAttributes(attribute.String("period", string(period)))
+
+	reports, err := handler.focusReporter.Rebuild(ctx, period, statsRange)
+	if err != nil {
+		log.Errorf("rebuild netlog %s focus reports: %s", period, err)
+		http.Error(w, "failed to rebuild netlog focus reports", http.StatusInternalServerError)
+		return
+	}
+
+	if reports == nil {
+		reports = []*FocusReport{}
+	}
+	pkg.SendJsonResponse(w, http.StatusOK, FocusReportsResponse{Range: statsRange, Reports: reports})
+}
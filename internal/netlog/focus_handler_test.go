@@ -0,0 +1,116 @@
+package netlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/2beens/serjtubincom/internal/auth"
+	"github.com/2beens/serjtubincom/internal/telemetry/metrics"
+
+	"github.com/go-redis/redismock/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetlogHandler_focus(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	repo := NewRepoMock()
+	m := metrics.NewTestManager()
+	loginChecker := auth.NewLoginChecker(time.Hour, db)
+	r := setupNetlogRouterForTests(t, repo, m, loginChecker, "beer")
+
+	day := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	repo.Visits = map[int]Visit{
+		1: {Id: 1, Device: "mac", URL: "https://github.com/a", Timestamp: day.Add(9 * time.Hour)},
+		2: {Id: 2, Device: "mac", URL: "https://gist.github.com/b", Timestamp: day.Add(9*time.Hour + 10*time.Minute)},
+		3: {Id: 3, Device: "mac", URL: "https://twitter.com/home", Timestamp: day.Add(9*time.Hour + 15*time.Minute)},
+	}
+
+	send := func(method, path string, body io.Reader) *httptest.ResponseRecorder {
+		mock.ExpectGet("serj-service-session||tokenAbc123").SetVal(fmt.Sprintf("%d", time.Now().Unix()))
+
+		req, err := http.NewRequest(method, path, body)
+		require.NoError(t, err)
+		req.Header.Set("Origin", "test")
+		req.Header.Set("X-SERJ-TOKEN", "tokenAbc123")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	getReports := func(method, path string) FocusReportsResponse {
+		rr := send(method, path, nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var resp FocusReportsResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		return resp
+	}
+
+	rr := send("POST", "/netlog/categories/rules", strings.NewReader(`{"pattern":"GitHub.com","category":"Work"}`))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var rule CategoryRule
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &rule))
+	assert.Equal(t, "github.com", rule.Pattern)
+	assert.Equal(t, "work", rule.Category)
+
+	rr = send("POST", "/netlog/categories/rules", strings.NewReader(`{"pattern":"twitter.com","category":"news"}`))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	// the same pattern again changes the category of the rule
+	rr = send("POST", "/netlog/categories/rules", strings.NewReader(`{"pattern":"twitter.com","category":"social"}`))
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	rr = send("POST", "/netlog/categories/rules", strings.NewReader(`{"pattern":"x.com","category":"uncategorized"}`))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	rr = send("POST", "/netlog/categories/rules", strings.NewReader(`{"pattern":`))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = send("GET", "/netlog/categories/rules", nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var rulesResp CategoryRulesResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &rulesResp))
+	require.Len(t, rulesResp.Rules, 2)
+	assert.Equal(t, "social", rulesResp.Rules[1].Category)
+
+	rr = send("GET", "/netlog/categories/hosts?from=2026-03-10&to=2026-03-11", nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var hostsResp struct {
+		Data []HostCategory `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &hostsResp))
+	assert.ElementsMatch(t, []HostCategory{
+		{HostCount: HostCount{Host: "github.com", Visits: 1}, Category: "work"},
+		{HostCount: HostCount{Host: "gist.github.com", Visits: 1}, Category: "work"},
+		{HostCount: HostCount{Host: "twitter.com", Visits: 1}, Category: "social"},
+	}, hostsResp.Data)
+
+	// nothing stored yet
+	resp := getReports("GET", "/netlog/focus/day?from=2026-03-01&to=2026-03-31")
+	assert.Empty(t, resp.Reports)
+
+	resp = getReports("POST", "/netlog/focus/day/rebuild?from=2026-03-10&to=2026-03-11")
+	require.Len(t, resp.Reports, 1)
+	assert.Equal(t, 3, resp.Reports[0].Visits)
+	assert.Equal(t, []CategoryTime{
+		{Category: "work", Seconds: 900, Visits: 2},
+		{Category: "social", Seconds: 30, Visits: 1},
+	}, resp.Reports[0].Categories)
+
+	resp = getReports("GET", "/netlog/focus/day?from=2026-03-01&to=2026-03-31")
+	require.Len(t, resp.Reports, 1)
+	assert.Equal(t, day, resp.Reports[0].Start.UTC())
+
+	rr = send("GET", "/netlog/focus/month", nil)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	rr = send("POST", "/netlog/focus/week/rebuild?from=2025-01-01&to=2026-01-01", nil)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = send("DELETE", fmt.Sprintf("/netlog/categories/rules/%d", rule.ID), nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = send("DELETE", fmt.Sprintf("/netlog/categories/rules/%d", rule.ID), nil)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,162 @@
+package netlog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/2beens/serjtubincom/internal/telemetry/tracing"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// GetCategoryRules returns all the category rules, the oldest first
+func (r *Repo) GetCategoryRules(ctx context.Context) (_ []CategoryRule, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.getCategoryRules")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	rows, err := r.db.Query(ctx, `SELECT id, pattern, category, created_at FROM netlog.category_rule ORDER BY id;`)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, scanCategoryRule)
+}
+
+// SaveCategoryRule adds the category rule, or changes the category of the existing rule with the same pattern
+func (r *Repo) SaveCategoryRule(ctx context.Context, rule *CategoryRule) (_ *CategoryRule, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.saveCategoryRule")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	if err := normalizeCategoryRule(rule); err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.String("pattern", rule.Pattern))
+	span.SetAttributes(attribute.String("category", rule.Category))
+
+	rows, err := r.db.Query(
+		ctx,
+		`
+			INSERT INTO netlog.category_rule (pattern, category)
+			VALUES ($1, $2)
+			ON CONFLICT (pattern) DO UPDATE SET category = EXCLUDED.category
+			RETURNING id, pattern, category, created_at;
+		`,
+		rule.Pattern, rule.Category,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	saved, err := pgx.CollectExactlyOneRow(rows, scanCategoryRule)
+	if err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+func (r *Repo) DeleteCategoryRule(ctx context.Context, id int) (err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.deleteCategoryRule")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	span.SetAttributes(attribute.Int("rule.id", id))
+
+	tag, err := r.db.Exec(ctx, `DELETE FROM netlog.category_rule WHERE id = $1;`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrCategoryRuleNotFound
+	}
+
+	return nil
+}
+
+// SaveFocusReport stores the report, replacing the existing one of the same period
+func (r *Repo) SaveFocusReport(ctx context.Context, report *FocusReport) (err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.saveFocusReport")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	span.SetAttributes(attribute.String("period", string(report.Period)))
+	span.SetAttributes(attribute.String("start", report.Start.String()))
+
+	categories, err := json.Marshal(report.Categories)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.Exec(
+		ctx,
+		`
+			INSERT INTO netlog.focus_report (period, period_start, period_end, visits, seconds, categories, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (period, period_start) DO UPDATE SET
+				period_end = EXCLUDED.period_end,
+				visits = EXCLUDED.visits,
+				seconds = EXCLUDED.seconds,
+				categories = EXCLUDED.categories,
+				updated_at = EXCLUDED.updated_at;
+		`,
+		string(report.Period), report.Start, report.End, report.Visits, report.Seconds, categories, report.UpdatedAt,
+	)
+	return err
+}
+
+// GetFocusReports returns the stored reports of the period starting within the range, the oldest first
+func (r *Repo) GetFocusReports(ctx context.Context, period FocusPeriod, statsRange StatsRange) (_ []*FocusReport, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.getFocusReports")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	span.SetAttributes(attribute.String("period", string(period)))
+
+	rows, err := r.db.Query(
+		ctx,
+		`
+			SELECT period, period_start, period_end, visits, seconds, categories, updated_at
+			FROM netlog.focus_report
+			WHERE period = $1 AND period_start >= $2 AND period_start < $3
+			ORDER BY period_start;
+		`,
+		string(period), statsRange.From, statsRange.To,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	reports, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*FocusReport, error) {
+		var report FocusReport
+		var categories []byte
+		if err := row.Scan(
+			&report.Period, &report.Start, &report.End, &report.Visits, &report.Seconds, &categories, &report.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(categories, &report.Categories); err != nil {
+			return nil, fmt.Errorf("invalid focus report categories: %w", err)
+		}
+		return &report, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("found-reports", len(reports)))
+	return reports, nil
+}
+
+func scanCategoryRule(row pgx.CollectableRow) (CategoryRule, error) {
+	var rule CategoryRule
+	err := row.Scan(&rule.ID, &rule.Pattern, &rule.Category, &rule.CreatedAt)
+	return rule, err
+}
@@ -0,0 +1,93 @@
+//go:build all_tests
+
+package netlog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepo_CategoryRules(t *testing.T) {
+	ctx := context.Background()
+	repo, shutdown := testRepoSetup(t)
+	defer shutdown()
+
+	_, err := repo.db.Exec(ctx, `DELETE FROM netlog.category_rule`)
+	require.NoError(t, err)
+
+	_, err = repo.SaveCategoryRule(ctx, &CategoryRule{Pattern: "github.com", Category: "two words"})
+	assert.ErrorIs(t, err, ErrInvalidCategoryRule)
+
+	work, err := repo.SaveCategoryRule(ctx, &CategoryRule{Pattern: "GitHub.com", Category: "work"})
+	require.NoError(t, err)
+	assert.Equal(t, "github.com", work.Pattern)
+	_, err = repo.SaveCategoryRule(ctx, &CategoryRule{Pattern: "*.slack.com", Category: "work"})
+	require.NoError(t, err)
+
+	// the same pattern again changes the category of the existing rule
+	docs, err := repo.SaveCategoryRule(ctx, &CategoryRule{Pattern: "github.com", Category: "docs"})
+	require.NoError(t, err)
+	assert.Equal(t, work.ID, docs.ID)
+
+	rules, err := repo.GetCategoryRules(ctx)
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	assert.Equal(t, "github.com", rules[0].Pattern)
+	assert.Equal(t, "docs", rules[0].Category)
+	assert.Equal(t, "*.slack.com", rules[1].Pattern)
+
+	require.NoError(t, repo.DeleteCategoryRule(ctx, work.ID))
+	assert.ErrorIs(t, repo.DeleteCategoryRule(ctx, work.ID), ErrCategoryRuleNotFound)
+}
+
+func TestRepo_FocusReports(t *testing.T) {
+	ctx := context.Background()
+	repo, shutdown := testRepoSetup(t)
+	defer shutdown()
+
+	_, err := repo.db.Exec(ctx, `DELETE FROM netlog.focus_report`)
+	require.NoError(t, err)
+
+	monday := time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC)
+	report := &FocusReport{
+		Period:  FocusPeriodDay,
+		Start:   monday,
+		End:     monday.AddDate(0, 0, 1),
+		Visits:  3,
+		Seconds: 930,
+		Categories: []CategoryTime{
+			{Category: "work", Seconds: 900, Visits: 2},
+			{Category: UncategorizedCategory, Seconds: 30, Visits: 1},
+		},
+		UpdatedAt: time.Now().Truncate(time.Microsecond),
+	}
+	require.NoError(t, repo.SaveFocusReport(ctx, report))
+	require.NoError(t, repo.SaveFocusReport(ctx, &FocusReport{
+		Period:     FocusPeriodWeek,
+		Start:      monday,
+		End:        monday.AddDate(0, 0, 7),
+		Categories: []CategoryTime{},
+		UpdatedAt:  time.Now(),
+	}))
+
+	// saved again, replaces the stored one
+	report.Visits = 4
+	require.NoError(t, repo.SaveFocusReport(ctx, report))
+
+	reports, err := repo.GetFocusReports(ctx, FocusPeriodDay, StatsRange{From: monday, To: monday.AddDate(0, 0, 7)})
+	require.NoError(t, err)
+	require.Len(t, reports, 1)
+	assert.Equal(t, FocusPeriodDay, reports[0].Period)
+	assert.True(t, monday.Equal(reports[0].Start))
+	assert.Equal(t, 4, reports[0].Visits)
+	assert.Equal(t, report.Categories, reports[0].Categories)
+	assert.True(t, report.UpdatedAt.Equal(reports[0].UpdatedAt))
+
+	reports, err = repo.GetFocusReports(ctx, FocusPeriodDay, StatsRange{From: monday.AddDate(0, 0, 1), To: monday.AddDate(0, 0, 7)})
+	require.NoError(t, err)
+	assert.Empty(t, reports)
+}
@@ -0,0 +1,160 @@
+package netlog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFocusPeriod(t *testing.T) {
+	_, err := ParseFocusPeriod("month")
+	assert.ErrorIs(t, err, ErrInvalidFocusPeriod)
+	period, err := ParseFocusPeriod("week")
+	require.NoError(t, err)
+	assert.Equal(t, FocusPeriodWeek, period)
+
+	// Wednesday, late evening in Belgrade is already Thursday in UTC
+	belgrade, err := time.LoadLocation("Europe/Belgrade")
+	require.NoError(t, err)
+	at := time.Date(2026, 3, 11, 23, 30, 0, 0, time.UTC).In(belgrade)
+
+	dayStart := FocusPeriodDay.Start(at)
+	assert.Equal(t, time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC), dayStart)
+	assert.Equal(t, time.Date(2026, 3, 12, 0, 0, 0, 0, time.UTC), FocusPeriodDay.End(dayStart))
+
+	weekStart := FocusPeriodWeek.Start(at)
+	assert.Equal(t, time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC), weekStart)
+	assert.Equal(t, time.Date(2026, 3, 16, 0, 0, 0, 0, time.UTC), FocusPeriodWeek.End(weekStart))
+	// Monday and Sunday are in the same week
+	assert.Equal(t, weekStart, FocusPeriodWeek.Start(weekStart))
+	assert.Equal(t, weekStart, FocusPeriodWeek.Start(time.Date(2026, 3, 15, 23, 59, 0, 0, time.UTC)))
+}
+
+func TestNormalizeCategoryRule(t *testing.T) {
+	rule := &CategoryRule{Pattern: " *.Slack.com ", Category: "Work"}
+	require.NoError(t, normalizeCategoryRule(rule))
+	assert.Equal(t, "*.slack.com", rule.Pattern)
+	assert.Equal(t, "work", rule.Category)
+
+	for _, invalid := range []CategoryRule{
+		{Pattern: "", Category: "work"},
+		{Pattern: "[a-", Category: "work"},
+		{Pattern: "github.com", Category: ""},
+		{Pattern: "github.com", Category: "deep work"},
+		{Pattern: "github.com", Category: "Uncategorized"},
+	} {
+		err := normalizeCategoryRule(&invalid)
+		assert.ErrorIs(t, err, ErrInvalidCategoryRule, "%+v", invalid)
+	}
+}
+
+func TestCategorizer(t *testing.T) {
+	categorizer := NewCategorizer([]CategoryRule{
+		{ID: 1, Pattern: "google.com", Category: "work"},
+		{ID: 2, Pattern: "*.google.*", Category: "entertainment"},
+		{ID: 3, Pattern: "docs.google.com", Category: "docs"},
+		{ID: 4, Pattern: "news.*", Category: "news"},
+		{ID: 5, Pattern: "ycombinator.com", Category: "news"},
+	})
+
+	for host, category := range map[string]string{
+		"google.com":             "work",
+		"mail.google.com":        "work",
+		"docs.google.com":        "docs",
+		"sheets.docs.google.com": "docs",
+		"maps.google.de":         "entertainment",
+		"news.bbc.co.uk":         "news",
+		"NEWS.ycombinator.com":   "news",
+		"github.com":             UncategorizedCategory,
+		"":                       UncategorizedCategory,
+	} {
+		assert.Equal(t, category, categorizer.Category(host), host)
+	}
+}
+
+func TestBuildFocusReport(t *testing.T) {
+	day := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	at := func(hour, minute int) time.Time {
+		return day.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+	}
+	visits := []*Visit{
+		// the day before, not in the report
+		{Id: 1, Device: "mac", URL: "https://github.com/a", Timestamp: at(-1, 0)},
+		{Id: 2, Device: "mac", URL: "https://github.com/b", Timestamp: at(9, 0)},
+		{Id: 3, Device: "mac", URL: "https://go.dev/doc", Timestamp: at(9, 20)},
+		{Id: 4, Device: "mac", URL: "https://twitter.com/home", Timestamp: at(9, 25)},
+		{Id: 5, Device: "iphone", URL: "https://twitter.com/x", Timestamp: at(21, 0)},
+		{Id: 6, Device: "iphone", URL: "https://example.com", Timestamp: at(21, 10)},
+	}
+	sessions := NewSessionAnalyzer(30 * time.Minute).Sessions(visits)
+	categorizer := NewCategorizer([]CategoryRule{
+		{Pattern: "github.com", Category: "work"},
+		{Pattern: "go.dev", Category: "docs"},
+		{Pattern: "twitter.com", Category: "social"},
+	})
+
+	report := BuildFocusReport(FocusPeriodDay, day, sessions, categorizer)
+	assert.Equal(t, FocusPeriodDay, report.Period)
+	assert.Equal(t, day, report.Start)
+	assert.Equal(t, day.AddDate(0, 0, 1), report.End)
+	assert.Equal(t, 5, report.Visits)
+	assert.Equal(t, []CategoryTime{
+		{Category: "work", Seconds: 1200, Visits: 1},
+		{Category: "social", Seconds: 630, Visits: 2},
+		{Category: "docs", Seconds: 300, Visits: 1},
+		{Category: UncategorizedCategory, Seconds: 30, Visits: 1},
+	}, report.Categories)
+	assert.Equal(t, 2160.0, report.Seconds)
+
+	empty := BuildFocusReport(FocusPeriodDay, day.AddDate(0, 0, 5), sessions, categorizer)
+	assert.Zero(t, empty.Visits)
+	assert.NotNil(t, empty.Categories)
+	assert.Empty(t, empty.Categories)
+}
+
+func TestFocusReporter_Rebuild(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRepoMock()
+	repo.Visits = map[int]Visit{}
+
+	monday := time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC)
+	// the last visit of Sunday is followed by one on Monday, which measures the time spent on it
+	repo.Visits[1] = Visit{Id: 1, Device: "mac", URL: "https://github.com/a", Timestamp: monday.Add(-10 * time.Minute)}
+	repo.Visits[2] = Visit{Id: 2, Device: "mac", URL: "https://go.dev/doc", Timestamp: monday.Add(5 * time.Minute)}
+	repo.Visits[3] = Visit{Id: 3, Device: "mac", URL: "https://github.com/b", Timestamp: monday.Add(26 * time.Hour)}
+
+	_, err := repo.SaveCategoryRule(ctx, &CategoryRule{Pattern: "github.com", Category: "work"})
+	require.NoError(t, err)
+
+	reporter := NewFocusReporter(repo, 30*time.Minute)
+	reports, err := reporter.Rebuild(ctx, FocusPeriodDay, StatsRange{
+		From: monday.Add(-time.Hour),
+		To:   monday.Add(24 * time.Hour),
+	})
+	require.NoError(t, err)
+	require.Len(t, reports, 2)
+	assert.Equal(t, monday.AddDate(0, 0, -1), reports[0].Start)
+	assert.Equal(t, []CategoryTime{{Category: "work", Seconds: 900, Visits: 1}}, reports[0].Categories)
+	assert.Equal(t, monday, reports[1].Start)
+	assert.Equal(t, []CategoryTime{{Category: UncategorizedCategory, Seconds: 30, Visits: 1}}, reports[1].Categories)
+	assert.False(t, reports[1].UpdatedAt.IsZero())
+
+	stored, err := repo.GetFocusReports(ctx, FocusPeriodDay, StatsRange{From: monday.AddDate(0, 0, -7), To: monday.AddDate(0, 0, 7)})
+	require.NoError(t, err)
+	assert.Equal(t, reports, stored)
+
+	// the week report, built with the new rule too
+	_, err = repo.SaveCategoryRule(ctx, &CategoryRule{Pattern: "go.dev", Category: "docs"})
+	require.NoError(t, err)
+	reports, err = reporter.Rebuild(ctx, FocusPeriodWeek, StatsRange{From: monday, To: monday.Add(time.Hour)})
+	require.NoError(t, err)
+	require.Len(t, reports, 1)
+	assert.Equal(t, monday, reports[0].Start)
+	assert.Equal(t, []CategoryTime{
+		{Category: "docs", Seconds: 30, Visits: 1},
+		{Category: "work", Seconds: 30, Visits: 1},
+	}, reports[0].Categories)
+}
@@ -0,0 +1,431 @@
+package netlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/2beens/serjtubincom/internal/telemetry/tracing"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+const (
+	DefaultGoogleDriveBackupsFolderName = "netlog-backup"
+
+	googleDriveFolderMimeType = "application/vnd.google-apps.folder"
+)
+
+var _ BackupTarget = (*GoogleDriveBackupTarget)(nil)
+
+type GoogleDriveBackupTarget struct {
+	service         *drive.Service
+	folderName      string
+	backupsFolderId string
+	// shareWithEmail is the user the backups folder is shared with (as a reader), none if empty
+	shareWithEmail  string
+	sharePermission *drive.Permission
+}
+
+type GoogleDriveBackupTargetParams struct {
+	CredentialsJson []byte
+	FolderName      string
+	ShareWithEmail  string
+}
+
+func NewGoogleDriveBackupTarget(ctx context.Context, params GoogleDriveBackupTargetParams) (*GoogleDriveBackupTarget, error) {
+	ctx, span := tracing.GlobalNetlogBackupTracer.Start(ctx, "googleDriveBackupTarget.new")
+	defer span.End()
+
+	// https://github.com/googleapis/google-api-go-client/blob/master/drive/v3/drive-gen.go
+	driveService, err := drive.NewService(ctx, option.WithCredentialsJSON(params.CredentialsJson))
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve drive client: %w", err)
+	}
+
+	folderName := params.FolderName
+	if folderName == "" {
+		folderName = DefaultGoogleDriveBackupsFolderName
+	}
+
+	rootFolderQuery := fmt.Sprintf("mimeType = '%s' and trashed = false and name = '%s'", googleDriveFolderMimeType, folderName)
+	log.Println(rootFolderQuery)
+	netlogBackupFolder, err := driveService.
+		Files.List().
+		Q(rootFolderQuery).
+		Fields("files(id, name)").
+		Do()
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve files: %w", err)
+	}
+
+	t := &GoogleDriveBackupTarget{
+		service:        driveService,
+		folderName:     folderName,
+		shareWithEmail: params.ShareWithEmail,
+	}
+
+	if len(netlogBackupFolder.Files) == 0 {
+		log.Println("root backups folder not found, recreating ...")
+		if err := t.createRootBackupsFolder(ctx); err != nil {
+			return nil, fmt.Errorf("failed to create root backups folder: %w", err)
+		}
+		log.Printf("new root backups folder created: %s", t.backupsFolderId)
+		return t, nil
+	}
+
+	rbf := netlogBackupFolder.Files[0]
+	if len(netlogBackupFolder.Files) > 1 {
+		log.Printf("attention: found %d root backups folders, will take the first one: %s", len(netlogBackupFolder.Files), rbf.Id)
+	}
+	log.Printf("found backups folder, %s: %s", rbf.Name, rbf.Id)
+	t.backupsFolderId = rbf.Id
+
+	if t.shareWithEmail == "" {
+		return t, nil
+	}
+
+	pList, err := driveService.Permissions.
+		List(t.backupsFolderId).
+		Fields("permissions(id, type, role, emailAddress)").
+		Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get root backup folder permission list: %w", err)
+	}
+
+	for _, p := range pList.Permissions {
+		if p.Type == "user" && p.Role == "reader" && strings.EqualFold(p.EmailAddress, t.shareWithEmail) {
+			t.sharePermission = p
+			break
+		}
+	}
+
+	if t.sharePermission == nil {
+		log.Printf("backups folder not shared with %s, creating permission ...", t.shareWithEmail)
+		if err := t.shareBackupsFolder(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+// DestroyAllFiles deletes all files from the google drive, not only the netlog backups
+func DestroyAllFiles(ctx context.Context, credentialsJson []byte) error {
+	ctx, span := tracing.GlobalNetlogBackupTracer.Start(ctx, "googleDriveBackupTarget.destroyAll")
+	defer span.End()
+
+	driveService, err := drive.NewService(ctx, option.WithCredentialsJSON(credentialsJson))
+	if err != nil {
+		return fmt.Errorf("unable to retrieve drive client: %w", err)
+	}
+
+	log.Println(" !! destroying netlog visits backups ...")
+
+	// all the pages are listed before deleting, as deleting the files while paging would skip some of them
+	files, err := listDriveFiles(ctx, driveService, "trashed = false")
+	if err != nil {
+		return fmt.Errorf("failed to get files list: %w", err)
+	}
+
+	log.Printf("deleting %d files ...", len(files))
+	for _, f := range files {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Printf("deleting: %s [%s] ...", f.Name, f.Id)
+		err = driveService.Files.
+			Delete(f.Id).
+			Context(ctx).
+			Do()
+		if err != nil {
+			log.Printf("failed to delete file %s: %s", f.Id, err)
+		}
+	}
+
+	if err := driveService.Files.EmptyTrash().Do(); err != nil {
+		log.Printf("empty trash err: %s", err)
+	}
+
+	return nil
+}
+
+func (t *GoogleDriveBackupTarget) Name() string {
+	return fmt.Sprintf("google drive [%s]", t.folderName)
+}
+
+func (t *GoogleDriveBackupTarget) List(ctx context.Context) ([]BackupFile, error) {
+	ctx, span := tracing.GlobalNetlogBackupTracer.Start(ctx, "googleDriveBackupTarget.list")
+	defer span.End()
+
+	driveFiles, err := t.listFiles(ctx, fmt.Sprintf("'%s' in parents and mimeType != '%s' and trashed = false", t.backupsFolderId, googleDriveFolderMimeType))
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]BackupFile, 0, len(driveFiles))
+	for _, f := range driveFiles {
+		if f.Name == backupManifestFileName {
+			continue
+		}
+
+		createdAt, err := time.Parse(time.RFC3339, f.CreatedTime)
+		if err != nil {
+			log.Printf(" ---> error parsing created at for file %s: %s", f.Name, err)
+		}
+		files = append(files, BackupFile{
+			ID:        f.Id,
+			Name:      f.Name,
+			CreatedAt: createdAt,
+		})
+	}
+
+	return files, nil
+}
+
+func (t *GoogleDriveBackupTarget) UploadChunk(ctx context.Context, name string, data []byte) (BackupFile, error) {
+	ctx, span := tracing.GlobalNetlogBackupTracer.Start(ctx, "googleDriveBackupTarget.uploadChunk")
+	defer span.End()
+
+	fileMeta := &drive.File{
+		Name: name,
+		// https://developers.google.com/drive/api/v3/mime-types
+		MimeType: "application/vnd.google-apps.file",
+		Parents:  []string{t.backupsFolderId},
+	}
+	if !isGoogleDocsChunk(name) {
+		fileMeta.MimeType = "application/octet-stream"
+	}
+	if t.sharePermission != nil {
+		fileMeta.PermissionIds = []string{t.sharePermission.Id}
+	}
+
+	// transient errors are retried by the backup service, see uploadChunk
+	createdFile, err := t.service.
+		Files.Create(fileMeta).
+		Context(ctx).
+		Fields("id, parents, createdTime").
+		Media(bytes.NewReader(data)).
+		Do()
+	if err != nil {
+		return BackupFile{}, err
+	}
+
+	createdAt, err := time.Parse(time.RFC3339, createdFile.CreatedTime)
+	if err != nil {
+		createdAt = time.Now()
+	}
+
+	return BackupFile{
+		ID:        createdFile.Id,
+		Name:      name,
+		CreatedAt: createdAt,
+	}, nil
+}
+
+func (t *GoogleDriveBackupTarget) Download(ctx context.Context, file BackupFile) ([]byte, error) {
+	ctx, span := tracing.GlobalNetlogBackupTracer.Start(ctx, "googleDriveBackupTarget.download")
+	defer span.End()
+
+	var resp *http.Response
+	var err error
+	if isGoogleDocsChunk(file.Name) {
+		// plain json chunks are google docs files, so they have to be exported, and not downloaded directly
+		resp, err = t.service.Files.Export(file.ID, "text/plain").Context(ctx).Download()
+	} else {
+		resp, err = t.service.Files.Get(file.ID).Context(ctx).Download()
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("!! warning, download file [%s] non-200 status returned: %d", file.Name, resp.StatusCode)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+func (t *GoogleDriveBackupTarget) Delete(ctx context.Context, file BackupFile) error {
+	_, span := tracing.GlobalNetlogBackupTracer.Start(ctx, "googleDriveBackupTarget.delete")
+	defer span.End()
+
+	return t.service.Files.Delete(file.ID).Context(ctx).Do()
+}
+
+func (t *GoogleDriveBackupTarget) GetManifest(ctx context.Context) (*BackupManifest, error) {
+	ctx, span := tracing.GlobalNetlogBackupTracer.Start(ctx, "googleDriveBackupTarget.getManifest")
+	defer span.End()
+
+	manifestFile, err := t.getManifestFile(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if manifestFile == nil {
+		return nil, ErrBackupManifestNotFound
+	}
+
+	resp, err := t.service.Files.Get(manifestFile.Id).Context(ctx).Download()
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var manifest BackupManifest
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("decode manifest: %w", err)
+	}
+
+	return &manifest, nil
+}
+
+func (t *GoogleDriveBackupTarget) SaveManifest(ctx context.Context, manifest *BackupManifest) error {
+	ctx, span := tracing.GlobalNetlogBackupTracer.Start(ctx, "googleDriveBackupTarget.saveManifest")
+	defer span.End()
+
+	manifestJson, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("marshal manifest: %w", err)
+	}
+
+	manifestFile, err := t.getManifestFile(ctx)
+	if err != nil {
+		return err
+	}
+
+	if manifestFile != nil {
+		_, err = t.service.
+			Files.Update(manifestFile.Id, &drive.File{}).
+			Context(ctx).
+			Media(bytes.NewReader(manifestJson)).
+			Do()
+		return err
+	}
+
+	_, err = t.service.
+		Files.Create(&drive.File{
+		Name:     backupManifestFileName,
+		MimeType: "application/json",
+		Parents:  []string{t.backupsFolderId},
+	}).
+		Context(ctx).
+		Media(bytes.NewReader(manifestJson)).
+		Do()
+	return err
+}
+
+// isGoogleDocsChunk tells if the chunk is stored as a google docs file, which is the case for the plain
+// json chunks only, as the compressed and encrypted ones are binary
+func isGoogleDocsChunk(name string) bool {
+	return strings.HasSuffix(name, ".json")
+}
+
+// getManifestFile returns nil if the manifest file does not exist
+func (t *GoogleDriveBackupTarget) getManifestFile(ctx context.Context) (*drive.File, error) {
+	files, err := t.listFiles(ctx, fmt.Sprintf("'%s' in parents and name = '%s' and trashed = false", t.backupsFolderId, backupManifestFileName))
+	if err != nil {
+		return nil, fmt.Errorf("find manifest file: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+	return files[0], nil
+}
+
+func (t *GoogleDriveBackupTarget) listFiles(ctx context.Context, query string) ([]*drive.File, error) {
+	return listDriveFiles(ctx, t.service, query)
+}
+
+// listDriveFiles returns the files from all the pages of the list result
+func listDriveFiles(ctx context.Context, service *drive.Service, query string) ([]*drive.File, error) {
+	var files []*drive.File
+	nextPageToken := ""
+	i := 1
+
+	for {
+		log.Printf("fetching all files chunk: %d", i)
+		fileList, err := service.
+			Files.List().
+			Context(ctx).
+			PageSize(100).
+			Q(query).
+			Fields("nextPageToken, files(id, name, createdTime)").
+			PageToken(nextPageToken).
+			Do()
+		if err != nil {
+			return nil, err
+		}
+
+		nextPageToken = fileList.NextPageToken
+
+		files = append(files, fileList.Files...)
+		log.Printf(" - loaded: %d", len(files))
+
+		if nextPageToken == "" {
+			break
+		}
+
+		i++
+	}
+
+	return files, nil
+}
+
+func (t *GoogleDriveBackupTarget) createRootBackupsFolder(ctx context.Context) error {
+	ctx, span := tracing.GlobalNetlogBackupTracer.Start(ctx, "googleDriveBackupTarget.createRootBackupsFolder")
+	defer span.End()
+
+	backupsFolderMeta := &drive.File{
+		Name:     t.folderName,
+		MimeType: googleDriveFolderMimeType,
+	}
+
+	bfRes, err := t.service.
+		Files.Create(backupsFolderMeta).
+		Fields("id").
+		Do()
+	if err != nil {
+		return err
+	}
+
+	t.backupsFolderId = bfRes.Id
+
+	if t.shareWithEmail == "" {
+		return nil
+	}
+
+	return t.shareBackupsFolder(ctx)
+}
+
+func (t *GoogleDriveBackupTarget) shareBackupsFolder(ctx context.Context) error {
+	_, span := tracing.GlobalNetlogBackupTracer.Start(ctx, "googleDriveBackupTarget.shareBackupsFolder")
+	defer span.End()
+
+	log.Printf("creating permission for backup folder [%s] ...", t.backupsFolderId)
+
+	permission := &drive.Permission{
+		EmailAddress: t.shareWithEmail,
+		Type:         "user",
+		Role:         "reader",
+	}
+
+	cp, err := t.service.Permissions.
+		Create(t.backupsFolderId, permission).
+		Do()
+	if err != nil {
+		return fmt.Errorf("failed to create permission: %w", err)
+	}
+
+	log.Printf("permission created: %s", cp.Id)
+	t.sharePermission = cp
+
+	return nil
+}
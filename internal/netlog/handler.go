@@ -3,6 +3,7 @@ package netlog
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/url"
 	netUrl "net/url"
@@ -22,15 +23,60 @@ import (
 
 type netlogRepo interface {
 	AddVisit(ctx context.Context, visit *Visit) error
-	GetVisits(ctx context.Context, keywords []string, field string, source string, limit int) ([]*Visit, error)
+	AddVisitsBatch(ctx context.Context, batch []BatchVisit) ([]bool, error)
+	GetVisits(ctx context.Context, query *SearchQuery, limit int) ([]*Visit, error)
 	CountAll(ctx context.Context) (int, error)
-	Count(ctx context.Context, keywords []string, field string, source string) (int, error)
-	GetVisitsPage(ctx context.Context, keywords []string, field string, source string, page int, size int) ([]*Visit, error)
+	Count(ctx context.Context, query *SearchQuery) (int, error)
+	GetVisitsPage(ctx context.Context, query *SearchQuery, page int, size int) ([]*Visit, error)
+	GetVisitsByCursor(ctx context.Context, query *SearchQuery, cursor string, size int) (*VisitsCursorPage, error)
+	EstimateCount(ctx context.Context, query *SearchQuery) (int, error)
+	GetVisitsAfterID(ctx context.Context, afterID, limit int) ([]*Visit, error)
+
+	TopHosts(ctx context.Context, statsRange StatsRange, limit int) ([]HostCount, error)
+	VisitsPerDay(ctx context.Context, statsRange StatsRange) ([]DayCount, error)
+	VisitsPerHourOfWeek(ctx context.Context, statsRange StatsRange) ([]HourOfWeekCount, error)
+	SourceDeviceSplit(ctx context.Context, statsRange StatsRange) ([]SourceDeviceCount, error)
+	NewDomains(ctx context.Context, statsRange StatsRange, limit int) ([]NewDomain, error)
+	GetVisitsInRange(ctx context.Context, statsRange StatsRange) ([]*Visit, error)
+	SearchRanked(ctx context.Context, text string, filter *SearchQuery, page, size int) ([]*RankedVisit, error)
+	CountRanked(ctx context.Context, text string, filter *SearchQuery) (int, error)
+
+	SaveVisitAnnotation(ctx context.Context, visitID int, annotation *VisitAnnotation) (*VisitAnnotation, error)
+	DeleteVisitAnnotation(ctx context.Context, visitID int) error
+	GetAnnotatedVisitsPage(ctx context.Context, list AnnotatedVisitsList, query *SearchQuery, page, size int) ([]*Visit, error)
+	CountAnnotated(ctx context.Context, list AnnotatedVisitsList, query *SearchQuery) (int, error)
+	TagCounts(ctx context.Context) ([]TagCount, error)
+
+	GetCategoryRules(ctx context.Context) ([]CategoryRule, error)
+	SaveCategoryRule(ctx context.Context, rule *CategoryRule) (*CategoryRule, error)
+	DeleteCategoryRule(ctx context.Context, id int) error
+	SaveFocusReport(ctx context.Context, report *FocusReport) error
+	GetFocusReports(ctx context.Context, period FocusPeriod, statsRange StatsRange) ([]*FocusReport, error)
+
+	GetBackupRuns(ctx context.Context, limit int) ([]*BackupRun, error)
+	GetLastSuccessfulBackupRun(ctx context.Context) (*BackupRun, error)
+	CountFailedBackupRuns(ctx context.Context, since time.Time) (int, error)
 }
 
 type VisitsResponse struct {
 	Visits []*Visit `json:"visits"`
-	Total  int      `json:"total"`
+	// Total is -1 when the count is not requested, see handleGetCursorPage
+	Total          int  `json:"total"`
+	TotalEstimated bool `json:"total_estimated,omitempty"`
+	// Next and Prev are opaque cursors to the adjacent pages, set only for cursor pages
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+const (
+	totalModeExact    = "exact"
+	totalModeEstimate = "estimate"
+	totalModeNone     = "none"
+)
+
+type RankedVisitsResponse struct {
+	Visits []*RankedVisit `json:"visits"`
+	Total  int            `json:"total"`
 }
 
 type newVisitRequest struct {
@@ -46,6 +92,10 @@ type Handler struct {
 	repo                  netlogRepo
 	loginChecker          *auth.LoginChecker
 	metrics               *metrics.Manager
+	sessionAnalyzer       *SessionAnalyzer
+	focusReporter         *FocusReporter
+	redactor              *Redactor
+	visitsBroker          *VisitsBroker
 }
 
 func NewHandler(
@@ -53,21 +103,59 @@ func NewHandler(
 	instrumentation *metrics.Manager,
 	browserRequestsSecret string,
 	loginChecker *auth.LoginChecker,
+	sessionIdleGap time.Duration,
+	redactor *Redactor,
+	visitsBroker *VisitsBroker,
 ) *Handler {
 	return &Handler{
 		repo:                  repo,
 		metrics:               instrumentation,
 		browserRequestsSecret: browserRequestsSecret,
 		loginChecker:          loginChecker,
+		sessionAnalyzer:       NewSessionAnalyzer(sessionIdleGap),
+		focusReporter:         NewFocusReporter(repo, sessionIdleGap),
+		redactor:              redactor,
+		visitsBroker:          visitsBroker,
 	}
 }
 
 func (handler *Handler) SetupRoutes(router *mux.Router) {
 	router.HandleFunc("/netlog/new", handler.handleNewVisit).Methods("POST", "OPTIONS").Name("new-visit")
+	router.HandleFunc("/netlog/batch", handler.handleNewVisitsBatch).Methods("POST", "OPTIONS").Name("new-visits-batch")
+	router.HandleFunc("/netlog/stream", handler.handleStream).Methods("GET", "OPTIONS").Name("stream")
 	router.HandleFunc("/netlog/", handler.handleGetAll).Methods("GET", "OPTIONS").Name("get-last")
 	router.HandleFunc("/netlog/limit/{limit}", handler.handleGetAll).Methods("GET", "OPTIONS").Name("get-with-limit")
 	router.HandleFunc("/netlog/s/{source}/f/{field}/page/{page}/size/{size}", handler.handleGetPage).Methods("GET", "OPTIONS").Name("visits-page")
 	router.HandleFunc("/netlog/s/{source}/f/{field}/search/{keywords}/page/{page}/size/{size}", handler.handleGetPage).Methods("GET", "OPTIONS").Name("search-page")
+	router.HandleFunc("/netlog/s/{source}/f/{field}/size/{size}", handler.handleGetCursorPage).Methods("GET", "OPTIONS").Name("visits-cursor-page")
+	router.HandleFunc("/netlog/s/{source}/f/{field}/search/{keywords}/size/{size}", handler.handleGetCursorPage).Methods("GET", "OPTIONS").Name("search-cursor-page")
+
+	// stats, all with optional <from> and <to> URL query params
+	router.HandleFunc("/netlog/stats/hosts", handler.handleStatsTopHosts).Methods("GET", "OPTIONS").Name("stats-top-hosts")
+	router.HandleFunc("/netlog/stats/days", handler.handleStatsPerDay).Methods("GET", "OPTIONS").Name("stats-per-day")
+	router.HandleFunc("/netlog/stats/hours", handler.handleStatsPerHourOfWeek).Methods("GET", "OPTIONS").Name("stats-per-hour-of-week")
+	router.HandleFunc("/netlog/stats/sources", handler.handleStatsSources).Methods("GET", "OPTIONS").Name("stats-sources")
+	router.HandleFunc("/netlog/stats/new-domains", handler.handleStatsNewDomains).Methods("GET", "OPTIONS").Name("stats-new-domains")
+	router.HandleFunc("/netlog/stats/domain-time", handler.handleDomainTimePerDay).Methods("GET", "OPTIONS").Name("stats-domain-time")
+	router.HandleFunc("/netlog/sessions", handler.handleSessions).Methods("GET", "OPTIONS").Name("sessions")
+	router.HandleFunc("/netlog/s/{source}/ranked/{query}/page/{page}/size/{size}", handler.handleRankedSearch).Methods("GET", "OPTIONS").Name("ranked-search-page")
+
+	// stars, tags, notes and the read later queue; the pages with the optional <q> URL query param
+	router.HandleFunc("/netlog/visits/{id}/annotation", handler.handleSaveAnnotation).Methods("PUT", "OPTIONS").Name("save-annotation")
+	router.HandleFunc("/netlog/visits/{id}/annotation", handler.handleDeleteAnnotation).Methods("DELETE", "OPTIONS").Name("delete-annotation")
+	router.HandleFunc("/netlog/annotated/page/{page}/size/{size}", handler.handleAnnotatedPage).Methods("GET", "OPTIONS").Name("annotated-page")
+	router.HandleFunc("/netlog/read-later/page/{page}/size/{size}", handler.handleReadLaterPage).Methods("GET", "OPTIONS").Name("read-later-page")
+	router.HandleFunc("/netlog/tags", handler.handleTags).Methods("GET", "OPTIONS").Name("tags")
+
+	// hosts categories and the daily and weekly focus reports (time per category); {period} is day or week
+	router.HandleFunc("/netlog/categories/rules", handler.handleCategoryRules).Methods("GET", "OPTIONS").Name("category-rules")
+	router.HandleFunc("/netlog/categories/rules", handler.handleSaveCategoryRule).Methods("POST", "OPTIONS").Name("save-category-rule")
+	router.HandleFunc("/netlog/categories/rules/{id}", handler.handleDeleteCategoryRule).Methods("DELETE", "OPTIONS").Name("delete-category-rule")
+	router.HandleFunc("/netlog/categories/hosts", handler.handleHostCategories).Methods("GET", "OPTIONS").Name("host-categories")
+	router.HandleFunc("/netlog/focus/{period}", handler.handleFocusReports).Methods("GET", "OPTIONS").Name("focus-reports")
+	router.HandleFunc("/netlog/focus/{period}/rebuild", handler.handleRebuildFocusReports).Methods("POST", "OPTIONS").Name("rebuild-focus-reports")
+
+	router.HandleFunc("/netlog/backups", handler.handleBackupRuns).Methods("GET", "OPTIONS").Name("backup-runs")
 }
 
 func (handler *Handler) handleGetPage(w http.ResponseWriter, r *http.Request) {
@@ -94,13 +182,10 @@ func (handler *Handler) handleGetPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var keywords []string
+	// keywords are a search query, e.g.: host:github.com title:"exact phrase" -draft (see query.go)
 	keywordsRaw := vars["keywords"]
-	if keywordsRaw != "" {
-		keywords = strings.Split(keywordsRaw, ",")
-	}
 
-	log.Tracef("get netlog visits: s[%s], f[%s], page %s size %s, keywords: %s", source, field, pageStr, sizeStr, keywords)
+	log.Tracef("get netlog visits: s[%s], f[%s], page %s size %s, keywords: %s", source, field, pageStr, sizeStr, keywordsRaw)
 
 	if page < 1 {
 		http.Error(w, "invalid page size (has to be non-zero value)", http.StatusBadRequest)
@@ -111,14 +196,21 @@ func (handler *Handler) handleGetPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	visits, err := handler.repo.GetVisitsPage(ctx, keywords, field, source, page, size)
+	query, err := NewSearchQuery(keywordsRaw, field, source)
+	if err != nil {
+		log.Tracef("get netlog visits page, invalid query [%s]: %s", keywordsRaw, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	visits, err := handler.repo.GetVisitsPage(ctx, query, page, size)
 	if err != nil {
 		log.Errorf("get visits error: %s", err)
 		http.Error(w, "failed to get netlog visits", http.StatusInternalServerError)
 		return
 	}
 
-	allVisitsCount, err := handler.repo.Count(ctx, keywords, field, source)
+	allVisitsCount, err := handler.repo.Count(ctx, query)
 	if err != nil {
 		log.Errorf("get netlog visits error: %s", err)
 		http.Error(w, "failed to get netlog visits", http.StatusInternalServerError)
@@ -140,6 +232,156 @@ func (handler *Handler) handleGetPage(w http.ResponseWriter, r *http.Request) {
 	pkg.WriteResponseBytes(w, pkg.ContentType.JSON, visitsRespJson, http.StatusOK)
 }
 
+// handleGetCursorPage returns a keyset page of visits. Optional URL query params:
+//   - cursor: the next/prev cursor from a previous response, empty for the first page
+//   - total: exact, estimate (default) or none; the exact count gets slow on big tables
+func (handler *Handler) handleGetCursorPage(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.GlobalTracer.Start(r.Context(), "netlogHandler.getCursorPage")
+	defer span.End()
+
+	vars := mux.Vars(r)
+
+	field := vars["field"]
+	source := vars["source"]
+	keywordsRaw := vars["keywords"]
+	cursor := r.URL.Query().Get("cursor")
+	totalMode := r.URL.Query().Get("total")
+	if totalMode == "" {
+		totalMode = totalModeEstimate
+	}
+
+	size, err := strconv.Atoi(vars["size"])
+	if err != nil {
+		log.Errorf("handle get netlog visits cursor page, from <size> param: %s", err)
+		http.Error(w, "parse form error, parameter <size>", http.StatusBadRequest)
+		return
+	}
+
+	log.Tracef("get netlog visits: s[%s], f[%s], cursor [%s] size %d, keywords: %s", source, field, cursor, size, keywordsRaw)
+
+	if size < 1 {
+		http.Error(w, "invalid size (has to be non-zero value)", http.StatusBadRequest)
+		return
+	}
+	if totalMode != totalModeExact && totalMode != totalModeEstimate && totalMode != totalModeNone {
+		http.Error(w, "invalid total mode (has to be one of: exact, estimate, none)", http.StatusBadRequest)
+		return
+	}
+
+	query, err := NewSearchQuery(keywordsRaw, field, source)
+	if err != nil {
+		log.Tracef("get netlog visits cursor page, invalid query [%s]: %s", keywordsRaw, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := handler.repo.GetVisitsByCursor(ctx, query, cursor, size)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCursor) {
+			http.Error(w, "invalid cursor", http.StatusBadRequest)
+			return
+		}
+		log.Errorf("get visits by cursor error: %s", err)
+		http.Error(w, "failed to get netlog visits", http.StatusInternalServerError)
+		return
+	}
+
+	total := -1
+	switch totalMode {
+	case totalModeExact:
+		total, err = handler.repo.Count(ctx, query)
+	case totalModeEstimate:
+		total, err = handler.repo.EstimateCount(ctx, query)
+	}
+	if err != nil {
+		log.Errorf("get netlog visits count error: %s", err)
+		http.Error(w, "failed to get netlog visits", http.StatusInternalServerError)
+		return
+	}
+
+	visits := page.Visits
+	if visits == nil {
+		visits = []*Visit{}
+	}
+
+	pkg.SendJsonResponse(w, http.StatusOK, VisitsResponse{
+		Visits:         visits,
+		Total:          total,
+		TotalEstimated: totalMode == totalModeEstimate,
+		Next:           page.Next,
+		Prev:           page.Prev,
+	})
+}
+
+// handleRankedSearch does a full-text search over visits titles and urls, with results ordered by relevance.
+// The query is a websearch-style text, e.g.: golang generics -java "error handling"
+func (handler *Handler) handleRankedSearch(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.GlobalTracer.Start(r.Context(), "netlogHandler.rankedSearch")
+	defer span.End()
+
+	vars := mux.Vars(r)
+
+	source := vars["source"]
+	text := vars["query"]
+
+	page, err := strconv.Atoi(vars["page"])
+	if err != nil {
+		log.Errorf("handle netlog ranked search, from <page> param: %s", err)
+		http.Error(w, "parse form error, parameter <page>", http.StatusBadRequest)
+		return
+	}
+	size, err := strconv.Atoi(vars["size"])
+	if err != nil {
+		log.Errorf("handle netlog ranked search, from <size> param: %s", err)
+		http.Error(w, "parse form error, parameter <size>", http.StatusBadRequest)
+		return
+	}
+
+	log.Tracef("netlog ranked search: s[%s], page %d size %d, query: %s", source, page, size, text)
+
+	if page < 1 {
+		http.Error(w, "invalid page size (has to be non-zero value)", http.StatusBadRequest)
+		return
+	}
+	if size < 1 {
+		http.Error(w, "invalid size (has to be non-zero value)", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(text) == "" {
+		http.Error(w, "error, search query empty", http.StatusBadRequest)
+		return
+	}
+
+	filter, err := NewSearchQuery("", "url", source)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	visits, err := handler.repo.SearchRanked(ctx, text, filter, page, size)
+	if err != nil {
+		log.Errorf("netlog ranked search error: %s", err)
+		http.Error(w, "failed to search netlog visits", http.StatusInternalServerError)
+		return
+	}
+
+	total, err := handler.repo.CountRanked(ctx, text, filter)
+	if err != nil {
+		log.Errorf("netlog ranked search count error: %s", err)
+		http.Error(w, "failed to search netlog visits", http.StatusInternalServerError)
+		return
+	}
+
+	if visits == nil {
+		visits = []*RankedVisit{}
+	}
+
+	pkg.SendJsonResponse(w, http.StatusOK, RankedVisitsResponse{
+		Visits: visits,
+		Total:  total,
+	})
+}
+
 func (handler *Handler) handleNewVisit(w http.ResponseWriter, r *http.Request) {
 	ctx, span := tracing.GlobalTracer.Start(r.Context(), "netlogHandler.new")
 	defer span.End()
@@ -199,7 +441,22 @@ func (handler *Handler) handleNewVisit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	parsedURL, err := netUrl.Parse(reqData.URL)
+	visit := &Visit{
+		Title:     reqData.Title,
+		URL:       reqData.URL,
+		Source:    reqData.Source,
+		Device:    reqData.Device,
+		Timestamp: time.Unix(reqData.Timestamp/1000, 0),
+	}
+
+	// redacted before anything about the visit is traced or logged
+	if handler.redactor.Redact(visit) {
+		span.SetAttributes(attribute.Bool("visit.dropped", true))
+		pkg.WriteResponse(w, pkg.ContentType.Text, "dropped", http.StatusOK)
+		return
+	}
+
+	parsedURL, err := netUrl.Parse(visit.URL)
 	if err != nil {
 		log.Errorf("failed to parse visit url: %s", err)
 		span.SetAttributes(attribute.String("visit.hostname", "<invalid/errored>"))
@@ -210,13 +467,6 @@ func (handler *Handler) handleNewVisit(w http.ResponseWriter, r *http.Request) {
 	span.SetAttributes(attribute.String("visit.device", reqData.Source))
 	span.SetAttributes(attribute.String("visit.device", reqData.Device))
 
-	visit := &Visit{
-		Title:     reqData.Title,
-		URL:       reqData.URL,
-		Source:    reqData.Source,
-		Device:    reqData.Device,
-		Timestamp: time.Unix(reqData.Timestamp/1000, 0),
-	}
 	if err := handler.repo.AddVisit(ctx, visit); err != nil {
 		log.Errorf("add new visit [%d], [%s] [%s]: %s", reqData.Timestamp, reqData.Source, reqData.Device, err)
 		http.Error(w, "error, failed to add new visit", http.StatusInternalServerError)
@@ -225,6 +475,7 @@ func (handler *Handler) handleNewVisit(w http.ResponseWriter, r *http.Request) {
 	}
 
 	handler.metrics.CounterNetlogVisits.Inc()
+	handler.visitsBroker.Publish(ctx, visit)
 
 	log.WithFields(log.Fields{
 		"timestamp": visit.Timestamp,
@@ -254,7 +505,7 @@ func (handler *Handler) handleGetAll(w http.ResponseWriter, r *http.Request) {
 
 	log.Debugf("getting last %d netlog visits ... ", limit)
 
-	visits, err := handler.repo.GetVisits(ctx, []string{}, "url", "all", limit)
+	visits, err := handler.repo.GetVisits(ctx, nil, limit)
 	if err != nil {
 		log.Errorf("get all visits error: %s", err)
 		http.Error(w, "failed to get all visits", http.StatusInternalServerError)
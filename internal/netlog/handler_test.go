@@ -61,7 +61,7 @@ func setupNetlogRouterForTests(
 	r.Use(authMiddleware.AuthCheck())
 	r.Use(middleware.DrainAndCloseRequest())
 
-	handler := NewHandler(repo, metricsManager, browserReqSecret, loginChecker)
+	handler := NewHandler(repo, metricsManager, browserReqSecret, loginChecker, DefaultSessionIdleGap, NewRedactor(), NewVisitsBroker(nil))
 	handler.SetupRoutes(r)
 
 	return r
@@ -71,7 +71,7 @@ func TestNewNetlogHandler(t *testing.T) {
 	r := mux.NewRouter()
 	repo := NewRepoMock()
 	m := metrics.NewTestManager()
-	handler := NewHandler(repo, m, "", nil)
+	handler := NewHandler(repo, m, "", nil, DefaultSessionIdleGap, NewRedactor(), NewVisitsBroker(nil))
 	handler.SetupRoutes(r)
 
 	for caseName, route := range map[string]struct {
@@ -89,6 +89,21 @@ func TestNewNetlogHandler(t *testing.T) {
 			path:   "/netlog/new",
 			method: "OPTIONS",
 		},
+		"new-visits-batch": {
+			name:   "new-visits-batch",
+			path:   "/netlog/batch",
+			method: "POST",
+		},
+		"stats-domain-time": {
+			name:   "stats-domain-time",
+			path:   "/netlog/stats/domain-time",
+			method: "GET",
+		},
+		"sessions": {
+			name:   "sessions",
+			path:   "/netlog/sessions",
+			method: "GET",
+		},
 		"get-last-get": {
 			name:   "get-last",
 			path:   "/netlog/",
@@ -114,6 +129,46 @@ func TestNewNetlogHandler(t *testing.T) {
 			path:   "/netlog/s/{source}/f/{field}/search/{keywords}/page/{page}/size/{size}",
 			method: "GET",
 		},
+		"ranked-search-page": {
+			name:   "ranked-search-page",
+			path:   "/netlog/s/{source}/ranked/{query}/page/{page}/size/{size}",
+			method: "GET",
+		},
+		"visits-cursor-page": {
+			name:   "visits-cursor-page",
+			path:   "/netlog/s/{source}/f/{field}/size/{size}",
+			method: "GET",
+		},
+		"search-cursor-page": {
+			name:   "search-cursor-page",
+			path:   "/netlog/s/{source}/f/{field}/search/{keywords}/size/{size}",
+			method: "GET",
+		},
+		"stats-top-hosts": {
+			name:   "stats-top-hosts",
+			path:   "/netlog/stats/hosts",
+			method: "GET",
+		},
+		"stats-per-day": {
+			name:   "stats-per-day",
+			path:   "/netlog/stats/days",
+			method: "GET",
+		},
+		"stats-per-hour-of-week": {
+			name:   "stats-per-hour-of-week",
+			path:   "/netlog/stats/hours",
+			method: "GET",
+		},
+		"stats-sources": {
+			name:   "stats-sources",
+			path:   "/netlog/stats/sources",
+			method: "GET",
+		},
+		"stats-new-domains": {
+			name:   "stats-new-domains",
+			path:   "/netlog/stats/new-domains",
+			method: "GET",
+		},
 	} {
 		t.Run(caseName, func(t *testing.T) {
 			req, err := http.NewRequest(route.method, route.path, nil)
@@ -139,7 +194,7 @@ func TestNetlogHandler_handleGetAll_Empty(t *testing.T) {
 
 	r := mux.NewRouter()
 	m := metrics.NewTestManager()
-	handler := NewHandler(repo, m, browserReqSecret, loginChecker)
+	handler := NewHandler(repo, m, browserReqSecret, loginChecker, DefaultSessionIdleGap, NewRedactor(), NewVisitsBroker(nil))
 	handler.SetupRoutes(r)
 	require.NotNil(t, handler)
 	require.NotNil(t, r)
@@ -463,3 +518,158 @@ func TestNetlogHandler_handleGetPage(t *testing.T) {
 
 	assert.Equal(t, float64(0), testutil.ToFloat64(m.CounterNetlogVisits))
 }
+
+func TestNetlogHandler_handleGetCursorPage(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	repo := NewRepoMock()
+	m := metrics.NewTestManager()
+	loginChecker := auth.NewLoginChecker(time.Hour, db)
+	r := setupNetlogRouterForTests(t, repo, m, loginChecker, "beer")
+
+	now := time.Now()
+	for id := 1; id <= 7; id++ {
+		repo.Visits[id] = Visit{
+			Id:        id,
+			Title:     fmt.Sprintf("test title %d", id),
+			Source:    "safari",
+			URL:       fmt.Sprintf("test:url:%d", id),
+			Timestamp: now.Add(time.Duration(id) * time.Hour),
+		}
+	}
+	repo.Visits[8] = Visit{Id: 8, Title: "other", Source: "pc", URL: "test:url:8", Timestamp: now}
+
+	getPage := func(path string) *VisitsResponse {
+		t.Helper()
+		mock.ExpectGet("serj-service-session||tokenAbc123").SetVal(fmt.Sprintf("%d", time.Now().Unix()))
+
+		req, err := http.NewRequest("GET", path, nil)
+		require.NoError(t, err)
+		req.Header.Set("Origin", "test")
+		req.Header.Set("X-SERJ-TOKEN", "tokenAbc123")
+		rr := httptest.NewRecorder()
+
+		r.ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var resp *VisitsResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		require.NotNil(t, resp)
+		return resp
+	}
+	ids := func(resp *VisitsResponse) []int {
+		var ids []int
+		for _, v := range resp.Visits {
+			ids = append(ids, v.Id)
+		}
+		return ids
+	}
+
+	first := getPage("/netlog/s/safari/f/url/search/test:url/size/3?total=exact")
+	assert.Equal(t, []int{7, 6, 5}, ids(first))
+	assert.Equal(t, 7, first.Total)
+	assert.False(t, first.TotalEstimated)
+	assert.Empty(t, first.Prev)
+	require.NotEmpty(t, first.Next)
+
+	second := getPage("/netlog/s/safari/f/url/search/test:url/size/3?cursor=" + first.Next)
+	assert.Equal(t, []int{4, 3, 2}, ids(second))
+	assert.True(t, second.TotalEstimated)
+	require.NotEmpty(t, second.Prev)
+	require.NotEmpty(t, second.Next)
+
+	// the last page is not padded with rows from the previous one
+	last := getPage("/netlog/s/safari/f/url/search/test:url/size/3?total=none&cursor=" + second.Next)
+	assert.Equal(t, []int{1}, ids(last))
+	assert.Equal(t, -1, last.Total)
+	assert.Empty(t, last.Next)
+	require.NotEmpty(t, last.Prev)
+
+	back := getPage("/netlog/s/safari/f/url/search/test:url/size/3?cursor=" + last.Prev)
+	assert.Equal(t, []int{4, 3, 2}, ids(back))
+	backToFirst := getPage("/netlog/s/safari/f/url/search/test:url/size/3?cursor=" + back.Prev)
+	assert.Equal(t, []int{7, 6, 5}, ids(backToFirst))
+	assert.Empty(t, backToFirst.Prev)
+
+	all := getPage("/netlog/s/all/f/url/size/10")
+	// 2 initial mock visits, one of them overwritten above
+	assert.Len(t, all.Visits, 9)
+	assert.Empty(t, all.Next)
+	assert.Empty(t, all.Prev)
+
+	for _, path := range []string{
+		"/netlog/s/all/f/url/size/0",
+		"/netlog/s/all/f/url/size/10?cursor=not-a-cursor",
+		"/netlog/s/all/f/url/size/10?total=maybe",
+	} {
+		mock.ExpectGet("serj-service-session||tokenAbc123").SetVal(fmt.Sprintf("%d", time.Now().Unix()))
+
+		req, err := http.NewRequest("GET", path, nil)
+		require.NoError(t, err)
+		req.Header.Set("Origin", "test")
+		req.Header.Set("X-SERJ-TOKEN", "tokenAbc123")
+		rr := httptest.NewRecorder()
+
+		r.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, path)
+	}
+}
+
+func TestNetlogHandler_handleRankedSearch(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	mock.ExpectGet("serj-service-session||tokenAbc123").SetVal(fmt.Sprintf("%d", time.Now().Unix()))
+
+	repo := NewRepoMock()
+	m := metrics.NewTestManager()
+	loginChecker := auth.NewLoginChecker(time.Hour, db)
+	r := setupNetlogRouterForTests(t, repo, m, loginChecker, "beer")
+
+	now := time.Now()
+	repo.Visits[2] = Visit{Id: 2, Title: "Go generics <explained>", Source: "safari", URL: "https://go.dev/generics", Timestamp: now}
+	repo.Visits[3] = Visit{Id: 3, Title: "Rust traits", Source: "safari", URL: "https://rust-lang.org/generics", Timestamp: now}
+	repo.Visits[4] = Visit{Id: 4, Title: "Go generics in chrome", Source: "chrome", URL: "https://go.dev/x", Timestamp: now}
+
+	req, err := http.NewRequest("GET", "/netlog/s/safari/ranked/go generics/page/1/size/10", nil)
+	require.NoError(t, err)
+	req.Header.Set("Origin", "test")
+	req.Header.Set("X-SERJ-TOKEN", "tokenAbc123")
+	rr := httptest.NewRecorder()
+
+	r.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	var resp *RankedVisitsResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	require.NotNil(t, resp)
+	assert.Equal(t, 2, resp.Total)
+	require.Len(t, resp.Visits, 2)
+	assert.Equal(t, 2, resp.Visits[0].Id)
+	assert.Equal(t, 3, resp.Visits[1].Id)
+	assert.Greater(t, resp.Visits[0].Rank, resp.Visits[1].Rank)
+	assert.Equal(t, "Go generics &lt;explained&gt;", resp.Visits[0].TitleHighlight)
+}
+
+func TestNetlogHandler_handleRankedSearch_badRequest(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	repo := NewRepoMock()
+	m := metrics.NewTestManager()
+	loginChecker := auth.NewLoginChecker(time.Hour, db)
+	r := setupNetlogRouterForTests(t, repo, m, loginChecker, "beer")
+
+	for _, path := range []string{
+		"/netlog/s/all/ranked/go/page/0/size/10",
+		"/netlog/s/all/ranked/go/page/1/size/x",
+		"/netlog/s/all/ranked/ /page/1/size/10",
+	} {
+		mock.ExpectGet("serj-service-session||tokenAbc123").SetVal(fmt.Sprintf("%d", time.Now().Unix()))
+
+		req, err := http.NewRequest("GET", path, nil)
+		require.NoError(t, err)
+		req.Header.Set("Origin", "test")
+		req.Header.Set("X-SERJ-TOKEN", "tokenAbc123")
+		rr := httptest.NewRecorder()
+
+		r.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, path)
+	}
+}
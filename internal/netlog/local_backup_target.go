@@ -0,0 +1,138 @@
+package netlog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var _ BackupTarget = (*LocalBackupTarget)(nil)
+
+// LocalBackupTarget keeps the backup files in a local directory, e.g. on a mounted external disk
+type LocalBackupTarget struct {
+	dir string
+}
+
+func NewLocalBackupTarget(dir string) (*LocalBackupTarget, error) {
+	if dir == "" {
+		return nil, errors.New("backups dir not specified")
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("create backups dir: %w", err)
+	}
+	return &LocalBackupTarget{dir: dir}, nil
+}
+
+func (t *LocalBackupTarget) Name() string {
+	return fmt.Sprintf("local dir [%s]", t.dir)
+}
+
+func (t *LocalBackupTarget) List(_ context.Context) ([]BackupFile, error) {
+	entries, err := os.ReadDir(t.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []BackupFile
+	for _, entry := range entries {
+		// skip the manifest, and the temp files left over from the interrupted writes
+		if entry.IsDir() || entry.Name() == backupManifestFileName || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, BackupFile{
+			ID:        filepath.Join(t.dir, entry.Name()),
+			Name:      entry.Name(),
+			CreatedAt: info.ModTime(),
+		})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].CreatedAt.Before(files[j].CreatedAt)
+	})
+
+	return files, nil
+}
+
+func (t *LocalBackupTarget) UploadChunk(_ context.Context, name string, data []byte) (BackupFile, error) {
+	if name == backupManifestFileName || name != filepath.Base(name) {
+		return BackupFile{}, fmt.Errorf("invalid backup file name: %s", name)
+	}
+
+	path := filepath.Join(t.dir, name)
+	if err := writeFileAtomic(path, data); err != nil {
+		return BackupFile{}, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return BackupFile{}, err
+	}
+
+	return BackupFile{
+		ID:        path,
+		Name:      name,
+		CreatedAt: info.ModTime(),
+	}, nil
+}
+
+func (t *LocalBackupTarget) Download(_ context.Context, file BackupFile) ([]byte, error) {
+	return os.ReadFile(filepath.Join(t.dir, file.Name))
+}
+
+func (t *LocalBackupTarget) Delete(_ context.Context, file BackupFile) error {
+	return os.Remove(filepath.Join(t.dir, file.Name))
+}
+
+func (t *LocalBackupTarget) GetManifest(_ context.Context) (*BackupManifest, error) {
+	manifestJson, err := os.ReadFile(filepath.Join(t.dir, backupManifestFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrBackupManifestNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest BackupManifest
+	if err := json.Unmarshal(manifestJson, &manifest); err != nil {
+		return nil, fmt.Errorf("decode manifest: %w", err)
+	}
+
+	return &manifest, nil
+}
+
+func (t *LocalBackupTarget) SaveManifest(_ context.Context, manifest *BackupManifest) error {
+	manifestJson, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal manifest: %w", err)
+	}
+	return writeFileAtomic(filepath.Join(t.dir, backupManifestFileName), manifestJson)
+}
+
+// writeFileAtomic writes to a temp file first, so an interrupted backup never leaves a half written file
+func writeFileAtomic(path string, data []byte) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), path)
+}
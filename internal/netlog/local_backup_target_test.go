@@ -0,0 +1,71 @@
+package netlog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalBackupTarget(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "backups")
+	target, err := NewLocalBackupTarget(dir)
+	require.NoError(t, err)
+
+	files, err := target.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+
+	_, err = target.GetManifest(ctx)
+	assert.ErrorIs(t, err, ErrBackupManifestNotFound)
+
+	file1, err := target.UploadChunk(ctx, "chunk_1.json", []byte(`[{"id":1}]`))
+	require.NoError(t, err)
+	assert.Equal(t, "chunk_1.json", file1.Name)
+	_, err = target.UploadChunk(ctx, "chunk_2.json", []byte(`[{"id":2}]`))
+	require.NoError(t, err)
+
+	_, err = target.UploadChunk(ctx, "../chunk_3.json", []byte(`[]`))
+	assert.Error(t, err)
+	_, err = target.UploadChunk(ctx, backupManifestFileName, []byte(`[]`))
+	assert.Error(t, err)
+
+	manifest := &BackupManifest{
+		LastVisitId:        2,
+		LastVisitTimestamp: time.Date(2024, 5, 10, 11, 12, 13, 0, time.UTC),
+		Chunks: []BackupChunk{
+			{Name: "chunk_1.json", VisitsCount: 1},
+			{Name: "chunk_2.json", VisitsCount: 1},
+		},
+	}
+	require.NoError(t, target.SaveManifest(ctx, manifest))
+
+	savedManifest, err := target.GetManifest(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, manifest.LastVisitId, savedManifest.LastVisitId)
+	assert.True(t, manifest.LastVisitTimestamp.Equal(savedManifest.LastVisitTimestamp))
+	assert.Equal(t, manifest.Chunks, savedManifest.Chunks)
+
+	// neither the manifest nor the leftover temp files are listed as backup files
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".chunk_3.json.tmp-123"), []byte("[]"), 0o600))
+	files, err = target.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	content, err := target.Download(ctx, file1)
+	require.NoError(t, err)
+	assert.Equal(t, `[{"id":1}]`, string(content))
+
+	require.NoError(t, DeleteAllBackupFiles(ctx, target))
+	files, err = target.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+
+	_, err = target.GetManifest(ctx)
+	assert.NoError(t, err)
+}
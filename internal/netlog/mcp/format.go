@@ -0,0 +1,118 @@
+package mcp
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/2beens/serjtubincom/internal/netlog"
+)
+
+// The results are compact plain text instead of json, one visit per line, so they take fewer tokens.
+
+const (
+	maxTitleLength         = 100
+	maxURLLength           = 160
+	sessionDomainsShown    = 5
+	maxSessionVisitsShown  = 30
+	visitTimeLayout        = "2006-01-02 15:04"
+	sessionVisitTimeLayout = "15:04"
+)
+
+func formatVisits(header string, visits []*netlog.Visit, loc *time.Location) string {
+	if len(visits) == 0 {
+		return header + ": no visits found.\n"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (%d, time | title | url):\n", header, len(visits))
+	for _, v := range visits {
+		b.WriteString(formatVisitLine(v, visitTimeLayout, loc))
+	}
+	return b.String()
+}
+
+func formatVisitLine(v *netlog.Visit, timeLayout string, loc *time.Location) string {
+	title := v.Title
+	if title == "" {
+		title = "-"
+	}
+	// the canonical url is without the tracking params and the fragment, so it's shorter
+	visitURL := v.CanonicalURL
+	if visitURL == "" {
+		visitURL = v.URL
+	}
+	return fmt.Sprintf(
+		"%s | %s | %s\n",
+		v.Timestamp.In(loc).Format(timeLayout), truncate(title, maxTitleLength), truncate(visitURL, maxURLLength),
+	)
+}
+
+func formatTopDomains(statsRange netlog.StatsRange, hosts []netlog.HostCount, loc *time.Location) string {
+	header := fmt.Sprintf(
+		"Top domains %s to %s",
+		statsRange.From.In(loc).Format(visitTimeLayout), statsRange.To.In(loc).Format(visitTimeLayout),
+	)
+	if len(hosts) == 0 {
+		return header + ": no visits found.\n"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (host visits):\n", header)
+	for _, h := range hosts {
+		fmt.Fprintf(&b, "%s %d\n", h.Host, h.Visits)
+	}
+	return b.String()
+}
+
+func formatSessions(day string, sessions []*netlog.Session, withVisits bool, loc *time.Location) string {
+	if len(sessions) == 0 {
+		return fmt.Sprintf("Sessions on %s: no visits found.\n", day)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Sessions on %s (%d, start-end (duration) device, visits: top domains by time):\n", day, len(sessions))
+	for _, s := range sessions {
+		domains := make([]string, 0, sessionDomainsShown)
+		for i, d := range s.Domains {
+			if i == sessionDomainsShown {
+				domains = append(domains, fmt.Sprintf("+%d more", len(s.Domains)-sessionDomainsShown))
+				break
+			}
+			domains = append(domains, d.Host+" "+formatMinutes(d.Seconds))
+		}
+		fmt.Fprintf(
+			&b, "%s-%s (%s) %s, %d visits: %s\n",
+			s.Start.In(loc).Format(sessionVisitTimeLayout), s.End.In(loc).Format(sessionVisitTimeLayout),
+			formatMinutes(s.DurationSeconds), s.Device, s.VisitsCount, strings.Join(domains, ", "),
+		)
+
+		if !withVisits {
+			continue
+		}
+		for i, v := range s.Visits {
+			if i == maxSessionVisitsShown {
+				fmt.Fprintf(&b, "  ... %d more visits\n", len(s.Visits)-maxSessionVisitsShown)
+				break
+			}
+			b.WriteString("  " + formatVisitLine(v.Visit, sessionVisitTimeLayout, loc))
+		}
+	}
+	return b.String()
+}
+
+func formatMinutes(seconds float64) string {
+	if seconds < 60 {
+		return "<1m"
+	}
+	return fmt.Sprintf("%dm", int(math.Round(seconds/60)))
+}
+
+func truncate(s string, maxRunes int) string {
+	runes := []rune(s)
+	if len(runes) <= maxRunes {
+		return s
+	}
+	return string(runes[:maxRunes-1]) + "…"
+}
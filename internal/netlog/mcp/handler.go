@@ -0,0 +1,210 @@
+package mcp
+
+import (
+	"context"
+	"time"
+
+	"github.com/2beens/serjtubincom/internal/netlog"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const (
+	defaultAroundWindow = 30 * time.Minute
+	maxAroundWindow     = 12 * time.Hour
+)
+
+// Handler handles MCP tool requests and responses: parses input, calls the service, formats MCP result.
+type Handler struct {
+	service contextService
+}
+
+// NewHandler builds a handler with the given service.
+func NewHandler(service contextService) *Handler {
+	return &Handler{
+		service: service,
+	}
+}
+
+// SearchVisitsInput is the input for search_netlog_visits.
+type SearchVisitsInput struct {
+	Text     string `json:"text,omitempty" jsonschema:"Full-text search over the page titles and urls (e.g. golang generics), best matches first"`
+	Query    string `json:"query,omitempty" jsonschema:"Netlog search query (e.g. title:\"error handling\" -youtube source:safari)"`
+	Host     string `json:"host,omitempty" jsonschema:"Filter by host, subdomains included (e.g. github.com)"`
+	FromDate string `json:"from_date,omitempty" jsonschema:"Start date (YYYY-MM-DD)"`
+	ToDate   string `json:"to_date,omitempty" jsonschema:"End date, inclusive (YYYY-MM-DD)"`
+	Timezone string `json:"timezone,omitempty" jsonschema:"IANA time zone of the dates and the shown times (e.g. Europe/Belgrade), UTC by default"`
+	Limit    int    `json:"limit,omitempty" jsonschema:"Max visits returned, 20 by default, at most 100"`
+}
+
+// SearchVisitsTool returns the MCP tool handler for search_netlog_visits.
+func (h *Handler) SearchVisitsTool() func(context.Context, *mcp.CallToolRequest, SearchVisitsInput) (*mcp.CallToolResult, any, error) {
+	return func(ctx context.Context, _ *mcp.CallToolRequest, in SearchVisitsInput) (*mcp.CallToolResult, any, error) {
+		loc, err := parseTimezone(in.Timezone)
+		if err != nil {
+			return errorResult("Invalid timezone: use an IANA name, e.g. Europe/Belgrade"), nil, nil
+		}
+
+		params := SearchParams{
+			Text:  in.Text,
+			Query: in.Query,
+			Host:  in.Host,
+			Limit: in.Limit,
+		}
+		if in.FromDate != "" {
+			from, err := time.ParseInLocation(time.DateOnly, in.FromDate, loc)
+			if err != nil {
+				return errorResult("Invalid from_date: use YYYY-MM-DD"), nil, nil
+			}
+			params.From = &from
+		}
+		if in.ToDate != "" {
+			to, err := time.ParseInLocation(time.DateOnly, in.ToDate, loc)
+			if err != nil {
+				return errorResult("Invalid to_date: use YYYY-MM-DD"), nil, nil
+			}
+			to = to.AddDate(0, 0, 1)
+			params.To = &to
+		}
+
+		visits, err := h.service.SearchVisits(ctx, params)
+		if err != nil {
+			return errorResult("Error searching visits: " + err.Error()), nil, nil
+		}
+
+		header := "Visits, newest first"
+		if in.Text != "" {
+			header = "Visits, best matches first"
+		}
+		return textResult(formatVisits(header, visits, loc)), nil, nil
+	}
+}
+
+// TopDomainsInput is the input for get_netlog_top_domains.
+type TopDomainsInput struct {
+	FromDate string `json:"from_date" jsonschema:"Start date (YYYY-MM-DD)"`
+	ToDate   string `json:"to_date" jsonschema:"End date, inclusive (YYYY-MM-DD)"`
+	Timezone string `json:"timezone,omitempty" jsonschema:"IANA time zone of the dates (e.g. Europe/Belgrade), UTC by default"`
+	Limit    int    `json:"limit,omitempty" jsonschema:"Max domains returned, 20 by default, at most 100"`
+}
+
+// TopDomainsTool returns the MCP tool handler for get_netlog_top_domains.
+func (h *Handler) TopDomainsTool() func(context.Context, *mcp.CallToolRequest, TopDomainsInput) (*mcp.CallToolResult, any, error) {
+	return func(ctx context.Context, _ *mcp.CallToolRequest, in TopDomainsInput) (*mcp.CallToolResult, any, error) {
+		loc, err := parseTimezone(in.Timezone)
+		if err != nil {
+			return errorResult("Invalid timezone: use an IANA name, e.g. Europe/Belgrade"), nil, nil
+		}
+		from, err := time.ParseInLocation(time.DateOnly, in.FromDate, loc)
+		if err != nil {
+			return errorResult("Invalid from_date: use YYYY-MM-DD"), nil, nil
+		}
+		to, err := time.ParseInLocation(time.DateOnly, in.ToDate, loc)
+		if err != nil {
+			return errorResult("Invalid to_date: use YYYY-MM-DD"), nil, nil
+		}
+		statsRange := netlog.StatsRange{From: from, To: to.AddDate(0, 0, 1)}
+		if !statsRange.From.Before(statsRange.To) {
+			return errorResult("Invalid range: from_date is after to_date"), nil, nil
+		}
+
+		hosts, err := h.service.TopDomains(ctx, statsRange, in.Limit)
+		if err != nil {
+			return errorResult("Error fetching top domains: " + err.Error()), nil, nil
+		}
+		return textResult(formatTopDomains(statsRange, hosts, loc)), nil, nil
+	}
+}
+
+// SessionsInput is the input for get_netlog_sessions.
+type SessionsInput struct {
+	Date          string `json:"date" jsonschema:"Day of the sessions (YYYY-MM-DD)"`
+	Timezone      string `json:"timezone,omitempty" jsonschema:"IANA time zone of the day and the shown times (e.g. Europe/Belgrade), UTC by default"`
+	IncludeVisits bool   `json:"include_visits,omitempty" jsonschema:"Also list the visits of each session (at most 30 per session)"`
+}
+
+// SessionsTool returns the MCP tool handler for get_netlog_sessions.
+func (h *Handler) SessionsTool() func(context.Context, *mcp.CallToolRequest, SessionsInput) (*mcp.CallToolResult, any, error) {
+	return func(ctx context.Context, _ *mcp.CallToolRequest, in SessionsInput) (*mcp.CallToolResult, any, error) {
+		loc, err := parseTimezone(in.Timezone)
+		if err != nil {
+			return errorResult("Invalid timezone: use an IANA name, e.g. Europe/Belgrade"), nil, nil
+		}
+		day, err := time.ParseInLocation(time.DateOnly, in.Date, loc)
+		if err != nil {
+			return errorResult("Invalid date: use YYYY-MM-DD"), nil, nil
+		}
+
+		sessions, err := h.service.Sessions(ctx, netlog.StatsRange{From: day, To: day.AddDate(0, 0, 1)})
+		if err != nil {
+			return errorResult("Error fetching sessions: " + err.Error()), nil, nil
+		}
+		return textResult(formatSessions(in.Date, sessions, in.IncludeVisits, loc)), nil, nil
+	}
+}
+
+// VisitsAroundInput is the input for get_netlog_visits_around.
+type VisitsAroundInput struct {
+	Timestamp     string `json:"timestamp" jsonschema:"The time to look around (RFC3339, or YYYY-MM-DD HH:MM in the timezone)"`
+	WindowMinutes int    `json:"window_minutes,omitempty" jsonschema:"Minutes before and after the timestamp, 30 by default, at most 720"`
+	Timezone      string `json:"timezone,omitempty" jsonschema:"IANA time zone of the timestamp and the shown times (e.g. Europe/Belgrade), UTC by default"`
+	Limit         int    `json:"limit,omitempty" jsonschema:"Max visits returned (the closest to the timestamp), 20 by default, at most 100"`
+}
+
+// VisitsAroundTool returns the MCP tool handler for get_netlog_visits_around.
+func (h *Handler) VisitsAroundTool() func(context.Context, *mcp.CallToolRequest, VisitsAroundInput) (*mcp.CallToolResult, any, error) {
+	return func(ctx context.Context, _ *mcp.CallToolRequest, in VisitsAroundInput) (*mcp.CallToolResult, any, error) {
+		loc, err := parseTimezone(in.Timezone)
+		if err != nil {
+			return errorResult("Invalid timezone: use an IANA name, e.g. Europe/Belgrade"), nil, nil
+		}
+		at, err := parseTimestamp(in.Timestamp, loc)
+		if err != nil {
+			return errorResult("Invalid timestamp: use RFC3339 or YYYY-MM-DD HH:MM"), nil, nil
+		}
+
+		window := defaultAroundWindow
+		if in.WindowMinutes > 0 {
+			window = min(time.Duration(in.WindowMinutes)*time.Minute, maxAroundWindow)
+		}
+
+		visits, err := h.service.VisitsAround(ctx, at, window, in.Limit)
+		if err != nil {
+			return errorResult("Error fetching visits: " + err.Error()), nil, nil
+		}
+
+		header := "Visits from " + at.Add(-window).In(loc).Format(visitTimeLayout) +
+			" to " + at.Add(window).In(loc).Format(visitTimeLayout) + ", oldest first"
+		return textResult(formatVisits(header, visits, loc)), nil, nil
+	}
+}
+
+func parseTimezone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(name)
+}
+
+func parseTimestamp(raw string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02T15:04", raw, loc); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02 15:04", raw, loc)
+}
+
+func textResult(text string) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: text}},
+	}
+}
+
+func errorResult(text string) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: text}},
+		IsError: true,
+	}
+}
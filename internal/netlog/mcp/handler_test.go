@@ -0,0 +1,327 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/2beens/serjtubincom/internal/netlog"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// mockContextService implements contextService for tests.
+type mockContextService struct {
+	visits       []*netlog.Visit
+	visitsErr    error
+	hosts        []netlog.HostCount
+	hostsErr     error
+	sessions     []*netlog.Session
+	sessionsErr  error
+	gotParams    SearchParams
+	gotRange     netlog.StatsRange
+	gotAt        time.Time
+	gotWindow    time.Duration
+	gotLimit     int
+	serviceCalls int
+}
+
+func (m *mockContextService) SearchVisits(ctx context.Context, params SearchParams) ([]*netlog.Visit, error) {
+	m.serviceCalls++
+	m.gotParams = params
+	return m.visits, m.visitsErr
+}
+
+func (m *mockContextService) TopDomains(ctx context.Context, statsRange netlog.StatsRange, limit int) ([]netlog.HostCount, error) {
+	m.serviceCalls++
+	m.gotRange = statsRange
+	m.gotLimit = limit
+	return m.hosts, m.hostsErr
+}
+
+func (m *mockContextService) Sessions(ctx context.Context, statsRange netlog.StatsRange) ([]*netlog.Session, error) {
+	m.serviceCalls++
+	m.gotRange = statsRange
+	return m.sessions, m.sessionsErr
+}
+
+func (m *mockContextService) VisitsAround(ctx context.Context, at time.Time, window time.Duration, limit int) ([]*netlog.Visit, error) {
+	m.serviceCalls++
+	m.gotAt = at
+	m.gotWindow = window
+	m.gotLimit = limit
+	return m.visits, m.visitsErr
+}
+
+func resultText(t *testing.T, res *mcp.CallToolResult) string {
+	t.Helper()
+	if len(res.Content) != 1 {
+		t.Fatalf("expected 1 content, got %d", len(res.Content))
+	}
+	tc, ok := res.Content[0].(*mcp.TextContent)
+	if !ok {
+		t.Fatalf("expected text content, got %T", res.Content[0])
+	}
+	return tc.Text
+}
+
+// Tests for SearchVisitsTool.
+func TestHandler_SearchVisitsTool(t *testing.T) {
+	t.Run("returns_compact_visits", func(t *testing.T) {
+		svc := &mockContextService{visits: []*netlog.Visit{
+			{
+				Title:        "Generics tutorial",
+				URL:          "https://go.dev/doc/tutorial/generics?utm_source=x",
+				CanonicalURL: "https://go.dev/doc/tutorial/generics",
+				Timestamp:    time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC),
+			},
+			{
+				URL:       "https://example.com",
+				Timestamp: time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC),
+			},
+		}}
+		h := NewHandler(svc)
+		res, _, err := h.SearchVisitsTool()(context.Background(), &mcp.CallToolRequest{}, SearchVisitsInput{
+			Text:     "generics",
+			FromDate: "2026-03-01",
+			ToDate:   "2026-03-01",
+			Timezone: "Europe/Belgrade",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if res.IsError {
+			t.Fatalf("unexpected IsError: %s", resultText(t, res))
+		}
+
+		want := "Visits, best matches first (2, time | title | url):\n" +
+			"2026-03-01 10:30 | Generics tutorial | https://go.dev/doc/tutorial/generics\n" +
+			"2026-03-01 09:00 | - | https://example.com\n"
+		if got := resultText(t, res); got != want {
+			t.Fatalf("text = %q, want %q", got, want)
+		}
+
+		// the dates are in the given timezone, and the to_date is inclusive
+		if svc.gotParams.From == nil || !svc.gotParams.From.Equal(time.Date(2026, 2, 28, 23, 0, 0, 0, time.UTC)) {
+			t.Fatalf("from = %v", svc.gotParams.From)
+		}
+		if svc.gotParams.To == nil || !svc.gotParams.To.Equal(time.Date(2026, 3, 1, 23, 0, 0, 0, time.UTC)) {
+			t.Fatalf("to = %v", svc.gotParams.To)
+		}
+	})
+
+	t.Run("returns_no_visits_found", func(t *testing.T) {
+		h := NewHandler(&mockContextService{})
+		res, _, err := h.SearchVisitsTool()(context.Background(), &mcp.CallToolRequest{}, SearchVisitsInput{Host: "go.dev"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := resultText(t, res); got != "Visits, newest first: no visits found.\n" {
+			t.Fatalf("text = %q", got)
+		}
+	})
+
+	t.Run("returns_error_for_invalid_input", func(t *testing.T) {
+		inputs := []SearchVisitsInput{
+			{FromDate: "01.03.2026"},
+			{ToDate: "yesterday"},
+			{Timezone: "Mars/Olympus"},
+		}
+		for _, in := range inputs {
+			svc := &mockContextService{}
+			res, _, err := NewHandler(svc).SearchVisitsTool()(context.Background(), &mcp.CallToolRequest{}, in)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !res.IsError {
+				t.Fatalf("expected IsError for %+v", in)
+			}
+			if svc.serviceCalls != 0 {
+				t.Fatalf("service should not be called for %+v", in)
+			}
+		}
+	})
+
+	t.Run("returns_error_when_service_fails", func(t *testing.T) {
+		h := NewHandler(&mockContextService{visitsErr: errors.New("db gone")})
+		res, _, err := h.SearchVisitsTool()(context.Background(), &mcp.CallToolRequest{}, SearchVisitsInput{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !res.IsError {
+			t.Fatalf("expected IsError")
+		}
+		if got := resultText(t, res); !strings.Contains(got, "db gone") {
+			t.Fatalf("text = %q", got)
+		}
+	})
+}
+
+// Tests for TopDomainsTool.
+func TestHandler_TopDomainsTool(t *testing.T) {
+	t.Run("returns_hosts", func(t *testing.T) {
+		svc := &mockContextService{hosts: []netlog.HostCount{
+			{Host: "go.dev", Visits: 12},
+			{Host: "github.com", Visits: 7},
+		}}
+		h := NewHandler(svc)
+		res, _, err := h.TopDomainsTool()(context.Background(), &mcp.CallToolRequest{}, TopDomainsInput{
+			FromDate: "2026-03-01",
+			ToDate:   "2026-03-07",
+			Limit:    2,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := "Top domains 2026-03-01 00:00 to 2026-03-08 00:00 (host visits):\ngo.dev 12\ngithub.com 7\n"
+		if got := resultText(t, res); got != want {
+			t.Fatalf("text = %q, want %q", got, want)
+		}
+		if svc.gotLimit != 2 {
+			t.Fatalf("limit = %d, want 2", svc.gotLimit)
+		}
+	})
+
+	t.Run("returns_error_for_reversed_range", func(t *testing.T) {
+		svc := &mockContextService{}
+		res, _, err := NewHandler(svc).TopDomainsTool()(context.Background(), &mcp.CallToolRequest{}, TopDomainsInput{
+			FromDate: "2026-03-07",
+			ToDate:   "2026-03-01",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !res.IsError || svc.serviceCalls != 0 {
+			t.Fatalf("expected IsError without calling the service")
+		}
+	})
+
+	t.Run("returns_error_for_missing_dates", func(t *testing.T) {
+		res, _, err := NewHandler(&mockContextService{}).TopDomainsTool()(context.Background(), &mcp.CallToolRequest{}, TopDomainsInput{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !res.IsError {
+			t.Fatalf("expected IsError")
+		}
+	})
+}
+
+// Tests for SessionsTool.
+func TestHandler_SessionsTool(t *testing.T) {
+	start := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	session := &netlog.Session{
+		Device:          "mac",
+		Start:           start,
+		End:             start.Add(45 * time.Minute),
+		DurationSeconds: 45 * 60,
+		VisitsCount:     2,
+		Domains: []netlog.DomainTime{
+			{Host: "go.dev", Seconds: 40 * 60, Visits: 1},
+			{Host: "github.com", Seconds: 30, Visits: 1},
+		},
+		Visits: []netlog.SessionVisit{
+			{Visit: &netlog.Visit{Title: "Go", URL: "https://go.dev", Timestamp: start}, Host: "go.dev"},
+			{Visit: &netlog.Visit{Title: "GitHub", URL: "https://github.com", Timestamp: start.Add(40 * time.Minute)}, Host: "github.com"},
+		},
+	}
+
+	t.Run("returns_sessions_with_visits", func(t *testing.T) {
+		svc := &mockContextService{sessions: []*netlog.Session{session}}
+		h := NewHandler(svc)
+		res, _, err := h.SessionsTool()(context.Background(), &mcp.CallToolRequest{}, SessionsInput{
+			Date:          "2026-03-01",
+			IncludeVisits: true,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := "Sessions on 2026-03-01 (1, start-end (duration) device, visits: top domains by time):\n" +
+			"09:00-09:45 (45m) mac, 2 visits: go.dev 40m, github.com <1m\n" +
+			"  09:00 | Go | https://go.dev\n" +
+			"  09:40 | GitHub | https://github.com\n"
+		if got := resultText(t, res); got != want {
+			t.Fatalf("text = %q, want %q", got, want)
+		}
+		if !svc.gotRange.From.Equal(start.Add(-9*time.Hour)) || !svc.gotRange.To.Equal(start.Add(15*time.Hour)) {
+			t.Fatalf("range = %v - %v", svc.gotRange.From, svc.gotRange.To)
+		}
+	})
+
+	t.Run("omits_visits_by_default", func(t *testing.T) {
+		h := NewHandler(&mockContextService{sessions: []*netlog.Session{session}})
+		res, _, err := h.SessionsTool()(context.Background(), &mcp.CallToolRequest{}, SessionsInput{Date: "2026-03-01"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := resultText(t, res); strings.Contains(got, "https://") {
+			t.Fatalf("unexpected visits in %q", got)
+		}
+	})
+
+	t.Run("returns_error_for_invalid_date", func(t *testing.T) {
+		res, _, err := NewHandler(&mockContextService{}).SessionsTool()(context.Background(), &mcp.CallToolRequest{}, SessionsInput{Date: "2026-3-1"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !res.IsError {
+			t.Fatalf("expected IsError")
+		}
+	})
+}
+
+// Tests for VisitsAroundTool.
+func TestHandler_VisitsAroundTool(t *testing.T) {
+	t.Run("parses_local_timestamp", func(t *testing.T) {
+		svc := &mockContextService{}
+		h := NewHandler(svc)
+		res, _, err := h.VisitsAroundTool()(context.Background(), &mcp.CallToolRequest{}, VisitsAroundInput{
+			Timestamp: "2026-03-01 10:00",
+			Timezone:  "Europe/Belgrade",
+			Limit:     5,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if res.IsError {
+			t.Fatalf("unexpected IsError: %s", resultText(t, res))
+		}
+		if !svc.gotAt.Equal(time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)) {
+			t.Fatalf("at = %v", svc.gotAt)
+		}
+		if svc.gotWindow != defaultAroundWindow || svc.gotLimit != 5 {
+			t.Fatalf("window = %v, limit = %d", svc.gotWindow, svc.gotLimit)
+		}
+		want := "Visits from 2026-03-01 09:30 to 2026-03-01 10:30, oldest first: no visits found.\n"
+		if got := resultText(t, res); got != want {
+			t.Fatalf("text = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("caps_window", func(t *testing.T) {
+		svc := &mockContextService{}
+		_, _, err := NewHandler(svc).VisitsAroundTool()(context.Background(), &mcp.CallToolRequest{}, VisitsAroundInput{
+			Timestamp:     "2026-03-01T10:00:00Z",
+			WindowMinutes: 10000,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if svc.gotWindow != maxAroundWindow {
+			t.Fatalf("window = %v, want %v", svc.gotWindow, maxAroundWindow)
+		}
+	})
+
+	t.Run("returns_error_for_invalid_timestamp", func(t *testing.T) {
+		svc := &mockContextService{}
+		res, _, err := NewHandler(svc).VisitsAroundTool()(context.Background(), &mcp.CallToolRequest{}, VisitsAroundInput{Timestamp: "10am"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !res.IsError || svc.serviceCalls != 0 {
+			t.Fatalf("expected IsError without calling the service")
+		}
+	})
+}
@@ -0,0 +1,43 @@
+package mcp
+
+import (
+	"time"
+
+	"github.com/2beens/serjtubincom/internal/netlog"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// NewServer builds an MCP server with netlog (browsing history) tools: visits search, top domains,
+// sessions of a day, visits around a time.
+// Used by the main backend when mounting MCP at /mcp/netlog (internal/server).
+func NewServer(repo *netlog.Repo, sessionIdleGap time.Duration) *mcp.Server {
+	svc := NewContextService(repo, sessionIdleGap)
+	h := NewHandler(svc)
+	s := mcp.NewServer(&mcp.Implementation{
+		Name:    "netlog-context",
+		Version: "1.0.0",
+	}, nil)
+
+	mcp.AddTool(s, &mcp.Tool{
+		Name:        "search_netlog_visits",
+		Description: "Searches the browsing history (visited pages). Optional: text (full-text over titles and urls, best matches first), query (netlog search syntax: host:, domain:, title:, url:, source:, device:, tag:, -term, OR), host, from_date, to_date (YYYY-MM-DD), timezone, limit. Without text, the newest visits first. Use to find a page read before, e.g. the article about X from last Tuesday.",
+	}, h.SearchVisitsTool())
+
+	mcp.AddTool(s, &mcp.Tool{
+		Name:        "get_netlog_top_domains",
+		Description: "Returns the most visited domains (hosts) with their visit counts for a period. Args: from_date, to_date (YYYY-MM-DD, inclusive); optional: timezone, limit. Use to see where the browsing time went in a period.",
+	}, h.TopDomainsTool())
+
+	mcp.AddTool(s, &mcp.Tool{
+		Name:        "get_netlog_sessions",
+		Description: "Returns the browsing sessions of a day: start, end, duration, device, visits count and the domains the most time was spent on. Arg: date (YYYY-MM-DD); optional: timezone, include_visits. Use to reconstruct what was done on a given day.",
+	}, h.SessionsTool())
+
+	mcp.AddTool(s, &mcp.Tool{
+		Name:        "get_netlog_visits_around",
+		Description: "Returns the visits around a point in time, the closest first picked, listed oldest first. Arg: timestamp (RFC3339 or YYYY-MM-DD HH:MM); optional: window_minutes (30 by default), timezone, limit. Use to see the context of a visit, e.g. what led to a page.",
+	}, h.VisitsAroundTool())
+
+	return s
+}
@@ -0,0 +1,163 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/2beens/serjtubincom/internal/netlog"
+)
+
+const (
+	defaultVisitsLimit = 20
+	maxVisitsLimit     = 100
+	defaultTopLimit    = 20
+	maxTopLimit        = 100
+)
+
+// VisitsRepo provides the netlog visits and stats (for dependency injection and testing).
+type VisitsRepo interface {
+	GetVisits(ctx context.Context, query *netlog.SearchQuery, limit int) ([]*netlog.Visit, error)
+	SearchRanked(ctx context.Context, text string, filter *netlog.SearchQuery, page, size int) ([]*netlog.RankedVisit, error)
+	TopHosts(ctx context.Context, statsRange netlog.StatsRange, limit int) ([]netlog.HostCount, error)
+	GetVisitsInRange(ctx context.Context, statsRange netlog.StatsRange) ([]*netlog.Visit, error)
+}
+
+// contextService provides the netlog browsing history context (visits search, top domains, sessions).
+// Used by Handler for testability.
+type contextService interface {
+	SearchVisits(ctx context.Context, params SearchParams) ([]*netlog.Visit, error)
+	TopDomains(ctx context.Context, statsRange netlog.StatsRange, limit int) ([]netlog.HostCount, error)
+	Sessions(ctx context.Context, statsRange netlog.StatsRange) ([]*netlog.Session, error)
+	VisitsAround(ctx context.Context, at time.Time, window time.Duration, limit int) ([]*netlog.Visit, error)
+}
+
+// SearchParams are the visits search filters, all optional.
+type SearchParams struct {
+	// Text is matched with the full-text search over the titles and urls, the best matches first
+	Text string
+	// Query is in the netlog search query syntax, see netlog.NewSearchQuery
+	Query string
+	Host  string
+	From  *time.Time
+	To    *time.Time
+	Limit int
+}
+
+// ContextService holds dependencies and implements the netlog context business logic.
+type ContextService struct {
+	repo            VisitsRepo
+	sessionAnalyzer *netlog.SessionAnalyzer
+}
+
+// NewContextService builds a ContextService, the sessions split on pauses longer than sessionIdleGap.
+func NewContextService(repo VisitsRepo, sessionIdleGap time.Duration) *ContextService {
+	return &ContextService{
+		repo:            repo,
+		sessionAnalyzer: netlog.NewSessionAnalyzer(sessionIdleGap),
+	}
+}
+
+// SearchVisits returns the visits matching the params: by relevance if there is a full-text search text,
+// otherwise the newest first.
+func (s *ContextService) SearchVisits(ctx context.Context, params SearchParams) ([]*netlog.Visit, error) {
+	filter, err := searchFilter(params)
+	if err != nil {
+		return nil, err
+	}
+	limit := clampLimit(params.Limit, defaultVisitsLimit, maxVisitsLimit)
+
+	if params.Text == "" {
+		return s.repo.GetVisits(ctx, filter, limit)
+	}
+
+	ranked, err := s.repo.SearchRanked(ctx, params.Text, filter, 1, limit)
+	if err != nil {
+		return nil, err
+	}
+	visits := make([]*netlog.Visit, 0, len(ranked))
+	for _, rv := range ranked {
+		visits = append(visits, rv.Visit)
+	}
+	return visits, nil
+}
+
+// searchFilter combines the query with the host and time range filters into a single search query
+func searchFilter(params SearchParams) (*netlog.SearchQuery, error) {
+	var terms []string
+	if params.Query != "" {
+		// grouped, so an OR in it doesn't take the other filters along
+		terms = append(terms, "("+params.Query+")")
+	}
+	if params.Host != "" {
+		if strings.ContainsAny(params.Host, " \t,\"()") {
+			return nil, fmt.Errorf("invalid host: %s", params.Host)
+		}
+		terms = append(terms, "host:"+params.Host)
+	}
+	if params.From != nil {
+		terms = append(terms, "after:"+params.From.UTC().Format(time.RFC3339))
+	}
+	if params.To != nil {
+		terms = append(terms, "before:"+params.To.UTC().Format(time.RFC3339))
+	}
+	return netlog.NewSearchQuery(strings.Join(terms, " "), "url", "all")
+}
+
+// TopDomains returns the most visited hosts in the range.
+func (s *ContextService) TopDomains(ctx context.Context, statsRange netlog.StatsRange, limit int) ([]netlog.HostCount, error) {
+	return s.repo.TopHosts(ctx, statsRange, clampLimit(limit, defaultTopLimit, maxTopLimit))
+}
+
+// Sessions returns the browsing sessions started in the range, oldest first.
+func (s *ContextService) Sessions(ctx context.Context, statsRange netlog.StatsRange) ([]*netlog.Session, error) {
+	visits, err := s.repo.GetVisitsInRange(ctx, statsRange)
+	if err != nil {
+		return nil, err
+	}
+	return s.sessionAnalyzer.Sessions(visits), nil
+}
+
+// VisitsAround returns at most limit visits within the window before and after the given time, the
+// closest ones to it, oldest first.
+func (s *ContextService) VisitsAround(ctx context.Context, at time.Time, window time.Duration, limit int) ([]*netlog.Visit, error) {
+	visits, err := s.repo.GetVisitsInRange(ctx, netlog.StatsRange{
+		From: at.Add(-window),
+		To:   at.Add(window),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	limit = clampLimit(limit, defaultVisitsLimit, maxVisitsLimit)
+	if len(visits) <= limit {
+		return visits, nil
+	}
+
+	closest := make([]*netlog.Visit, len(visits))
+	copy(closest, visits)
+	sort.SliceStable(closest, func(i, j int) bool {
+		return absDuration(closest[i].Timestamp.Sub(at)) < absDuration(closest[j].Timestamp.Sub(at))
+	})
+	closest = closest[:limit]
+	sort.SliceStable(closest, func(i, j int) bool {
+		return closest[i].Timestamp.Before(closest[j].Timestamp)
+	})
+	return closest, nil
+}
+
+func clampLimit(limit, defaultLimit, maxLimit int) int {
+	if limit <= 0 {
+		return defaultLimit
+	}
+	return min(limit, maxLimit)
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,219 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/2beens/serjtubincom/internal/netlog"
+)
+
+// mockVisitsRepo implements VisitsRepo for service tests.
+type mockVisitsRepo struct {
+	visits      []*netlog.Visit
+	visitsErr   error
+	ranked      []*netlog.RankedVisit
+	rankedErr   error
+	hosts       []netlog.HostCount
+	hostsErr    error
+	inRange     []*netlog.Visit
+	inRangeErr  error
+	gotQuery    *netlog.SearchQuery
+	gotText     string
+	gotLimit    int
+	gotRange    netlog.StatsRange
+	getVisitsOK bool
+}
+
+func (m *mockVisitsRepo) GetVisits(ctx context.Context, query *netlog.SearchQuery, limit int) ([]*netlog.Visit, error) {
+	m.getVisitsOK = true
+	m.gotQuery = query
+	m.gotLimit = limit
+	return m.visits, m.visitsErr
+}
+
+func (m *mockVisitsRepo) SearchRanked(ctx context.Context, text string, filter *netlog.SearchQuery, page, size int) ([]*netlog.RankedVisit, error) {
+	m.gotText = text
+	m.gotQuery = filter
+	m.gotLimit = size
+	return m.ranked, m.rankedErr
+}
+
+func (m *mockVisitsRepo) TopHosts(ctx context.Context, statsRange netlog.StatsRange, limit int) ([]netlog.HostCount, error) {
+	m.gotRange = statsRange
+	m.gotLimit = limit
+	return m.hosts, m.hostsErr
+}
+
+func (m *mockVisitsRepo) GetVisitsInRange(ctx context.Context, statsRange netlog.StatsRange) ([]*netlog.Visit, error) {
+	m.gotRange = statsRange
+	return m.inRange, m.inRangeErr
+}
+
+func TestContextService_SearchVisits(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("without_text_uses_query_filters", func(t *testing.T) {
+		from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+		to := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+		want := []*netlog.Visit{{Id: 1, URL: "https://go.dev/blog"}}
+		repo := &mockVisitsRepo{visits: want}
+		svc := NewContextService(repo, 0)
+
+		got, err := svc.SearchVisits(ctx, SearchParams{
+			Query: "blog OR news",
+			Host:  "go.dev",
+			From:  &from,
+			To:    &to,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !repo.getVisitsOK {
+			t.Fatalf("GetVisits not called")
+		}
+		if len(got) != 1 || got[0].Id != 1 {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+		if repo.gotLimit != defaultVisitsLimit {
+			t.Fatalf("limit = %d, want %d", repo.gotLimit, defaultVisitsLimit)
+		}
+
+		cases := []struct {
+			visit *netlog.Visit
+			match bool
+		}{
+			{&netlog.Visit{URL: "https://go.dev/blog/x", Timestamp: from.Add(time.Hour)}, true},
+			{&netlog.Visit{URL: "https://go.dev/news", Timestamp: from.Add(time.Hour)}, true},
+			// the OR stays within the query, so the host filter still applies
+			{&netlog.Visit{URL: "https://example.com/news", Timestamp: from.Add(time.Hour)}, false},
+			{&netlog.Visit{URL: "https://go.dev/blog/x", Timestamp: to.Add(time.Hour)}, false},
+			{&netlog.Visit{URL: "https://go.dev/blog/x", Timestamp: from.Add(-time.Hour)}, false},
+		}
+		for _, c := range cases {
+			if got := repo.gotQuery.Matches(c.visit); got != c.match {
+				t.Fatalf("query matches %s at %s = %t, want %t", c.visit.URL, c.visit.Timestamp, got, c.match)
+			}
+		}
+	})
+
+	t.Run("with_text_uses_ranked_search", func(t *testing.T) {
+		repo := &mockVisitsRepo{ranked: []*netlog.RankedVisit{
+			{Visit: &netlog.Visit{Id: 2}},
+			{Visit: &netlog.Visit{Id: 1}},
+		}}
+		svc := NewContextService(repo, 0)
+
+		got, err := svc.SearchVisits(ctx, SearchParams{Text: "generics", Limit: 500})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if repo.getVisitsOK {
+			t.Fatalf("GetVisits should not be called")
+		}
+		if repo.gotText != "generics" {
+			t.Fatalf("text = %q, want generics", repo.gotText)
+		}
+		if repo.gotLimit != maxVisitsLimit {
+			t.Fatalf("limit = %d, want %d", repo.gotLimit, maxVisitsLimit)
+		}
+		if len(got) != 2 || got[0].Id != 2 || got[1].Id != 1 {
+			t.Fatalf("visits not in the ranked order: %v", got)
+		}
+	})
+
+	t.Run("returns_error_for_invalid_host", func(t *testing.T) {
+		repo := &mockVisitsRepo{}
+		svc := NewContextService(repo, 0)
+		if _, err := svc.SearchVisits(ctx, SearchParams{Host: "go.dev OR x"}); err == nil {
+			t.Fatalf("expected error")
+		}
+		if repo.getVisitsOK {
+			t.Fatalf("GetVisits should not be called")
+		}
+	})
+
+	t.Run("returns_error_when_repo_fails", func(t *testing.T) {
+		svc := NewContextService(&mockVisitsRepo{rankedErr: errors.New("db gone")}, 0)
+		if _, err := svc.SearchVisits(ctx, SearchParams{Text: "x"}); err == nil {
+			t.Fatalf("expected error")
+		}
+	})
+}
+
+func TestContextService_TopDomains(t *testing.T) {
+	repo := &mockVisitsRepo{hosts: []netlog.HostCount{{Host: "go.dev", Visits: 3}}}
+	svc := NewContextService(repo, 0)
+
+	got, err := svc.TopDomains(context.Background(), netlog.StatsRange{}, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 1 || got[0].Host != "go.dev" {
+		t.Fatalf("got %v", got)
+	}
+	if repo.gotLimit != defaultTopLimit {
+		t.Fatalf("limit = %d, want %d", repo.gotLimit, defaultTopLimit)
+	}
+}
+
+func TestContextService_Sessions(t *testing.T) {
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	repo := &mockVisitsRepo{inRange: []*netlog.Visit{
+		{Id: 1, URL: "https://go.dev/a", Device: "mac", Timestamp: start},
+		{Id: 2, URL: "https://go.dev/b", Device: "mac", Timestamp: start.Add(5 * time.Minute)},
+		{Id: 3, URL: "https://go.dev/c", Device: "mac", Timestamp: start.Add(3 * time.Hour)},
+	}}
+	svc := NewContextService(repo, 30*time.Minute)
+
+	sessions, err := svc.Sessions(context.Background(), netlog.StatsRange{From: start, To: start.AddDate(0, 0, 1)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+	if sessions[0].VisitsCount != 2 || sessions[1].VisitsCount != 1 {
+		t.Fatalf("visits counts = %d, %d, want 2, 1", sessions[0].VisitsCount, sessions[1].VisitsCount)
+	}
+}
+
+func TestContextService_VisitsAround(t *testing.T) {
+	at := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	var inRange []*netlog.Visit
+	for i, offset := range []time.Duration{-20, -10, -2, 1, 3, 15} {
+		inRange = append(inRange, &netlog.Visit{Id: i + 1, Timestamp: at.Add(offset * time.Minute)})
+	}
+
+	t.Run("returns_closest_oldest_first", func(t *testing.T) {
+		repo := &mockVisitsRepo{inRange: inRange}
+		svc := NewContextService(repo, 0)
+
+		got, err := svc.VisitsAround(context.Background(), at, 30*time.Minute, 3)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !repo.gotRange.From.Equal(at.Add(-30*time.Minute)) || !repo.gotRange.To.Equal(at.Add(30*time.Minute)) {
+			t.Fatalf("range = %v - %v", repo.gotRange.From, repo.gotRange.To)
+		}
+		var ids []int
+		for _, v := range got {
+			ids = append(ids, v.Id)
+		}
+		if len(ids) != 3 || ids[0] != 3 || ids[1] != 4 || ids[2] != 5 {
+			t.Fatalf("ids = %v, want [3 4 5]", ids)
+		}
+	})
+
+	t.Run("returns_all_under_limit", func(t *testing.T) {
+		svc := NewContextService(&mockVisitsRepo{inRange: inRange}, 0)
+		got, err := svc.VisitsAround(context.Background(), at, 30*time.Minute, 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(got) != len(inRange) {
+			t.Fatalf("expected %d visits, got %d", len(inRange), len(got))
+		}
+	})
+}
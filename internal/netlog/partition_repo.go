@@ -0,0 +1,273 @@
+package netlog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/2beens/serjtubincom/internal/telemetry/tracing"
+
+	"github.com/jackc/pgx/v5"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const visitDefaultPartition = "visit_default"
+
+// VisitPartition is a monthly partition of the visit table
+type VisitPartition struct {
+	Name  string    `json:"name"`
+	Month time.Time `json:"month"`
+	// estimated, from the last vacuum/analyze of the partition
+	Rows int `json:"rows"`
+}
+
+// GetVisitPartitions returns the monthly partitions of the visit table, the oldest first.
+// The default partition is not included.
+func (r *Repo) GetVisitPartitions(ctx context.Context) (_ []VisitPartition, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.getVisitPartitions")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	rows, err := r.db.Query(
+		ctx,
+		`
+			SELECT c.relname, GREATEST(c.reltuples, 0)::bigint
+			FROM pg_inherits i
+			JOIN pg_class c ON c.oid = i.inhrelid
+			WHERE i.inhparent = 'netlog.visit'::regclass
+			ORDER BY c.relname;
+		`,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	partitions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (VisitPartition, error) {
+		var p VisitPartition
+		err := row.Scan(&p.Name, &p.Rows)
+		return p, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	monthly := make([]VisitPartition, 0, len(partitions))
+	for _, p := range partitions {
+		month, ok := visitPartitionMonth(p.Name)
+		if !ok {
+			continue
+		}
+		p.Month = month
+		monthly = append(monthly, p)
+	}
+
+	span.SetAttributes(attribute.Int("partitions", len(monthly)))
+	return monthly, nil
+}
+
+// GetDefaultPartitionMonths returns the months (UTC) of the visits in the default partition, i.e. the
+// visits added or restored before their monthly partition was created
+func (r *Repo) GetDefaultPartitionMonths(ctx context.Context) (_ []time.Time, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.getDefaultPartitionMonths")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	rows, err := r.db.Query(
+		ctx,
+		fmt.Sprintf(`
+			SELECT DISTINCT date_trunc('month', timestamp AT TIME ZONE 'UTC')
+			FROM %s
+			ORDER BY 1;
+		`, pgx.Identifier{DefaultVisitsSchema, visitDefaultPartition}.Sanitize()),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	months, err := pgx.CollectRows(rows, pgx.RowTo[time.Time])
+	if err != nil {
+		return nil, err
+	}
+	for i := range months {
+		months[i] = months[i].UTC()
+	}
+	return months, nil
+}
+
+// CreateVisitPartition creates the partition of the given month, unless it exists already. The visits of
+// that month in the default partition are moved to the new one, in the same transaction. Returns whether
+// the partition was created, and the number of the moved visits.
+func (r *Repo) CreateVisitPartition(ctx context.Context, month time.Time) (_ bool, _ int, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.createVisitPartition")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	month = monthStart(month)
+	partitionName := visitPartitionName(month)
+	span.SetAttributes(attribute.String("partition", partitionName))
+
+	visitTable := pgx.Identifier{DefaultVisitsSchema, "visit"}.Sanitize()
+	partitionTable := pgx.Identifier{DefaultVisitsSchema, partitionName}.Sanitize()
+	defaultTable := pgx.Identifier{DefaultVisitsSchema, visitDefaultPartition}.Sanitize()
+	from, to := month, month.AddDate(0, 1, 0)
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, 0, err
+	}
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			log.Errorf("create visit partition, rollback: %s", err)
+		}
+	}()
+
+	var exists bool
+	if err := tx.QueryRow(
+		ctx,
+		`SELECT to_regclass($1) IS NOT NULL;`,
+		partitionTable,
+	).Scan(&exists); err != nil {
+		return false, 0, fmt.Errorf("check partition: %w", err)
+	}
+	if exists {
+		return false, 0, nil
+	}
+
+	var inDefault bool
+	if err := tx.QueryRow(
+		ctx,
+		fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s WHERE timestamp >= $1 AND timestamp < $2);`, defaultTable),
+		from, to,
+	).Scan(&inDefault); err != nil {
+		return false, 0, fmt.Errorf("check default partition: %w", err)
+	}
+
+	// a partition can't be added while the default partition has visits in its range, so the default one
+	// is detached until they are moved
+	createSQL := fmt.Sprintf(
+		`CREATE TABLE %s PARTITION OF %s FOR VALUES FROM (%s) TO (%s);`,
+		partitionTable, visitTable, partitionBoundSQL(from), partitionBoundSQL(to),
+	)
+	if !inDefault {
+		if _, err := tx.Exec(ctx, createSQL); err != nil {
+			return false, 0, fmt.Errorf("create partition: %w", err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return false, 0, err
+		}
+		return true, 0, nil
+	}
+
+	if _, err := tx.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s DETACH PARTITION %s;`, visitTable, defaultTable)); err != nil {
+		return false, 0, fmt.Errorf("detach default partition: %w", err)
+	}
+	if _, err := tx.Exec(ctx, createSQL); err != nil {
+		return false, 0, fmt.Errorf("create partition: %w", err)
+	}
+	tag, err := tx.Exec(
+		ctx,
+		fmt.Sprintf(`
+			WITH moved AS (
+				DELETE FROM %s
+				WHERE timestamp >= $1 AND timestamp < $2
+				RETURNING id, title, source, device, url, timestamp, host, registered_domain, canonical_url
+			)
+			INSERT INTO %s (id, title, source, device, url, timestamp, host, registered_domain, canonical_url)
+			SELECT * FROM moved;
+		`, defaultTable, partitionTable),
+		from, to,
+	)
+	if err != nil {
+		return false, 0, fmt.Errorf("move visits from default partition: %w", err)
+	}
+	if _, err := tx.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s ATTACH PARTITION %s DEFAULT;`, visitTable, defaultTable)); err != nil {
+		return false, 0, fmt.Errorf("attach default partition: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, 0, err
+	}
+
+	span.SetAttributes(attribute.Int64("moved-visits", tag.RowsAffected()))
+	return true, int(tag.RowsAffected()), nil
+}
+
+// ArchiveVisitPartition passes all the visits of the given month partition to archive, and drops the
+// partition only if archive succeeds. The partition is locked for writes meanwhile.
+// The annotations of the archived visits are kept, for when they are restored.
+func (r *Repo) ArchiveVisitPartition(ctx context.Context, month time.Time, archive func(visits []*Visit) error) (_ int, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.archiveVisitPartition")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	partitionName := visitPartitionName(monthStart(month))
+	span.SetAttributes(attribute.String("partition", partitionName))
+
+	partitionTable := pgx.Identifier{DefaultVisitsSchema, partitionName}.Sanitize()
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			log.Errorf("archive visit partition, rollback: %s", err)
+		}
+	}()
+
+	if _, err := tx.Exec(ctx, fmt.Sprintf(`LOCK TABLE %s IN SHARE MODE;`, partitionTable)); err != nil {
+		return 0, fmt.Errorf("lock partition: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, fmt.Sprintf(`SELECT `+visitColumnsSQL+` FROM %s ORDER BY id;`, partitionTable))
+	if err != nil {
+		return 0, fmt.Errorf("get partition visits: %w", err)
+	}
+	visits, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*Visit, error) {
+		v := &Visit{}
+		err := row.Scan(
+			&v.Id, &v.Title, &v.Source, &v.Device, &v.URL, &v.Timestamp,
+			&v.Host, &v.RegisteredDomain, &v.CanonicalURL,
+		)
+		return v, err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("get partition visits: %w", err)
+	}
+
+	if err := archive(visits); err != nil {
+		return 0, fmt.Errorf("archive visits: %w", err)
+	}
+
+	if _, err := tx.Exec(
+		ctx,
+		fmt.Sprintf(
+			`ALTER TABLE %s DETACH PARTITION %s;`,
+			pgx.Identifier{DefaultVisitsSchema, "visit"}.Sanitize(), partitionTable,
+		),
+	); err != nil {
+		return 0, fmt.Errorf("detach partition: %w", err)
+	}
+	if _, err := tx.Exec(ctx, fmt.Sprintf(`DROP TABLE %s;`, partitionTable)); err != nil {
+		return 0, fmt.Errorf("drop partition: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	span.SetAttributes(attribute.Int("archived-visits", len(visits)))
+	return len(visits), nil
+}
+
+// partitionBoundSQL is the partition bound literal of the given time, in UTC, so it doesn't depend on
+// the session time zone (partition bounds can't be query params)
+func partitionBoundSQL(t time.Time) string {
+	return "'" + t.UTC().Format("2006-01-02 15:04:05") + "+00'"
+}
@@ -0,0 +1,97 @@
+//go:build all_tests
+
+package netlog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepo_VisitPartitions(t *testing.T) {
+	ctx := context.Background()
+	repo, shutdown := testRepoSetup(t)
+	defer shutdown()
+
+	addedVisits := cleanupAndAddTestVisits(ctx, t, repo)
+	require.Len(t, addedVisits, 5)
+
+	// old visits, e.g. restored from a backup, end up in the default partition
+	oldMonth := time.Date(2001, time.February, 1, 0, 0, 0, 0, time.UTC)
+	_, err := repo.db.Exec(ctx, `DROP TABLE IF EXISTS netlog.visit_p2001_02;`)
+	require.NoError(t, err)
+	_, err = repo.RestoreVisits(ctx, DefaultVisitsSchema, []*Visit{
+		{Id: 100001, URL: "https://old.com/a", Timestamp: oldMonth.Add(time.Hour)},
+		{Id: 100002, URL: "https://old.com/b", Timestamp: oldMonth.Add(27 * 24 * time.Hour)},
+	})
+	require.NoError(t, err)
+
+	months, err := repo.GetDefaultPartitionMonths(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, months, oldMonth)
+
+	created, moved, err := repo.CreateVisitPartition(ctx, oldMonth.Add(10*24*time.Hour))
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, 2, moved)
+	created, _, err = repo.CreateVisitPartition(ctx, oldMonth)
+	require.NoError(t, err)
+	assert.False(t, created)
+
+	months, err = repo.GetDefaultPartitionMonths(ctx)
+	require.NoError(t, err)
+	assert.NotContains(t, months, oldMonth)
+
+	partitions, err := repo.GetVisitPartitions(ctx)
+	require.NoError(t, err)
+	require.NotEmpty(t, partitions)
+	assert.Equal(t, "visit_p2001_02", partitions[0].Name)
+	assert.Equal(t, oldMonth, partitions[0].Month)
+
+	// the queries and the count go across the partitions
+	count, err := repo.CountAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 7, count)
+
+	_, err = repo.SaveVisitAnnotation(ctx, 100001, &VisitAnnotation{Tags: []string{"old"}})
+	require.NoError(t, err)
+
+	var archived []*Visit
+	archivedCount, err := repo.ArchiveVisitPartition(ctx, oldMonth, func(visits []*Visit) error {
+		archived = visits
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, archivedCount)
+	require.Len(t, archived, 2)
+	assert.Equal(t, "https://old.com/a", archived[0].URL)
+
+	count, err = repo.CountAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 5, count)
+	partitions, err = repo.GetVisitPartitions(ctx)
+	require.NoError(t, err)
+	for _, p := range partitions {
+		assert.NotEqual(t, "visit_p2001_02", p.Name)
+	}
+
+	// the annotations of the archived visits are back with them
+	tags, err := repo.TagCounts(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, tags)
+	_, _, err = repo.CreateVisitPartition(ctx, oldMonth)
+	require.NoError(t, err)
+	_, err = repo.RestoreVisits(ctx, DefaultVisitsSchema, archived)
+	require.NoError(t, err)
+	tags, err = repo.TagCounts(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []TagCount{{Tag: "old", Visits: 1}}, tags)
+
+	_, err = repo.DeleteVisits(ctx, []int{100001, 100002})
+	require.NoError(t, err)
+	_, err = repo.db.Exec(ctx, `DROP TABLE netlog.visit_p2001_02;`)
+	require.NoError(t, err)
+}
@@ -0,0 +1,330 @@
+package netlog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	visitPartitionPrefix      = "visit_p"
+	visitPartitionMonthLayout = "2006_01"
+
+	visitsArchivePrefix      = "netlog-visits-"
+	visitsArchiveSuffix      = ".json.zst"
+	visitsArchiveMonthLayout = "2006-01"
+
+	visitPartitionsCheckInterval = 12 * time.Hour
+)
+
+var ErrVisitsArchiveNotFound = errors.New("visits archive not found")
+
+type visitPartitionsRepo interface {
+	GetVisitPartitions(ctx context.Context) ([]VisitPartition, error)
+	GetDefaultPartitionMonths(ctx context.Context) ([]time.Time, error)
+	CreateVisitPartition(ctx context.Context, month time.Time) (bool, int, error)
+	ArchiveVisitPartition(ctx context.Context, month time.Time, archive func(visits []*Visit) error) (int, error)
+	RestoreVisits(ctx context.Context, schema string, visits []*Visit) (RestoreResult, error)
+}
+
+// monthStart returns the start of the month (UTC) of the given time
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// visitPartitionName is the name of the visit table partition of the given month, e.g. visit_p2024_01
+func visitPartitionName(month time.Time) string {
+	return visitPartitionPrefix + month.UTC().Format(visitPartitionMonthLayout)
+}
+
+func visitPartitionMonth(name string) (time.Time, bool) {
+	monthRaw, ok := strings.CutPrefix(name, visitPartitionPrefix)
+	if !ok {
+		return time.Time{}, false
+	}
+	month, err := time.Parse(visitPartitionMonthLayout, monthRaw)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return month, true
+}
+
+// EnsureVisitPartitions creates the partitions from the current month to monthsAhead months ahead, so the
+// new visits never end up in the default partition, and the partitions of the visits that did (e.g. the
+// restored ones), moving them there. Returns the months of the created partitions.
+func EnsureVisitPartitions(ctx context.Context, repo visitPartitionsRepo, now time.Time, monthsAhead int) ([]time.Time, error) {
+	months, err := repo.GetDefaultPartitionMonths(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get default partition months: %w", err)
+	}
+	current := monthStart(now)
+	for i := 0; i <= monthsAhead; i++ {
+		months = append(months, current.AddDate(0, i, 0))
+	}
+
+	var created []time.Time
+	seen := map[time.Time]bool{}
+	for _, month := range months {
+		month = monthStart(month)
+		if seen[month] {
+			continue
+		}
+		seen[month] = true
+
+		isCreated, moved, err := repo.CreateVisitPartition(ctx, month)
+		if err != nil {
+			return created, fmt.Errorf("create partition %s: %w", visitPartitionName(month), err)
+		}
+		if isCreated {
+			log.Infof("netlog visit partition %s created, visits moved from the default partition: %d", visitPartitionName(month), moved)
+			created = append(created, month)
+		}
+	}
+
+	return created, nil
+}
+
+// MaintainVisitPartitions keeps the visit partitions created ahead, until the context is done
+func MaintainVisitPartitions(ctx context.Context, repo visitPartitionsRepo, monthsAhead int) {
+	if monthsAhead <= 0 {
+		log.Debugln("netlog visit partitions maintenance disabled")
+		return
+	}
+
+	ticker := time.NewTicker(visitPartitionsCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := EnsureVisitPartitions(ctx, repo, time.Now(), monthsAhead); err != nil {
+			log.Errorf("netlog visit partitions maintenance: %s", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// visitsArchive is the content of an archive file, with the visits of one month
+type visitsArchive struct {
+	Month  string   `json:"month"`
+	Visits []*Visit `json:"visits"`
+}
+
+// ArchivedMonth is a month of visits moved from the visit table to its archive file
+type ArchivedMonth struct {
+	Month  time.Time `json:"month"`
+	File   string    `json:"file"`
+	Visits int       `json:"visits"`
+}
+
+// VisitsArchiver moves the old visit partitions to zstd compressed json files, one per month, and
+// restores them on demand
+type VisitsArchiver struct {
+	repo  visitPartitionsRepo
+	dir   string
+	codec *BackupCodec
+}
+
+func NewVisitsArchiver(repo visitPartitionsRepo, dir string) (*VisitsArchiver, error) {
+	if dir == "" {
+		return nil, errors.New("visits archive dir not set")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create visits archive dir: %w", err)
+	}
+
+	codec, err := NewBackupCodec(BackupCompressionZstd, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &VisitsArchiver{
+		repo:  repo,
+		dir:   dir,
+		codec: codec,
+	}, nil
+}
+
+// ArchiveOlderThan archives the partitions of the months that ended more than the given number of months
+// ago, e.g. with 12 months in October 2025, the partitions up to September 2024 are archived.
+// With dryRun, it only returns the partitions that would be archived, without the visit counts.
+func (a *VisitsArchiver) ArchiveOlderThan(ctx context.Context, now time.Time, months int, dryRun bool) ([]ArchivedMonth, error) {
+	if months <= 0 {
+		return nil, fmt.Errorf("invalid visits retention months: %d", months)
+	}
+
+	partitions, err := a.repo.GetVisitPartitions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get visit partitions: %w", err)
+	}
+
+	cutoff := monthStart(now).AddDate(0, -months, 0)
+	var archived []ArchivedMonth
+	for _, p := range partitions {
+		if !p.Month.Before(cutoff) {
+			continue
+		}
+		if ctx.Err() != nil {
+			return archived, ctx.Err()
+		}
+
+		archivedMonth := ArchivedMonth{
+			Month: p.Month,
+			File:  a.archivePath(p.Month),
+		}
+		if dryRun {
+			archived = append(archived, archivedMonth)
+			continue
+		}
+
+		archivedMonth.Visits, err = a.repo.ArchiveVisitPartition(ctx, p.Month, func(visits []*Visit) error {
+			return a.writeArchive(p.Month, visits)
+		})
+		if err != nil {
+			return archived, fmt.Errorf("archive partition %s: %w", p.Name, err)
+		}
+		archived = append(archived, archivedMonth)
+	}
+
+	return archived, nil
+}
+
+// Archives returns the months with an archive file, the oldest first
+func (a *VisitsArchiver) Archives() ([]time.Time, error) {
+	entries, err := os.ReadDir(a.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var months []time.Time
+	for _, entry := range entries {
+		monthRaw, ok := strings.CutPrefix(entry.Name(), visitsArchivePrefix)
+		if !ok {
+			continue
+		}
+		monthRaw, ok = strings.CutSuffix(monthRaw, visitsArchiveSuffix)
+		if !ok {
+			continue
+		}
+		month, err := time.Parse(visitsArchiveMonthLayout, monthRaw)
+		if err != nil {
+			continue
+		}
+		months = append(months, month)
+	}
+
+	sort.Slice(months, func(i, j int) bool { return months[i].Before(months[j]) })
+	return months, nil
+}
+
+// Restore puts the archived visits of the given month back into their partition. The archive file is
+// kept, and the month is archived again by the next archiving, if it's still past the retention.
+func (a *VisitsArchiver) Restore(ctx context.Context, month time.Time) (RestoreResult, error) {
+	month = monthStart(month)
+	visits, err := a.readArchive(month)
+	if err != nil {
+		return RestoreResult{}, err
+	}
+
+	if _, _, err := a.repo.CreateVisitPartition(ctx, month); err != nil {
+		return RestoreResult{}, fmt.Errorf("create partition %s: %w", visitPartitionName(month), err)
+	}
+
+	return a.repo.RestoreVisits(ctx, DefaultVisitsSchema, visits)
+}
+
+func (a *VisitsArchiver) archivePath(month time.Time) string {
+	return filepath.Join(a.dir, visitsArchivePrefix+month.Format(visitsArchiveMonthLayout)+visitsArchiveSuffix)
+}
+
+func (a *VisitsArchiver) writeArchive(month time.Time, visits []*Visit) error {
+	// the month can be archived already, and its partition created again for the visits with the old
+	// timestamps added later (batch, import or backup restore), so they are merged with the archived ones
+	archived, err := a.readArchive(month)
+	if err != nil && !errors.Is(err, ErrVisitsArchiveNotFound) {
+		return fmt.Errorf("read existing archive: %w", err)
+	}
+	visits = mergeArchivedVisits(archived, visits)
+
+	archiveJson, err := json.Marshal(visitsArchive{
+		Month:  month.Format(visitsArchiveMonthLayout),
+		Visits: visits,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal visits: %w", err)
+	}
+
+	path := a.archivePath(month)
+	data, err := a.codec.Encode(filepath.Base(path), archiveJson)
+	if err != nil {
+		return fmt.Errorf("encode visits: %w", err)
+	}
+	return writeFileAtomic(path, data)
+}
+
+// mergeArchivedVisits adds the visits to the archived ones, the visits with the same id and timestamp
+// replace the archived ones, e.g. the restored month archived again. The result is ordered by the timestamp.
+func mergeArchivedVisits(archived, visits []*Visit) []*Visit {
+	type visitKey struct {
+		id        int
+		timestamp int64
+	}
+
+	merged := make([]*Visit, 0, len(archived)+len(visits))
+	index := make(map[visitKey]int, len(archived)+len(visits))
+	for _, v := range slices.Concat(archived, visits) {
+		key := visitKey{id: v.Id, timestamp: v.Timestamp.UnixNano()}
+		if i, ok := index[key]; ok {
+			merged[i] = v
+			continue
+		}
+		index[key] = len(merged)
+		merged = append(merged, v)
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		if !merged[i].Timestamp.Equal(merged[j].Timestamp) {
+			return merged[i].Timestamp.Before(merged[j].Timestamp)
+		}
+		return merged[i].Id < merged[j].Id
+	})
+	return merged
+}
+
+func (a *VisitsArchiver) readArchive(month time.Time) ([]*Visit, error) {
+	path := a.archivePath(month)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrVisitsArchiveNotFound, month.Format(visitsArchiveMonthLayout))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	archiveJson, err := a.codec.Decode(filepath.Base(path), a.codec.Format(), data)
+	if err != nil {
+		return nil, fmt.Errorf("decode visits archive: %w", err)
+	}
+	var archive visitsArchive
+	if err := json.Unmarshal(archiveJson, &archive); err != nil {
+		return nil, fmt.Errorf("unmarshal visits archive: %w", err)
+	}
+	if archive.Month != month.Format(visitsArchiveMonthLayout) {
+		return nil, fmt.Errorf("visits archive %s has the visits of %s", filepath.Base(path), archive.Month)
+	}
+
+	return archive.Visits, nil
+}
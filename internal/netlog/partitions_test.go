@@ -0,0 +1,233 @@
+package netlog
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// partitionsRepoMock keeps the visits by their partition month, the default partition ones separately
+type partitionsRepoMock struct {
+	partitions map[time.Time][]*Visit
+	inDefault  []*Visit
+}
+
+func newPartitionsRepoMock() *partitionsRepoMock {
+	return &partitionsRepoMock{partitions: map[time.Time][]*Visit{}}
+}
+
+func (m *partitionsRepoMock) GetVisitPartitions(_ context.Context) ([]VisitPartition, error) {
+	var partitions []VisitPartition
+	for month, visits := range m.partitions {
+		partitions = append(partitions, VisitPartition{Name: visitPartitionName(month), Month: month, Rows: len(visits)})
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].Month.Before(partitions[j].Month) })
+	return partitions, nil
+}
+
+func (m *partitionsRepoMock) GetDefaultPartitionMonths(_ context.Context) ([]time.Time, error) {
+	var months []time.Time
+	for _, v := range m.inDefault {
+		months = append(months, monthStart(v.Timestamp))
+	}
+	return months, nil
+}
+
+func (m *partitionsRepoMock) CreateVisitPartition(_ context.Context, month time.Time) (bool, int, error) {
+	if _, ok := m.partitions[month]; ok {
+		return false, 0, nil
+	}
+	m.partitions[month] = []*Visit{}
+
+	var kept []*Visit
+	for _, v := range m.inDefault {
+		if monthStart(v.Timestamp).Equal(month) {
+			m.partitions[month] = append(m.partitions[month], v)
+		} else {
+			kept = append(kept, v)
+		}
+	}
+	moved := len(m.inDefault) - len(kept)
+	m.inDefault = kept
+	return true, moved, nil
+}
+
+func (m *partitionsRepoMock) ArchiveVisitPartition(_ context.Context, month time.Time, archive func(visits []*Visit) error) (int, error) {
+	visits, ok := m.partitions[month]
+	if !ok {
+		return 0, errors.New("partition not found")
+	}
+	if err := archive(visits); err != nil {
+		return 0, err
+	}
+	delete(m.partitions, month)
+	return len(visits), nil
+}
+
+func (m *partitionsRepoMock) RestoreVisits(_ context.Context, _ string, visits []*Visit) (RestoreResult, error) {
+	for _, v := range visits {
+		month := monthStart(v.Timestamp)
+		if _, ok := m.partitions[month]; ok {
+			m.partitions[month] = append(m.partitions[month], v)
+		} else {
+			m.inDefault = append(m.inDefault, v)
+		}
+	}
+	return RestoreResult{Inserted: len(visits)}, nil
+}
+
+func utcMonth(year int, m time.Month) time.Time {
+	return time.Date(year, m, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func TestVisitPartitionName(t *testing.T) {
+	assert.Equal(t, "visit_p2024_01", visitPartitionName(utcMonth(2024, time.January)))
+	assert.Equal(t, "visit_p2023_12", visitPartitionName(utcMonth(2023, time.December)))
+
+	parsed, ok := visitPartitionMonth("visit_p2024_01")
+	assert.True(t, ok)
+	assert.Equal(t, utcMonth(2024, time.January), parsed)
+	for _, name := range []string{"visit_default", "visit_p2024", "visit_p2024_13", "visit"} {
+		_, ok := visitPartitionMonth(name)
+		assert.False(t, ok, name)
+	}
+
+	// in UTC, whatever the time zone of the given time
+	belgrade := time.FixedZone("CET", 3600)
+	assert.Equal(t, utcMonth(2023, time.December), monthStart(time.Date(2024, time.January, 1, 0, 30, 0, 0, belgrade)))
+	assert.Equal(t, "'2024-01-01 00:00:00+00'", partitionBoundSQL(utcMonth(2024, time.January)))
+}
+
+func TestEnsureVisitPartitions(t *testing.T) {
+	ctx := context.Background()
+	repo := newPartitionsRepoMock()
+	repo.partitions[utcMonth(2025, time.October)] = []*Visit{}
+	repo.inDefault = []*Visit{
+		{Id: 1, Timestamp: time.Date(2021, time.March, 4, 10, 0, 0, 0, time.UTC)},
+		{Id: 2, Timestamp: time.Date(2021, time.March, 20, 10, 0, 0, 0, time.UTC)},
+		{Id: 3, Timestamp: time.Date(2025, time.December, 2, 10, 0, 0, 0, time.UTC)},
+	}
+
+	now := time.Date(2025, time.October, 16, 12, 0, 0, 0, time.UTC)
+	created, err := EnsureVisitPartitions(ctx, repo, now, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Time{
+		utcMonth(2021, time.March),
+		utcMonth(2025, time.December),
+		utcMonth(2025, time.November),
+	}, created)
+	assert.Empty(t, repo.inDefault)
+	assert.Len(t, repo.partitions[utcMonth(2021, time.March)], 2)
+	assert.Len(t, repo.partitions[utcMonth(2025, time.December)], 1)
+
+	created, err = EnsureVisitPartitions(ctx, repo, now, 2)
+	require.NoError(t, err)
+	assert.Empty(t, created)
+}
+
+func TestVisitsArchiver(t *testing.T) {
+	ctx := context.Background()
+	repo := newPartitionsRepoMock()
+	for i, m := range []time.Time{utcMonth(2023, time.August), utcMonth(2023, time.September), utcMonth(2023, time.October)} {
+		repo.partitions[m] = []*Visit{
+			{Id: 2*i + 1, URL: "https://one.com", Timestamp: m.Add(time.Hour)},
+			{Id: 2*i + 2, URL: "https://two.com", Title: "two", Timestamp: m.Add(48 * time.Hour)},
+		}
+	}
+
+	dir := t.TempDir()
+	archiver, err := NewVisitsArchiver(repo, dir)
+	require.NoError(t, err)
+
+	_, err = archiver.ArchiveOlderThan(ctx, time.Now(), 0, false)
+	assert.Error(t, err)
+
+	now := time.Date(2024, time.September, 3, 0, 0, 0, 0, time.UTC)
+	archived, err := archiver.ArchiveOlderThan(ctx, now, 12, true)
+	require.NoError(t, err)
+	require.Len(t, archived, 1)
+	assert.Equal(t, utcMonth(2023, time.August), archived[0].Month)
+	assert.Len(t, repo.partitions, 3)
+
+	archived, err = archiver.ArchiveOlderThan(ctx, now.AddDate(0, 1, 0), 12, false)
+	require.NoError(t, err)
+	require.Len(t, archived, 2)
+	assert.Equal(t, 2, archived[1].Visits)
+	assert.FileExists(t, archived[1].File)
+	assert.Len(t, repo.partitions, 1)
+
+	months, err := archiver.Archives()
+	require.NoError(t, err)
+	assert.Equal(t, []time.Time{utcMonth(2023, time.August), utcMonth(2023, time.September)}, months)
+
+	// the archives are zstd compressed
+	data, err := os.ReadFile(archived[0].File)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x28, 0xb5, 0x2f, 0xfd}, data[:4])
+
+	_, err = archiver.Restore(ctx, utcMonth(2023, time.July))
+	assert.ErrorIs(t, err, ErrVisitsArchiveNotFound)
+
+	result, err := archiver.Restore(ctx, time.Date(2023, time.September, 15, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Inserted)
+	restored := repo.partitions[utcMonth(2023, time.September)]
+	require.Len(t, restored, 2)
+	assert.Equal(t, 4, restored[1].Id)
+	assert.Equal(t, "two", restored[1].Title)
+	assert.True(t, utcMonth(2023, time.September).Add(48*time.Hour).Equal(restored[1].Timestamp))
+	assert.Empty(t, repo.inDefault)
+}
+
+func TestVisitsArchiver_ArchiveAgain(t *testing.T) {
+	ctx := context.Background()
+	august := utcMonth(2023, time.August)
+	repo := newPartitionsRepoMock()
+	repo.partitions[august] = []*Visit{
+		{Id: 1, URL: "https://one.com", Timestamp: august.Add(time.Hour)},
+		{Id: 2, URL: "https://two.com", Timestamp: august.Add(48 * time.Hour)},
+	}
+
+	archiver, err := NewVisitsArchiver(repo, t.TempDir())
+	require.NoError(t, err)
+
+	now := time.Date(2024, time.September, 3, 0, 0, 0, 0, time.UTC)
+	_, err = archiver.ArchiveOlderThan(ctx, now, 12, false)
+	require.NoError(t, err)
+	assert.Empty(t, repo.partitions)
+
+	// an imported visit of the archived month lands in the default partition, and gets its month
+	// partition again
+	_, err = repo.RestoreVisits(ctx, DefaultVisitsSchema, []*Visit{
+		{Id: 3, URL: "https://imported.com", Timestamp: august.Add(24 * time.Hour)},
+	})
+	require.NoError(t, err)
+	_, _, err = repo.CreateVisitPartition(ctx, august)
+	require.NoError(t, err)
+
+	archived, err := archiver.ArchiveOlderThan(ctx, now, 12, false)
+	require.NoError(t, err)
+	require.Len(t, archived, 1)
+	assert.Equal(t, 1, archived[0].Visits)
+
+	// the month archived before is kept, with the new visit added
+	visits, err := archiver.readArchive(august)
+	require.NoError(t, err)
+	require.Len(t, visits, 3)
+	assert.Equal(t, []int{1, 3, 2}, []int{visits[0].Id, visits[1].Id, visits[2].Id})
+
+	// restored and archived again, the visits are not duplicated
+	_, err = archiver.Restore(ctx, august)
+	require.NoError(t, err)
+	_, err = archiver.ArchiveOlderThan(ctx, now, 12, false)
+	require.NoError(t, err)
+	visits, err = archiver.readArchive(august)
+	require.NoError(t, err)
+	assert.Len(t, visits, 3)
+}
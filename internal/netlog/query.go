@@ -0,0 +1,546 @@
+package netlog
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// netlog search query language:
+//
+//	word                 bare term, matched against the default field (url or title)
+//	"exact phrase"       quoted term, may contain spaces and commas
+//	host:github.com      visits to github.com and its subdomains
+//	domain:bbc.co.uk     visits to the registered domain, see registeredDomainOf
+//	url:/docs            url contains
+//	title:"some title"   title contains
+//	device:iphone        device equals (case-insensitive)
+//	source:safari        source equals (case-insensitive)
+//	after:2025-01-01     visits on or after the given date (or RFC3339 time)
+//	before:2025-01-01    visits before the given date (or RFC3339 time)
+//	tag:golang           annotated visits with the tag (case-insensitive)
+//	is:starred           starred visits
+//	is:readlater         visits in the read later queue
+//	-term                negation, works for any term or group
+//	a OR b, a | b        either of the terms
+//	(a OR b) c           grouping
+//
+// Terms separated by whitespace (or commas, for the older clients) are AND-ed.
+// OR binds tighter than the implicit AND, so `a b OR c` means `a AND (b OR c)`.
+
+var ErrInvalidSearchQuery = errors.New("invalid search query")
+
+const (
+	queryFieldURL    = "url"
+	queryFieldTitle  = "title"
+	queryFieldHost   = "host"
+	queryFieldDomain = "domain"
+	queryFieldDevice = "device"
+	queryFieldSource = "source"
+	queryFieldBefore = "before"
+	queryFieldAfter  = "after"
+	queryFieldTag    = "tag"
+	queryFieldIs     = "is"
+
+	queryIsStarred   = "starred"
+	queryIsReadLater = "readlater"
+)
+
+var knownQueryFields = map[string]bool{
+	queryFieldURL:    true,
+	queryFieldTitle:  true,
+	queryFieldHost:   true,
+	queryFieldDomain: true,
+	queryFieldDevice: true,
+	queryFieldSource: true,
+	queryFieldBefore: true,
+	queryFieldAfter:  true,
+	queryFieldTag:    true,
+	queryFieldIs:     true,
+}
+
+// SearchQuery is a parsed netlog search query, compiled into a parameterized
+// SQL WHERE clause by the repo, or matched in memory against a visit.
+type SearchQuery struct {
+	root queryNode
+}
+
+// NewSearchQuery parses the raw query. Bare terms are matched against the
+// defaultField (url or title). If source is not "all", the query is additionally
+// restricted to visits from the given source.
+func NewSearchQuery(raw, defaultField, source string) (*SearchQuery, error) {
+	if defaultField != queryFieldURL && defaultField != queryFieldTitle {
+		return nil, fmt.Errorf("%w: unknown field name: %s", ErrInvalidSearchQuery, defaultField)
+	}
+
+	p := &queryParser{
+		tokens:       lexQuery(raw),
+		defaultField: defaultField,
+	}
+	root, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSearchQuery, err)
+	}
+
+	if source != "" && source != "all" {
+		sourceNode := &termNode{field: queryFieldSource, value: source}
+		switch r := root.(type) {
+		case nil:
+			root = sourceNode
+		case andNode:
+			root = append(r, sourceNode)
+		default:
+			root = andNode{root, sourceNode}
+		}
+	}
+
+	return &SearchQuery{root: root}, nil
+}
+
+// MustNewSearchQuery is like NewSearchQuery, but panics on error.
+// Meant to be used with static, known-to-be-valid queries.
+func MustNewSearchQuery(raw, defaultField, source string) *SearchQuery {
+	q, err := NewSearchQuery(raw, defaultField, source)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// IsEmpty returns true if the query matches all visits.
+func (q *SearchQuery) IsEmpty() bool {
+	return q == nil || q.root == nil
+}
+
+// Matches reports whether the visit satisfies the query.
+func (q *SearchQuery) Matches(visit *Visit) bool {
+	if q.IsEmpty() {
+		return true
+	}
+	return q.root.matches(visit)
+}
+
+// String returns the SQL condition of the query, used in logs and traces.
+func (q *SearchQuery) String() string {
+	cond, _ := q.whereCondition(0)
+	return cond
+}
+
+// whereCondition compiles the query into an SQL condition (without the WHERE keyword),
+// with placeholders numbered after argsOffset, and the list of matching arguments.
+// For an empty query, an empty condition is returned.
+func (q *SearchQuery) whereCondition(argsOffset int) (string, []any) {
+	if q.IsEmpty() {
+		return "", nil
+	}
+	b := &sqlArgs{offset: argsOffset}
+	return q.root.sql(b), b.args
+}
+
+// whereClause is like whereCondition, but prepends the WHERE keyword if needed.
+func (q *SearchQuery) whereClause(argsOffset int) (string, []any) {
+	cond, args := q.whereCondition(argsOffset)
+	if cond == "" {
+		return "", nil
+	}
+	return "WHERE " + cond, args
+}
+
+type sqlArgs struct {
+	offset int
+	args   []any
+}
+
+// add stores the arg and returns its placeholder
+func (b *sqlArgs) add(arg any) string {
+	b.args = append(b.args, arg)
+	return fmt.Sprintf("$%d", b.offset+len(b.args))
+}
+
+type queryNode interface {
+	sql(b *sqlArgs) string
+	matches(v *Visit) bool
+}
+
+type andNode []queryNode
+
+func (n andNode) sql(b *sqlArgs) string {
+	parts := make([]string, 0, len(n))
+	for _, child := range n {
+		parts = append(parts, child.sql(b))
+	}
+	return "(" + strings.Join(parts, " AND ") + ")"
+}
+
+func (n andNode) matches(v *Visit) bool {
+	for _, child := range n {
+		if !child.matches(v) {
+			return false
+		}
+	}
+	return true
+}
+
+type orNode []queryNode
+
+func (n orNode) sql(b *sqlArgs) string {
+	parts := make([]string, 0, len(n))
+	for _, child := range n {
+		parts = append(parts, child.sql(b))
+	}
+	return "(" + strings.Join(parts, " OR ") + ")"
+}
+
+func (n orNode) matches(v *Visit) bool {
+	for _, child := range n {
+		if child.matches(v) {
+			return true
+		}
+	}
+	return false
+}
+
+type notNode struct {
+	node queryNode
+}
+
+func (n notNode) sql(b *sqlArgs) string {
+	return "NOT " + n.node.sql(b)
+}
+
+func (n notNode) matches(v *Visit) bool {
+	return !n.node.matches(v)
+}
+
+type termNode struct {
+	field string
+	value string
+	time  time.Time // set for before/after terms
+}
+
+func (n *termNode) sql(b *sqlArgs) string {
+	switch n.field {
+	case queryFieldTitle:
+		return fmt.Sprintf("COALESCE(title, '') ILIKE %s", b.add(likeContains(n.value)))
+	case queryFieldHost:
+		return fmt.Sprintf("url ~* %s", b.add(hostRegex(n.value)))
+	case queryFieldDomain:
+		return fmt.Sprintf("registered_domain = %s", b.add(strings.ToLower(n.value)))
+	case queryFieldDevice:
+		return fmt.Sprintf("LOWER(COALESCE(device, '')) = %s", b.add(strings.ToLower(n.value)))
+	case queryFieldSource:
+		return fmt.Sprintf("LOWER(COALESCE(source, '')) = %s", b.add(strings.ToLower(n.value)))
+	case queryFieldBefore:
+		return fmt.Sprintf("timestamp < %s", b.add(n.time))
+	case queryFieldAfter:
+		return fmt.Sprintf("timestamp >= %s", b.add(n.time))
+	case queryFieldTag:
+		return annotationExistsSQL(fmt.Sprintf("va.tags @> ARRAY[%s::text]", b.add(strings.ToLower(n.value))))
+	case queryFieldIs:
+		if n.value == queryIsReadLater {
+			return annotationExistsSQL(readLaterPendingSQL("va"))
+		}
+		return annotationExistsSQL("va.starred")
+	default:
+		return fmt.Sprintf("url ILIKE %s", b.add(likeContains(n.value)))
+	}
+}
+
+func (n *termNode) matches(v *Visit) bool {
+	switch n.field {
+	case queryFieldTitle:
+		return containsFold(v.Title, n.value)
+	case queryFieldHost:
+		parsedURL, err := url.Parse(v.URL)
+		if err != nil {
+			return false
+		}
+		host := strings.ToLower(parsedURL.Hostname())
+		want := strings.ToLower(n.value)
+		return host == want || strings.HasSuffix(host, "."+want)
+	case queryFieldDomain:
+		_, _, registeredDomain := canonicalizeURL(v.URL)
+		return registeredDomain != "" && registeredDomain == strings.ToLower(n.value)
+	case queryFieldDevice:
+		return strings.EqualFold(v.Device, n.value)
+	case queryFieldSource:
+		return strings.EqualFold(v.Source, n.value)
+	case queryFieldBefore:
+		return v.Timestamp.Before(n.time)
+	case queryFieldAfter:
+		return !v.Timestamp.Before(n.time)
+	case queryFieldTag:
+		return v.Annotation != nil && slices.Contains(v.Annotation.Tags, strings.ToLower(n.value))
+	case queryFieldIs:
+		if v.Annotation == nil {
+			return false
+		}
+		if n.value == queryIsReadLater {
+			return v.Annotation.ReadLater
+		}
+		return v.Annotation.Starred
+	default:
+		return containsFold(v.URL, n.value)
+	}
+}
+
+// annotationExistsSQL makes a condition on the annotation of the visit, which is not there for most visits
+func annotationExistsSQL(cond string) string {
+	return "EXISTS (SELECT 1 FROM netlog.visit_annotation va WHERE va.visit_id = id AND " + cond + ")"
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// likeContains makes a LIKE pattern which matches values containing s
+func likeContains(s string) string {
+	return "%" + likeEscaper.Replace(s) + "%"
+}
+
+// hostRegex makes a (case-insensitive) POSIX regex matching URLs of the given host and its subdomains
+func hostRegex(host string) string {
+	return `^[a-z][a-z0-9+.-]*://([^/?#@]*@)?([^/?#@]*\.)?` + regexp.QuoteMeta(host) + `(:[0-9]+)?([/?#]|$)`
+}
+
+type tokenKind int
+
+const (
+	tokenTerm tokenKind = iota
+	tokenOr
+	tokenNot
+	tokenLParen
+	tokenRParen
+)
+
+type queryToken struct {
+	kind tokenKind
+	// for term tokens
+	field string
+	value string
+}
+
+func isQuerySeparator(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ','
+}
+
+func lexQuery(input string) []queryToken {
+	var tokens []queryToken
+	pos := 0
+	for pos < len(input) {
+		c := input[pos]
+		switch {
+		case isQuerySeparator(c):
+			pos++
+		case c == '(':
+			tokens = append(tokens, queryToken{kind: tokenLParen})
+			pos++
+		case c == ')':
+			tokens = append(tokens, queryToken{kind: tokenRParen})
+			pos++
+		case c == '|':
+			tokens = append(tokens, queryToken{kind: tokenOr})
+			pos++
+		case c == '-' && pos+1 < len(input) && !isQuerySeparator(input[pos+1]):
+			tokens = append(tokens, queryToken{kind: tokenNot})
+			pos++
+		default:
+			var token queryToken
+			token, pos = lexTerm(input, pos)
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// lexTerm reads a single term starting at pos, and returns it with the position after it.
+// Quoted parts are taken verbatim; a field prefix is only recognized before the first quote.
+func lexTerm(input string, pos int) (queryToken, int) {
+	var sb strings.Builder
+	firstQuoteAt := -1
+	for pos < len(input) {
+		c := input[pos]
+		if c == '"' {
+			if firstQuoteAt < 0 {
+				firstQuoteAt = sb.Len()
+			}
+			pos++
+			end := strings.IndexByte(input[pos:], '"')
+			if end < 0 {
+				// unterminated quote - take the rest of the input
+				sb.WriteString(input[pos:])
+				pos = len(input)
+				break
+			}
+			sb.WriteString(input[pos : pos+end])
+			pos += end + 1
+			continue
+		}
+		if isQuerySeparator(c) || c == '(' || c == ')' {
+			break
+		}
+		sb.WriteByte(c)
+		pos++
+	}
+
+	text := sb.String()
+	if firstQuoteAt < 0 && text == "OR" {
+		return queryToken{kind: tokenOr}, pos
+	}
+
+	unquotedPrefix := text
+	if firstQuoteAt >= 0 {
+		unquotedPrefix = text[:firstQuoteAt]
+	}
+	if colonIdx := strings.IndexByte(unquotedPrefix, ':'); colonIdx > 0 {
+		field := strings.ToLower(unquotedPrefix[:colonIdx])
+		if knownQueryFields[field] {
+			return queryToken{kind: tokenTerm, field: field, value: text[colonIdx+1:]}, pos
+		}
+	}
+
+	return queryToken{kind: tokenTerm, value: text}, pos
+}
+
+type queryParser struct {
+	tokens       []queryToken
+	pos          int
+	defaultField string
+}
+
+func (p *queryParser) peek() *queryToken {
+	if p.pos >= len(p.tokens) {
+		return nil
+	}
+	return &p.tokens[p.pos]
+}
+
+func (p *queryParser) parse() (queryNode, error) {
+	node, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t != nil {
+		// the only way to stop before the end is an unmatched closing paren
+		return nil, errors.New("unexpected ')'")
+	}
+	return node, nil
+}
+
+// parseAnd parses a sequence of (implicitly AND-ed) expressions, until the end or a closing paren
+func (p *queryParser) parseAnd() (queryNode, error) {
+	var nodes andNode
+	for t := p.peek(); t != nil && t.kind != tokenRParen; t = p.peek() {
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+
+	switch len(nodes) {
+	case 0:
+		return nil, nil
+	case 1:
+		return nodes[0], nil
+	default:
+		return nodes, nil
+	}
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	first, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := orNode{first}
+	for t := p.peek(); t != nil && t.kind == tokenOr; t = p.peek() {
+		p.pos++
+		next, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, next)
+	}
+
+	if len(nodes) == 1 {
+		return first, nil
+	}
+	return nodes, nil
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, errors.New("unexpected end of query")
+	}
+	p.pos++
+
+	switch t.kind {
+	case tokenNot:
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{node: node}, nil
+	case tokenLParen:
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.peek(); closing == nil || closing.kind != tokenRParen {
+			return nil, errors.New("missing ')'")
+		}
+		p.pos++
+		if node == nil {
+			return nil, errors.New("empty group")
+		}
+		return node, nil
+	case tokenOr:
+		return nil, errors.New("unexpected OR")
+	case tokenRParen:
+		return nil, errors.New("unexpected ')'")
+	default:
+		return p.termNode(t)
+	}
+}
+
+func (p *queryParser) termNode(t *queryToken) (queryNode, error) {
+	field := t.field
+	if field == "" {
+		field = p.defaultField
+	} else if t.value == "" {
+		return nil, fmt.Errorf("empty value for %s", field)
+	}
+
+	node := &termNode{field: field, value: t.value}
+	if field == queryFieldBefore || field == queryFieldAfter {
+		parsed, err := parseQueryTime(t.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s time %q, use YYYY-MM-DD or RFC3339", field, t.value)
+		}
+		node.time = parsed
+	}
+	if field == queryFieldIs {
+		node.value = strings.ToLower(t.value)
+		if node.value != queryIsStarred && node.value != queryIsReadLater {
+			return nil, fmt.Errorf("unknown is:%s, use is:%s or is:%s", t.value, queryIsStarred, queryIsReadLater)
+		}
+	}
+
+	return node, nil
+}
+
+func parseQueryTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,209 @@
+package netlog
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSearchQuery_whereCondition(t *testing.T) {
+	jan1 := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		raw          string
+		field        string
+		source       string
+		expectedCond string
+		expectedArgs []any
+	}{
+		"empty": {
+			raw: "", field: "url", source: "all",
+			expectedCond: "",
+		},
+		"only source": {
+			raw: "", field: "url", source: "chrome",
+			expectedCond: "LOWER(COALESCE(source, '')) = $1",
+			expectedArgs: []any{"chrome"},
+		},
+		"single keyword": {
+			raw: "word1", field: "url", source: "chrome",
+			expectedCond: "(url ILIKE $1 AND LOWER(COALESCE(source, '')) = $2)",
+			expectedArgs: []any{"%word1%", "chrome"},
+		},
+		"single keyword title": {
+			raw: "word1", field: "title", source: "all",
+			expectedCond: "COALESCE(title, '') ILIKE $1",
+			expectedArgs: []any{"%word1%"},
+		},
+		"comma separated keywords": {
+			raw: "word1,word2,word3", field: "url", source: "all",
+			expectedCond: "(url ILIKE $1 AND url ILIKE $2 AND url ILIKE $3)",
+			expectedArgs: []any{"%word1%", "%word2%", "%word3%"},
+		},
+		"negation": {
+			raw: "word1 -word2", field: "url", source: "all",
+			expectedCond: "(url ILIKE $1 AND NOT url ILIKE $2)",
+			expectedArgs: []any{"%word1%", "%word2%"},
+		},
+		"fields": {
+			raw: `host:github.com title:"exact phrase" device:iPhone`, field: "url", source: "all",
+			expectedCond: "(url ~* $1 AND COALESCE(title, '') ILIKE $2 AND LOWER(COALESCE(device, '')) = $3)",
+			expectedArgs: []any{hostRegex("github.com"), "%exact phrase%", "iphone"},
+		},
+		"domain": {
+			raw: "domain:BBC.co.uk", field: "url", source: "all",
+			expectedCond: "registered_domain = $1",
+			expectedArgs: []any{"bbc.co.uk"},
+		},
+		"annotations": {
+			raw: "tag:GoLang is:Starred -is:readlater", field: "url", source: "all",
+			expectedCond: "(" + annotationExistsSQL("va.tags @> ARRAY[$1::text]") + " AND " + annotationExistsSQL("va.starred") +
+				" AND NOT " + annotationExistsSQL(readLaterPendingSQL("va")) + ")",
+			expectedArgs: []any{"golang"},
+		},
+		"time range": {
+			raw: "after:2025-01-01 before:2025-02-01T10:00:00Z", field: "url", source: "all",
+			expectedCond: "(timestamp >= $1 AND timestamp < $2)",
+			expectedArgs: []any{jan1, time.Date(2025, 2, 1, 10, 0, 0, 0, time.UTC)},
+		},
+		"or binds tighter than and": {
+			raw: "a b OR c | d", field: "url", source: "all",
+			expectedCond: "(url ILIKE $1 AND (url ILIKE $2 OR url ILIKE $3 OR url ILIKE $4))",
+			expectedArgs: []any{"%a%", "%b%", "%c%", "%d%"},
+		},
+		"negated group": {
+			raw: "-(host:a.com OR host:b.com) go", field: "title", source: "all",
+			expectedCond: "(NOT (url ~* $1 OR url ~* $2) AND COALESCE(title, '') ILIKE $3)",
+			expectedArgs: []any{hostRegex("a.com"), hostRegex("b.com"), "%go%"},
+		},
+		"like wildcards are escaped": {
+			raw: `100%_off`, field: "url", source: "all",
+			expectedCond: "url ILIKE $1",
+			expectedArgs: []any{`%100\%\_off%`},
+		},
+		"sql is never inlined": {
+			raw: `'; DROP TABLE netlog.visit;`, field: "url", source: "' OR 1=1 --",
+			expectedCond: "(url ILIKE $1 AND url ILIKE $2 AND url ILIKE $3 AND url ILIKE $4 AND LOWER(COALESCE(source, '')) = $5)",
+			expectedArgs: []any{"%';%", "%DROP%", "%TABLE%", "%netlog.visit;%", "' or 1=1 --"},
+		},
+		"unknown field prefix is a plain keyword": {
+			raw: "test:url", field: "url", source: "all",
+			expectedCond: "url ILIKE $1",
+			expectedArgs: []any{"%test:url%"},
+		},
+		"quoted field prefix is a plain keyword": {
+			raw: `"host:x"`, field: "url", source: "all",
+			expectedCond: "url ILIKE $1",
+			expectedArgs: []any{"%host:x%"},
+		},
+		"dash inside a word": {
+			raw: "foo-bar", field: "url", source: "all",
+			expectedCond: "url ILIKE $1",
+			expectedArgs: []any{"%foo-bar%"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			query, err := NewSearchQuery(tc.raw, tc.field, tc.source)
+			require.NoError(t, err)
+
+			cond, args := query.whereCondition(0)
+			assert.Equal(t, tc.expectedCond, cond)
+			assert.Equal(t, tc.expectedArgs, args)
+		})
+	}
+}
+
+func TestSearchQuery_whereClause_argsOffset(t *testing.T) {
+	query := MustNewSearchQuery("a b", "url", "all")
+	where, args := query.whereClause(2)
+	assert.Equal(t, "WHERE (url ILIKE $3 AND url ILIKE $4)", where)
+	assert.Len(t, args, 2)
+
+	var nilQuery *SearchQuery
+	where, args = nilQuery.whereClause(0)
+	assert.Empty(t, where)
+	assert.Empty(t, args)
+	assert.True(t, nilQuery.IsEmpty())
+}
+
+func TestNewSearchQuery_errors(t *testing.T) {
+	for _, tc := range []struct {
+		raw   string
+		field string
+	}{
+		{raw: "a", field: "device"},
+		{raw: "(a OR b", field: "url"},
+		{raw: "a OR b)", field: "url"},
+		{raw: "OR a", field: "url"},
+		{raw: "a OR", field: "url"},
+		{raw: "()", field: "url"},
+		{raw: "host:", field: "url"},
+		{raw: "before:yesterday", field: "url"},
+		{raw: "is:read", field: "url"},
+		{raw: "tag:", field: "url"},
+	} {
+		t.Run(tc.raw, func(t *testing.T) {
+			query, err := NewSearchQuery(tc.raw, tc.field, "all")
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, ErrInvalidSearchQuery))
+			assert.Nil(t, query)
+		})
+	}
+}
+
+func TestSearchQuery_Matches(t *testing.T) {
+	visit := &Visit{
+		Title:     "Go Generics Explained",
+		Source:    "Chrome",
+		Device:    "mb-serj",
+		URL:       "https://blog.github.com/2025/go?ref=x",
+		Timestamp: time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC),
+	}
+
+	for raw, expected := range map[string]bool{
+		"":                           true,
+		"github":                     true,
+		"GITHUB":                     true,
+		"gitlab":                     false,
+		"host:github.com":            true,
+		"host:blog.github.com":       true,
+		"host:hub.com":               false,
+		"domain:github.com":          true,
+		"domain:blog.github.com":     false,
+		"title:generics":             true,
+		`title:"generics explained"`: true,
+		`title:"explained generics"`: false,
+		"device:MB-SERJ":             true,
+		"device:mb":                  false,
+		"source:chrome":              true,
+		"after:2025-03-01":           true,
+		"after:2025-03-11":           false,
+		"before:2025-03-11":          true,
+		"before:2025-03-10":          false,
+		"-github":                    false,
+		"gitlab OR github":           true,
+		"-(gitlab OR bitbucket) go":  true,
+		"go -host:github.com":        false,
+	} {
+		t.Run(raw, func(t *testing.T) {
+			query, err := NewSearchQuery(raw, "url", "all")
+			require.NoError(t, err)
+			assert.Equal(t, expected, query.Matches(visit))
+		})
+	}
+
+	// the annotation terms need the annotation of the visit
+	assert.False(t, MustNewSearchQuery("is:starred", "url", "all").Matches(visit))
+	visit.Annotation = &VisitAnnotation{Starred: true, Tags: []string{"golang"}}
+	assert.True(t, MustNewSearchQuery("is:starred tag:GoLang", "url", "all").Matches(visit))
+	assert.False(t, MustNewSearchQuery("is:readlater", "url", "all").Matches(visit))
+	assert.False(t, MustNewSearchQuery("tag:rust", "url", "all").Matches(visit))
+
+	assert.False(t, MustNewSearchQuery("", "url", "safari").Matches(visit))
+	assert.True(t, MustNewSearchQuery("", "url", "chrome").Matches(visit))
+}
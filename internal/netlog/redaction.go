@@ -0,0 +1,266 @@
+package netlog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"sync/atomic"
+)
+
+// RedactionRules are the privacy rules applied to the netlog visits before they are stored.
+//
+// A host pattern matches the host and all its subdomains (e.g. "bank.com" matches "www.bank.com"), and
+// can have the path.Match wildcards (e.g. "*.bank.*"). A query param pattern is a param name, or a name
+// prefix ending with * (e.g. "utm_*"), both case-insensitive.
+type RedactionRules struct {
+	// DropHosts are the hosts the visits to which are not stored at all
+	DropHosts []string
+	// StripQueryParams are removed from the url query, and from the fragment if it is a query too,
+	// as the OAuth tokens sometimes are
+	StripQueryParams []string
+	// HashPathHosts are the sensitive hosts the url path and query of which are replaced by their hash,
+	// so the visits to the same page can still be grouped
+	HashPathHosts []string
+	// TruncatePathHosts are the sensitive hosts the url of which is truncated to the host
+	TruncatePathHosts []string
+}
+
+// redactedPathPrefix is the path prefix of the hashed url paths
+const redactedPathPrefix = "/redacted/"
+
+type redactionRuleSet struct {
+	dropHosts         []string
+	stripParams       []string
+	hashPathHosts     []string
+	truncatePathHosts []string
+}
+
+// Redactor applies the redaction rules to the visits. The rules can be replaced with Update while in use.
+type Redactor struct {
+	rules atomic.Pointer[redactionRuleSet]
+}
+
+// NewRedactor returns a redactor without any rules, use Update to set them
+func NewRedactor() *Redactor {
+	r := &Redactor{}
+	r.rules.Store(&redactionRuleSet{})
+	return r
+}
+
+// Update validates the rules and replaces the current ones with them. The current rules are kept if
+// the new ones are invalid.
+func (r *Redactor) Update(rules RedactionRules) error {
+	ruleSet, err := compileRedactionRules(rules)
+	if err != nil {
+		return err
+	}
+	r.rules.Store(ruleSet)
+	return nil
+}
+
+func compileRedactionRules(rules RedactionRules) (*redactionRuleSet, error) {
+	hostPatterns := func(name string, patterns []string) ([]string, error) {
+		var compiled []string
+		for _, p := range patterns {
+			p = strings.ToLower(strings.TrimSpace(p))
+			if p == "" {
+				return nil, fmt.Errorf("%s: empty host pattern", name)
+			}
+			if _, err := path.Match(p, ""); err != nil {
+				return nil, fmt.Errorf("%s: host pattern [%s]: %w", name, p, err)
+			}
+			compiled = append(compiled, p)
+		}
+		return compiled, nil
+	}
+
+	ruleSet := &redactionRuleSet{}
+	var err error
+	if ruleSet.dropHosts, err = hostPatterns("drop hosts", rules.DropHosts); err != nil {
+		return nil, err
+	}
+	if ruleSet.hashPathHosts, err = hostPatterns("hash path hosts", rules.HashPathHosts); err != nil {
+		return nil, err
+	}
+	if ruleSet.truncatePathHosts, err = hostPatterns("truncate path hosts", rules.TruncatePathHosts); err != nil {
+		return nil, err
+	}
+
+	for _, p := range rules.StripQueryParams {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" || p == "*" {
+			return nil, errors.New("strip query params: empty param pattern")
+		}
+		ruleSet.stripParams = append(ruleSet.stripParams, p)
+	}
+
+	return ruleSet, nil
+}
+
+// Redact applies the rules to the visit url and title, and returns true if the visit is to be dropped
+// instead. The urls that can't be parsed, e.g. with a bad escape, are redacted too, with their host
+// taken from the raw url.
+func (r *Redactor) Redact(visit *Visit) (drop bool) {
+	rules := r.rules.Load()
+
+	u := splitVisitURL(visit.URL)
+	if u.hostname != "" {
+		if matchesAnyHost(u.hostname, rules.dropHosts) {
+			return true
+		}
+
+		// the title of a sensitive page usually tells as much as its path
+		if matchesAnyHost(u.hostname, rules.truncatePathHosts) {
+			visit.URL = u.scheme + "://" + u.host + "/"
+			visit.Title = u.hostname
+			return false
+		}
+		if matchesAnyHost(u.hostname, rules.hashPathHosts) {
+			visit.Title = u.hostname
+			// already redacted, e.g. when the rules are applied to the stored visits again
+			if strings.HasPrefix(u.path, redactedPathPrefix) && u.rawQuery == "" && u.fragment == "" {
+				return false
+			}
+			hash := sha256.Sum256([]byte(u.path + "?" + u.rawQuery))
+			visit.URL = u.scheme + "://" + u.host + redactedPathPrefix + hex.EncodeToString(hash[:8])
+			return false
+		}
+	}
+
+	if len(rules.stripParams) > 0 {
+		visit.URL = stripQueryParams(visit.URL, rules.stripParams)
+	}
+
+	return false
+}
+
+// visitURLParts are the parts of the visit url the redaction rules are applied to
+type visitURLParts struct {
+	scheme string
+	// host is with the port, and hostname is the lower case host without it
+	host     string
+	hostname string
+	path     string // escaped
+	rawQuery string
+	fragment string
+}
+
+// splitVisitURL parses the url, or splits the raw url if it can't be parsed, so the secrets in the
+// invalid urls are not kept. The hostname is empty if the url has no host, e.g. about:blank.
+func splitVisitURL(rawURL string) visitURLParts {
+	if parsedURL, err := url.Parse(rawURL); err == nil && parsedURL.Host != "" {
+		return visitURLParts{
+			scheme:   parsedURL.Scheme,
+			host:     parsedURL.Host,
+			hostname: strings.ToLower(parsedURL.Hostname()),
+			path:     parsedURL.EscapedPath(),
+			rawQuery: parsedURL.RawQuery,
+			fragment: parsedURL.Fragment,
+		}
+	}
+
+	var u visitURLParts
+	scheme, rest, found := strings.Cut(rawURL, "://")
+	if !found {
+		return u
+	}
+	u.scheme = scheme
+	rest, u.fragment, _ = strings.Cut(rest, "#")
+	rest, u.rawQuery, _ = strings.Cut(rest, "?")
+	authority := rest
+	if i := strings.Index(rest, "/"); i >= 0 {
+		authority, u.path = rest[:i], rest[i:]
+	}
+	// without the user info
+	if i := strings.LastIndex(authority, "@"); i >= 0 {
+		authority = authority[i+1:]
+	}
+	u.host = authority
+
+	hostname := authority
+	if strings.HasPrefix(hostname, "[") {
+		// ipv6, e.g. [::1]:8080
+		if i := strings.Index(hostname, "]"); i >= 0 {
+			hostname = hostname[1:i]
+		}
+	} else if i := strings.LastIndex(hostname, ":"); i >= 0 {
+		hostname = hostname[:i]
+	}
+	u.hostname = strings.ToLower(hostname)
+	return u
+}
+
+// stripQueryParams removes the params from the raw url as it is, so the rest of it is not re-encoded
+func stripQueryParams(rawURL string, patterns []string) string {
+	rest, fragment, hasFragment := strings.Cut(rawURL, "#")
+	base, query, hasQuery := strings.Cut(rest, "?")
+
+	result := base
+	if hasQuery {
+		if query = stripParams(query, patterns); query != "" {
+			result += "?" + query
+		}
+	}
+	if hasFragment {
+		// e.g. #access_token=...&state=...
+		if strings.Contains(fragment, "=") {
+			fragment = stripParams(fragment, patterns)
+		}
+		if fragment != "" {
+			result += "#" + fragment
+		}
+	}
+	return result
+}
+
+func stripParams(query string, patterns []string) string {
+	var kept []string
+	for _, param := range strings.Split(query, "&") {
+		if param == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(param, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if !matchesAnyParam(strings.ToLower(name), patterns) {
+			kept = append(kept, param)
+		}
+	}
+	return strings.Join(kept, "&")
+}
+
+func matchesAnyParam(name string, patterns []string) bool {
+	for _, p := range patterns {
+		if prefix, isPrefix := strings.CutSuffix(p, "*"); isPrefix {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == p {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAnyHost(host string, patterns []string) bool {
+	for _, p := range patterns {
+		if matchesHost(host, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesHost reports whether the host is the pattern host or its subdomain, or matches the pattern wildcards
+func matchesHost(host, pattern string) bool {
+	if host == pattern || strings.HasSuffix(host, "."+pattern) {
+		return true
+	}
+	matched, _ := path.Match(pattern, host)
+	return matched
+}
@@ -0,0 +1,123 @@
+package netlog
+
+import (
+	"context"
+	"errors"
+
+	"github.com/2beens/serjtubincom/internal/telemetry/tracing"
+
+	"github.com/jackc/pgx/v5"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// GetVisitsAfterID returns at most limit visits with the ID greater than afterID, ordered by ID,
+// used to go through all the visits without loading them all at once
+func (r *Repo) GetVisitsAfterID(ctx context.Context, afterID, limit int) (_ []*Visit, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.getVisitsAfterID")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	span.SetAttributes(attribute.Int("after-id", afterID))
+	span.SetAttributes(attribute.Int("limit", limit))
+
+	rows, err := r.db.Query(
+		ctx,
+		`
+			SELECT `+visitColumnsSQL+`
+			FROM netlog.visit
+			WHERE id > $1
+			ORDER BY id
+			LIMIT $2;
+		`,
+		afterID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	visits, err := visitsFromRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("found-visits", len(visits)))
+	return visits, nil
+}
+
+// UpdateVisitsURL sets the url (with the fields derived from it) and the title of the visits, by their IDs,
+// in a single transaction
+func (r *Repo) UpdateVisitsURL(ctx context.Context, visits []*Visit) (err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.updateVisitsURL")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	span.SetAttributes(attribute.Int("visits", len(visits)))
+	if len(visits) == 0 {
+		return nil
+	}
+
+	batch := &pgx.Batch{}
+	for _, v := range visits {
+		v.DeriveURLFields()
+		batch.Queue(
+			`
+				UPDATE netlog.visit
+				SET url = $1, title = $2, host = $3, registered_domain = $4, canonical_url = $5
+				WHERE id = $6;
+			`,
+			v.URL, v.Title, v.Host, v.RegisteredDomain, v.CanonicalURL, v.Id,
+		)
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			log.Errorf("update visits url, rollback: %s", err)
+		}
+	}()
+
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// DeleteVisits deletes the visits by their IDs, with their annotations, and returns the number of deleted visits
+func (r *Repo) DeleteVisits(ctx context.Context, ids []int) (_ int, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.deleteVisits")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	span.SetAttributes(attribute.Int("visits", len(ids)))
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	// the visit table is partitioned, so the annotations can't reference the visits with a cascading foreign key
+	var deleted int
+	if err := r.db.QueryRow(
+		ctx,
+		`
+			WITH deleted AS (
+				DELETE FROM netlog.visit WHERE id = ANY($1) RETURNING id
+			), deleted_annotations AS (
+				DELETE FROM netlog.visit_annotation WHERE visit_id IN (SELECT id FROM deleted)
+			)
+			SELECT COUNT(*) FROM deleted;
+		`,
+		ids,
+	).Scan(&deleted); err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
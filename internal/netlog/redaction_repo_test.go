@@ -0,0 +1,59 @@
+//go:build all_tests
+
+package netlog
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepo_RedactVisits(t *testing.T) {
+	ctx := context.Background()
+	repo, shutdown := testRepoSetup(t)
+	defer shutdown()
+
+	addedVisits := cleanupAndAddTestVisits(ctx, t, repo)
+	require.Len(t, addedVisits, 5)
+
+	var visits []*Visit
+	afterID := 0
+	for {
+		page, err := repo.GetVisitsAfterID(ctx, afterID, 2)
+		require.NoError(t, err)
+		if len(page) == 0 {
+			break
+		}
+		assert.LessOrEqual(t, len(page), 2)
+		visits = append(visits, page...)
+		afterID = page[len(page)-1].Id
+	}
+	require.Len(t, visits, 5)
+	for i := 1; i < len(visits); i++ {
+		assert.Less(t, visits[i-1].Id, visits[i].Id)
+	}
+
+	// v1 is redacted, v2 dropped
+	v1, v2 := *addedVisits[0], addedVisits[1]
+	v1.URL = "https://www.one.com/redacted/abc"
+	v1.Title = "www.one.com"
+	require.NoError(t, repo.UpdateVisitsURL(ctx, []*Visit{&v1}))
+
+	deleted, err := repo.DeleteVisits(ctx, []int{v2.Id})
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	deleted, err = repo.DeleteVisits(ctx, []int{v2.Id})
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+
+	visits, err = repo.GetVisitsAfterID(ctx, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, visits, 4)
+	assert.Equal(t, v1.Id, visits[0].Id)
+	assert.Equal(t, "https://www.one.com/redacted/abc", visits[0].URL)
+	assert.Equal(t, "www.one.com", visits[0].Title)
+	assert.Equal(t, addedVisits[0].Timestamp.Unix(), visits[0].Timestamp.Unix())
+	assert.Equal(t, addedVisits[2].Id, visits[1].Id)
+}
@@ -0,0 +1,193 @@
+package netlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/2beens/serjtubincom/internal/telemetry/metrics"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testRedactionRules = RedactionRules{
+	DropHosts:         []string{"bank.com", "*.private.*"},
+	StripQueryParams:  []string{"utm_*", "token", "Code"},
+	HashPathHosts:     []string{"health.org"},
+	TruncatePathHosts: []string{"mail.example.com"},
+}
+
+func TestRedactor_Redact(t *testing.T) {
+	redactor := NewRedactor()
+	require.NoError(t, redactor.Update(testRedactionRules))
+
+	testCases := []struct {
+		name          string
+		url           string
+		expectedDrop  bool
+		expectedURL   string
+		expectedTitle string
+	}{
+		{"drop host", "https://bank.com/accounts", true, "", ""},
+		{"drop subdomain", "https://online.Bank.com:8443/login", true, "", ""},
+		{"drop glob", "http://docs.private.net/", true, "", ""},
+		{"not a subdomain", "https://notbank.com/", false, "https://notbank.com/", "title"},
+		{
+			"strip params", "https://shop.com/item?id=1&utm_source=x&UTM_MEDIUM=y&token=abc&code=42#top",
+			false, "https://shop.com/item?id=1#top", "title",
+		},
+		{"strip all params", "https://shop.com/?utm_source=x&token=abc", false, "https://shop.com/", "title"},
+		{"strip fragment params", "https://app.com/cb#access=1&token=abc", false, "https://app.com/cb#access=1", "title"},
+		{"keep escaped url as is", "https://shop.com/a b/č?q=a%20b&utm_x=1", false, "https://shop.com/a b/č?q=a%20b", "title"},
+		{"truncate path", "https://mail.example.com/u/0/inbox/123?token=abc#x", false, "https://mail.example.com/", "mail.example.com"},
+		{"hash path", "https://www.health.org/results/42?patient=7", false, "https://www.health.org/redacted/", "www.health.org"},
+		{"hash already hashed", "https://health.org/redacted/0123456789abcdef", false, "https://health.org/redacted/0123456789abcdef", "health.org"},
+		{"no host", "about:blank", false, "about:blank", "title"},
+		{"invalid url", "https://site.com/a%zz?token=SECRET&code=X", false, "https://site.com/a%zz", "title"},
+		{"invalid url fragment", "https://site.com/a%zz?id=1#access=1&token=abc", false, "https://site.com/a%zz?id=1#access=1", "title"},
+		{"invalid url drop host", "https://user@Online.Bank.com:8443/a%zz?token=abc", true, "", ""},
+		{"invalid url drop glob", "http://docs.private.net/%zz", true, "", ""},
+		{"invalid url truncate path", "https://mail.example.com/u/%zz?token=abc", false, "https://mail.example.com/", "mail.example.com"},
+		{"invalid url hash path", "https://health.org/results/%zz?patient=7", false, "https://health.org/redacted/", "health.org"},
+		{"invalid url no path", "https://bank.com?%zz", true, "", ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			visit := &Visit{URL: tc.url, Title: "title"}
+			drop := redactor.Redact(visit)
+			assert.Equal(t, tc.expectedDrop, drop)
+			if drop {
+				return
+			}
+			if strings.HasSuffix(tc.expectedURL, redactedPathPrefix) {
+				assert.True(t, strings.HasPrefix(visit.URL, tc.expectedURL), visit.URL)
+				assert.Len(t, visit.URL, len(tc.expectedURL)+16)
+			} else {
+				assert.Equal(t, tc.expectedURL, visit.URL)
+			}
+			assert.Equal(t, tc.expectedTitle, visit.Title)
+		})
+	}
+
+	// the same page has the same hash, and the hashing is idempotent
+	v1 := &Visit{URL: "https://health.org/results/42?patient=7"}
+	v2 := &Visit{URL: "https://health.org/results/42?patient=7"}
+	v3 := &Visit{URL: "https://health.org/results/42?patient=8"}
+	redactor.Redact(v1)
+	redactor.Redact(v2)
+	redactor.Redact(v3)
+	assert.Equal(t, v1.URL, v2.URL)
+	assert.NotEqual(t, v1.URL, v3.URL)
+	hashedURL := v1.URL
+	redactor.Redact(v1)
+	assert.Equal(t, hashedURL, v1.URL)
+}
+
+func TestRedactor_Update(t *testing.T) {
+	redactor := NewRedactor()
+
+	// no rules, nothing redacted
+	visit := &Visit{URL: "https://bank.com/?token=abc", Title: "title"}
+	assert.False(t, redactor.Redact(visit))
+	assert.Equal(t, "https://bank.com/?token=abc", visit.URL)
+
+	require.NoError(t, redactor.Update(testRedactionRules))
+	assert.True(t, redactor.Redact(visit))
+
+	// invalid rules keep the current ones
+	err := redactor.Update(RedactionRules{DropHosts: []string{"[bank.com"}})
+	assert.ErrorContains(t, err, "drop hosts")
+	assert.True(t, redactor.Redact(visit))
+	assert.Error(t, redactor.Update(RedactionRules{StripQueryParams: []string{" "}}))
+	assert.Error(t, redactor.Update(RedactionRules{TruncatePathHosts: []string{""}}))
+
+	require.NoError(t, redactor.Update(RedactionRules{}))
+	assert.False(t, redactor.Redact(visit))
+}
+
+func TestNetlogHandler_handleNewVisit_redacted(t *testing.T) {
+	repo := NewRepoMock()
+	m := metrics.NewTestManager()
+	redactor := NewRedactor()
+	require.NoError(t, redactor.Update(testRedactionRules))
+
+	r := mux.NewRouter()
+	handler := NewHandler(repo, m, "", nil, DefaultSessionIdleGap, redactor, NewVisitsBroker(nil))
+	handler.SetupRoutes(r)
+
+	postVisit := func(visitURL string) *httptest.ResponseRecorder {
+		reqBytes, err := json.Marshal(newVisitRequest{
+			Title:     "Inbox (3)",
+			Source:    "chrome",
+			Device:    "mb-serj",
+			URL:       visitURL,
+			Timestamp: time.Now().UnixMilli(),
+		})
+		require.NoError(t, err)
+		req, err := http.NewRequest("POST", "/netlog/new", bytes.NewBuffer(reqBytes))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := postVisit("https://bank.com/accounts")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "dropped", rr.Body.String())
+	assert.Len(t, repo.Visits, 2)
+
+	rr = postVisit("https://shop.com/item?id=1&utm_source=newsletter")
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	require.Len(t, repo.Visits, 3)
+	assert.Equal(t, "https://shop.com/item?id=1", repo.Visits[2].URL)
+	assert.Equal(t, "Inbox (3)", repo.Visits[2].Title)
+
+	rr = postVisit("https://mail.example.com/u/0/inbox")
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	require.Len(t, repo.Visits, 4)
+	assert.Equal(t, "https://mail.example.com/", repo.Visits[3].URL)
+	assert.Equal(t, "mail.example.com", repo.Visits[3].Title)
+}
+
+func TestNetlogHandler_handleNewVisitsBatch_redacted(t *testing.T) {
+	repo := NewRepoMock()
+	m := metrics.NewTestManager()
+	redactor := NewRedactor()
+	require.NoError(t, redactor.Update(testRedactionRules))
+
+	r := mux.NewRouter()
+	handler := NewHandler(repo, m, "", nil, DefaultSessionIdleGap, redactor, NewVisitsBroker(nil))
+	handler.SetupRoutes(r)
+
+	now := time.Now().UnixMilli()
+	body := strings.Join([]string{
+		`{"id":"a","url":"https://bank.com/accounts","timestamp":` + strconv.FormatInt(now, 10) + `}`,
+		`{"id":"b","url":"https://shop.com/?token=abc","timestamp":` + strconv.FormatInt(now, 10) + `}`,
+	}, "\n")
+	req, err := http.NewRequest("POST", "/netlog/batch", strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var resp BatchResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, 1, resp.Added)
+	assert.Equal(t, 1, resp.Dropped)
+	assert.Equal(t, BatchItemDropped, resp.Results[0].Status)
+	assert.Equal(t, BatchItemAdded, resp.Results[1].Status)
+
+	require.Len(t, repo.Visits, 3)
+	assert.Equal(t, "https://shop.com/", repo.Visits[2].URL)
+	// the dropped visit's client ID is not stored
+	assert.False(t, repo.ClientIDs["a"])
+}
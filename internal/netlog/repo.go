@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"html"
 	"strings"
 	"time"
 
@@ -23,6 +24,25 @@ type Visit struct {
 	Device    string    `json:"device"`
 	URL       string    `json:"url"`       // mandatory
 	Timestamp time.Time `json:"timestamp"` // mandatory
+	// derived from the url, see DeriveURLFields
+	Host             string `json:"host,omitempty"`
+	RegisteredDomain string `json:"registered_domain,omitempty"`
+	CanonicalURL     string `json:"canonical_url,omitempty"`
+	// set only for the visits listed with their annotations, see GetAnnotatedVisitsPage
+	Annotation *VisitAnnotation `json:"annotation,omitempty"`
+}
+
+// visitColumnsSQL are the visit table columns read by visitsFromRows
+const visitColumnsSQL = `id, COALESCE(title, ''), COALESCE(source, ''), COALESCE(device, ''), url, timestamp,
+	COALESCE(host, ''), COALESCE(registered_domain, ''), COALESCE(canonical_url, '')`
+
+// RankedVisit is a visit found by the full-text search, with its relevance
+// rank and the highlighted title and url
+type RankedVisit struct {
+	*Visit
+	Rank           float32 `json:"rank"`
+	TitleHighlight string  `json:"title_highlight"`
+	URLHighlight   string  `json:"url_highlight"`
 }
 
 var _ netlogRepo = (*Repo)(nil)
@@ -51,10 +71,17 @@ func (r *Repo) AddVisit(ctx context.Context, visit *Visit) (err error) {
 		return errors.New("visit url or timestamp empty")
 	}
 
+	visit.DeriveURLFields()
+
 	rows, err := r.db.Query(
 		ctx,
-		`INSERT INTO netlog.visit (title, source, device, url, timestamp) VALUES ($1, $2, $3, $4, $5) RETURNING id;`,
+		`
+			INSERT INTO netlog.visit (title, source, device, url, timestamp, host, registered_domain, canonical_url)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING id;
+		`,
 		visit.Title, visit.Source, visit.Device, visit.URL, visit.Timestamp,
+		visit.Host, visit.RegisteredDomain, visit.CanonicalURL,
 	)
 	if err != nil {
 		return err
@@ -76,115 +103,189 @@ func (r *Repo) AddVisit(ctx context.Context, visit *Visit) (err error) {
 	return fmt.Errorf("unexpected error, failed to insert visit: %+v", *visit)
 }
 
-func (r *Repo) GetAllVisits(ctx context.Context, fromTimestamp *time.Time) (_ []*Visit, err error) {
-	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.all")
+// BatchVisit is a visit sent in a batch, with the client generated idempotency ID.
+type BatchVisit struct {
+	ClientID string
+	Visit    *Visit
+}
+
+// AddVisitsBatch adds all the visits in a single transaction, skipping the ones with an already seen client ID.
+// The returned slice tells, for each visit in the batch, whether it was added (true) or is a duplicate (false).
+// Client IDs within the batch are expected to be unique.
+func (r *Repo) AddVisitsBatch(ctx context.Context, batch []BatchVisit) (_ []bool, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.addBatch")
 	defer func() {
 		tracing.EndSpanWithErrCheck(span, err)
 	}()
 
-	if fromTimestamp != nil {
-		span.SetAttributes(attribute.String("visit.from-time", fromTimestamp.String()))
-	} else {
-		span.SetAttributes(attribute.String("visit.from-time", "nil"))
+	span.SetAttributes(attribute.Int("batch.size", len(batch)))
+
+	clientIDs := make([]string, 0, len(batch))
+	for _, bv := range batch {
+		if bv.Visit.URL == "" || bv.Visit.Timestamp.IsZero() {
+			return nil, errors.New("visit url or timestamp empty")
+		}
+		clientIDs = append(clientIDs, bv.ClientID)
 	}
 
-	var rows pgx.Rows
-	if fromTimestamp != nil {
-		rows, err = r.db.Query(
-			ctx,
-			`
-			SELECT
-				id, COALESCE(title, '') as title, COALESCE(source, '') as source, COALESCE(device, '') as device, url, timestamp
-			FROM netlog.visit
-			WHERE timestamp >= $1;`,
-			fromTimestamp,
-		)
-	} else {
-		rows, err = r.db.Query(
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := tx.Rollback(ctx); err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+			log.Errorf("add visits batch, rollback: %s", err)
+		}
+	}()
+
+	// a concurrent batch with the same client IDs waits here until this transaction is done
+	rows, err := tx.Query(
+		ctx,
+		`
+			INSERT INTO netlog.visit_client_id (client_id)
+			SELECT unnest($1::text[])
+			ON CONFLICT (client_id) DO NOTHING
+			RETURNING client_id;
+		`,
+		clientIDs,
+	)
+	if err != nil {
+		return nil, err
+	}
+	newClientIDs, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+
+	isNew := make(map[string]bool, len(newClientIDs))
+	for _, id := range newClientIDs {
+		isNew[id] = true
+	}
+
+	added := make([]bool, len(batch))
+	var visitsRows [][]any
+	for i, bv := range batch {
+		if !isNew[bv.ClientID] {
+			continue
+		}
+		added[i] = true
+		v := bv.Visit
+		v.DeriveURLFields()
+		visitsRows = append(visitsRows, []any{
+			v.Title, v.Source, v.Device, v.URL, v.Timestamp, v.Host, v.RegisteredDomain, v.CanonicalURL,
+		})
+	}
+
+	if len(visitsRows) > 0 {
+		if _, err := tx.CopyFrom(
 			ctx,
-			`
-			SELECT
-				id, COALESCE(title, '') as title, COALESCE(source, '') as source, COALESCE(device, '') as device, url, timestamp
-			FROM netlog.visit;`,
-		)
+			pgx.Identifier{"netlog", "visit"},
+			[]string{"title", "source", "device", "url", "timestamp", "host", "registered_domain", "canonical_url"},
+			pgx.CopyFromRows(visitsRows),
+		); err != nil {
+			return nil, err
+		}
 	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("batch.added", len(visitsRows)))
+	return added, nil
+}
+
+// GetAllVisits returns the visits with the id greater than afterId (all of them with 0), ordered by the id,
+// so the backups continue from the last backed up visit no matter the visits timestamps
+func (r *Repo) GetAllVisits(ctx context.Context, afterId int) (_ []*Visit, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.all")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+	span.SetAttributes(attribute.Int("visit.after-id", afterId))
+
+	rows, err := r.db.Query(
+		ctx,
+		`
+			SELECT `+visitColumnsSQL+`
+			FROM netlog.visit
+			WHERE id > $1
+			ORDER BY id;`,
+		afterId,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	if err := rows.Err(); err != nil {
+	visits, err := visitsFromRows(rows)
+	if err != nil {
 		return nil, err
 	}
-
-	visits := visitsFromRows(rows)
 	span.SetAttributes(attribute.Int("found-visits", len(visits)))
 	return visits, nil
 }
 
-func (r *Repo) GetVisits(ctx context.Context, keywords []string, field string, source string, limit int) (_ []*Visit, err error) {
+func (r *Repo) GetVisits(ctx context.Context, query *SearchQuery, limit int) (_ []*Visit, err error) {
 	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.getVisits")
 	defer func() {
 		tracing.EndSpanWithErrCheck(span, err)
 	}()
 
-	span.SetAttributes(attribute.String("visit.source", source))
-	span.SetAttributes(attribute.String("visit.field", field))
+	span.SetAttributes(attribute.String("visit.query", query.String()))
 	span.SetAttributes(attribute.Int("limit", limit))
 
-	sbQueryLike := getQueryWhereCondition(field, source, keywords)
-	query := fmt.Sprintf(`
-		SELECT
-			id, COALESCE(title, ''), COALESCE(source, ''), COALESCE(device, '') as device, url, timestamp
+	where, args := query.whereClause(0)
+	sqlQuery := fmt.Sprintf(`
+		SELECT `+visitColumnsSQL+`
 		FROM netlog.visit
 		%s
 		ORDER BY id DESC
-		LIMIT $1;
-	`, sbQueryLike)
+		LIMIT $%d;
+	`, where, len(args)+1)
 
 	rows, err := r.db.Query(
 		ctx,
-		query,
-		limit,
+		sqlQuery,
+		append(args, limit)...,
 	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	if err := rows.Err(); err != nil {
+	visits, err := visitsFromRows(rows)
+	if err != nil {
 		return nil, err
 	}
-
-	visits := visitsFromRows(rows)
 	span.SetAttributes(attribute.Int("found-visits", len(visits)))
 	return visits, nil
 }
 
 func (r *Repo) CountAll(ctx context.Context) (int, error) {
-	return r.Count(ctx, []string{}, "url", "all")
+	return r.Count(ctx, nil)
 }
 
-func (r *Repo) Count(ctx context.Context, keywords []string, field string, source string) (_ int, err error) {
+func (r *Repo) Count(ctx context.Context, query *SearchQuery) (_ int, err error) {
 	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.count")
 	defer func() {
 		tracing.EndSpanWithErrCheck(span, err)
 	}()
 
-	span.SetAttributes(attribute.String("visit.source", source))
-	span.SetAttributes(attribute.String("visit.field", field))
+	span.SetAttributes(attribute.String("visit.query", query.String()))
 
-	sbQueryLike := getQueryWhereCondition(field, source, keywords)
-	query := fmt.Sprintf(`
+	where, args := query.whereClause(0)
+	sqlQuery := fmt.Sprintf(`
 		SELECT COUNT(*)
 		FROM netlog.visit
 		%s
 		;
-	`, sbQueryLike)
+	`, where)
 
 	rows, err := r.db.Query(
 		ctx,
-		query,
+		sqlQuery,
+		args...,
 	)
 	if err != nil {
 		return -1, err
@@ -205,115 +306,304 @@ func (r *Repo) Count(ctx context.Context, keywords []string, field string, sourc
 	return -1, errors.New("unexpected error, failed to get netlog visits count")
 }
 
-func (r *Repo) GetVisitsPage(ctx context.Context, keywords []string, field string, source string, page int, size int) (_ []*Visit, err error) {
+// GetVisitsPage returns an offset based page of visits. Pages past the end are empty.
+// Deep offsets get slow on big tables, prefer GetVisitsByCursor.
+func (r *Repo) GetVisitsPage(ctx context.Context, query *SearchQuery, page int, size int) (_ []*Visit, err error) {
 	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.getVisitsPage")
 	defer func() {
 		tracing.EndSpanWithErrCheck(span, err)
 	}()
 
-	span.SetAttributes(attribute.String("visit.source", source))
-	span.SetAttributes(attribute.String("visit.field", field))
+	span.SetAttributes(attribute.String("visit.query", query.String()))
 	span.SetAttributes(attribute.Int("page", page))
 	span.SetAttributes(attribute.Int("size", size))
 
+	if page < 1 || size < 1 {
+		return []*Visit{}, nil
+	}
+
 	limit := size
 	offset := (page - 1) * size
-	allVisitsCount, err := r.CountAll(ctx)
+
+	log.Tracef("getting visits, limit %d, offset %d", limit, offset)
+
+	where, args := query.whereClause(0)
+	sqlQuery := fmt.Sprintf(`
+		SELECT `+visitColumnsSQL+`
+		FROM netlog.visit
+		%s
+		ORDER BY timestamp DESC, id DESC
+		LIMIT $%d
+		OFFSET $%d;
+	`, where, len(args)+1, len(args)+2)
+
+	rows, err := r.db.Query(
+		ctx,
+		sqlQuery,
+		append(args, limit, offset)...,
+	)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	if allVisitsCount <= limit {
-		return r.GetVisits(ctx, []string{}, field, source, size)
+	visits, err := visitsFromRows(rows)
+	if err != nil {
+		return nil, err
 	}
+	span.SetAttributes(attribute.Int("found-visits", len(visits)))
+	return visits, nil
+}
 
-	if allVisitsCount-offset < limit {
-		offset = allVisitsCount - limit
+// GetVisitsByCursor returns a keyset page of visits, ordered by (timestamp, id) descending.
+// An empty cursor returns the first (newest) page. The cursors of the returned page are
+// opaque, and empty when there is no page in that direction.
+func (r *Repo) GetVisitsByCursor(ctx context.Context, query *SearchQuery, cursor string, size int) (_ *VisitsCursorPage, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.getVisitsByCursor")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	span.SetAttributes(attribute.String("visit.query", query.String()))
+	span.SetAttributes(attribute.String("cursor", cursor))
+	span.SetAttributes(attribute.Int("size", size))
+
+	var keyset *visitsCursor
+	if cursor != "" {
+		if keyset, err = decodeVisitsCursor(cursor); err != nil {
+			return nil, err
+		}
 	}
 
-	log.Tracef("getting visits, all count %d, limit %d, offset %d", allVisitsCount, limit, offset)
+	cond, args := query.whereCondition(0)
+	var conditions []string
+	if cond != "" {
+		conditions = append(conditions, cond)
+	}
 
-	sbQueryLike := getQueryWhereCondition(field, source, keywords)
-	query := fmt.Sprintf(`
-		SELECT
-			id, COALESCE(title, ''), COALESCE(source, ''), COALESCE(device, '') as device, url, timestamp
+	order := "DESC"
+	if keyset != nil {
+		comparison := "<"
+		if keyset.direction == cursorPrev {
+			comparison = ">"
+			order = "ASC"
+		}
+		conditions = append(conditions, fmt.Sprintf("(timestamp, id) %s ($%d, $%d)", comparison, len(args)+1, len(args)+2))
+		args = append(args, keyset.timestamp, keyset.id)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	sqlQuery := fmt.Sprintf(`
+		SELECT `+visitColumnsSQL+`
 		FROM netlog.visit
 		%s
-		ORDER BY timestamp DESC
-		LIMIT $1
-		OFFSET $2;
-	`, sbQueryLike)
+		ORDER BY timestamp %s, id %s
+		LIMIT $%d;
+	`, where, order, order, len(args)+1)
 
+	// one more than asked, to know if there is a page after this one
 	rows, err := r.db.Query(
 		ctx,
-		query,
-		limit,
-		offset,
+		sqlQuery,
+		append(args, size+1)...,
 	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	if err := rows.Err(); err != nil {
+	visits, err := visitsFromRows(rows)
+	if err != nil {
 		return nil, err
 	}
 
-	visits := visitsFromRows(rows)
-	span.SetAttributes(attribute.Int("found-visits", len(visits)))
-	return visits, nil
+	page := cursorPageFromRows(visits, keyset, size)
+	span.SetAttributes(attribute.Int("found-visits", len(page.Visits)))
+	return page, nil
 }
 
-// getQueryWhereCondition will make a SQL WHERE condition
-// keywords starting with "-" will be filtered out with `url NOT LIKE ...`
-// column - the name of the column to which the "like" is applied for
-// source - the source of the netlog visit
-func getQueryWhereCondition(column, source string, keywords []string) string {
-	var sbQueryLike strings.Builder
-	if len(keywords) > 0 {
-		sbQueryLike.WriteString("WHERE ")
-		for i, word := range keywords {
-			if strings.HasPrefix(word, "-") {
-				word = strings.TrimPrefix(word, "-")
-				sbQueryLike.WriteString(fmt.Sprintf("%s NOT LIKE '%%%s%%' ", column, word))
-			} else {
-				sbQueryLike.WriteString(fmt.Sprintf("%s LIKE '%%%s%%' ", column, word))
-			}
-			if i < len(keywords)-1 {
-				sbQueryLike.WriteString("AND ")
-			}
+// EstimateCount returns an estimated visits count, without scanning the table.
+// For no query, it's the sum of the partitions row counts postgres keeps in pg_class (updated by
+// vacuum/analyze), otherwise, the number of rows the planner expects the query to return.
+func (r *Repo) EstimateCount(ctx context.Context, query *SearchQuery) (_ int, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.estimateCount")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	span.SetAttributes(attribute.String("visit.query", query.String()))
+
+	if query.IsEmpty() {
+		var estimate float64
+		if err := r.db.QueryRow(
+			ctx,
+			`
+				SELECT COALESCE(SUM(c.reltuples) FILTER (WHERE c.reltuples >= 0), -1)::float8
+				FROM pg_inherits i
+				JOIN pg_class c ON c.oid = i.inhrelid
+				WHERE i.inhparent = 'netlog.visit'::regclass;
+			`,
+		).Scan(&estimate); err != nil {
+			return -1, err
 		}
+		// -1 means no partition was vacuumed/analyzed yet
+		if estimate < 0 {
+			return r.Count(ctx, nil)
+		}
+		return int(estimate), nil
 	}
 
-	if source != "all" && len(keywords) == 0 {
-		sbQueryLike.WriteString(fmt.Sprintf("WHERE source = '%s'", source))
-	} else if source != "all" {
-		sbQueryLike.WriteString(fmt.Sprintf("AND source = '%s'", source))
+	where, args := query.whereClause(0)
+	var plan []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := r.db.QueryRow(
+		ctx,
+		fmt.Sprintf(`EXPLAIN (FORMAT JSON) SELECT 1 FROM netlog.visit %s;`, where),
+		args...,
+	).Scan(&plan); err != nil {
+		return -1, err
+	}
+	if len(plan) == 0 {
+		return -1, errors.New("unexpected error, empty netlog visits count estimate plan")
 	}
 
-	return sbQueryLike.String()
+	return int(plan[0].Plan.Rows), nil
 }
 
-func visitsFromRows(rows pgx.Rows) []*Visit {
-	var visits []*Visit
+// rankedSearchTsQuery combines the english (stemmed, for titles) and simple (verbatim, for url tokens) queries
+// built from the same websearch-style text, e.g.: golang generics -java "error handling"
+const rankedSearchTsQuery = `(websearch_to_tsquery('english', $1) || websearch_to_tsquery('simple', $1))`
+
+const (
+	highlightStart = "[[hl]]"
+	highlightStop  = "[[/hl]]"
+	// titles and urls are short, so they are highlighted as a whole, instead of in fragments
+	highlightOptions = `StartSel="` + highlightStart + `", StopSel="` + highlightStop + `", HighlightAll=true`
+)
+
+var highlightReplacer = strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>")
+
+// highlightToHTML escapes the ts_headline result (titles and urls are user data), and only then
+// turns the highlight markers into <mark> tags, so the result is safe to render as HTML
+func highlightToHTML(headline string) string {
+	return highlightReplacer.Replace(html.EscapeString(headline))
+}
+
+// SearchRanked runs a full-text search over visit titles and urls (host and path tokens),
+// ordered by relevance. The filter query is optional, and can further narrow the results (e.g. by source).
+func (r *Repo) SearchRanked(ctx context.Context, text string, filter *SearchQuery, page, size int) (_ []*RankedVisit, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.searchRanked")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	span.SetAttributes(attribute.String("visit.filter", filter.String()))
+	span.SetAttributes(attribute.Int("page", page))
+	span.SetAttributes(attribute.Int("size", size))
+
+	filterCond, filterArgs := filter.whereCondition(1)
+	if filterCond != "" {
+		filterCond = "AND " + filterCond
+	}
+
+	// ts_headline is expensive, so it's only calculated for the rows of the requested page
+	sqlQuery := fmt.Sprintf(`
+		WITH q AS (SELECT %s AS query),
+		ranked AS (
+			SELECT
+				v.id, COALESCE(v.title, '') AS title, COALESCE(v.source, '') AS source, COALESCE(v.device, '') AS device,
+				v.url, v.timestamp, COALESCE(v.host, '') AS host, COALESCE(v.registered_domain, '') AS registered_domain,
+				COALESCE(v.canonical_url, '') AS canonical_url, ts_rank(v.search_vector, q.query) AS rank
+			FROM netlog.visit v, q
+			WHERE v.search_vector @@ q.query %s
+			ORDER BY rank DESC, v.timestamp DESC
+			LIMIT $%d
+			OFFSET $%d
+		)
+		SELECT
+			ranked.id, ranked.title, ranked.source, ranked.device, ranked.url, ranked.timestamp,
+			ranked.host, ranked.registered_domain, ranked.canonical_url, ranked.rank,
+			ts_headline('english', ranked.title, q.query, $%d),
+			ts_headline('simple', ranked.url, q.query, $%d)
+		FROM ranked, q
+		ORDER BY ranked.rank DESC, ranked.timestamp DESC;
+	`, rankedSearchTsQuery, filterCond, len(filterArgs)+2, len(filterArgs)+3, len(filterArgs)+4, len(filterArgs)+4)
+
+	args := append([]any{text}, filterArgs...)
+	args = append(args, size, (page-1)*size, highlightOptions)
+
+	rows, err := r.db.Query(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var visits []*RankedVisit
 	for rows.Next() {
-		var id int
-		var title string
-		var source string
-		var device string
-		var url string
-		var timestamp time.Time
-		if err := rows.Scan(&id, &title, &source, &device, &url, &timestamp); err != nil {
-			return nil
+		visit := &Visit{}
+		rankedVisit := &RankedVisit{Visit: visit}
+		var titleHighlight, urlHighlight string
+		if err := rows.Scan(
+			&visit.Id, &visit.Title, &visit.Source, &visit.Device, &visit.URL, &visit.Timestamp,
+			&visit.Host, &visit.RegisteredDomain, &visit.CanonicalURL, &rankedVisit.Rank, &titleHighlight, &urlHighlight,
+		); err != nil {
+			return nil, err
 		}
-		visits = append(visits, &Visit{
-			Id:        id,
-			Title:     title,
-			Source:    source,
-			Device:    device,
-			URL:       url,
-			Timestamp: timestamp,
-		})
+		rankedVisit.TitleHighlight = highlightToHTML(titleHighlight)
+		rankedVisit.URLHighlight = highlightToHTML(urlHighlight)
+		visits = append(visits, rankedVisit)
 	}
-	return visits
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("found-visits", len(visits)))
+	return visits, nil
+}
+
+// CountRanked returns the total number of visits matching the full-text search (and the optional filter).
+func (r *Repo) CountRanked(ctx context.Context, text string, filter *SearchQuery) (_ int, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.countRanked")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	filterCond, filterArgs := filter.whereCondition(1)
+	if filterCond != "" {
+		filterCond = "AND " + filterCond
+	}
+
+	sqlQuery := fmt.Sprintf(`
+		SELECT COUNT(*)
+		FROM netlog.visit
+		WHERE search_vector @@ %s %s;
+	`, rankedSearchTsQuery, filterCond)
+
+	var count int
+	if err := r.db.QueryRow(ctx, sqlQuery, append([]any{text}, filterArgs...)...).Scan(&count); err != nil {
+		return -1, err
+	}
+
+	return count, nil
+}
+
+// visitsFromRows reads all the visits rows, and closes them. A scan error, or an error the rows
+// failed with while being read, is returned instead of the visits read before it
+func visitsFromRows(rows pgx.Rows) ([]*Visit, error) {
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (*Visit, error) {
+		v := &Visit{}
+		err := row.Scan(
+			&v.Id, &v.Title, &v.Source, &v.Device, &v.URL, &v.Timestamp,
+			&v.Host, &v.RegisteredDomain, &v.CanonicalURL,
+		)
+		return v, err
+	})
 }
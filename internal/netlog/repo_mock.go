@@ -3,6 +3,7 @@ package netlog
 import (
 	"context"
 	"errors"
+	"html"
 	"sort"
 	"strings"
 	"sync"
@@ -14,12 +15,28 @@ var _ netlogRepo = (*repoMock)(nil)
 type repoMock struct {
 	// visit ID to Visit
 	Visits map[int]Visit
-	mutex  sync.Mutex
+	// batch visits client IDs seen so far
+	ClientIDs map[string]bool
+	// backup run ID to BackupRun
+	BackupRuns map[string]*BackupRun
+	// visit ID to its VisitAnnotation, with ReadLater set when read
+	Annotations map[int]*VisitAnnotation
+	// category rule ID to CategoryRule
+	CategoryRules map[int]*CategoryRule
+	// period and start (RFC3339) to the stored FocusReport
+	FocusReports map[string]*FocusReport
+	mutex        sync.Mutex
 }
 
 func NewRepoMock() *repoMock {
 	repo := &repoMock{
-		Visits: map[int]Visit{},
+		Visits:      map[int]Visit{},
+		ClientIDs:   map[string]bool{},
+		BackupRuns:  map[string]*BackupRun{},
+		Annotations: map[int]*VisitAnnotation{},
+
+		CategoryRules: map[int]*CategoryRule{},
+		FocusReports:  map[string]*FocusReport{},
 	}
 
 	now := time.Now()
@@ -49,43 +66,46 @@ func (r *repoMock) AddVisit(_ context.Context, visit *Visit) error {
 
 	nextId := len(r.Visits)
 
+	visit.Id = nextId
+	visit.DeriveURLFields()
 	r.Visits[nextId] = *visit
 	return nil
 }
 
+func (r *repoMock) AddVisitsBatch(_ context.Context, batch []BatchVisit) ([]bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	added := make([]bool, len(batch))
+	for i, bv := range batch {
+		if r.ClientIDs[bv.ClientID] {
+			continue
+		}
+		r.ClientIDs[bv.ClientID] = true
+		bv.Visit.DeriveURLFields()
+		visit := *bv.Visit
+		visit.Id = len(r.Visits)
+		r.Visits[visit.Id] = visit
+		added[i] = true
+	}
+	return added, nil
+}
+
 func (r *repoMock) GetAllVisits(ctx context.Context) ([]*Visit, error) {
-	return r.GetVisits(ctx, []string{}, "url", "all", -1)
+	return r.GetVisits(ctx, nil, -1)
 }
 
-func (r *repoMock) GetVisits(_ context.Context, keywords []string, field string, source string, limit int) ([]*Visit, error) {
+func (r *repoMock) GetVisits(_ context.Context, query *SearchQuery, limit int) ([]*Visit, error) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	if field != "url" && field != "title" {
-		return nil, errors.New("unknown field name")
-	}
-
 	var foundVisits []*Visit
 	for k := range r.Visits {
 		visit := r.Visits[k]
-		if len(keywords) > 0 {
-			for _, keyword := range keywords {
-				field := visit.URL
-				if field == "title" {
-					field = visit.Title
-				}
-				if !strings.Contains(field, keyword) {
-					continue
-				}
-				if source != "all" && visit.Source != source {
-					continue
-				}
-				foundVisits = append(foundVisits, &visit)
-				break
-			}
-		} else {
-			foundVisits = append(foundVisits, &visit)
+		if !query.Matches(r.withAnnotation(k, visit)) {
+			continue
 		}
+		foundVisits = append(foundVisits, &visit)
 		if limit >= 0 && len(foundVisits) == limit {
 			break
 		}
@@ -93,6 +113,26 @@ func (r *repoMock) GetVisits(_ context.Context, keywords []string, field string,
 	return foundVisits, nil
 }
 
+func (r *repoMock) GetVisitsAfterID(_ context.Context, afterID, limit int) ([]*Visit, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var visits []*Visit
+	for id, visit := range r.Visits {
+		if id > afterID {
+			visit.Id = id
+			visits = append(visits, &visit)
+		}
+	}
+	sort.Slice(visits, func(i, j int) bool {
+		return visits[i].Id < visits[j].Id
+	})
+	if len(visits) > limit {
+		visits = visits[:limit]
+	}
+	return visits, nil
+}
+
 func (r *repoMock) CountAll(_ context.Context) (int, error) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
@@ -100,40 +140,25 @@ func (r *repoMock) CountAll(_ context.Context) (int, error) {
 	return len(r.Visits), nil
 }
 
-func (r *repoMock) Count(_ context.Context, keywords []string, field string, source string) (int, error) {
+func (r *repoMock) Count(_ context.Context, query *SearchQuery) (int, error) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	if field != "url" && field != "title" {
-		return -1, errors.New("unknown field name")
-	}
-
 	count := 0
-	for _, visit := range r.Visits {
-		for _, keyword := range keywords {
-			field := visit.URL
-			if field == "title" {
-				field = visit.Title
-			}
-			if !strings.Contains(field, keyword) {
-				continue
-			}
-			if source != "all" && visit.Source != source {
-				continue
-			}
+	for id, visit := range r.Visits {
+		if query.Matches(r.withAnnotation(id, visit)) {
 			count++
-			break
 		}
 	}
 	return count, nil
 }
 
-func (r *repoMock) GetVisitsPage(ctx context.Context, keywords []string, field string, source string, page int, size int) ([]*Visit, error) {
+func (r *repoMock) GetVisitsPage(ctx context.Context, query *SearchQuery, page int, size int) ([]*Visit, error) {
 	if len(r.Visits) <= size {
 		return r.GetAllVisits(ctx)
 	}
 
-	foundVisits, err := r.GetVisits(ctx, keywords, field, source, -1)
+	foundVisits, err := r.GetVisits(ctx, query, -1)
 	if err != nil {
 		return nil, err
 	}
@@ -164,3 +189,551 @@ func (r *repoMock) GetVisitsPage(ctx context.Context, keywords []string, field s
 	}
 	return visits, nil
 }
+
+func (r *repoMock) GetVisitsByCursor(ctx context.Context, query *SearchQuery, cursor string, size int) (*VisitsCursorPage, error) {
+	var keyset *visitsCursor
+	if cursor != "" {
+		var err error
+		if keyset, err = decodeVisitsCursor(cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	foundVisits, err := r.GetVisits(ctx, query, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	// newest first, the same order as the repo uses
+	sort.Slice(foundVisits, func(i, j int) bool {
+		if foundVisits[i].Timestamp.Equal(foundVisits[j].Timestamp) {
+			return foundVisits[i].Id > foundVisits[j].Id
+		}
+		return foundVisits[i].Timestamp.After(foundVisits[j].Timestamp)
+	})
+
+	// -1 if the visit comes before (is newer than) the keyset position, 1 if after, 0 if at it
+	compareToKeyset := func(v *Visit) int {
+		ts := v.Timestamp.Truncate(time.Microsecond)
+		switch {
+		case ts.After(keyset.timestamp) || (ts.Equal(keyset.timestamp) && v.Id > keyset.id):
+			return -1
+		case ts.Before(keyset.timestamp) || v.Id < keyset.id:
+			return 1
+		}
+		return 0
+	}
+
+	var rows []*Visit
+	switch {
+	case keyset == nil:
+		rows = foundVisits
+	case keyset.direction == cursorNext:
+		for _, v := range foundVisits {
+			if compareToKeyset(v) > 0 {
+				rows = append(rows, v)
+			}
+		}
+	default:
+		// oldest first, as the repo fetches them for the previous page
+		for i := len(foundVisits) - 1; i >= 0; i-- {
+			if compareToKeyset(foundVisits[i]) < 0 {
+				rows = append(rows, foundVisits[i])
+			}
+		}
+	}
+
+	if len(rows) > size+1 {
+		rows = rows[:size+1]
+	}
+
+	return cursorPageFromRows(rows, keyset, size), nil
+}
+
+func (r *repoMock) EstimateCount(ctx context.Context, query *SearchQuery) (int, error) {
+	return r.Count(ctx, query)
+}
+
+func (r *repoMock) SearchRanked(_ context.Context, text string, filter *SearchQuery, page, size int) ([]*RankedVisit, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	found := r.rankedMatches(text, filter)
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].Rank != found[j].Rank {
+			return found[i].Rank > found[j].Rank
+		}
+		return found[i].Timestamp.After(found[j].Timestamp)
+	})
+
+	startIndex := (page - 1) * size
+	if startIndex >= len(found) {
+		return []*RankedVisit{}, nil
+	}
+	endIndex := startIndex + size
+	if endIndex > len(found) {
+		endIndex = len(found)
+	}
+	return found[startIndex:endIndex], nil
+}
+
+func (r *repoMock) CountRanked(_ context.Context, text string, filter *SearchQuery) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.rankedMatches(text, filter)), nil
+}
+
+// rankedMatches is a naive stand-in for the postgres full-text search:
+// a visit matches if it contains any of the words, and the rank is the number of matched words
+func (r *repoMock) rankedMatches(text string, filter *SearchQuery) []*RankedVisit {
+	words := strings.Fields(strings.ToLower(text))
+	var found []*RankedVisit
+	for k := range r.Visits {
+		visit := r.Visits[k]
+		if !filter.Matches(&visit) {
+			continue
+		}
+		matched := 0
+		for _, word := range words {
+			if containsFold(visit.Title, word) || containsFold(visit.URL, word) {
+				matched++
+			}
+		}
+		if matched == 0 {
+			continue
+		}
+		found = append(found, &RankedVisit{
+			Visit:          &visit,
+			Rank:           float32(matched) / float32(len(words)),
+			TitleHighlight: html.EscapeString(visit.Title),
+			URLHighlight:   html.EscapeString(visit.URL),
+		})
+	}
+	return found
+}
+
+func (r *repoMock) visitsInRange(statsRange StatsRange) []Visit {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var visits []Visit
+	for _, v := range r.Visits {
+		if !v.Timestamp.Before(statsRange.From) && v.Timestamp.Before(statsRange.To) {
+			visits = append(visits, v)
+		}
+	}
+	return visits
+}
+
+func (r *repoMock) TopHosts(_ context.Context, statsRange StatsRange, limit int) ([]HostCount, error) {
+	counts := map[string]int{}
+	for _, v := range r.visitsInRange(statsRange) {
+		if host := visitHost(v.URL); host != "" {
+			counts[host]++
+		}
+	}
+
+	hosts := []HostCount{}
+	for host, count := range counts {
+		hosts = append(hosts, HostCount{Host: host, Visits: count})
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		if hosts[i].Visits == hosts[j].Visits {
+			return hosts[i].Host < hosts[j].Host
+		}
+		return hosts[i].Visits > hosts[j].Visits
+	})
+	if len(hosts) > limit {
+		hosts = hosts[:limit]
+	}
+	return hosts, nil
+}
+
+func (r *repoMock) VisitsPerDay(_ context.Context, statsRange StatsRange) ([]DayCount, error) {
+	counts := map[time.Time]int{}
+	for _, v := range r.visitsInRange(statsRange) {
+		counts[v.Timestamp.UTC().Truncate(24*time.Hour)]++
+	}
+	return fillDayCounts(statsRange, counts), nil
+}
+
+func (r *repoMock) VisitsPerHourOfWeek(_ context.Context, statsRange StatsRange) ([]HourOfWeekCount, error) {
+	cells := emptyHourOfWeekCounts()
+	for _, v := range r.visitsInRange(statsRange) {
+		ts := v.Timestamp.UTC()
+		weekday := int(ts.Weekday())
+		if weekday == 0 {
+			weekday = 7
+		}
+		cells[hourOfWeekIndex(weekday, ts.Hour())].Visits++
+	}
+	return cells, nil
+}
+
+func (r *repoMock) SourceDeviceSplit(_ context.Context, statsRange StatsRange) ([]SourceDeviceCount, error) {
+	counts := map[SourceDeviceCount]int{}
+	for _, v := range r.visitsInRange(statsRange) {
+		counts[SourceDeviceCount{Source: v.Source, Device: v.Device}]++
+	}
+
+	split := []SourceDeviceCount{}
+	for sdc, count := range counts {
+		sdc.Visits = count
+		split = append(split, sdc)
+	}
+	sort.Slice(split, func(i, j int) bool {
+		if split[i].Visits == split[j].Visits {
+			return split[i].Source+split[i].Device < split[j].Source+split[j].Device
+		}
+		return split[i].Visits > split[j].Visits
+	})
+	return split, nil
+}
+
+func (r *repoMock) NewDomains(_ context.Context, statsRange StatsRange, limit int) ([]NewDomain, error) {
+	r.mutex.Lock()
+	firstSeen := map[string]*NewDomain{}
+	for _, v := range r.Visits {
+		host := visitHost(v.URL)
+		if host == "" || !v.Timestamp.Before(statsRange.To) {
+			continue
+		}
+		nd, ok := firstSeen[host]
+		if !ok {
+			nd = &NewDomain{Host: host, FirstSeen: v.Timestamp}
+			firstSeen[host] = nd
+		}
+		if v.Timestamp.Before(nd.FirstSeen) {
+			nd.FirstSeen = v.Timestamp
+		}
+		if !v.Timestamp.Before(statsRange.From) {
+			nd.Visits++
+		}
+	}
+	r.mutex.Unlock()
+
+	domains := []NewDomain{}
+	for _, nd := range firstSeen {
+		if !nd.FirstSeen.Before(statsRange.From) {
+			domains = append(domains, *nd)
+		}
+	}
+	sort.Slice(domains, func(i, j int) bool {
+		return domains[i].FirstSeen.After(domains[j].FirstSeen)
+	})
+	if len(domains) > limit {
+		domains = domains[:limit]
+	}
+	return domains, nil
+}
+
+func (r *repoMock) GetVisitsInRange(_ context.Context, statsRange StatsRange) ([]*Visit, error) {
+	visits := r.visitsInRange(statsRange)
+	sort.Slice(visits, func(i, j int) bool {
+		return visits[i].Timestamp.Before(visits[j].Timestamp)
+	})
+
+	result := make([]*Visit, 0, len(visits))
+	for i := range visits {
+		result = append(result, &visits[i])
+	}
+	return result, nil
+}
+
+func (r *repoMock) SaveBackupRunEvent(_ context.Context, msg *BackupIPCMessage) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	run, ok := r.BackupRuns[msg.RunId]
+	if !ok {
+		run = &BackupRun{
+			RunId:     msg.RunId,
+			Status:    BackupRunRunning,
+			StartedAt: msg.Timestamp,
+		}
+		r.BackupRuns[msg.RunId] = run
+	}
+	if run.Status != BackupRunRunning {
+		return nil
+	}
+
+	switch msg.Type {
+	case BackupIPCRunFinished:
+		run.Status = BackupRunFinished
+	case BackupIPCRunFailed:
+		run.Status = BackupRunFailed
+	}
+	if msg.Target != "" {
+		run.Target = msg.Target
+	}
+	run.UpdatedAt = msg.Timestamp
+	run.VisitsCount = msg.VisitsCount
+	run.ChunksDone = msg.ChunksDone
+	run.ChunksTotal = msg.ChunksTotal
+	run.DurationSeconds = msg.DurationSeconds
+	run.Error = msg.Error
+
+	return nil
+}
+
+func (r *repoMock) GetBackupRuns(_ context.Context, limit int) ([]*BackupRun, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	runs := make([]*BackupRun, 0, len(r.BackupRuns))
+	for _, run := range r.BackupRuns {
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+	if len(runs) > limit {
+		runs = runs[:limit]
+	}
+	return runs, nil
+}
+
+func (r *repoMock) GetLastSuccessfulBackupRun(_ context.Context) (*BackupRun, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var last *BackupRun
+	for _, run := range r.BackupRuns {
+		if run.Status == BackupRunFinished && (last == nil || run.StartedAt.After(last.StartedAt)) {
+			last = run
+		}
+	}
+	return last, nil
+}
+
+func (r *repoMock) CountFailedBackupRuns(_ context.Context, since time.Time) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	count := 0
+	for _, run := range r.BackupRuns {
+		if run.Status == BackupRunFailed && run.StartedAt.After(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *repoMock) SaveVisitAnnotation(_ context.Context, visitID int, annotation *VisitAnnotation) (*VisitAnnotation, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.Visits[visitID]; !ok {
+		return nil, ErrVisitNotFound
+	}
+	if err := normalizeAnnotation(annotation); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	saved := &VisitAnnotation{
+		Starred:   annotation.Starred,
+		Tags:      annotation.Tags,
+		Note:      annotation.Note,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	existing := r.annotationOf(visitID)
+	if existing != nil {
+		saved.CreatedAt = existing.CreatedAt
+	}
+	if annotation.ReadLater {
+		saved.ReadLaterAt = &now
+		if existing != nil && existing.ReadLater {
+			saved.ReadLaterAt = existing.ReadLaterAt
+		}
+	}
+	r.Annotations[visitID] = saved
+
+	return r.annotationOf(visitID), nil
+}
+
+func (r *repoMock) DeleteVisitAnnotation(_ context.Context, visitID int) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.Annotations[visitID]; !ok {
+		return ErrVisitAnnotationNotFound
+	}
+	delete(r.Annotations, visitID)
+	return nil
+}
+
+func (r *repoMock) GetAnnotatedVisitsPage(_ context.Context, list AnnotatedVisitsList, query *SearchQuery, page, size int) ([]*Visit, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	found := r.annotatedVisits(list, query)
+	sort.Slice(found, func(i, j int) bool {
+		if list == AnnotatedListReadLater {
+			return found[i].Annotation.ReadLaterAt.Before(*found[j].Annotation.ReadLaterAt)
+		}
+		return found[i].Annotation.UpdatedAt.After(found[j].Annotation.UpdatedAt)
+	})
+
+	startIndex := (page - 1) * size
+	if startIndex >= len(found) {
+		return []*Visit{}, nil
+	}
+	return found[startIndex:min(startIndex+size, len(found))], nil
+}
+
+func (r *repoMock) CountAnnotated(_ context.Context, list AnnotatedVisitsList, query *SearchQuery) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.annotatedVisits(list, query)), nil
+}
+
+func (r *repoMock) TagCounts(_ context.Context) ([]TagCount, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	counts := map[string]int{}
+	for _, annotation := range r.Annotations {
+		for _, tag := range annotation.Tags {
+			counts[tag]++
+		}
+	}
+
+	tagCounts := make([]TagCount, 0, len(counts))
+	for tag, count := range counts {
+		tagCounts = append(tagCounts, TagCount{Tag: tag, Visits: count})
+	}
+	sort.Slice(tagCounts, func(i, j int) bool {
+		if tagCounts[i].Visits != tagCounts[j].Visits {
+			return tagCounts[i].Visits > tagCounts[j].Visits
+		}
+		return tagCounts[i].Tag < tagCounts[j].Tag
+	})
+	return tagCounts, nil
+}
+
+func (r *repoMock) annotatedVisits(list AnnotatedVisitsList, query *SearchQuery) []*Visit {
+	var found []*Visit
+	for id := range r.Annotations {
+		visit := r.withAnnotation(id, r.Visits[id])
+		if list == AnnotatedListReadLater && !visit.Annotation.ReadLater {
+			continue
+		}
+		if query.Matches(visit) {
+			found = append(found, visit)
+		}
+	}
+	return found
+}
+
+func (r *repoMock) withAnnotation(visitID int, visit Visit) *Visit {
+	visit.Id = visitID
+	visit.Annotation = r.annotationOf(visitID)
+	return &visit
+}
+
+// annotationOf returns a copy of the visit annotation, with ReadLater set as the repo does it: until
+// the same canonical url is visited again
+func (r *repoMock) annotationOf(visitID int) *VisitAnnotation {
+	stored, ok := r.Annotations[visitID]
+	if !ok {
+		return nil
+	}
+
+	annotation := *stored
+	annotation.ReadLater = annotation.ReadLaterAt != nil
+	if annotation.ReadLater {
+		canonicalURL := CanonicalizeURL(r.Visits[visitID].URL)
+		for _, v := range r.Visits {
+			if CanonicalizeURL(v.URL) == canonicalURL && v.Timestamp.After(*annotation.ReadLaterAt) {
+				annotation.ReadLater = false
+				break
+			}
+		}
+	}
+	return &annotation
+}
+
+func (r *repoMock) GetCategoryRules(_ context.Context) ([]CategoryRule, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	rules := make([]CategoryRule, 0, len(r.CategoryRules))
+	for _, rule := range r.CategoryRules {
+		rules = append(rules, *rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].ID < rules[j].ID
+	})
+	return rules, nil
+}
+
+func (r *repoMock) SaveCategoryRule(_ context.Context, rule *CategoryRule) (*CategoryRule, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := normalizeCategoryRule(rule); err != nil {
+		return nil, err
+	}
+
+	for _, existing := range r.CategoryRules {
+		if existing.Pattern == rule.Pattern {
+			existing.Category = rule.Category
+			saved := *existing
+			return &saved, nil
+		}
+	}
+
+	nextID := 1
+	for id := range r.CategoryRules {
+		nextID = max(nextID, id+1)
+	}
+	saved := &CategoryRule{
+		ID:        nextID,
+		Pattern:   rule.Pattern,
+		Category:  rule.Category,
+		CreatedAt: time.Now(),
+	}
+	r.CategoryRules[nextID] = saved
+
+	result := *saved
+	return &result, nil
+}
+
+func (r *repoMock) DeleteCategoryRule(_ context.Context, id int) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.CategoryRules[id]; !ok {
+		return ErrCategoryRuleNotFound
+	}
+	delete(r.CategoryRules, id)
+	return nil
+}
+
+func (r *repoMock) SaveFocusReport(_ context.Context, report *FocusReport) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	saved := *report
+	r.FocusReports[string(report.Period)+"|"+report.Start.UTC().Format(time.RFC3339)] = &saved
+	return nil
+}
+
+func (r *repoMock) GetFocusReports(_ context.Context, period FocusPeriod, statsRange StatsRange) ([]*FocusReport, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var reports []*FocusReport
+	for _, report := range r.FocusReports {
+		if report.Period == period && !report.Start.Before(statsRange.From) && report.Start.Before(statsRange.To) {
+			found := *report
+			reports = append(reports, &found)
+		}
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Start.Before(reports[j].Start)
+	})
+	return reports, nil
+}
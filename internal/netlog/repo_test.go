@@ -102,30 +102,6 @@ func cleanupAndAddTestVisits(ctx context.Context, t *testing.T, repo *Repo) []*V
 	return []*Visit{v1, v2, v3, v4, v4b}
 }
 
-func TestUtil_getQueryLikeCondition(t *testing.T) {
-	// no keywords
-	queryLike := getQueryWhereCondition("url", "chrome", []string{})
-	assert.Equal(t, "WHERE source = 'chrome'", queryLike)
-
-	// only one keyword
-	keywords := []string{"word1"}
-	queryLike = getQueryWhereCondition("url", "chrome", keywords)
-	assert.Equal(t, "WHERE url LIKE '%word1%' AND source = 'chrome'", queryLike)
-
-	keywords = []string{"word1"}
-	queryLike = getQueryWhereCondition("title", "safari", keywords)
-	assert.Equal(t, "WHERE title LIKE '%word1%' AND source = 'safari'", queryLike)
-
-	// more keywords
-	keywords = []string{"word1", "word2", "word3"}
-	queryLike = getQueryWhereCondition("url", "pc", keywords)
-	assert.Equal(t, "WHERE url LIKE '%word1%' AND url LIKE '%word2%' AND url LIKE '%word3%' AND source = 'pc'", queryLike)
-
-	keywords = []string{"word1", "word2", "word3"}
-	queryLike = getQueryWhereCondition("title", "pc", keywords)
-	assert.Equal(t, "WHERE title LIKE '%word1%' AND title LIKE '%word2%' AND title LIKE '%word3%' AND source = 'pc'", queryLike)
-}
-
 func TestRepo_AddVisit(t *testing.T) {
 	ctx := context.Background()
 	repo, shutdown := testRepoSetup(t)
@@ -184,7 +160,7 @@ func TestRepo_AddVisit(t *testing.T) {
 
 	assert.Equal(t, 3, countAfter-count)
 
-	allVisits, err := repo.GetAllVisits(ctx, nil)
+	allVisits, err := repo.GetAllVisits(ctx, 0)
 	require.NoError(t, err)
 	require.Len(t, allVisits, countAfter)
 
@@ -201,6 +177,84 @@ func TestRepo_AddVisit(t *testing.T) {
 	assert.Equal(t, *foundV1, *v1)
 }
 
+func TestRepo_AddVisitsBatch(t *testing.T) {
+	ctx := context.Background()
+	repo, shutdown := testRepoSetup(t)
+	defer shutdown()
+
+	_, err := deleteAllVisits(ctx, repo)
+	require.NoError(t, err)
+	_, err = repo.db.Exec(ctx, `DELETE FROM netlog.visit_client_id`)
+	require.NoError(t, err)
+
+	now := time.Now()
+	batch := []BatchVisit{
+		{ClientID: "c1", Visit: &Visit{Title: "one", Source: "chrome", Device: "mb-serj", URL: "https://one.com", Timestamp: now}},
+		{ClientID: "c2", Visit: &Visit{Title: "two", Source: "chrome", Device: "mb-serj", URL: "https://two.com", Timestamp: now}},
+	}
+	added, err := repo.AddVisitsBatch(ctx, batch)
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true, true}, added)
+
+	// retried, with one new visit
+	batch = append(batch, BatchVisit{ClientID: "c3", Visit: &Visit{Title: "three", URL: "https://three.com", Timestamp: now}})
+	added, err = repo.AddVisitsBatch(ctx, batch)
+	require.NoError(t, err)
+	assert.Equal(t, []bool{false, false, true}, added)
+
+	count, err := repo.CountAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	_, err = repo.AddVisitsBatch(ctx, []BatchVisit{{ClientID: "c4", Visit: &Visit{Title: "no url", Timestamp: now}}})
+	assert.EqualError(t, err, "visit url or timestamp empty")
+}
+
+func TestRepo_VisitURLFields(t *testing.T) {
+	ctx := context.Background()
+	repo, shutdown := testRepoSetup(t)
+	defer shutdown()
+
+	_, err := deleteAllVisits(ctx, repo)
+	require.NoError(t, err)
+	_, err = repo.db.Exec(ctx, `DELETE FROM netlog.visit_client_id`)
+	require.NoError(t, err)
+
+	now := time.Now()
+	require.NoError(t, repo.AddVisit(ctx, &Visit{URL: "https://WWW.BBC.co.uk:443/news?b=2&utm_source=x&a=1#top", Timestamp: now}))
+	_, err = repo.AddVisitsBatch(ctx, []BatchVisit{
+		{ClientID: "c1", Visit: &Visit{URL: "https://docs.github.com/en?fbclid=abc", Timestamp: now}},
+	})
+	require.NoError(t, err)
+	// e.g. a visit stored before the columns were added
+	_, err = repo.db.Exec(ctx, `INSERT INTO netlog.visit (url, timestamp) VALUES ('https://old.github.com/', $1)`, now)
+	require.NoError(t, err)
+
+	visits, err := repo.GetVisitsAfterID(ctx, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, visits, 3)
+	assert.Equal(t, "www.bbc.co.uk", visits[0].Host)
+	assert.Equal(t, "bbc.co.uk", visits[0].RegisteredDomain)
+	assert.Equal(t, "https://www.bbc.co.uk/news?a=1&b=2", visits[0].CanonicalURL)
+	assert.Equal(t, "docs.github.com", visits[1].Host)
+	assert.Equal(t, "github.com", visits[1].RegisteredDomain)
+	assert.Equal(t, "https://docs.github.com/en", visits[1].CanonicalURL)
+	assert.Empty(t, visits[2].CanonicalURL)
+
+	// the host stats fall back to the url for the visits not backfilled yet
+	hosts, err := repo.TopHosts(ctx, StatsRange{From: now.Add(-time.Minute), To: now.Add(time.Minute)}, 10)
+	require.NoError(t, err)
+	assert.Len(t, hosts, 3)
+
+	// backfilled
+	require.NoError(t, repo.UpdateVisitsURL(ctx, visits[2:]))
+
+	domainQuery := MustNewSearchQuery("domain:github.com", "url", "all")
+	count, err := repo.Count(ctx, domainQuery)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
 func TestRepo_GetAllVisits(t *testing.T) {
 	ctx := context.Background()
 	repo, shutdown := testRepoSetup(t)
@@ -209,30 +263,36 @@ func TestRepo_GetAllVisits(t *testing.T) {
 	_, err := deleteAllVisits(ctx, repo)
 	require.NoError(t, err)
 
-	allVisits, err := repo.GetAllVisits(ctx, nil)
+	allVisits, err := repo.GetAllVisits(ctx, 0)
 	require.NoError(t, err)
 	assert.Empty(t, allVisits)
 
+	// the later added visits have the older timestamps, like the imported ones
 	now := time.Now()
-	addedCount := 10
+	var added []*Visit
 	for i := 1; i <= 10; i++ {
-		repo.AddVisit(ctx, &Visit{
+		visit := &Visit{
 			Title:     gofakeit.Name(),
 			Source:    "pc",
 			Device:    "mb-serj",
 			URL:       gofakeit.URL(),
-			Timestamp: now.Add(time.Duration(i) * time.Minute),
-		})
+			Timestamp: now.Add(-time.Duration(i) * time.Minute),
+		}
+		require.NoError(t, repo.AddVisit(ctx, visit))
+		added = append(added, visit)
 	}
 
-	allVisits, err = repo.GetAllVisits(ctx, &now)
+	allVisits, err = repo.GetAllVisits(ctx, 0)
 	require.NoError(t, err)
-	assert.Len(t, allVisits, addedCount)
+	require.Len(t, allVisits, len(added))
+	for i, v := range allVisits {
+		assert.Equal(t, added[i].Id, v.Id)
+	}
 
-	after5mins := now.Add(5 * time.Minute)
-	after5minutesVisits, err := repo.GetAllVisits(ctx, &after5mins)
+	afterFifthVisits, err := repo.GetAllVisits(ctx, added[4].Id)
 	require.NoError(t, err)
-	assert.Len(t, after5minutesVisits, 6)
+	require.Len(t, afterFifthVisits, 5)
+	assert.Equal(t, added[5].Id, afterFifthVisits[0].Id)
 }
 
 func TestRepo_GetVisits_and_Count(t *testing.T) {
@@ -275,11 +335,14 @@ func TestRepo_GetVisits_and_Count(t *testing.T) {
 	}
 
 	for _, tc := range testCases {
-		gottenVisits, err := repo.GetVisits(ctx, tc.keywords, tc.field, tc.source, tc.limit)
+		query, err := NewSearchQuery(strings.Join(tc.keywords, " "), tc.field, tc.source)
+		require.NoError(t, err)
+
+		gottenVisits, err := repo.GetVisits(ctx, query, tc.limit)
 		require.NoError(t, err)
 		assert.Len(t, gottenVisits, tc.expectedVisitsCount, fmt.Sprintf("retrieved visits invalid for test case: %v", tc))
 
-		gottenCount, err := repo.Count(ctx, tc.keywords, tc.field, tc.source)
+		gottenCount, err := repo.Count(ctx, query)
 		require.NoError(t, err)
 		if tc.source != "all" {
 			assert.Equal(t, tc.expectedVisitsCount, gottenCount, fmt.Sprintf("count invalid for test case: %+v", tc))
@@ -288,7 +351,7 @@ func TestRepo_GetVisits_and_Count(t *testing.T) {
 		}
 	}
 
-	visits, err := repo.GetVisits(ctx, []string{"four"}, "url", "chrome", 10)
+	visits, err := repo.GetVisits(ctx, MustNewSearchQuery("four", "url", "chrome"), 10)
 	require.NoError(t, err)
 	require.Len(t, visits, 2)
 	assert.True(t, strings.HasPrefix(visits[0].Title, "title four"))
@@ -307,33 +370,146 @@ func TestRepo_GetVisitsPage(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, allVisits, 5)
 
-	gottenVisits, err := repo.GetVisitsPage(ctx, []string{"www"}, "url", "all", 3, 2)
+	// the last page is not clamped, i.e. it does not repeat visits from the previous page
+	gottenVisits, err := repo.GetVisitsPage(ctx, MustNewSearchQuery("www", "url", "all"), 3, 2)
 	require.NoError(t, err)
-	assert.Len(t, gottenVisits, 2)
-	assert.Equal(t, v4b.Id, gottenVisits[1].Id)
-	assert.Equal(t, v4.Id, gottenVisits[0].Id)
-	gottenVisits, err = repo.GetVisitsPage(ctx, []string{"www"}, "url", "all", 2, 2)
+	require.Len(t, gottenVisits, 1)
+	assert.Equal(t, v4b.Id, gottenVisits[0].Id)
+	gottenVisits, err = repo.GetVisitsPage(ctx, MustNewSearchQuery("www", "url", "all"), 4, 2)
+	require.NoError(t, err)
+	assert.Len(t, gottenVisits, 0)
+	gottenVisits, err = repo.GetVisitsPage(ctx, MustNewSearchQuery("www", "url", "all"), 2, 2)
 	require.NoError(t, err)
 	assert.Len(t, gottenVisits, 2)
 	assert.Equal(t, v4.Id, gottenVisits[1].Id)
 	assert.Equal(t, v3.Id, gottenVisits[0].Id)
-	gottenVisits, err = repo.GetVisitsPage(ctx, []string{"www"}, "url", "all", 1, 2)
+	gottenVisits, err = repo.GetVisitsPage(ctx, MustNewSearchQuery("www", "url", "all"), 1, 2)
 	require.NoError(t, err)
 	assert.Len(t, gottenVisits, 2)
 	assert.Equal(t, v2.Id, gottenVisits[1].Id)
 	assert.Equal(t, v1.Id, gottenVisits[0].Id)
-	gottenVisits, err = repo.GetVisitsPage(ctx, []string{"www"}, "url", "all", 0, 2)
+	gottenVisits, err = repo.GetVisitsPage(ctx, MustNewSearchQuery("www", "url", "all"), 0, 2)
 	require.NoError(t, err)
 	assert.Len(t, gottenVisits, 0)
-	gottenVisits, err = repo.GetVisitsPage(ctx, []string{"www"}, "url", "all", 1, 20)
+	gottenVisits, err = repo.GetVisitsPage(ctx, MustNewSearchQuery("www", "url", "all"), 1, 20)
 	require.NoError(t, err)
 	assert.Len(t, gottenVisits, 5)
-	gottenVisits, err = repo.GetVisitsPage(ctx, []string{"title"}, "title", "all", 1, 20)
+	gottenVisits, err = repo.GetVisitsPage(ctx, MustNewSearchQuery("title", "title", "all"), 1, 20)
 	require.NoError(t, err)
 	assert.Len(t, gottenVisits, 5)
-	gottenVisits, err = repo.GetVisitsPage(ctx, []string{"www"}, "url", "chrome", 1, 2)
+	gottenVisits, err = repo.GetVisitsPage(ctx, MustNewSearchQuery("www", "url", "chrome"), 1, 2)
 	require.NoError(t, err)
 	assert.Len(t, gottenVisits, 2)
 	assert.Equal(t, v4.Id, gottenVisits[1].Id)
 	assert.Equal(t, v3.Id, gottenVisits[0].Id)
 }
+
+func TestRepo_GetVisitsByCursor(t *testing.T) {
+	ctx := context.Background()
+	repo, shutdown := testRepoSetup(t)
+	defer shutdown()
+
+	addedVisits := cleanupAndAddTestVisits(ctx, t, repo)
+	v1, v2, v3, v4, v4b := addedVisits[0], addedVisits[1], addedVisits[2], addedVisits[3], addedVisits[4]
+	ids := func(visits []*Visit) []int {
+		var ids []int
+		for _, v := range visits {
+			ids = append(ids, v.Id)
+		}
+		return ids
+	}
+
+	query := MustNewSearchQuery("www", "url", "all")
+	first, err := repo.GetVisitsByCursor(ctx, query, "", 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int{v1.Id, v2.Id}, ids(first.Visits))
+	assert.Empty(t, first.Prev)
+	require.NotEmpty(t, first.Next)
+
+	second, err := repo.GetVisitsByCursor(ctx, query, first.Next, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int{v3.Id, v4.Id}, ids(second.Visits))
+	require.NotEmpty(t, second.Prev)
+	require.NotEmpty(t, second.Next)
+
+	last, err := repo.GetVisitsByCursor(ctx, query, second.Next, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int{v4b.Id}, ids(last.Visits))
+	assert.Empty(t, last.Next)
+
+	back, err := repo.GetVisitsByCursor(ctx, query, last.Prev, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int{v3.Id, v4.Id}, ids(back.Visits))
+	backToFirst, err := repo.GetVisitsByCursor(ctx, query, back.Prev, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int{v1.Id, v2.Id}, ids(backToFirst.Visits))
+	assert.Empty(t, backToFirst.Prev)
+
+	chrome, err := repo.GetVisitsByCursor(ctx, MustNewSearchQuery("", "url", "chrome"), "", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []int{v3.Id, v4.Id, v4b.Id}, ids(chrome.Visits))
+	assert.Empty(t, chrome.Next)
+
+	_, err = repo.GetVisitsByCursor(ctx, query, "invalid", 2)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	_, err = repo.db.Exec(ctx, `ANALYZE netlog.visit`)
+	require.NoError(t, err)
+	estimate, err := repo.EstimateCount(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 5, estimate)
+	estimate, err = repo.EstimateCount(ctx, MustNewSearchQuery("", "url", "chrome"))
+	require.NoError(t, err)
+	assert.Greater(t, estimate, 0)
+}
+
+func TestRepo_SearchRanked(t *testing.T) {
+	ctx := context.Background()
+	repo, shutdown := testRepoSetup(t)
+	defer shutdown()
+
+	_, err := deleteAllVisits(ctx, repo)
+	require.NoError(t, err)
+
+	now := time.Now()
+	vGo := &Visit{Title: "Go generics <explained>", Source: "chrome", Device: "mb-serj", URL: "https://go.dev/blog/generics", Timestamp: now}
+	vGoSafari := &Visit{Title: "Generics in Go", Source: "safari", Device: "mb-serj", URL: "https://www.example.com/posts/1", Timestamp: now.Add(-time.Minute)}
+	vRust := &Visit{Title: "Rust traits", Source: "chrome", Device: "mb-serj", URL: "https://doc.rust-lang.org/book/traits", Timestamp: now.Add(-2 * time.Minute)}
+	for _, v := range []*Visit{vGo, vGoSafari, vRust} {
+		require.NoError(t, repo.AddVisit(ctx, v))
+	}
+
+	visits, err := repo.SearchRanked(ctx, "go generics", nil, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, visits, 2)
+	// the first one also has the search terms in the url host and path
+	assert.Equal(t, vGo.Id, visits[0].Id)
+	assert.Equal(t, vGoSafari.Id, visits[1].Id)
+	assert.GreaterOrEqual(t, visits[0].Rank, visits[1].Rank)
+	assert.Contains(t, visits[0].TitleHighlight, "<mark>")
+	assert.Contains(t, visits[0].TitleHighlight, "&lt;explained&gt;")
+
+	count, err := repo.CountRanked(ctx, "go generics", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	// url tokens are searchable too
+	visits, err = repo.SearchRanked(ctx, "rust book", nil, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, visits, 1)
+	assert.Equal(t, vRust.Id, visits[0].Id)
+
+	safariOnly := MustNewSearchQuery("", "url", "safari")
+	visits, err = repo.SearchRanked(ctx, "generics", safariOnly, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, visits, 1)
+	assert.Equal(t, vGoSafari.Id, visits[0].Id)
+	count, err = repo.CountRanked(ctx, "generics", safariOnly)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	visits, err = repo.SearchRanked(ctx, "go generics", nil, 2, 1)
+	require.NoError(t, err)
+	require.Len(t, visits, 1)
+	assert.Equal(t, vGoSafari.Id, visits[0].Id)
+}
@@ -0,0 +1,200 @@
+package netlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/2beens/serjtubincom/internal/telemetry/tracing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+var _ BackupTarget = (*S3BackupTarget)(nil)
+
+// S3BackupTarget keeps the backup files in a bucket of any S3 compatible storage (AWS S3, MinIO, R2, ...)
+type S3BackupTarget struct {
+	client *minio.Client
+	bucket string
+	// prefix is the "folder" within the bucket, all backup files keys start with it
+	prefix string
+}
+
+type S3BackupTargetParams struct {
+	Endpoint  string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+}
+
+func NewS3BackupTarget(ctx context.Context, params S3BackupTargetParams) (*S3BackupTarget, error) {
+	ctx, span := tracing.GlobalNetlogBackupTracer.Start(ctx, "s3BackupTarget.new")
+	defer span.End()
+
+	if params.Endpoint == "" {
+		return nil, errors.New("s3 endpoint not specified")
+	}
+	if params.Bucket == "" {
+		return nil, errors.New("s3 bucket not specified")
+	}
+
+	client, err := minio.New(params.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(params.AccessKey, params.SecretKey, ""),
+		Secure: params.UseSSL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("new s3 client: %w", err)
+	}
+
+	exists, err := client.BucketExists(ctx, params.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("check bucket exists: %w", err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, params.Bucket, minio.MakeBucketOptions{}); err != nil {
+			return nil, fmt.Errorf("create bucket %s: %w", params.Bucket, err)
+		}
+	}
+
+	prefix := strings.Trim(params.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	return &S3BackupTarget{
+		client: client,
+		bucket: params.Bucket,
+		prefix: prefix,
+	}, nil
+}
+
+func (t *S3BackupTarget) Name() string {
+	return fmt.Sprintf("s3 [%s/%s]", t.bucket, t.prefix)
+}
+
+func (t *S3BackupTarget) List(ctx context.Context) ([]BackupFile, error) {
+	ctx, span := tracing.GlobalNetlogBackupTracer.Start(ctx, "s3BackupTarget.list")
+	defer span.End()
+
+	var files []BackupFile
+	for object := range t.client.ListObjects(ctx, t.bucket, minio.ListObjectsOptions{Prefix: t.prefix}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+
+		name := strings.TrimPrefix(object.Key, t.prefix)
+		// skip the manifest and the objects in the nested "folders"
+		if name == backupManifestFileName || strings.Contains(name, "/") {
+			continue
+		}
+
+		files = append(files, BackupFile{
+			ID:        object.Key,
+			Name:      name,
+			CreatedAt: object.LastModified,
+		})
+	}
+
+	return files, nil
+}
+
+func (t *S3BackupTarget) UploadChunk(ctx context.Context, name string, data []byte) (BackupFile, error) {
+	ctx, span := tracing.GlobalNetlogBackupTracer.Start(ctx, "s3BackupTarget.uploadChunk")
+	defer span.End()
+
+	if name == backupManifestFileName || path.Base(name) != name {
+		return BackupFile{}, fmt.Errorf("invalid backup file name: %s", name)
+	}
+
+	key := t.prefix + name
+	if err := t.putObject(ctx, key, data); err != nil {
+		return BackupFile{}, err
+	}
+
+	info, err := t.client.StatObject(ctx, t.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return BackupFile{}, fmt.Errorf("stat uploaded object: %w", err)
+	}
+
+	return BackupFile{
+		ID:        key,
+		Name:      name,
+		CreatedAt: info.LastModified,
+	}, nil
+}
+
+func (t *S3BackupTarget) Download(ctx context.Context, file BackupFile) ([]byte, error) {
+	ctx, span := tracing.GlobalNetlogBackupTracer.Start(ctx, "s3BackupTarget.download")
+	defer span.End()
+
+	return t.getObject(ctx, t.prefix+file.Name)
+}
+
+func (t *S3BackupTarget) Delete(ctx context.Context, file BackupFile) error {
+	ctx, span := tracing.GlobalNetlogBackupTracer.Start(ctx, "s3BackupTarget.delete")
+	defer span.End()
+
+	return t.client.RemoveObject(ctx, t.bucket, t.prefix+file.Name, minio.RemoveObjectOptions{})
+}
+
+func (t *S3BackupTarget) GetManifest(ctx context.Context) (*BackupManifest, error) {
+	ctx, span := tracing.GlobalNetlogBackupTracer.Start(ctx, "s3BackupTarget.getManifest")
+	defer span.End()
+
+	manifestJson, err := t.getObject(ctx, t.prefix+backupManifestFileName)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrBackupManifestNotFound
+		}
+		return nil, err
+	}
+
+	var manifest BackupManifest
+	if err := json.Unmarshal(manifestJson, &manifest); err != nil {
+		return nil, fmt.Errorf("decode manifest: %w", err)
+	}
+
+	return &manifest, nil
+}
+
+func (t *S3BackupTarget) SaveManifest(ctx context.Context, manifest *BackupManifest) error {
+	ctx, span := tracing.GlobalNetlogBackupTracer.Start(ctx, "s3BackupTarget.saveManifest")
+	defer span.End()
+
+	manifestJson, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("marshal manifest: %w", err)
+	}
+
+	return t.putObject(ctx, t.prefix+backupManifestFileName, manifestJson)
+}
+
+func (t *S3BackupTarget) putObject(ctx context.Context, key string, data []byte) error {
+	_, err := t.client.PutObject(
+		ctx,
+		t.bucket,
+		key,
+		bytes.NewReader(data),
+		int64(len(data)),
+		minio.PutObjectOptions{ContentType: "application/json"},
+	)
+	return err
+}
+
+func (t *S3BackupTarget) getObject(ctx context.Context, key string) ([]byte, error) {
+	object, err := t.client.GetObject(ctx, t.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	return io.ReadAll(object)
+}
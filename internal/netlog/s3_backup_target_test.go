@@ -0,0 +1,84 @@
+//go:build all_tests
+
+package netlog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runs against a MinIO stand-in, e.g.:
+// docker run -p 9100:9000 minio/minio server /data
+// S3_TEST_ENDPOINT=localhost:9100 go test -tags=all_tests ./internal/netlog/ -run TestS3BackupTarget
+func TestS3BackupTarget(t *testing.T) {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT not set")
+	}
+
+	accessKey := os.Getenv("S3_TEST_ACCESS_KEY")
+	secretKey := os.Getenv("S3_TEST_SECRET_KEY")
+	if accessKey == "" {
+		accessKey, secretKey = "minioadmin", "minioadmin"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	target, err := NewS3BackupTarget(ctx, S3BackupTargetParams{
+		Endpoint:  endpoint,
+		Bucket:    "netlog-backup-test",
+		Prefix:    fmt.Sprintf("test-%d", time.Now().UnixNano()),
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+	})
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, DeleteAllBackupFiles(ctx, target))
+	}()
+
+	files, err := target.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+
+	_, err = target.GetManifest(ctx)
+	assert.ErrorIs(t, err, ErrBackupManifestNotFound)
+
+	file1, err := target.UploadChunk(ctx, "chunk_1.json", []byte(`[{"id":1}]`))
+	require.NoError(t, err)
+	_, err = target.UploadChunk(ctx, "chunk_2.json", []byte(`[{"id":2}]`))
+	require.NoError(t, err)
+
+	manifest := &BackupManifest{
+		LastVisitId: 2,
+		Chunks: []BackupChunk{
+			{Name: "chunk_1.json", VisitsCount: 1},
+			{Name: "chunk_2.json", VisitsCount: 1},
+		},
+	}
+	require.NoError(t, target.SaveManifest(ctx, manifest))
+
+	savedManifest, err := target.GetManifest(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, manifest.Chunks, savedManifest.Chunks)
+
+	files, err = target.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	content, err := target.Download(ctx, file1)
+	require.NoError(t, err)
+	assert.Equal(t, `[{"id":1}]`, string(content))
+
+	require.NoError(t, target.Delete(ctx, file1))
+	files, err = target.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "chunk_2.json", files[0].Name)
+}
@@ -0,0 +1,195 @@
+package netlog
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	DefaultSessionIdleGap = 30 * time.Minute
+	// lastVisitDwell is the time assumed spent on the last visit of a session,
+	// as there is no next visit to measure it by
+	lastVisitDwell = 30 * time.Second
+	unknownDevice  = "unknown"
+)
+
+// SessionAnalyzer rebuilds browsing sessions from the visits: visits on the same device belong to the
+// same session, until there's a pause between two of them longer than the idle gap.
+// The time spent on a visit (dwell) is the time until the next visit in the session.
+type SessionAnalyzer struct {
+	idleGap time.Duration
+}
+
+func NewSessionAnalyzer(idleGap time.Duration) *SessionAnalyzer {
+	if idleGap <= 0 {
+		idleGap = DefaultSessionIdleGap
+	}
+	return &SessionAnalyzer{
+		idleGap: idleGap,
+	}
+}
+
+func (a *SessionAnalyzer) IdleGap() time.Duration {
+	return a.idleGap
+}
+
+type SessionVisit struct {
+	*Visit
+	Host         string  `json:"host"`
+	DwellSeconds float64 `json:"dwell_seconds"`
+}
+
+type DomainTime struct {
+	Host    string  `json:"host"`
+	Seconds float64 `json:"seconds"`
+	Visits  int     `json:"visits"`
+}
+
+type DomainDayTime struct {
+	Day time.Time `json:"day"`
+	DomainTime
+}
+
+type Session struct {
+	// Device is the visits device, or the source if the device is not known
+	Device string    `json:"device"`
+	Start  time.Time `json:"start"`
+	// End is the last visit time plus its dwell
+	End             time.Time      `json:"end"`
+	DurationSeconds float64        `json:"duration_seconds"`
+	VisitsCount     int            `json:"visits_count"`
+	Domains         []DomainTime   `json:"domains"`
+	Visits          []SessionVisit `json:"visits,omitempty"`
+}
+
+func sessionDevice(visit *Visit) string {
+	if visit.Device != "" {
+		return visit.Device
+	}
+	if visit.Source != "" {
+		return visit.Source
+	}
+	return unknownDevice
+}
+
+// Sessions groups the visits into sessions, ordered by their start time.
+func (a *SessionAnalyzer) Sessions(visits []*Visit) []*Session {
+	visitsPerDevice := map[string][]*Visit{}
+	for _, v := range visits {
+		device := sessionDevice(v)
+		visitsPerDevice[device] = append(visitsPerDevice[device], v)
+	}
+
+	var sessions []*Session
+	for device, deviceVisits := range visitsPerDevice {
+		sort.SliceStable(deviceVisits, func(i, j int) bool {
+			return deviceVisits[i].Timestamp.Before(deviceVisits[j].Timestamp)
+		})
+
+		var current *Session
+		for i, v := range deviceVisits {
+			if current == nil {
+				current = &Session{Device: device, Start: v.Timestamp}
+				sessions = append(sessions, current)
+			}
+
+			dwell := lastVisitDwell
+			isLastInSession := true
+			if i+1 < len(deviceVisits) {
+				if gap := deviceVisits[i+1].Timestamp.Sub(v.Timestamp); gap <= a.idleGap {
+					dwell = gap
+					isLastInSession = false
+				}
+			}
+
+			current.Visits = append(current.Visits, SessionVisit{
+				Visit:        v,
+				Host:         visitHost(v.URL),
+				DwellSeconds: dwell.Seconds(),
+			})
+
+			if isLastInSession {
+				current.finish(v.Timestamp.Add(dwell))
+				current = nil
+			}
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].Start.Equal(sessions[j].Start) {
+			return sessions[i].Device < sessions[j].Device
+		}
+		return sessions[i].Start.Before(sessions[j].Start)
+	})
+
+	return sessions
+}
+
+func (s *Session) finish(end time.Time) {
+	s.End = end
+	s.DurationSeconds = end.Sub(s.Start).Seconds()
+	s.VisitsCount = len(s.Visits)
+
+	perHost := map[string]*DomainTime{}
+	for _, sv := range s.Visits {
+		dt, ok := perHost[sv.Host]
+		if !ok {
+			dt = &DomainTime{Host: sv.Host}
+			perHost[sv.Host] = dt
+		}
+		dt.Seconds += sv.DwellSeconds
+		dt.Visits++
+	}
+	s.Domains = sortedDomainTimes(perHost)
+}
+
+// DomainTimePerDay sums the estimated time spent per domain, for each (UTC) day of the visits.
+// Ordered by day, and then by the time spent, descending.
+func DomainTimePerDay(sessions []*Session) []DomainDayTime {
+	perDay := map[time.Time]map[string]*DomainTime{}
+	for _, s := range sessions {
+		for _, sv := range s.Visits {
+			day := sv.Timestamp.UTC().Truncate(24 * time.Hour)
+			if perDay[day] == nil {
+				perDay[day] = map[string]*DomainTime{}
+			}
+			dt, ok := perDay[day][sv.Host]
+			if !ok {
+				dt = &DomainTime{Host: sv.Host}
+				perDay[day][sv.Host] = dt
+			}
+			dt.Seconds += sv.DwellSeconds
+			dt.Visits++
+		}
+	}
+
+	days := make([]time.Time, 0, len(perDay))
+	for day := range perDay {
+		days = append(days, day)
+	}
+	sort.Slice(days, func(i, j int) bool {
+		return days[i].Before(days[j])
+	})
+
+	result := []DomainDayTime{}
+	for _, day := range days {
+		for _, dt := range sortedDomainTimes(perDay[day]) {
+			result = append(result, DomainDayTime{Day: day, DomainTime: dt})
+		}
+	}
+	return result
+}
+
+func sortedDomainTimes(perHost map[string]*DomainTime) []DomainTime {
+	domains := make([]DomainTime, 0, len(perHost))
+	for _, dt := range perHost {
+		domains = append(domains, *dt)
+	}
+	sort.Slice(domains, func(i, j int) bool {
+		if domains[i].Seconds == domains[j].Seconds {
+			return domains[i].Host < domains[j].Host
+		}
+		return domains[i].Seconds > domains[j].Seconds
+	})
+	return domains
+}
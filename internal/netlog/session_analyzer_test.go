@@ -0,0 +1,87 @@
+package netlog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionAnalyzer_Sessions(t *testing.T) {
+	start := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+	at := func(minutes float64) time.Time {
+		return start.Add(time.Duration(minutes * float64(time.Minute)))
+	}
+
+	visits := []*Visit{
+		// first mb-serj session
+		{Id: 1, Device: "mb-serj", URL: "https://github.com/a", Timestamp: at(0)},
+		{Id: 3, Device: "mb-serj", URL: "https://go.dev/doc", Timestamp: at(10)},
+		{Id: 2, Device: "mb-serj", URL: "https://github.com/b", Timestamp: at(5)},
+		// iphone, interleaved with the mb-serj visits
+		{Id: 4, Device: "iphone", URL: "https://news.ycombinator.com", Timestamp: at(2)},
+		{Id: 5, Device: "iphone", URL: "https://news.ycombinator.com/item", Timestamp: at(3.5)},
+		// second mb-serj session, after a 50 minutes pause
+		{Id: 6, Device: "mb-serj", URL: "https://github.com/c", Timestamp: at(60)},
+		// no device, falls back to the source
+		{Id: 7, Source: "safari", URL: "https://example.com", Timestamp: at(1)},
+	}
+
+	sessions := NewSessionAnalyzer(30 * time.Minute).Sessions(visits)
+	require.Len(t, sessions, 4)
+
+	first := sessions[0]
+	assert.Equal(t, "mb-serj", first.Device)
+	assert.Equal(t, at(0), first.Start)
+	assert.Equal(t, 3, first.VisitsCount)
+	require.Len(t, first.Visits, 3)
+	assert.Equal(t, []int{1, 2, 3}, []int{first.Visits[0].Id, first.Visits[1].Id, first.Visits[2].Id})
+	assert.Equal(t, 300.0, first.Visits[0].DwellSeconds)
+	assert.Equal(t, lastVisitDwell.Seconds(), first.Visits[2].DwellSeconds)
+	assert.Equal(t, at(10).Add(lastVisitDwell), first.End)
+	assert.Equal(t, 630.0, first.DurationSeconds)
+	assert.Equal(t, []DomainTime{
+		{Host: "github.com", Seconds: 600, Visits: 2},
+		{Host: "go.dev", Seconds: 30, Visits: 1},
+	}, first.Domains)
+
+	assert.Equal(t, "safari", sessions[1].Device)
+	assert.Equal(t, "iphone", sessions[2].Device)
+	assert.Equal(t, 90.0, sessions[2].Visits[0].DwellSeconds)
+
+	assert.Equal(t, "mb-serj", sessions[3].Device)
+	assert.Equal(t, at(60), sessions[3].Start)
+	assert.Equal(t, 1, sessions[3].VisitsCount)
+
+	// with a longer idle gap, both mb-serj sessions merge, and the pause counts as dwell time
+	sessions = NewSessionAnalyzer(time.Hour).Sessions(visits)
+	require.Len(t, sessions, 3)
+	assert.Equal(t, 4, sessions[0].VisitsCount)
+	assert.Equal(t, 3000.0, sessions[0].Visits[2].DwellSeconds)
+
+	assert.Empty(t, NewSessionAnalyzer(0).Sessions(nil))
+	assert.Equal(t, DefaultSessionIdleGap, NewSessionAnalyzer(0).IdleGap())
+}
+
+func TestDomainTimePerDay(t *testing.T) {
+	day1 := time.Date(2025, 3, 10, 23, 58, 0, 0, time.UTC)
+	visits := []*Visit{
+		{Id: 1, Device: "mb-serj", URL: "https://github.com/a", Timestamp: day1},
+		{Id: 2, Device: "mb-serj", URL: "https://go.dev", Timestamp: day1.Add(time.Minute)},
+		// the next day, in the same session
+		{Id: 3, Device: "mb-serj", URL: "https://github.com/b", Timestamp: day1.Add(3 * time.Minute)},
+		{Id: 4, Device: "iphone", URL: "https://go.dev/x", Timestamp: day1.Add(5 * time.Minute)},
+	}
+
+	sessions := NewSessionAnalyzer(30 * time.Minute).Sessions(visits)
+	perDay := DomainTimePerDay(sessions)
+
+	day2 := time.Date(2025, 3, 11, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, []DomainDayTime{
+		{Day: day1.Truncate(24 * time.Hour), DomainTime: DomainTime{Host: "go.dev", Seconds: 120, Visits: 1}},
+		{Day: day1.Truncate(24 * time.Hour), DomainTime: DomainTime{Host: "github.com", Seconds: 60, Visits: 1}},
+		{Day: day2, DomainTime: DomainTime{Host: "github.com", Seconds: 30, Visits: 1}},
+		{Day: day2, DomainTime: DomainTime{Host: "go.dev", Seconds: 30, Visits: 1}},
+	}, perDay)
+}
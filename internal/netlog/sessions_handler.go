@@ -0,0 +1,123 @@
+package netlog
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/2beens/serjtubincom/internal/telemetry/tracing"
+	"github.com/2beens/serjtubincom/pkg"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// sessions are rebuilt in memory from all the visits in the range, so the range is limited
+const maxSessionsRange = 92 * 24 * time.Hour
+
+// sessionsRequest reads the stats range, and the optional <gap> (idle gap, e.g. 15m) and <device> URL query params
+func (handler *Handler) sessionsRequest(r *http.Request) (StatsRange, *SessionAnalyzer, string, error) {
+	statsRange, err := statsRangeFromRequest(r)
+	if err != nil {
+		return StatsRange{}, nil, "", err
+	}
+	if statsRange.To.Sub(statsRange.From) > maxSessionsRange {
+		return StatsRange{}, nil, "", errors.New("invalid range, sessions are limited to 92 days")
+	}
+
+	analyzer := handler.sessionAnalyzer
+	if gapRaw := r.URL.Query().Get("gap"); gapRaw != "" {
+		gap, err := time.ParseDuration(gapRaw)
+		if err != nil || gap < time.Minute {
+			return StatsRange{}, nil, "", errors.New("invalid <gap>, has to be a duration of at least 1m, e.g. 15m")
+		}
+		analyzer = NewSessionAnalyzer(gap)
+	}
+
+	return statsRange, analyzer, r.URL.Query().Get("device"), nil
+}
+
+func (handler *Handler) buildSessions(ctx context.Context, statsRange StatsRange, analyzer *SessionAnalyzer, device string) ([]*Session, error) {
+	visits, err := handler.repo.GetVisitsInRange(ctx, statsRange)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := analyzer.Sessions(visits)
+	if device == "" {
+		return sessions, nil
+	}
+
+	var deviceSessions []*Session
+	for _, s := range sessions {
+		if s.Device == device {
+			deviceSessions = append(deviceSessions, s)
+		}
+	}
+	return deviceSessions, nil
+}
+
+type SessionsResponse struct {
+	Range          StatsRange `json:"range"`
+	IdleGapMinutes float64    `json:"idle_gap_minutes"`
+	Sessions       []*Session `json:"sessions"`
+}
+
+// handleSessions lists the browsing sessions in the range, newest first.
+// The visits of each session are included only with the <visits=true> URL query param.
+func (handler *Handler) handleSessions(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.GlobalTracer.Start(r.Context(), "netlogHandler.sessions")
+	defer span.End()
+
+	statsRange, analyzer, device, err := handler.sessionsRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sessions, err := handler.buildSessions(ctx, statsRange, analyzer, device)
+	if err != nil {
+		log.Errorf("get netlog sessions: %s", err)
+		http.Error(w, "failed to get netlog sessions", http.StatusInternalServerError)
+		return
+	}
+
+	withVisits := r.URL.Query().Get("visits") == "true"
+	newestFirst := make([]*Session, 0, len(sessions))
+	for i := len(sessions) - 1; i >= 0; i-- {
+		s := sessions[i]
+		if !withVisits {
+			withoutVisits := *s
+			withoutVisits.Visits = nil
+			s = &withoutVisits
+		}
+		newestFirst = append(newestFirst, s)
+	}
+
+	pkg.SendJsonResponse(w, http.StatusOK, SessionsResponse{
+		Range:          statsRange,
+		IdleGapMinutes: analyzer.IdleGap().Minutes(),
+		Sessions:       newestFirst,
+	})
+}
+
+// handleDomainTimePerDay returns the estimated time spent per domain, per day
+func (handler *Handler) handleDomainTimePerDay(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.GlobalTracer.Start(r.Context(), "netlogHandler.domainTimePerDay")
+	defer span.End()
+
+	statsRange, analyzer, device, err := handler.sessionsRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sessions, err := handler.buildSessions(ctx, statsRange, analyzer, device)
+	if err != nil {
+		log.Errorf("get netlog domain time per day: %s", err)
+		http.Error(w, "failed to get netlog domain time per day", http.StatusInternalServerError)
+		return
+	}
+
+	pkg.SendJsonResponse(w, http.StatusOK, StatsResponse{Range: statsRange, Data: DomainTimePerDay(sessions)})
+}
@@ -0,0 +1,89 @@
+package netlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/2beens/serjtubincom/internal/auth"
+	"github.com/2beens/serjtubincom/internal/telemetry/metrics"
+
+	"github.com/go-redis/redismock/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetlogHandler_sessions(t *testing.T) {
+	db, mock := redismock.NewClientMock()
+	repo := NewRepoMock()
+	m := metrics.NewTestManager()
+	loginChecker := auth.NewLoginChecker(time.Hour, db)
+	r := setupNetlogRouterForTests(t, repo, m, loginChecker, "beer")
+
+	start := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+	repo.Visits = map[int]Visit{
+		1: {Id: 1, Device: "mb-serj", URL: "https://github.com/a", Timestamp: start},
+		2: {Id: 2, Device: "mb-serj", URL: "https://go.dev", Timestamp: start.Add(10 * time.Minute)},
+		3: {Id: 3, Device: "mb-serj", URL: "https://github.com/b", Timestamp: start.Add(30 * time.Minute)},
+		4: {Id: 4, Device: "iphone", URL: "https://go.dev/x", Timestamp: start.Add(time.Minute)},
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		mock.ExpectGet("serj-service-session||tokenAbc123").SetVal(fmt.Sprintf("%d", time.Now().Unix()))
+
+		req, err := http.NewRequest("GET", path, nil)
+		require.NoError(t, err)
+		req.Header.Set("Origin", "test")
+		req.Header.Set("X-SERJ-TOKEN", "tokenAbc123")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	const day = "from=2025-03-10&to=2025-03-11"
+
+	rr := get("/netlog/sessions?" + day)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var resp SessionsResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, 30.0, resp.IdleGapMinutes)
+	require.Len(t, resp.Sessions, 2)
+	// newest first
+	assert.Equal(t, "iphone", resp.Sessions[0].Device)
+	assert.Equal(t, "mb-serj", resp.Sessions[1].Device)
+	assert.Equal(t, 3, resp.Sessions[1].VisitsCount)
+	assert.Empty(t, resp.Sessions[1].Visits)
+
+	// a shorter idle gap splits the mb-serj session
+	rr = get("/netlog/sessions?gap=15m&device=mb-serj&visits=true&" + day)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	resp = SessionsResponse{}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	require.Len(t, resp.Sessions, 2)
+	assert.Equal(t, 15.0, resp.IdleGapMinutes)
+	require.Len(t, resp.Sessions[0].Visits, 1)
+	assert.Equal(t, 3, resp.Sessions[0].Visits[0].Id)
+	require.Len(t, resp.Sessions[1].Visits, 2)
+
+	rr = get("/netlog/stats/domain-time?" + day)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	var domainTimeResp struct {
+		Data []DomainDayTime `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &domainTimeResp))
+	require.Len(t, domainTimeResp.Data, 2)
+	assert.Equal(t, DomainTime{Host: "go.dev", Seconds: 1200 + 30, Visits: 2}, domainTimeResp.Data[0].DomainTime)
+	assert.Equal(t, DomainTime{Host: "github.com", Seconds: 600 + 30, Visits: 2}, domainTimeResp.Data[1].DomainTime)
+
+	for _, path := range []string{
+		"/netlog/sessions?gap=soon",
+		"/netlog/sessions?gap=10s",
+		"/netlog/sessions?from=2025-01-01&to=2025-06-01",
+		"/netlog/stats/domain-time?from=x",
+	} {
+		assert.Equal(t, http.StatusBadRequest, get(path).Code, path)
+	}
+}
@@ -0,0 +1,180 @@
+package netlog
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/2beens/serjtubincom/internal/telemetry/tracing"
+	"github.com/2beens/serjtubincom/pkg"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultStatsRange = 30 * 24 * time.Hour
+	// the per day stats have one entry per day, so keep the range sane
+	maxStatsRange     = 20 * 365 * 24 * time.Hour
+	defaultStatsLimit = 20
+	maxStatsLimit     = 1000
+)
+
+type StatsResponse struct {
+	Range StatsRange `json:"range"`
+	Data  any        `json:"data"`
+}
+
+// statsRangeFromRequest reads the optional <from> and <to> URL query params (YYYY-MM-DD or RFC3339).
+// Defaults to the last 30 days.
+func statsRangeFromRequest(r *http.Request) (StatsRange, error) {
+	statsRange := StatsRange{To: time.Now()}
+
+	if toRaw := r.URL.Query().Get("to"); toRaw != "" {
+		to, err := parseQueryTime(toRaw)
+		if err != nil {
+			return StatsRange{}, errors.New("invalid <to> time, use YYYY-MM-DD or RFC3339")
+		}
+		statsRange.To = to
+	}
+
+	statsRange.From = statsRange.To.Add(-defaultStatsRange)
+	if fromRaw := r.URL.Query().Get("from"); fromRaw != "" {
+		from, err := parseQueryTime(fromRaw)
+		if err != nil {
+			return StatsRange{}, errors.New("invalid <from> time, use YYYY-MM-DD or RFC3339")
+		}
+		statsRange.From = from
+	}
+
+	if !statsRange.From.Before(statsRange.To) {
+		return StatsRange{}, errors.New("invalid range, <from> has to be before <to>")
+	}
+	if statsRange.To.Sub(statsRange.From) > maxStatsRange {
+		return StatsRange{}, errors.New("invalid range, too long")
+	}
+
+	return statsRange, nil
+}
+
+func statsLimitFromRequest(r *http.Request) (int, error) {
+	limitRaw := r.URL.Query().Get("limit")
+	if limitRaw == "" {
+		return defaultStatsLimit, nil
+	}
+	limit, err := strconv.Atoi(limitRaw)
+	if err != nil || limit < 1 || limit > maxStatsLimit {
+		return 0, errors.New("invalid <limit>, has to be between 1 and 1000")
+	}
+	return limit, nil
+}
+
+func (handler *Handler) handleStatsTopHosts(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.GlobalTracer.Start(r.Context(), "netlogHandler.statsTopHosts")
+	defer span.End()
+
+	statsRange, err := statsRangeFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := statsLimitFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hosts, err := handler.repo.TopHosts(ctx, statsRange, limit)
+	if err != nil {
+		log.Errorf("get netlog top hosts: %s", err)
+		http.Error(w, "failed to get netlog top hosts", http.StatusInternalServerError)
+		return
+	}
+
+	pkg.SendJsonResponse(w, http.StatusOK, StatsResponse{Range: statsRange, Data: hosts})
+}
+
+func (handler *Handler) handleStatsPerDay(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.GlobalTracer.Start(r.Context(), "netlogHandler.statsPerDay")
+	defer span.End()
+
+	statsRange, err := statsRangeFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	days, err := handler.repo.VisitsPerDay(ctx, statsRange)
+	if err != nil {
+		log.Errorf("get netlog visits per day: %s", err)
+		http.Error(w, "failed to get netlog visits per day", http.StatusInternalServerError)
+		return
+	}
+
+	pkg.SendJsonResponse(w, http.StatusOK, StatsResponse{Range: statsRange, Data: days})
+}
+
+func (handler *Handler) handleStatsPerHourOfWeek(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.GlobalTracer.Start(r.Context(), "netlogHandler.statsPerHourOfWeek")
+	defer span.End()
+
+	statsRange, err := statsRangeFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cells, err := handler.repo.VisitsPerHourOfWeek(ctx, statsRange)
+	if err != nil {
+		log.Errorf("get netlog visits per hour of week: %s", err)
+		http.Error(w, "failed to get netlog visits per hour of week", http.StatusInternalServerError)
+		return
+	}
+
+	pkg.SendJsonResponse(w, http.StatusOK, StatsResponse{Range: statsRange, Data: cells})
+}
+
+func (handler *Handler) handleStatsSources(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.GlobalTracer.Start(r.Context(), "netlogHandler.statsSources")
+	defer span.End()
+
+	statsRange, err := statsRangeFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	split, err := handler.repo.SourceDeviceSplit(ctx, statsRange)
+	if err != nil {
+		log.Errorf("get netlog source/device split: %s", err)
+		http.Error(w, "failed to get netlog source/device split", http.StatusInternalServerError)
+		return
+	}
+
+	pkg.SendJsonResponse(w, http.StatusOK, StatsResponse{Range: statsRange, Data: split})
+}
+
+func (handler *Handler) handleStatsNewDomains(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.GlobalTracer.Start(r.Context(), "netlogHandler.statsNewDomains")
+	defer span.End()
+
+	statsRange, err := statsRangeFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := statsLimitFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	domains, err := handler.repo.NewDomains(ctx, statsRange, limit)
+	if err != nil {
+		log.Errorf("get netlog new domains: %s", err)
+		http.Error(w, "failed to get netlog new domains", http.StatusInternalServerError)
+		return
+	}
+
+	pkg.SendJsonResponse(w, http.StatusOK, StatsResponse{Range: statsRange, Data: domains})
+}
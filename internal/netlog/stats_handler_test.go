@@ -0,0 +1,121 @@
+package netlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/2beens/serjtubincom/internal/auth"
+	"github.com/2beens/serjtubincom/internal/telemetry/metrics"
+
+	"github.com/go-redis/redismock/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupStatsTest(t *testing.T) func(path string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	db, mock := redismock.NewClientMock()
+	repo := NewRepoMock()
+	m := metrics.NewTestManager()
+	loginChecker := auth.NewLoginChecker(time.Hour, db)
+	r := setupNetlogRouterForTests(t, repo, m, loginChecker, "beer")
+
+	// Monday, 10 March 2025
+	monday := time.Date(2025, 3, 10, 9, 30, 0, 0, time.UTC)
+	repo.Visits = map[int]Visit{
+		1: {Id: 1, Source: "chrome", Device: "mb-serj", URL: "https://old.example.com/", Timestamp: monday.AddDate(0, -1, 0)},
+		2: {Id: 2, Source: "chrome", Device: "mb-serj", URL: "https://GitHub.com/a", Timestamp: monday},
+		3: {Id: 3, Source: "chrome", Device: "mb-serj", URL: "https://github.com/b", Timestamp: monday.Add(time.Minute)},
+		4: {Id: 4, Source: "safari", Device: "iphone", URL: "https://old.example.com/x", Timestamp: monday.AddDate(0, 0, 2)},
+		5: {Id: 5, Source: "safari", Device: "iphone", URL: "https://go.dev/", Timestamp: monday.AddDate(0, 0, 2).Add(time.Hour)},
+		6: {Id: 6, Source: "safari", Device: "iphone", URL: "https://go.dev/doc", Timestamp: monday.AddDate(0, 0, 3)},
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		mock.ExpectGet("serj-service-session||tokenAbc123").SetVal(fmt.Sprintf("%d", time.Now().Unix()))
+
+		req, err := http.NewRequest("GET", path, nil)
+		require.NoError(t, err)
+		req.Header.Set("Origin", "test")
+		req.Header.Set("X-SERJ-TOKEN", "tokenAbc123")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	return get
+}
+
+func decodeStatsResponse[T any](t *testing.T, rr *httptest.ResponseRecorder) (StatsRange, T) {
+	t.Helper()
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var resp struct {
+		Range StatsRange `json:"range"`
+		Data  T          `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	return resp.Range, resp.Data
+}
+
+func TestNetlogHandler_stats(t *testing.T) {
+	get := setupStatsTest(t)
+	const week = "from=2025-03-10&to=2025-03-17"
+
+	statsRange, hosts := decodeStatsResponse[[]HostCount](t, get("/netlog/stats/hosts?"+week))
+	assert.Equal(t, time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC), statsRange.From)
+	assert.Equal(t, []HostCount{
+		{Host: "github.com", Visits: 2},
+		{Host: "go.dev", Visits: 2},
+		{Host: "old.example.com", Visits: 1},
+	}, hosts)
+
+	_, hosts = decodeStatsResponse[[]HostCount](t, get("/netlog/stats/hosts?limit=1&"+week))
+	assert.Len(t, hosts, 1)
+
+	_, days := decodeStatsResponse[[]DayCount](t, get("/netlog/stats/days?"+week))
+	require.Len(t, days, 7)
+	assert.Equal(t, 2, days[0].Visits)
+	assert.Equal(t, 0, days[1].Visits)
+	assert.Equal(t, 2, days[2].Visits)
+	assert.Equal(t, 1, days[3].Visits)
+	assert.Equal(t, time.Date(2025, 3, 16, 0, 0, 0, 0, time.UTC), days[6].Day)
+
+	_, cells := decodeStatsResponse[[]HourOfWeekCount](t, get("/netlog/stats/hours?"+week))
+	require.Len(t, cells, 7*24)
+	assert.Equal(t, HourOfWeekCount{Weekday: 1, Hour: 9, Visits: 2}, cells[9])
+	assert.Equal(t, HourOfWeekCount{Weekday: 3, Hour: 10, Visits: 1}, cells[2*24+10])
+
+	_, split := decodeStatsResponse[[]SourceDeviceCount](t, get("/netlog/stats/sources?"+week))
+	assert.Equal(t, []SourceDeviceCount{
+		{Source: "safari", Device: "iphone", Visits: 3},
+		{Source: "chrome", Device: "mb-serj", Visits: 2},
+	}, split)
+
+	// old.example.com was first seen a month before
+	_, domains := decodeStatsResponse[[]NewDomain](t, get("/netlog/stats/new-domains?"+week))
+	require.Len(t, domains, 2)
+	assert.Equal(t, "go.dev", domains[0].Host)
+	assert.Equal(t, 2, domains[0].Visits)
+	assert.Equal(t, "github.com", domains[1].Host)
+}
+
+func TestNetlogHandler_stats_badRequest(t *testing.T) {
+	get := setupStatsTest(t)
+
+	for _, path := range []string{
+		"/netlog/stats/hosts?from=yesterday",
+		"/netlog/stats/days?to=2025-13-01",
+		"/netlog/stats/hours?from=2025-03-10&to=2025-03-01",
+		"/netlog/stats/new-domains?limit=0",
+		"/netlog/stats/hosts?limit=x",
+		"/netlog/stats/days?from=1900-01-01",
+	} {
+		assert.Equal(t, http.StatusBadRequest, get(path).Code, path)
+	}
+}
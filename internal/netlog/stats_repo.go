@@ -0,0 +1,309 @@
+package netlog
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/2beens/serjtubincom/internal/telemetry/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// visitHostSQL is the visit host, extracted from the url (lowercased, without the userinfo and the port)
+// for the visits stored before the host column was added, and not backfilled yet
+const visitHostSQL = `COALESCE(host, LOWER(COALESCE(substring(url from '^[a-zA-Z][a-zA-Z0-9+.-]*://(?:[^/?#@]*@)?([^/?#:@]+)'), '')))`
+
+// StatsRange is a [From, To) time range the visits stats are calculated for.
+// Days and hours are always in UTC.
+type StatsRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+type HostCount struct {
+	Host   string `json:"host"`
+	Visits int    `json:"visits"`
+}
+
+type DayCount struct {
+	Day    time.Time `json:"day"`
+	Visits int       `json:"visits"`
+}
+
+type HourOfWeekCount struct {
+	// Weekday is the ISO day of the week, 1 (Monday) to 7 (Sunday)
+	Weekday int `json:"weekday"`
+	Hour    int `json:"hour"`
+	Visits  int `json:"visits"`
+}
+
+type SourceDeviceCount struct {
+	Source string `json:"source"`
+	Device string `json:"device"`
+	Visits int    `json:"visits"`
+}
+
+type NewDomain struct {
+	Host      string    `json:"host"`
+	FirstSeen time.Time `json:"first_seen"`
+	// Visits is the number of visits to the host within the stats range
+	Visits int `json:"visits"`
+}
+
+func (r *Repo) TopHosts(ctx context.Context, statsRange StatsRange, limit int) (_ []HostCount, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.topHosts")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	span.SetAttributes(attribute.Int("limit", limit))
+
+	rows, err := r.db.Query(
+		ctx,
+		`
+			SELECT host, COUNT(*) AS visits
+			FROM (
+				SELECT `+visitHostSQL+` AS host
+				FROM netlog.visit
+				WHERE timestamp >= $1 AND timestamp < $2
+			) h
+			WHERE host <> ''
+			GROUP BY host
+			ORDER BY visits DESC, host
+			LIMIT $3;
+		`,
+		statsRange.From, statsRange.To, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hosts := []HostCount{}
+	for rows.Next() {
+		var hc HostCount
+		if err := rows.Scan(&hc.Host, &hc.Visits); err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, hc)
+	}
+
+	return hosts, rows.Err()
+}
+
+// VisitsPerDay returns the visits count for each UTC day in the range, including the days without visits.
+func (r *Repo) VisitsPerDay(ctx context.Context, statsRange StatsRange) (_ []DayCount, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.visitsPerDay")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	rows, err := r.db.Query(
+		ctx,
+		`
+			SELECT (timestamp AT TIME ZONE 'UTC')::date AS day, COUNT(*)
+			FROM netlog.visit
+			WHERE timestamp >= $1 AND timestamp < $2
+			GROUP BY day;
+		`,
+		statsRange.From, statsRange.To,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	countsPerDay := map[time.Time]int{}
+	for rows.Next() {
+		var day time.Time
+		var count int
+		if err := rows.Scan(&day, &count); err != nil {
+			return nil, err
+		}
+		countsPerDay[day.UTC().Truncate(24*time.Hour)] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return fillDayCounts(statsRange, countsPerDay), nil
+}
+
+// VisitsPerHourOfWeek returns all 7x24 (weekday, UTC hour) cells, ordered from Monday 00h.
+func (r *Repo) VisitsPerHourOfWeek(ctx context.Context, statsRange StatsRange) (_ []HourOfWeekCount, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.visitsPerHourOfWeek")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	rows, err := r.db.Query(
+		ctx,
+		`
+			SELECT
+				EXTRACT(ISODOW FROM timestamp AT TIME ZONE 'UTC')::int AS weekday,
+				EXTRACT(HOUR FROM timestamp AT TIME ZONE 'UTC')::int AS hour,
+				COUNT(*)
+			FROM netlog.visit
+			WHERE timestamp >= $1 AND timestamp < $2
+			GROUP BY weekday, hour;
+		`,
+		statsRange.From, statsRange.To,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cells := emptyHourOfWeekCounts()
+	for rows.Next() {
+		var weekday, hour, count int
+		if err := rows.Scan(&weekday, &hour, &count); err != nil {
+			return nil, err
+		}
+		cells[hourOfWeekIndex(weekday, hour)].Visits = count
+	}
+
+	return cells, rows.Err()
+}
+
+func (r *Repo) SourceDeviceSplit(ctx context.Context, statsRange StatsRange) (_ []SourceDeviceCount, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.sourceDeviceSplit")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	rows, err := r.db.Query(
+		ctx,
+		`
+			SELECT COALESCE(source, '') AS source, COALESCE(device, '') AS device, COUNT(*) AS visits
+			FROM netlog.visit
+			WHERE timestamp >= $1 AND timestamp < $2
+			GROUP BY 1, 2
+			ORDER BY visits DESC, source, device;
+		`,
+		statsRange.From, statsRange.To,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	split := []SourceDeviceCount{}
+	for rows.Next() {
+		var sdc SourceDeviceCount
+		if err := rows.Scan(&sdc.Source, &sdc.Device, &sdc.Visits); err != nil {
+			return nil, err
+		}
+		split = append(split, sdc)
+	}
+
+	return split, rows.Err()
+}
+
+// NewDomains returns the hosts visited for the first time ever within the range, newest first.
+func (r *Repo) NewDomains(ctx context.Context, statsRange StatsRange, limit int) (_ []NewDomain, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.newDomains")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	span.SetAttributes(attribute.Int("limit", limit))
+
+	rows, err := r.db.Query(
+		ctx,
+		`
+			SELECT host, first_seen, visits
+			FROM (
+				SELECT
+					`+visitHostSQL+` AS host,
+					MIN(timestamp) AS first_seen,
+					COUNT(*) FILTER (WHERE timestamp >= $1) AS visits
+				FROM netlog.visit
+				WHERE timestamp < $2
+				GROUP BY 1
+			) h
+			WHERE host <> '' AND first_seen >= $1
+			ORDER BY first_seen DESC
+			LIMIT $3;
+		`,
+		statsRange.From, statsRange.To, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	domains := []NewDomain{}
+	for rows.Next() {
+		var nd NewDomain
+		if err := rows.Scan(&nd.Host, &nd.FirstSeen, &nd.Visits); err != nil {
+			return nil, err
+		}
+		domains = append(domains, nd)
+	}
+
+	return domains, rows.Err()
+}
+
+// GetVisitsInRange returns all the visits within the range, oldest first.
+func (r *Repo) GetVisitsInRange(ctx context.Context, statsRange StatsRange) (_ []*Visit, err error) {
+	ctx, span := tracing.GlobalTracer.Start(ctx, "netlogPsqlApi.getVisitsInRange")
+	defer func() {
+		tracing.EndSpanWithErrCheck(span, err)
+	}()
+
+	rows, err := r.db.Query(
+		ctx,
+		`
+			SELECT `+visitColumnsSQL+`
+			FROM netlog.visit
+			WHERE timestamp >= $1 AND timestamp < $2
+			ORDER BY timestamp, id;
+		`,
+		statsRange.From, statsRange.To,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	visits, err := visitsFromRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("found-visits", len(visits)))
+	return visits, nil
+}
+
+// visitHost returns the lowercased url host, matching visitHostSQL
+func visitHost(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsedURL.Hostname())
+}
+
+func fillDayCounts(statsRange StatsRange, countsPerDay map[time.Time]int) []DayCount {
+	days := []DayCount{}
+	for day := statsRange.From.UTC().Truncate(24 * time.Hour); day.Before(statsRange.To); day = day.AddDate(0, 0, 1) {
+		days = append(days, DayCount{Day: day, Visits: countsPerDay[day]})
+	}
+	return days
+}
+
+func emptyHourOfWeekCounts() []HourOfWeekCount {
+	cells := make([]HourOfWeekCount, 0, 7*24)
+	for weekday := 1; weekday <= 7; weekday++ {
+		for hour := 0; hour < 24; hour++ {
+			cells = append(cells, HourOfWeekCount{Weekday: weekday, Hour: hour})
+		}
+	}
+	return cells
+}
+
+func hourOfWeekIndex(weekday, hour int) int {
+	return (weekday-1)*24 + hour
+}
@@ -0,0 +1,70 @@
+//go:build all_tests
+
+package netlog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepo_stats(t *testing.T) {
+	ctx := context.Background()
+	repo, shutdown := testRepoSetup(t)
+	defer shutdown()
+
+	_, err := deleteAllVisits(ctx, repo)
+	require.NoError(t, err)
+
+	// Monday, 10 March 2025
+	monday := time.Date(2025, 3, 10, 9, 30, 0, 0, time.UTC)
+	for _, v := range []*Visit{
+		{Source: "chrome", Device: "mb-serj", URL: "https://old.example.com/", Timestamp: monday.AddDate(0, -1, 0)},
+		{Source: "chrome", Device: "mb-serj", URL: "https://GitHub.com/a", Timestamp: monday},
+		{Source: "chrome", Device: "mb-serj", URL: "https://user@github.com:443/b", Timestamp: monday.Add(time.Minute)},
+		{Source: "safari", Device: "iphone", URL: "https://old.example.com/x", Timestamp: monday.AddDate(0, 0, 2)},
+		{Source: "safari", Device: "iphone", URL: "https://go.dev/", Timestamp: monday.AddDate(0, 0, 2).Add(time.Hour)},
+		{Source: "safari", Device: "iphone", URL: "https://go.dev/doc", Timestamp: monday.AddDate(0, 0, 3)},
+	} {
+		require.NoError(t, repo.AddVisit(ctx, v))
+	}
+
+	week := StatsRange{From: time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC), To: time.Date(2025, 3, 17, 0, 0, 0, 0, time.UTC)}
+
+	hosts, err := repo.TopHosts(ctx, week, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []HostCount{
+		{Host: "github.com", Visits: 2},
+		{Host: "go.dev", Visits: 2},
+		{Host: "old.example.com", Visits: 1},
+	}, hosts)
+
+	days, err := repo.VisitsPerDay(ctx, week)
+	require.NoError(t, err)
+	require.Len(t, days, 7)
+	assert.Equal(t, []int{2, 0, 2, 1, 0, 0, 0}, []int{days[0].Visits, days[1].Visits, days[2].Visits, days[3].Visits, days[4].Visits, days[5].Visits, days[6].Visits})
+
+	cells, err := repo.VisitsPerHourOfWeek(ctx, week)
+	require.NoError(t, err)
+	require.Len(t, cells, 7*24)
+	assert.Equal(t, 2, cells[hourOfWeekIndex(1, 9)].Visits)
+	assert.Equal(t, 1, cells[hourOfWeekIndex(3, 10)].Visits)
+
+	split, err := repo.SourceDeviceSplit(ctx, week)
+	require.NoError(t, err)
+	assert.Equal(t, []SourceDeviceCount{
+		{Source: "safari", Device: "iphone", Visits: 3},
+		{Source: "chrome", Device: "mb-serj", Visits: 2},
+	}, split)
+
+	domains, err := repo.NewDomains(ctx, week, 10)
+	require.NoError(t, err)
+	require.Len(t, domains, 2)
+	assert.Equal(t, "go.dev", domains[0].Host)
+	assert.Equal(t, 2, domains[0].Visits)
+	assert.Equal(t, "github.com", domains[1].Host)
+	assert.True(t, monday.Equal(domains[1].FirstSeen))
+}
@@ -0,0 +1,161 @@
+package netlog
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	visitsStreamRedisChannel = "netlog-visits"
+	// a subscriber more than that many visits behind is dropped, and catches up when it reconnects
+	visitsSubscriptionBuffer = 64
+)
+
+// VisitsBroker fans out the newly stored visits to the live stream subscribers. With a redis client, the
+// visits go through redis pub/sub first, so the subscribers on all the service instances get them.
+type VisitsBroker struct {
+	redis       *redis.Client
+	mutex       sync.Mutex
+	subscribers map[*VisitsSubscription]struct{}
+	closed      bool
+}
+
+type VisitsSubscription struct {
+	filter *SearchQuery
+	visits chan *Visit
+}
+
+// Visits returns the channel of the visits matching the subscription filter. It's closed when the
+// subscriber falls behind, or the broker is stopped.
+func (s *VisitsSubscription) Visits() <-chan *Visit {
+	return s.visits
+}
+
+// NewVisitsBroker makes the broker, in-process only if redisClient is nil
+func NewVisitsBroker(redisClient *redis.Client) *VisitsBroker {
+	return &VisitsBroker{
+		redis:       redisClient,
+		subscribers: map[*VisitsSubscription]struct{}{},
+	}
+}
+
+// Run receives the visits published over redis (by any instance), until the context is done, and then
+// closes all the subscriptions
+func (b *VisitsBroker) Run(ctx context.Context) {
+	defer b.close()
+
+	if b.redis == nil {
+		<-ctx.Done()
+		return
+	}
+
+	pubsub := b.redis.Subscribe(ctx, visitsStreamRedisChannel)
+	defer func() {
+		if err := pubsub.Close(); err != nil {
+			log.Warnf("netlog visits broker, close redis subscription: %s", err)
+		}
+	}()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			var visit Visit
+			if err := json.Unmarshal([]byte(msg.Payload), &visit); err != nil {
+				log.Errorf("netlog visits broker, unmarshal visit: %s", err)
+				continue
+			}
+			b.fanOut(&visit)
+		}
+	}
+}
+
+// Publish sends the visit to the subscribers. If redis fails, only the subscribers of this instance get it.
+func (b *VisitsBroker) Publish(ctx context.Context, visit *Visit) {
+	if b.redis == nil {
+		b.fanOut(visit)
+		return
+	}
+
+	visitJson, err := json.Marshal(visit)
+	if err != nil {
+		log.Errorf("netlog visits broker, marshal visit: %s", err)
+		return
+	}
+	if err := b.redis.Publish(ctx, visitsStreamRedisChannel, visitJson).Err(); err != nil {
+		log.Errorf("netlog visits broker, publish visit [%d]: %s", visit.Id, err)
+		b.fanOut(visit)
+	}
+}
+
+// Subscribe returns a subscription to the visits matching the filter, which has to be unsubscribed when done
+func (b *VisitsBroker) Subscribe(filter *SearchQuery) *VisitsSubscription {
+	sub := &VisitsSubscription{
+		filter: filter,
+		visits: make(chan *Visit, visitsSubscriptionBuffer),
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.closed {
+		close(sub.visits)
+		return sub
+	}
+	b.subscribers[sub] = struct{}{}
+	return sub
+}
+
+func (b *VisitsBroker) Unsubscribe(sub *VisitsSubscription) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.visits)
+	}
+}
+
+func (b *VisitsBroker) SubscribersCount() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return len(b.subscribers)
+}
+
+func (b *VisitsBroker) fanOut(visit *Visit) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for sub := range b.subscribers {
+		if !sub.filter.Matches(visit) {
+			continue
+		}
+		select {
+		case sub.visits <- visit:
+		default:
+			log.Warnf("netlog visits broker, dropping a subscriber %d visits behind", len(sub.visits))
+			delete(b.subscribers, sub)
+			close(sub.visits)
+		}
+	}
+}
+
+func (b *VisitsBroker) close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.closed = true
+	for sub := range b.subscribers {
+		close(sub.visits)
+	}
+	clear(b.subscribers)
+}
@@ -0,0 +1,177 @@
+package netlog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/2beens/serjtubincom/internal/telemetry/tracing"
+
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	streamHeartbeatInterval = 25 * time.Second
+	streamRetryMillis       = 5000
+	streamReplayBatchSize   = 200
+	// a client further behind gets the reset event, and should reload the visits list instead
+	streamReplayMaxVisits = 1000
+)
+
+// handleStream streams the new visits as server-sent events, with the optional <source>, <device> and <host>
+// URL query params filters. The event IDs are the visit IDs, so a client reconnecting with the Last-Event-ID
+// header (or the <last_event_id> URL query param) first gets the visits it missed. The visits added with
+// /netlog/batch are not streamed live, but they are replayed.
+// Needs the X-SERJ-TOKEN header as all the other routes, so the browser EventSource can't be used as it is.
+func (handler *Handler) handleStream(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracing.GlobalTracer.Start(r.Context(), "netlogHandler.stream")
+	defer span.End()
+
+	lastEventID := -1
+	lastEventIDRaw := r.Header.Get("Last-Event-ID")
+	if lastEventIDRaw == "" {
+		lastEventIDRaw = r.URL.Query().Get("last_event_id")
+	}
+	if lastEventIDRaw != "" {
+		var err error
+		if lastEventID, err = strconv.Atoi(lastEventIDRaw); err != nil || lastEventID < 0 {
+			http.Error(w, "invalid last event id", http.StatusBadRequest)
+			return
+		}
+	}
+	span.SetAttributes(attribute.Int("last-event-id", lastEventID))
+
+	filter := streamFilter(r)
+	span.SetAttributes(attribute.String("filter", filter.String()))
+
+	// the stream outlives the server write timeout
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Warnf("netlog stream, clear write deadline: %s", err)
+	}
+
+	// subscribed before the replay, so no visit falls in between
+	sub := handler.visitsBroker.Subscribe(filter)
+	defer handler.visitsBroker.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	stream := &visitsStream{w: w, rc: rc}
+	stream.write(fmt.Sprintf("retry: %d\n\n", streamRetryMillis))
+
+	lastSentID := lastEventID
+	if lastEventID >= 0 {
+		replayed, err := handler.replayVisits(r, stream, filter, lastEventID)
+		if err != nil {
+			log.Errorf("netlog stream, replay visits after [%d]: %s", lastEventID, err)
+			return
+		}
+		lastSentID = replayed
+	}
+	if stream.flush() != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			stream.write(": ping\n\n")
+		case visit, ok := <-sub.Visits():
+			if !ok {
+				// fell behind, or the server is stopping; the client reconnects and catches up
+				return
+			}
+			if visit.Id <= lastSentID {
+				continue
+			}
+			stream.writeVisit(visit)
+			lastSentID = visit.Id
+		}
+		if stream.flush() != nil {
+			return
+		}
+	}
+}
+
+// replayVisits sends the stored visits after the given ID, and returns the ID of the last one
+func (handler *Handler) replayVisits(r *http.Request, stream *visitsStream, filter *SearchQuery, afterID int) (int, error) {
+	replayed := 0
+	for replayed < streamReplayMaxVisits {
+		visits, err := handler.repo.GetVisitsAfterID(r.Context(), afterID, streamReplayBatchSize)
+		if err != nil {
+			return afterID, err
+		}
+		for _, v := range visits {
+			if filter.Matches(v) {
+				stream.writeVisit(v)
+			}
+		}
+		if len(visits) > 0 {
+			afterID = visits[len(visits)-1].Id
+		}
+		if len(visits) < streamReplayBatchSize {
+			return afterID, nil
+		}
+		replayed += len(visits)
+	}
+
+	stream.write("event: reset\ndata: {}\n\n")
+	return afterID, nil
+}
+
+// streamFilter makes the search query from the stream filters
+func streamFilter(r *http.Request) *SearchQuery {
+	var nodes andNode
+	for _, field := range []string{queryFieldSource, queryFieldDevice, queryFieldHost} {
+		if value := r.URL.Query().Get(field); value != "" {
+			nodes = append(nodes, &termNode{field: field, value: value})
+		}
+	}
+	if len(nodes) == 0 {
+		return &SearchQuery{}
+	}
+	return &SearchQuery{root: nodes}
+}
+
+// visitsStream writes the server-sent events, and keeps the first write error
+type visitsStream struct {
+	w   http.ResponseWriter
+	rc  *http.ResponseController
+	err error
+}
+
+func (s *visitsStream) write(event string) {
+	if s.err != nil {
+		return
+	}
+	_, s.err = s.w.Write([]byte(event))
+}
+
+func (s *visitsStream) writeVisit(visit *Visit) {
+	visitJson, err := json.Marshal(visit)
+	if err != nil {
+		log.Errorf("netlog stream, marshal visit [%d]: %s", visit.Id, err)
+		return
+	}
+	s.write(fmt.Sprintf("id: %d\nevent: visit\ndata: %s\n\n", visit.Id, visitJson))
+}
+
+func (s *visitsStream) flush() error {
+	if s.err != nil {
+		return s.err
+	}
+	s.err = s.rc.Flush()
+	return s.err
+}
@@ -0,0 +1,176 @@
+package netlog
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/2beens/serjtubincom/internal/telemetry/metrics"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVisitsBroker(t *testing.T) {
+	broker := NewVisitsBroker(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	brokerDone := make(chan struct{})
+	go func() {
+		broker.Run(ctx)
+		close(brokerDone)
+	}()
+
+	all := broker.Subscribe(&SearchQuery{})
+	chrome := broker.Subscribe(MustNewSearchQuery("", "url", "chrome"))
+	slow := broker.Subscribe(&SearchQuery{})
+	assert.Equal(t, 3, broker.SubscribersCount())
+
+	broker.Publish(ctx, &Visit{Id: 1, Source: "safari", URL: "https://one.com"})
+	broker.Publish(ctx, &Visit{Id: 2, Source: "chrome", URL: "https://two.com"})
+
+	assert.Equal(t, 1, (<-all.Visits()).Id)
+	assert.Equal(t, 2, (<-all.Visits()).Id)
+	assert.Equal(t, 2, (<-chrome.Visits()).Id)
+
+	broker.Unsubscribe(all)
+	_, open := <-all.Visits()
+	assert.False(t, open)
+	// unsubscribing again is fine
+	broker.Unsubscribe(all)
+
+	// the subscriber that doesn't keep up is dropped, it has the first two visits buffered already
+	for i := range visitsSubscriptionBuffer - 2 {
+		broker.Publish(ctx, &Visit{Id: 3 + i, Source: "safari"})
+	}
+	assert.Equal(t, 2, broker.SubscribersCount())
+	broker.Publish(ctx, &Visit{Id: 100, Source: "safari"})
+	assert.Equal(t, 1, broker.SubscribersCount())
+	received := 0
+	for range slow.Visits() {
+		received++
+	}
+	assert.Equal(t, visitsSubscriptionBuffer, received)
+
+	// stopping the broker ends all the subscriptions, and the new ones are closed right away
+	cancel()
+	<-brokerDone
+	_, open = <-chrome.Visits()
+	assert.False(t, open)
+	_, open = <-broker.Subscribe(&SearchQuery{}).Visits()
+	assert.False(t, open)
+}
+
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// readSSEEvent reads the next event, skipping the comments and the retry field
+func readSSEEvent(t *testing.T, reader *bufio.Reader) sseEvent {
+	t.Helper()
+
+	var event sseEvent
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if event.event != "" {
+				return event
+			}
+		case strings.HasPrefix(line, "id: "):
+			event.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestNetlogHandler_stream(t *testing.T) {
+	repo := NewRepoMock()
+	broker := NewVisitsBroker(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	go broker.Run(ctx)
+
+	r := mux.NewRouter()
+	handler := NewHandler(repo, metrics.NewTestManager(), "", nil, DefaultSessionIdleGap, NewRedactor(), broker)
+	handler.SetupRoutes(r)
+	server := httptest.NewServer(r)
+	defer server.Close()
+	// the streams have to end before the server is closed
+	defer cancel()
+
+	openStream := func(query, lastEventID string) *bufio.Reader {
+		req, err := http.NewRequestWithContext(ctx, "GET", server.URL+"/netlog/stream"+query, nil)
+		require.NoError(t, err)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := server.Client().Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = resp.Body.Close() })
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+		return bufio.NewReader(resp.Body)
+	}
+	postVisit := func(source, visitURL string) {
+		body := `{"source":"` + source + `","url":"` + visitURL + `","timestamp":` + strconv.FormatInt(time.Now().UnixMilli(), 10) + `}`
+		req, err := http.NewRequest("POST", server.URL+"/netlog/new", strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := server.Client().Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+	waitForSubscribers := func(count int) {
+		require.Eventually(t, func() bool {
+			return broker.SubscribersCount() == count
+		}, time.Second, 5*time.Millisecond)
+	}
+
+	allStream := openStream("", "")
+	githubStream := openStream("?host=github.com&source=chrome", "")
+	waitForSubscribers(2)
+
+	postVisit("safari", "https://go.dev/doc")
+	postVisit("chrome", "https://docs.github.com/en")
+
+	event := readSSEEvent(t, allStream)
+	assert.Equal(t, "visit", event.event)
+	assert.Equal(t, "2", event.id)
+	assert.Contains(t, event.data, `"url":"https://go.dev/doc"`)
+	event = readSSEEvent(t, allStream)
+	assert.Equal(t, "3", event.id)
+
+	event = readSSEEvent(t, githubStream)
+	assert.Equal(t, "3", event.id)
+	assert.Contains(t, event.data, `"host":"docs.github.com"`)
+
+	// resumed after the first visit, the missed ones are replayed before the live ones
+	resumedStream := openStream("", "2")
+	waitForSubscribers(3)
+	postVisit("chrome", "https://github.com/2beens")
+	assert.Equal(t, "3", readSSEEvent(t, resumedStream).id)
+	assert.Equal(t, "4", readSSEEvent(t, resumedStream).id)
+	assert.Equal(t, "4", readSSEEvent(t, allStream).id)
+	assert.Equal(t, "4", readSSEEvent(t, githubStream).id)
+
+	req, err := http.NewRequest("GET", server.URL+"/netlog/stream", nil)
+	require.NoError(t, err)
+	req.Header.Set("Last-Event-ID", "abc")
+	resp, err := server.Client().Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
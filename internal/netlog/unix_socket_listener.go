@@ -2,12 +2,12 @@ package netlog
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"path/filepath"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/2beens/serjtubincom/internal/telemetry/metrics"
@@ -18,11 +18,13 @@ import (
 
 // VisitsBackupUnixSocketListenerSetup - this is a deliberately overengineered method of communicating of netlog backup with the main service
 // just so I have a piece of code that uses UNIX socket interprocess communication, and also to avoid
-// adding the Prometheus push gateway to push metrics to it
+// adding the Prometheus push gateway to push metrics to it.
+// The backup runs are reported with the messages described in backup_ipc.go, and saved to the backup runs history.
 func VisitsBackupUnixSocketListenerSetup(
 	ctx context.Context,
 	socketAddrDir, socketFileName string,
 	instr *metrics.Manager,
+	runsStore backupRunsStore,
 ) (net.Addr, error) {
 	socket := filepath.Join(socketAddrDir, socketFileName)
 	listener, err := net.Listen("unix", socket)
@@ -69,73 +71,67 @@ func VisitsBackupUnixSocketListenerSetup(
 				continue
 			}
 
-			go func() {
-				defer func() {
-					if err := conn.Close(); err != nil {
-						log.Errorf("netlog backup, close conn: %s", err)
-					}
-				}()
-
-				buf := make([]byte, 1024)
-				n, err := conn.Read(buf)
-				if err != nil {
-					return
-				}
+			go handleBackupIPCConn(ctx, conn, instr, runsStore)
+		}
+	}()
 
-				messageReceived := pkg.BytesToString(buf[:n])
-				log.Infof("netlog backup unix socket received: %s", messageReceived)
+	return listener.Addr(), nil
+}
 
-				msgParts := strings.Split(messageReceived, "||")
-				if len(msgParts) != 2 {
-					log.Errorf("netlog backup conn, invalid message received: %s", messageReceived)
-					return
-				}
+// handleBackupIPCConn reads the messages until the backup closes the connection, and acks each of them
+func handleBackupIPCConn(ctx context.Context, conn net.Conn, instr *metrics.Manager, runsStore backupRunsStore) {
+	defer func() {
+		if err := conn.Close(); err != nil {
+			log.Errorf("netlog backup, close conn: %s", err)
+		}
+	}()
 
-				durationInfo := msgParts[1]
-				sendNetlogBackupDurationInfo(durationInfo, instr)
+	for {
+		msg, err := readBackupIPCMessage(conn)
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		if err != nil {
+			log.Errorf("netlog backup conn, read message: %s", err)
+			return
+		}
 
-				visitsCountInfo := msgParts[0]
-				sendNetlogBackupVisitsCount(visitsCountInfo, instr)
+		log.Infof("netlog backup unix socket received: %s [run %s]", msg.Type, msg.RunId)
 
-				_, err = conn.Write([]byte("ok"))
-				if err != nil {
-					log.Errorf("netlog backup conn, send response: %s", err)
-				}
-			}()
+		ack := &BackupIPCMessage{
+			Version:   BackupIPCProtocolVersion,
+			Type:      BackupIPCAck,
+			RunId:     msg.RunId,
+			Timestamp: time.Now(),
+		}
+		if err := handleBackupIPCMessage(ctx, msg, instr, runsStore); err != nil {
+			log.Errorf("netlog backup conn, handle message: %s", err)
+			ack.Error = err.Error()
 		}
-	}()
-
-	return listener.Addr(), nil
-}
 
-func sendNetlogBackupDurationInfo(durationInfoMsg string, metrics *metrics.Manager) {
-	durationInfoParts := strings.Split(durationInfoMsg, "::")
-	if len(durationInfoParts) != 2 {
-		log.Errorf("netlog backup conn, invalid duration info received: %s", durationInfoMsg)
-		return
+		if err := writeBackupIPCMessage(conn, ack); err != nil {
+			log.Errorf("netlog backup conn, send ack: %s", err)
+			return
+		}
 	}
+}
 
-	durationInSec, err := strconv.ParseFloat(durationInfoParts[1], 64)
-	if err != nil {
-		log.Errorf("netlog backup conn, invalid duration info received: %s", err)
-		return
+func handleBackupIPCMessage(ctx context.Context, msg *BackupIPCMessage, instr *metrics.Manager, runsStore backupRunsStore) error {
+	if err := msg.validate(); err != nil {
+		return err
 	}
 
-	metrics.HistNetlogBackupDuration.Observe(durationInSec)
-}
-
-func sendNetlogBackupVisitsCount(visitsCountInfoMsg string, metrics *metrics.Manager) {
-	visitsCountInfoParts := strings.Split(visitsCountInfoMsg, "::")
-	if len(visitsCountInfoParts) != 2 {
-		log.Errorf("netlog backup conn, invalid visits info received: %s", visitsCountInfoMsg)
-		return
+	switch msg.Type {
+	case BackupIPCRunFinished:
+		instr.HistNetlogBackupDuration.Observe(msg.DurationSeconds)
+		instr.CounterVisitsBackups.Add(float64(msg.VisitsCount))
+	case BackupIPCRunFailed:
+		log.Errorf("netlog backup run %s failed: %s", msg.RunId, msg.Error)
 	}
 
-	visitsCount, err := strconv.Atoi(visitsCountInfoParts[1])
-	if err != nil {
-		log.Errorf("netlog backup conn, invalid visits counter: %s", err)
-		return
+	if err := runsStore.SaveBackupRunEvent(ctx, msg); err != nil {
+		return fmt.Errorf("save backup run: %w", err)
 	}
 
-	metrics.CounterVisitsBackups.Add(float64(visitsCount))
+	return nil
 }
@@ -9,7 +9,6 @@ import (
 	"time"
 
 	"github.com/2beens/serjtubincom/internal/telemetry/metrics"
-	"github.com/2beens/serjtubincom/pkg"
 
 	"github.com/prometheus/client_golang/prometheus/testutil"
 	promcl "github.com/prometheus/client_model/go"
@@ -32,26 +31,75 @@ func TestVisitsBackupUnixSocketListenerSetup(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	socket := fmt.Sprintf("%d.sock", os.Getpid())
 
-	addr, err := VisitsBackupUnixSocketListenerSetup(ctx, dir, socket, metrics)
+	runsRepo := NewRepoMock()
+	addr, err := VisitsBackupUnixSocketListenerSetup(ctx, dir, socket, metrics, runsRepo)
 	require.NoError(t, err)
 
 	/////////////////
 	conn, err := net.DialTimeout("unix", addr.String(), 20*time.Second)
 	require.NoError(t, err)
+	defer conn.Close()
 
 	require.NoError(t, conn.SetDeadline(time.Now().Add(2*time.Second)))
 
+	send := func(msg *BackupIPCMessage) *BackupIPCMessage {
+		t.Helper()
+		require.NoError(t, writeBackupIPCMessage(conn, msg))
+		ack, err := readBackupIPCMessage(conn)
+		require.NoError(t, err)
+		assert.Equal(t, BackupIPCAck, ack.Type)
+		assert.Equal(t, msg.RunId, ack.RunId)
+		return ack
+	}
+
 	visitsCount := 15
 	duration := 12.1234
-	_, err = conn.Write([]byte(fmt.Sprintf("visits-count::%d||duration::%f", visitsCount, duration)))
-	require.NoError(t, err)
-
-	buf := make([]byte, 1024)
-	n, err := conn.Read(buf)
-	require.NoError(t, err)
-
-	msgReceived := pkg.BytesToString(buf[:n])
-	assert.Equal(t, "ok", msgReceived)
+	startedAt := time.Now().Add(-time.Duration(duration * float64(time.Second)))
+
+	// multiple messages over the same connection
+	ack := send(&BackupIPCMessage{
+		Version:   BackupIPCProtocolVersion,
+		Type:      BackupIPCRunStarted,
+		RunId:     "run-1",
+		Timestamp: startedAt,
+		Target:    BackupTargetGoogleDrive,
+	})
+	assert.Empty(t, ack.Error)
+	ack = send(&BackupIPCMessage{
+		Version:         BackupIPCProtocolVersion,
+		Type:            BackupIPCRunFinished,
+		RunId:           "run-1",
+		Timestamp:       time.Now(),
+		VisitsCount:     visitsCount,
+		ChunksDone:      1,
+		ChunksTotal:     1,
+		DurationSeconds: duration,
+	})
+	assert.Empty(t, ack.Error)
+
+	// unknown versions and message types are rejected
+	ack = send(&BackupIPCMessage{
+		Version:   BackupIPCProtocolVersion + 1,
+		Type:      BackupIPCRunFinished,
+		RunId:     "run-2",
+		Timestamp: time.Now(),
+	})
+	assert.Equal(t, "unsupported protocol version: 2", ack.Error)
+	ack = send(&BackupIPCMessage{
+		Version:   BackupIPCProtocolVersion,
+		Type:      "visits-count::15",
+		RunId:     "run-2",
+		Timestamp: time.Now(),
+	})
+	assert.Equal(t, "unknown message type: visits-count::15", ack.Error)
+
+	require.Len(t, runsRepo.BackupRuns, 1)
+	run := runsRepo.BackupRuns["run-1"]
+	require.NotNil(t, run)
+	assert.Equal(t, BackupRunFinished, run.Status)
+	assert.Equal(t, BackupTargetGoogleDrive, run.Target)
+	assert.Equal(t, visitsCount, run.VisitsCount)
+	assert.Equal(t, duration, run.DurationSeconds)
 
 	// stop unix listener
 	cancel()
@@ -23,6 +23,7 @@ import (
 	"github.com/2beens/serjtubincom/internal/middleware"
 	"github.com/2beens/serjtubincom/internal/misc"
 	"github.com/2beens/serjtubincom/internal/netlog"
+	netlogmcp "github.com/2beens/serjtubincom/internal/netlog/mcp"
 	notesBox "github.com/2beens/serjtubincom/internal/notes_box"
 	"github.com/2beens/serjtubincom/internal/spotify"
 	"github.com/2beens/serjtubincom/internal/telemetry/metrics"
@@ -59,6 +60,9 @@ type Server struct {
 	weatherApi     *weather.Api
 	quotesManager  *misc.QuotesManager
 	spotifyHandler *spotify.Handler
+	netlogRedactor *netlog.Redactor
+	// fans out the new netlog visits to the live stream
+	netlogVisitsBroker *netlog.VisitsBroker
 
 	redisClient  *redis.Client
 	loginChecker *auth.LoginChecker
@@ -184,6 +188,16 @@ func NewServer(
 	go spotifyTracker.PeriodicStatusCheck()
 	log.Debugf("spotify tracker redirect uri: %s", params.Config.SpotifyRedirectURI)
 
+	netlogRedactor := netlog.NewRedactor()
+	if err := netlogRedactor.Update(netlogRedactionRules(params.Config)); err != nil {
+		return nil, fmt.Errorf("netlog redaction rules: %w", err)
+	}
+
+	netlogVisitsBroker := netlog.NewVisitsBroker(nil)
+	if params.Config.NetlogStreamOverRedis {
+		netlogVisitsBroker = netlog.NewVisitsBroker(rdb)
+	}
+
 	s := &Server{
 		config:                params.Config,
 		dbPool:                dbPool,
@@ -203,6 +217,9 @@ func NewServer(
 		),
 		versionInfo:    params.VersionInfo,
 		spotifyHandler: spotifyHandler,
+		netlogRedactor: netlogRedactor,
+
+		netlogVisitsBroker: netlogVisitsBroker,
 
 		redisClient:  rdb,
 		authService:  authService,
@@ -234,6 +251,29 @@ func NewServer(
 	return s, nil
 }
 
+// ReloadNetlogRedaction replaces the netlog redaction rules with the ones from the (reloaded) config.
+// The current rules are kept if the new ones are invalid.
+func (s *Server) ReloadNetlogRedaction(cfg *config.Config) error {
+	if err := s.netlogRedactor.Update(netlogRedactionRules(cfg)); err != nil {
+		return err
+	}
+	log.Printf(
+		"netlog redaction rules reloaded: %d drop hosts, %d strip query params, %d hash path hosts, %d truncate path hosts",
+		len(cfg.NetlogRedactDropHosts), len(cfg.NetlogRedactStripQueryParams),
+		len(cfg.NetlogRedactHashPathHosts), len(cfg.NetlogRedactTruncatePathHosts),
+	)
+	return nil
+}
+
+func netlogRedactionRules(cfg *config.Config) netlog.RedactionRules {
+	return netlog.RedactionRules{
+		DropHosts:         cfg.NetlogRedactDropHosts,
+		StripQueryParams:  cfg.NetlogRedactStripQueryParams,
+		HashPathHosts:     cfg.NetlogRedactHashPathHosts,
+		TruncatePathHosts: cfg.NetlogRedactTruncatePathHosts,
+	}
+}
+
 func (s *Server) routerSetup() (*mux.Router, error) {
 	r := mux.NewRouter()
 	r.Use(otelmux.Middleware("main-router"))
@@ -241,6 +281,10 @@ func (s *Server) routerSetup() (*mux.Router, error) {
 	blogHandler := blog.NewBlogHandler(
 		blog.NewRepo(s.dbPool),
 		s.loginChecker,
+		blog.FeedLinks{
+			SiteURL:  s.config.BlogSiteURL,
+			FeedsURL: s.config.BlogFeedsURL,
+		},
 	)
 	blogHandler.SetupRoutes(r)
 
@@ -264,6 +308,9 @@ func (s *Server) routerSetup() (*mux.Router, error) {
 		s.metricsManager,
 		s.browserRequestsSecret,
 		s.loginChecker,
+		time.Duration(s.config.NetlogSessionIdleGapMinutes)*time.Minute,
+		s.netlogRedactor,
+		s.netlogVisitsBroker,
 	)
 	netlogHandler.SetupRoutes(r)
 
@@ -319,6 +366,15 @@ func (s *Server) routerSetup() (*mux.Router, error) {
 	// /mcp is protected: not in allowedPaths, so it always requires auth. If config.MCPSecret is set,
 	// only requests with Authorization: Bearer <secret> or X-MCP-Secret can access /mcp; otherwise
 	// same auth as API (X-SERJ-TOKEN + login). See internal/middleware/auth.go and internal/gymstats/mcp/README.md.
+	// The netlog (browsing history) MCP is a sibling server under /mcp, so it's protected the same way,
+	// and has to be routed before /mcp. See internal/netlog/mcp/README.md.
+	netlogMCPServer := netlogmcp.NewServer(
+		netlog.NewRepo(s.dbPool),
+		time.Duration(s.config.NetlogSessionIdleGapMinutes)*time.Minute,
+	)
+	netlogMCPHandler := mcpsdk.NewStreamableHTTPHandler(func(*http.Request) *mcpsdk.Server { return netlogMCPServer }, nil)
+	r.PathPrefix("/mcp/netlog").Handler(netlogMCPHandler)
+
 	mcpServer := gymstatsmcp.NewServer(s.dbPool, gsRepo)
 	mcpHandler := mcpsdk.NewStreamableHTTPHandler(func(*http.Request) *mcpsdk.Server { return mcpServer }, nil)
 	r.PathPrefix("/mcp").Handler(mcpHandler)
@@ -391,6 +447,25 @@ func (s *Server) Serve(ctx context.Context, host string, port int) {
 
 	s.metricsManager.GaugeLifeSignal.Set(1)
 
+	// stopped with the context, which also ends the netlog streams, so they don't hold up the shutdown
+	go s.netlogVisitsBroker.Run(ctx)
+
+	// the old netlog visit partitions are archived with cmd/netlog_partitions, only the new ones are made here
+	go netlog.MaintainVisitPartitions(ctx, netlog.NewRepo(s.dbPool), s.config.NetlogPartitionsAheadMonths)
+
+	// the older netlog focus reports are rebuilt on demand, over the API
+	go netlog.MaintainFocusReports(
+		ctx,
+		netlog.NewFocusReporter(netlog.NewRepo(s.dbPool), time.Duration(s.config.NetlogSessionIdleGapMinutes)*time.Minute),
+		time.Duration(s.config.NetlogFocusReportsIntervalMinutes)*time.Minute,
+	)
+
+	go blog.RunScheduledPublisher(
+		ctx,
+		blog.NewRepo(s.dbPool),
+		time.Duration(s.config.BlogPublisherIntervalSeconds)*time.Second,
+	)
+
 	// netlog backup unix socket
 	s.setNetlogBackupUnixSocket(ctx)
 }
@@ -459,14 +534,18 @@ func (s *Server) setNetlogBackupUnixSocket(ctx context.Context) {
 		return
 	}
 
+	netlogRepo := netlog.NewRepo(s.dbPool)
 	if addr, err := netlog.VisitsBackupUnixSocketListenerSetup(
 		ctx,
 		s.config.NetlogUnixSocketAddrDir,
 		s.config.NetlogUnixSocketFileName,
 		s.metricsManager,
+		netlogRepo,
 	); err != nil {
 		log.Errorf("failed to create netlog backup unix socket: %s", err)
 	} else {
 		log.Debugf("netlog backup unix socket: %s", addr)
 	}
+
+	go netlog.MonitorBackupRuns(ctx, netlogRepo, s.config.NetlogBackupAlertAfterDays)
 }
@@ -1,30 +1,178 @@
+-- named multi-part blog posts series, see blog.Series
+CREATE TABLE public.blog_series
+(
+    id    SERIAL PRIMARY KEY,
+    slug  VARCHAR NOT NULL UNIQUE,
+    title VARCHAR NOT NULL
+);
+
+ALTER TABLE public.blog_series OWNER TO postgres;
+
 CREATE TABLE public.blog
 (
-    id         SERIAL PRIMARY KEY,
-    title      VARCHAR NOT NULL,
-    created_at TIMESTAMPTZ NOT NULL,
-    content    TEXT    NOT NULL,
-    claps      INTEGER NOT NULL DEFAULT 0
+    id             SERIAL PRIMARY KEY,
+    title          VARCHAR     NOT NULL,
+    created_at     TIMESTAMPTZ NOT NULL,
+    content        TEXT        NOT NULL,
+    claps          INTEGER     NOT NULL DEFAULT 0,
+    -- the content rendered to html and its table of contents, rendered again when the
+    -- render_version is older than blog.RenderVersion
+    content_html   TEXT,
+    toc            JSONB,
+    reading_time   INTEGER     NOT NULL DEFAULT 0,
+    render_version INTEGER     NOT NULL DEFAULT 0,
+    -- draft, scheduled, published or unlisted, see blog.Status
+    status         VARCHAR     NOT NULL DEFAULT 'published',
+    -- when the scheduled post is published
+    publish_at     TIMESTAMPTZ,
+    -- the series the post is a part of, and its part number from 1
+    series_id      INTEGER REFERENCES public.blog_series (id) ON DELETE SET NULL,
+    series_part    INTEGER,
+    UNIQUE (series_id, series_part)
 );
 
 ALTER TABLE public.blog OWNER TO postgres;
 CREATE INDEX ix_blog_created_at ON public.blog USING btree (created_at);
+CREATE INDEX ix_blog_scheduled_publish_at ON public.blog (publish_at) WHERE status = 'scheduled';
+
+-- immutable blog title and content versions, one stored with each change, see blog.Revision
+CREATE TABLE public.blog_revision
+(
+    blog_id    INTEGER     NOT NULL REFERENCES public.blog (id) ON DELETE CASCADE,
+    -- from 1, within the blog
+    revision   INTEGER     NOT NULL,
+    title      VARCHAR     NOT NULL,
+    content    TEXT        NOT NULL,
+    author     VARCHAR     NOT NULL,
+    summary    VARCHAR     NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (blog_id, revision)
+);
+
+ALTER TABLE public.blog_revision OWNER TO postgres;
+
+CREATE TABLE public.blog_tag
+(
+    blog_id INTEGER NOT NULL REFERENCES public.blog (id) ON DELETE CASCADE,
+    tag     VARCHAR NOT NULL,
+    PRIMARY KEY (blog_id, tag)
+);
+
+ALTER TABLE public.blog_tag OWNER TO postgres;
+CREATE INDEX ix_blog_tag_tag ON public.blog_tag (tag);
 
 -- NETLOG DB SETUP
 CREATE SCHEMA netlog;
+-- partitioned by month (UTC) on the visit timestamp, the monthly partitions (e.g. netlog.visit_p2024_01)
+-- are created ahead by the service, see netlog.EnsureVisitPartitions, and the old ones can be archived
+-- with cmd/netlog_partitions
 CREATE TABLE netlog.visit
 (
-    id        SERIAL PRIMARY KEY,
+    id        SERIAL,
     title     VARCHAR,
     source    VARCHAR,
     device    VARCHAR,
     url       VARCHAR     NOT NULL,
-    timestamp TIMESTAMPTZ NOT NULL
-);
+    timestamp TIMESTAMPTZ NOT NULL,
+    -- derived from the url when the visit is stored, see netlog.Visit.DeriveURLFields
+    host              VARCHAR,
+    registered_domain VARCHAR,
+    canonical_url     VARCHAR,
+    -- full-text search document: title (weight A), url host (B) and the rest of the url tokens (C)
+    search_vector TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', COALESCE(title, '')), 'A') ||
+        setweight(to_tsvector('simple', COALESCE(substring(url from '^[a-zA-Z][a-zA-Z0-9+.-]*://([^/?#:@]+)'), '')), 'B') ||
+        setweight(to_tsvector('simple', regexp_replace(url, '[^a-zA-Z0-9]+', ' ', 'g')), 'C')
+    ) STORED,
+    -- the partition key has to be in the primary key, the ids are still unique, as they come from the sequence
+    PRIMARY KEY (id, timestamp)
+) PARTITION BY RANGE (timestamp);
+
+-- for the visits with no monthly partition yet, moved to their partitions by the partitions maintenance
+CREATE TABLE netlog.visit_default PARTITION OF netlog.visit DEFAULT;
 
 ALTER TABLE netlog.visit OWNER TO postgres;
 CREATE INDEX ix_visit_created_at ON netlog.visit USING btree (timestamp);
+CREATE INDEX ix_visit_timestamp_id ON netlog.visit USING btree (timestamp, id);
 CREATE INDEX ix_visit_url ON netlog.visit (url);
+CREATE INDEX ix_visit_search_vector ON netlog.visit USING gin (search_vector);
+CREATE INDEX ix_visit_host ON netlog.visit (host);
+CREATE INDEX ix_visit_registered_domain ON netlog.visit (registered_domain);
+CREATE INDEX ix_visit_canonical_url ON netlog.visit (canonical_url);
+
+-- client generated IDs of the visits added via /netlog/batch, so the retried batches don't create duplicates
+CREATE TABLE netlog.visit_client_id
+(
+    client_id  VARCHAR PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE netlog.visit_client_id OWNER TO postgres;
+
+-- netlog visits starred, tagged, annotated or put in the read later queue, see netlog.VisitAnnotation
+-- (no foreign key, as the visit ids are not unique by themselves in the partitioned table, the annotations
+-- are deleted with their visits by netlog.Repo.DeleteVisits, and kept for the archived ones)
+CREATE TABLE netlog.visit_annotation
+(
+    visit_id       INTEGER PRIMARY KEY,
+    starred        BOOLEAN     NOT NULL DEFAULT false,
+    tags           TEXT[]      NOT NULL DEFAULT '{}',
+    note           TEXT        NOT NULL DEFAULT '',
+    -- the visit is in the read later queue until its canonical url is visited again after this time
+    read_later_at  TIMESTAMPTZ,
+    read_later_url VARCHAR,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE netlog.visit_annotation OWNER TO postgres;
+CREATE INDEX ix_visit_annotation_tags ON netlog.visit_annotation USING gin (tags);
+CREATE INDEX ix_visit_annotation_updated_at ON netlog.visit_annotation USING btree (updated_at);
+
+-- netlog backup runs history, reported by the netlog backup over the unix socket
+CREATE TABLE netlog.backup_run
+(
+    run_id           VARCHAR PRIMARY KEY,
+    target           VARCHAR,
+    status           VARCHAR     NOT NULL,
+    started_at       TIMESTAMPTZ NOT NULL,
+    updated_at       TIMESTAMPTZ NOT NULL,
+    visits_count     INTEGER     NOT NULL DEFAULT 0,
+    chunks_done      INTEGER     NOT NULL DEFAULT 0,
+    chunks_total     INTEGER     NOT NULL DEFAULT 0,
+    duration_seconds DOUBLE PRECISION,
+    error            TEXT
+);
+
+ALTER TABLE netlog.backup_run OWNER TO postgres;
+CREATE INDEX ix_backup_run_started_at ON netlog.backup_run USING btree (started_at);
+
+-- netlog hosts categories for the focus reports, see netlog.CategoryRule
+CREATE TABLE netlog.category_rule
+(
+    id         SERIAL PRIMARY KEY,
+    pattern    VARCHAR     NOT NULL UNIQUE,
+    category   VARCHAR     NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE netlog.category_rule OWNER TO postgres;
+
+-- netlog daily and weekly time spent per category, see netlog.FocusReport
+CREATE TABLE netlog.focus_report
+(
+    period       VARCHAR          NOT NULL,
+    period_start TIMESTAMPTZ      NOT NULL,
+    period_end   TIMESTAMPTZ      NOT NULL,
+    visits       INTEGER          NOT NULL,
+    seconds      DOUBLE PRECISION NOT NULL,
+    -- [{"category": "work", "seconds": 3600, "visits": 42}, ...], the most time spent first
+    categories   JSONB            NOT NULL DEFAULT '[]',
+    updated_at   TIMESTAMPTZ      NOT NULL DEFAULT now(),
+    PRIMARY KEY (period, period_start)
+);
+
+ALTER TABLE netlog.focus_report OWNER TO postgres;
 
 CREATE TABLE public.note
 (
@@ -0,0 +1,11 @@
+-- netlog full-text search: generated tsvector over visit title and url tokens, with a GIN index
+-- (for databases created before the column was added to db_schema.sql)
+-- note: adding a stored generated column rewrites the table, run it in a quiet period
+ALTER TABLE netlog.visit
+    ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', COALESCE(title, '')), 'A') ||
+        setweight(to_tsvector('simple', COALESCE(substring(url from '^[a-zA-Z][a-zA-Z0-9+.-]*://([^/?#:@]+)'), '')), 'B') ||
+        setweight(to_tsvector('simple', regexp_replace(url, '[^a-zA-Z0-9]+', ' ', 'g')), 'C')
+    ) STORED;
+
+CREATE INDEX ix_visit_search_vector ON netlog.visit USING gin (search_vector);
@@ -0,0 +1,2 @@
+-- netlog keyset (cursor) pagination: visits are paged by (timestamp, id)
+CREATE INDEX CONCURRENTLY ix_visit_timestamp_id ON netlog.visit USING btree (timestamp, id);
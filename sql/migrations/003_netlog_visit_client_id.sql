@@ -0,0 +1,8 @@
+-- netlog batch ingestion: client generated visit IDs, used to skip duplicates when a batch is retried
+CREATE TABLE netlog.visit_client_id
+(
+    client_id  VARCHAR PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE netlog.visit_client_id OWNER TO postgres;
@@ -0,0 +1,17 @@
+-- netlog backup runs history, reported by the netlog backup over the unix socket
+CREATE TABLE netlog.backup_run
+(
+    run_id           VARCHAR PRIMARY KEY,
+    target           VARCHAR,
+    status           VARCHAR     NOT NULL,
+    started_at       TIMESTAMPTZ NOT NULL,
+    updated_at       TIMESTAMPTZ NOT NULL,
+    visits_count     INTEGER     NOT NULL DEFAULT 0,
+    chunks_done      INTEGER     NOT NULL DEFAULT 0,
+    chunks_total     INTEGER     NOT NULL DEFAULT 0,
+    duration_seconds DOUBLE PRECISION,
+    error            TEXT
+);
+
+ALTER TABLE netlog.backup_run OWNER TO postgres;
+CREATE INDEX ix_backup_run_started_at ON netlog.backup_run USING btree (started_at);
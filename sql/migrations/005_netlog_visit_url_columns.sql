@@ -0,0 +1,11 @@
+-- netlog visit host, registered domain and canonical url, derived from the url when the visit is stored
+-- (for databases created before the columns were added to db_schema.sql)
+-- the existing visits are filled in with cmd/netlog_backfill_urls afterwards
+ALTER TABLE netlog.visit
+    ADD COLUMN host              VARCHAR,
+    ADD COLUMN registered_domain VARCHAR,
+    ADD COLUMN canonical_url     VARCHAR;
+
+CREATE INDEX ix_visit_host ON netlog.visit (host);
+CREATE INDEX ix_visit_registered_domain ON netlog.visit (registered_domain);
+CREATE INDEX ix_visit_canonical_url ON netlog.visit (canonical_url);
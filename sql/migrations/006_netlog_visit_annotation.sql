@@ -0,0 +1,17 @@
+-- netlog visits stars, tags, notes and the read later queue
+-- (for databases created before the table was added to db_schema.sql)
+CREATE TABLE netlog.visit_annotation
+(
+    visit_id       INTEGER PRIMARY KEY REFERENCES netlog.visit (id) ON DELETE CASCADE,
+    starred        BOOLEAN     NOT NULL DEFAULT false,
+    tags           TEXT[]      NOT NULL DEFAULT '{}',
+    note           TEXT        NOT NULL DEFAULT '',
+    read_later_at  TIMESTAMPTZ,
+    read_later_url VARCHAR,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE netlog.visit_annotation OWNER TO postgres;
+CREATE INDEX ix_visit_annotation_tags ON netlog.visit_annotation USING gin (tags);
+CREATE INDEX ix_visit_annotation_updated_at ON netlog.visit_annotation USING btree (updated_at);
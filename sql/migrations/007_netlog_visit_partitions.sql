@@ -0,0 +1,71 @@
+-- netlog.visit partitioned by month on the visit timestamp, so the old months can be archived and the
+-- vacuum works on the recent partitions only, see netlog.EnsureVisitPartitions and cmd/netlog_partitions
+-- (for databases created before the partitioning was added to db_schema.sql)
+-- the visits are copied to the new table, and the visit table is locked meanwhile, so stop the service first
+BEGIN;
+
+-- the partitioned table has no unique visit id (the partition key has to be in the primary key), so the
+-- annotations are deleted with their visits by netlog.Repo.DeleteVisits instead, and kept for the archived ones
+ALTER TABLE netlog.visit_annotation DROP CONSTRAINT IF EXISTS visit_annotation_visit_id_fkey;
+
+ALTER TABLE netlog.visit RENAME TO visit_unpartitioned;
+ALTER TABLE netlog.visit_unpartitioned RENAME CONSTRAINT visit_pkey TO visit_unpartitioned_pkey;
+-- recreated on the partitioned table, after the visits are copied
+DROP INDEX netlog.ix_visit_created_at, netlog.ix_visit_timestamp_id, netlog.ix_visit_url,
+    netlog.ix_visit_search_vector, netlog.ix_visit_host, netlog.ix_visit_registered_domain,
+    netlog.ix_visit_canonical_url;
+
+CREATE TABLE netlog.visit
+(
+    id        INTEGER     NOT NULL DEFAULT nextval('netlog.visit_id_seq'),
+    title     VARCHAR,
+    source    VARCHAR,
+    device    VARCHAR,
+    url       VARCHAR     NOT NULL,
+    timestamp TIMESTAMPTZ NOT NULL,
+    host              VARCHAR,
+    registered_domain VARCHAR,
+    canonical_url     VARCHAR,
+    search_vector TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', COALESCE(title, '')), 'A') ||
+        setweight(to_tsvector('simple', COALESCE(substring(url from '^[a-zA-Z][a-zA-Z0-9+.-]*://([^/?#:@]+)'), '')), 'B') ||
+        setweight(to_tsvector('simple', regexp_replace(url, '[^a-zA-Z0-9]+', ' ', 'g')), 'C')
+    ) STORED,
+    PRIMARY KEY (id, timestamp)
+) PARTITION BY RANGE (timestamp);
+
+ALTER SEQUENCE netlog.visit_id_seq OWNED BY netlog.visit.id;
+
+-- one partition per month (UTC), from the first visit to 3 months ahead, named as netlog.visitPartitionName
+DO $$
+DECLARE
+    month TIMESTAMP := date_trunc('month', COALESCE((SELECT MIN(timestamp) FROM netlog.visit_unpartitioned), now()) AT TIME ZONE 'UTC');
+BEGIN
+    WHILE month <= date_trunc('month', now() AT TIME ZONE 'UTC') + INTERVAL '3 months' LOOP
+        EXECUTE format(
+            'CREATE TABLE netlog.%I PARTITION OF netlog.visit FOR VALUES FROM (%L) TO (%L)',
+            'visit_p' || to_char(month, 'YYYY_MM'), month::text || '+00', (month + INTERVAL '1 month')::text || '+00'
+        );
+        month := month + INTERVAL '1 month';
+    END LOOP;
+END $$;
+
+-- for the visits with no monthly partition yet, moved to their partitions by the partitions maintenance
+CREATE TABLE netlog.visit_default PARTITION OF netlog.visit DEFAULT;
+
+INSERT INTO netlog.visit (id, title, source, device, url, timestamp, host, registered_domain, canonical_url)
+SELECT id, title, source, device, url, timestamp, host, registered_domain, canonical_url
+FROM netlog.visit_unpartitioned;
+
+DROP TABLE netlog.visit_unpartitioned;
+
+ALTER TABLE netlog.visit OWNER TO postgres;
+CREATE INDEX ix_visit_created_at ON netlog.visit USING btree (timestamp);
+CREATE INDEX ix_visit_timestamp_id ON netlog.visit USING btree (timestamp, id);
+CREATE INDEX ix_visit_url ON netlog.visit (url);
+CREATE INDEX ix_visit_search_vector ON netlog.visit USING gin (search_vector);
+CREATE INDEX ix_visit_host ON netlog.visit (host);
+CREATE INDEX ix_visit_registered_domain ON netlog.visit (registered_domain);
+CREATE INDEX ix_visit_canonical_url ON netlog.visit (canonical_url);
+
+COMMIT;
@@ -0,0 +1,27 @@
+-- netlog hosts categories and the focus reports
+-- (for databases created before the tables were added to db_schema.sql)
+CREATE TABLE netlog.category_rule
+(
+    id         SERIAL PRIMARY KEY,
+    pattern    VARCHAR     NOT NULL UNIQUE,
+    category   VARCHAR     NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE netlog.category_rule OWNER TO postgres;
+
+-- netlog daily and weekly time spent per category, see netlog.FocusReport
+CREATE TABLE netlog.focus_report
+(
+    period       VARCHAR          NOT NULL,
+    period_start TIMESTAMPTZ      NOT NULL,
+    period_end   TIMESTAMPTZ      NOT NULL,
+    visits       INTEGER          NOT NULL,
+    seconds      DOUBLE PRECISION NOT NULL,
+    -- [{"category": "work", "seconds": 3600, "visits": 42}, ...], the most time spent first
+    categories   JSONB            NOT NULL DEFAULT '[]',
+    updated_at   TIMESTAMPTZ      NOT NULL DEFAULT now(),
+    PRIMARY KEY (period, period_start)
+);
+
+ALTER TABLE netlog.focus_report OWNER TO postgres;
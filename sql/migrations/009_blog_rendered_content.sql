@@ -0,0 +1,13 @@
+-- blog posts content rendered to html, with the table of contents and the reading time
+-- (for databases created before the columns were added to db_schema.sql)
+-- the existing posts are rendered when they are read the first time, see blog.Repo.GetBlog
+ALTER TABLE public.blog
+    ADD COLUMN content_html   TEXT,
+    ADD COLUMN toc            JSONB,
+    ADD COLUMN reading_time   INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN render_version INTEGER NOT NULL DEFAULT 0;
+
+-- the reading time is shown in the posts lists, so it is estimated for all the posts already
+-- (words / 200, at least one minute, same as blog.ReadingTime)
+UPDATE public.blog
+SET reading_time = GREATEST(1, CEIL(COALESCE(array_length(regexp_split_to_array(trim(content), '\s+'), 1), 0) / 200.0));
@@ -0,0 +1,8 @@
+-- blog posts lifecycle: draft, scheduled, published or unlisted
+-- (for databases created before the columns were added to db_schema.sql)
+-- the existing posts are all published
+ALTER TABLE public.blog
+    ADD COLUMN status     VARCHAR NOT NULL DEFAULT 'published',
+    ADD COLUMN publish_at TIMESTAMPTZ;
+
+CREATE INDEX ix_blog_scheduled_publish_at ON public.blog (publish_at) WHERE status = 'scheduled';
@@ -0,0 +1,21 @@
+-- blog revisions history
+-- (for databases created before the table was added to db_schema.sql)
+CREATE TABLE public.blog_revision
+(
+    blog_id    INTEGER     NOT NULL REFERENCES public.blog (id) ON DELETE CASCADE,
+    -- from 1, within the blog
+    revision   INTEGER     NOT NULL,
+    title      VARCHAR     NOT NULL,
+    content    TEXT        NOT NULL,
+    author     VARCHAR     NOT NULL,
+    summary    VARCHAR     NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (blog_id, revision)
+);
+
+ALTER TABLE public.blog_revision OWNER TO postgres;
+
+-- the current versions of the existing posts are their first revisions, the older ones are gone
+INSERT INTO public.blog_revision (blog_id, revision, title, content, author, summary)
+SELECT id, 1, title, content, 'admin', 'revision history started'
+FROM public.blog;
@@ -0,0 +1,25 @@
+-- blog posts tags and series
+-- (for databases created before the tables were added to db_schema.sql)
+CREATE TABLE public.blog_series
+(
+    id    SERIAL PRIMARY KEY,
+    slug  VARCHAR NOT NULL UNIQUE,
+    title VARCHAR NOT NULL
+);
+
+ALTER TABLE public.blog_series OWNER TO postgres;
+
+ALTER TABLE public.blog
+    ADD COLUMN series_id   INTEGER REFERENCES public.blog_series (id) ON DELETE SET NULL,
+    ADD COLUMN series_part INTEGER,
+    ADD UNIQUE (series_id, series_part);
+
+CREATE TABLE public.blog_tag
+(
+    blog_id INTEGER NOT NULL REFERENCES public.blog (id) ON DELETE CASCADE,
+    tag     VARCHAR NOT NULL,
+    PRIMARY KEY (blog_id, tag)
+);
+
+ALTER TABLE public.blog_tag OWNER TO postgres;
+CREATE INDEX ix_blog_tag_tag ON public.blog_tag (tag);
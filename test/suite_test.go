@@ -228,6 +228,7 @@ func getTestConfig(redisPort, postgresPort string) *config.Config {
 		QuotesCsvPath:                     "../assets/quotes.csv",
 		NetlogUnixSocketAddrDir:           tempDir,
 		NetlogUnixSocketFileName:          "netlog-test.sock",
+		NetlogSessionIdleGapMinutes:       30,
 		RedisHost:                         "localhost",
 		RedisPort:                         redisPort,
 		PostgresPort:                      postgresPort,